@@ -0,0 +1,18 @@
+// openapi.go
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec describes every route registered by registerRoutes. The
+// contract test in openapi_test.go fails when the two drift apart.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// specOperations returns "METHOD path" for every operation in the spec.
+func specOperations(t *testing.T) map[string]bool {
+	t.Helper()
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+
+	ops := map[string]bool{}
+	for path, item := range spec.Paths {
+		for method := range item {
+			ops[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	return ops
+}
+
+// routeOperations returns "METHOD path" for every route the router serves.
+// OPTIONS is only registered for CORS preflight and is not documented.
+func routeOperations(t *testing.T) map[string]bool {
+	t.Helper()
+
+	router := mux.NewRouter()
+	registerRoutes(router, routeHandlers{})
+
+	ops := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouter prefixes and method-less routes such as /metrics
+			if route.GetHandler() == nil {
+				return nil
+			}
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			if method != http.MethodOptions {
+				ops[method+" "+path] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking routes: %v", err)
+	}
+	return ops
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	spec := specOperations(t)
+	var missing []string
+	for op := range routeOperations(t) {
+		if !spec[op] {
+			missing = append(missing, op)
+		}
+	}
+	sort.Strings(missing)
+	for _, op := range missing {
+		t.Errorf("route %s has no entry in api/openapi.json", op)
+	}
+}
+
+func TestEverySpecEntryIsRouted(t *testing.T) {
+	routes := routeOperations(t)
+	var stale []string
+	for op := range specOperations(t) {
+		if !routes[op] {
+			stale = append(stale, op)
+		}
+	}
+	sort.Strings(stale)
+	for _, op := range stale {
+		t.Errorf("api/openapi.json documents %s, which is not routed", op)
+	}
+}
@@ -2,9 +2,12 @@
 package api
 
 import (
+	"net/http"
+
 	"backend/internal/handlers"
 	"backend/internal/repository"
 	"backend/internal/service"
+	"backend/middleware"
 
 	"github.com/gorilla/mux"
 	"github.com/minio/minio-go/v7"
@@ -13,45 +16,208 @@ import (
 )
 
 func NewRouter(
-	mongoClient *mongo.Client,
+	db *mongo.Database,
 	fileService *service.FileService,
 	minioClient *minio.Client,
-	chunkRepo *repository.ChunkRepository,
-	fileRepo *repository.FileRepository,
+	presignClient *minio.Client,
 	userRepo *repository.UserRepository,
 	userService *service.UserService,
+	loginGuard *service.LoginGuard,
+	mfaService *service.MFAService,
+	emailService *service.AccountEmailService,
+	ssoService *service.SSOService,
+	jobQueue *service.JobQueue,
+	planService *service.PlanService,
+	uploadLimits service.UploadLimits,
+	fileStore *service.FileStore,
+	tusService *service.TusService,
+	archiveService *service.ArchiveService,
+	extractor *service.Extractor,
 	bucket string,
+	adminClientCert bool,
+	limiter *middleware.RateLimiter,
 ) *mux.Router {
 	router := mux.NewRouter()
 
-	minioRepo := repository.NewMinIOFileRepository(mongoClient)
-	minioFileHandler := handlers.NewMinIOFileHandler(minioRepo,userRepo, minioClient, bucket)
-	chunkHandler := handlers.NewChunkHandler(chunkRepo, fileRepo, minioRepo, minioClient, bucket)
-	userHandler := handlers.NewUserHandler(userService)
+	minioRepo := repository.NewMinIOFileRepository(db)
+	minioFileHandler := handlers.NewMinIOFileHandler(minioRepo,userRepo, minioClient, presignClient, bucket, jobQueue, planService, uploadLimits, extractor)
+	chunkHandler := handlers.NewChunkHandler(fileStore, userRepo.FindByObjectID, minioRepo, presignClient, bucket)
+	userHandler := handlers.NewUserHandler(userService, planService, mfaService, emailService, ssoService)
+	accountEmailHandler := handlers.NewAccountEmailHandler(emailService, userRepo.FindByObjectID)
+	mfaHandler := handlers.NewMFAHandler(mfaService, userRepo.FindByObjectID)
+	jobHandler := handlers.NewJobHandler(jobQueue, userRepo.FindByObjectID)
+	planHandler := handlers.NewPlanHandler(planService)
+	accessKeyService := service.NewAccessKeyService(repository.NewAccessKeyRepository(db), userRepo)
+	accessKeyHandler := handlers.NewAccessKeyHandler(accessKeyService, userRepo.FindByObjectID)
+	tusHandler := handlers.NewTusHandler(tusService, userRepo.FindByObjectID)
+	archiveHandler := handlers.NewArchiveHandler(archiveService, userRepo.FindByObjectID)
+	storage := service.NewStorageService(minioClient, bucket)
+	shareLinkRepo := repository.NewShareLinkRepository(db)
+	shareService := service.NewShareService(shareLinkRepo, minioRepo, userRepo, planService, storage)
+	bulkHandler := handlers.NewBulkHandler(service.NewBulkService(minioRepo, userRepo, storage, shareService), userRepo.FindByObjectID)
+	shareHandler := handlers.NewShareHandler(shareService)
+	accountService := service.NewAccountService(userRepo, minioRepo, storage, shareLinkRepo, repository.NewAccessKeyRepository(db), repository.NewFolderRepository(db), repository.NewMultipartUploadRepository(db), emailService, mfaService)
+	accountHandler := handlers.NewAccountHandler(accountService, userRepo.FindByObjectID)
+	adminService := service.NewAdminService(userRepo, minioRepo, jobQueue, loginGuard, accountService)
+	adminHandler := handlers.NewAdminHandler(adminService)
 
 	//Test
-	testRepo := repository.NewTestRepository(mongoClient)
+	testRepo := repository.NewTestRepository(db)
 	testHandler := handlers.NewTestHandler(testRepo)
 
-	router.HandleFunc("/upload-chunk", chunkHandler.HandleChunkUpload).Methods("POST", "OPTIONS")
-	router.HandleFunc("/api/minio/files/init", minioFileHandler.InitializeMinIOUpload).Methods("POST")
-	router.HandleFunc("/files/minio/{fileId}", chunkHandler.GetFileFromMinIO).Methods("GET")
+	registerRoutes(router, routeHandlers{
+		minio:           minioFileHandler,
+		chunk:           chunkHandler,
+		user:            userHandler,
+		account:         accountHandler,
+		mfa:             mfaHandler,
+		accountEmail:    accountEmailHandler,
+		job:             jobHandler,
+		admin:           adminHandler,
+		plan:            planHandler,
+		accessKey:       accessKeyHandler,
+		tus:             tusHandler,
+		archive:         archiveHandler,
+		bulk:            bulkHandler,
+		share:           shareHandler,
+		test:            testHandler,
+		adminLookup:     userRepo.FindByObjectID,
+		adminClientCert: adminClientCert,
+		limiter:         limiter,
+	})
+
+	return router
+}
+
+// routeHandlers holds everything registerRoutes mounts. Keeping route
+// registration separate from construction lets the route table be inspected
+// without a database.
+type routeHandlers struct {
+	minio        *handlers.MinIOFileHandler
+	chunk        *handlers.ChunkHandler
+	user         *handlers.UserHandler
+	account      *handlers.AccountHandler
+	mfa          *handlers.MFAHandler
+	accountEmail *handlers.AccountEmailHandler
+	job          *handlers.JobHandler
+	admin        *handlers.AdminHandler
+	plan         *handlers.PlanHandler
+	accessKey    *handlers.AccessKeyHandler
+	tus          *handlers.TusHandler
+	archive      *handlers.ArchiveHandler
+	bulk         *handlers.BulkHandler
+	share        *handlers.ShareHandler
+	test         *handlers.TestHandler
+	adminLookup  middleware.UserLookup
+	// adminClientCert makes admin routes require a verified TLS client
+	// certificate on top of the admin token
+	adminClientCert bool
+	// limiter throttles sign-in, registration and URL minting; nil disables
+	// it
+	limiter *middleware.RateLimiter
+}
+
+func registerRoutes(router *mux.Router, h routeHandlers) {
+	router.Handle("/upload-chunk", middleware.RequireAuth(http.HandlerFunc(h.chunk.HandleChunkUpload))).Methods("POST", "OPTIONS")
+	router.Handle("/api/minio/files/init", middleware.RequireAuth(h.limiter.Limit("upload_init", http.HandlerFunc(h.minio.InitializeMinIOUpload)))).Methods("POST")
+	router.Handle("/files/minio/{fileId}", middleware.RequireAuth(h.limiter.Limit("presign", http.HandlerFunc(h.chunk.GetFileFromMinIO)))).Methods("GET")
 
-  router.HandleFunc("/api/minio/files/delete", minioFileHandler.DeleteFileFromMinIO).Methods("DELETE", "OPTIONS")
+  router.Handle("/api/minio/files/delete", middleware.RequireAuth(http.HandlerFunc(h.minio.DeleteFileFromMinIO))).Methods("DELETE", "OPTIONS")
 	
-	router.HandleFunc("/api/auth/register", userHandler.Register).Methods("POST", "OPTIONS")
-	router.HandleFunc("/api/auth/login", userHandler.Login).Methods("POST", "OPTIONS")
+	router.Handle("/api/auth/register", h.limiter.Limit("register", http.HandlerFunc(h.user.Register))).Methods("POST", "OPTIONS")
+	router.Handle("/api/auth/login", h.limiter.Limit("login", http.HandlerFunc(h.user.Login))).Methods("POST", "OPTIONS")
+	router.Handle("/api/auth/login/mfa", h.limiter.Limit("login", http.HandlerFunc(h.user.LoginMFA))).Methods("POST")
+
+	// Single sign-on with OpenID Connect; answers 404 unless configured
+	router.Handle("/api/auth/oidc/login", h.limiter.Limit("login", http.HandlerFunc(h.user.OIDCLogin))).Methods("GET")
+	router.Handle("/api/auth/oidc/callback", h.limiter.Limit("login", http.HandlerFunc(h.user.OIDCCallback))).Methods("GET")
+	router.Handle("/api/auth/oidc/token", h.limiter.Limit("login", http.HandlerFunc(h.user.OIDCToken))).Methods("POST")
+
+	// Email verification and password reset
+	router.Handle("/api/auth/verify-email/resend", middleware.RequireAuth(h.limiter.Limit("email", http.HandlerFunc(h.accountEmail.ResendVerification)))).Methods("POST")
+	router.HandleFunc("/api/auth/verify-email", h.accountEmail.VerifyEmail).Methods("POST")
+	router.Handle("/api/auth/password-reset/request", h.limiter.Limit("email", http.HandlerFunc(h.accountEmail.RequestPasswordReset))).Methods("POST")
+	router.HandleFunc("/api/auth/password-reset", h.accountEmail.ResetPassword).Methods("POST")
+
+	// The signed-in user's own account; confirming an email change takes
+	// the emailed token instead
+	router.Handle("/api/account", middleware.RequireAuth(http.HandlerFunc(h.account.GetAccount))).Methods("GET")
+	router.Handle("/api/account", middleware.RequireAuth(http.HandlerFunc(h.account.UpdateAccount))).Methods("PATCH")
+	router.Handle("/api/account", middleware.RequireAuth(h.limiter.Limit("login", http.HandlerFunc(h.account.DeleteAccount)))).Methods("DELETE")
+	router.Handle("/api/account/password", middleware.RequireAuth(h.limiter.Limit("login", http.HandlerFunc(h.account.ChangePassword)))).Methods("POST")
+	router.Handle("/api/account/email", middleware.RequireAuth(h.limiter.Limit("email", http.HandlerFunc(h.account.ChangeEmail)))).Methods("POST")
+	router.HandleFunc("/api/account/email/confirm", h.accountEmail.ConfirmEmailChange).Methods("POST")
+
+	// Two-factor authentication
+	router.Handle("/api/auth/mfa", middleware.RequireAuth(http.HandlerFunc(h.mfa.GetStatus))).Methods("GET")
+	router.Handle("/api/auth/mfa/totp", middleware.RequireAuth(http.HandlerFunc(h.mfa.Enroll))).Methods("POST")
+	router.Handle("/api/auth/mfa/totp/activate", middleware.RequireAuth(http.HandlerFunc(h.mfa.Activate))).Methods("POST")
+	router.Handle("/api/auth/mfa/totp/disable", middleware.RequireAuth(http.HandlerFunc(h.mfa.Disable))).Methods("POST")
+	router.Handle("/api/auth/mfa/recovery-codes", middleware.RequireAuth(http.HandlerFunc(h.mfa.RegenerateRecoveryCodes))).Methods("POST")
 	
-	router.HandleFunc("/api/minio/files/{fileId}/complete", minioFileHandler.CompleteMinIOUpload).Methods("POST")
+	router.Handle("/api/minio/files/{fileId}/complete", middleware.RequireAuth(h.limiter.Limit("upload_init", http.HandlerFunc(h.minio.CompleteMinIOUpload)))).Methods("POST")
+	router.Handle("/api/minio/files", middleware.RequireAuth(http.HandlerFunc(h.minio.ListFiles))).Methods("GET")
+	router.Handle("/api/minio/files/{fileId}/status", middleware.RequireAuth(h.limiter.Limit("presign", http.HandlerFunc(h.minio.GetUploadStatus)))).Methods("GET")
+	router.Handle("/api/minio/files/{fileId}/extract", middleware.RequireAuth(http.HandlerFunc(h.minio.ExtractArchive))).Methods("POST")
+	router.Handle("/api/minio/archive", middleware.RequireAuth(http.HandlerFunc(h.archive.DownloadArchive))).Methods("POST")
+	router.Handle("/api/minio/files/bulk/delete", middleware.RequireAuth(http.HandlerFunc(h.bulk.BulkDelete))).Methods("POST")
+	router.Handle("/api/minio/files/bulk/move", middleware.RequireAuth(http.HandlerFunc(h.bulk.BulkMove))).Methods("POST")
+	router.Handle("/api/minio/files/bulk/tags", middleware.RequireAuth(http.HandlerFunc(h.bulk.BulkTag))).Methods("POST")
+	router.Handle("/api/minio/files/bulk/share", middleware.RequireAuth(http.HandlerFunc(h.bulk.BulkShare))).Methods("POST")
+	router.Handle("/api/jobs/{jobId}", middleware.RequireAuth(http.HandlerFunc(h.job.GetOwnJob))).Methods("GET")
+
+	router.HandleFunc("/api/plans", h.plan.ListPlans).Methods("GET")
+
+	// Public share links; the token is the credential
+	router.HandleFunc("/s/{token}", h.share.DownloadShared).Methods("GET", "HEAD")
+
+	// Resumable uploads (tus 1.0); OPTIONS is protocol discovery
+	router.HandleFunc("/api/tus", h.tus.Options).Methods("OPTIONS")
+	router.Handle("/api/tus", middleware.RequireAuth(http.HandlerFunc(h.tus.CreateUpload))).Methods("POST")
+	router.HandleFunc("/api/tus/{uploadId}", h.tus.Options).Methods("OPTIONS")
+	router.Handle("/api/tus/{uploadId}", middleware.RequireAuth(http.HandlerFunc(h.tus.GetUploadOffset))).Methods("HEAD")
+	router.Handle("/api/tus/{uploadId}", middleware.RequireAuth(http.HandlerFunc(h.tus.PatchUpload))).Methods("PATCH")
+	router.Handle("/api/tus/{uploadId}", middleware.RequireAuth(http.HandlerFunc(h.tus.TerminateUpload))).Methods("DELETE")
+
+	// S3 gateway credentials
+	router.Handle("/api/access-keys", middleware.RequireAuth(http.HandlerFunc(h.accessKey.ListAccessKeys))).Methods("GET")
+	router.Handle("/api/access-keys", middleware.RequireAuth(http.HandlerFunc(h.accessKey.CreateAccessKey))).Methods("POST")
+	router.Handle("/api/access-keys/{accessKeyId}", middleware.RequireAuth(http.HandlerFunc(h.accessKey.DeleteAccessKey))).Methods("DELETE")
 
-	router.HandleFunc("/get/user/storageHealth", minioFileHandler.GetUserStorageHealth).Methods("GET")
+	router.Handle("/get/user/storageHealth", middleware.RequireAuth(http.HandlerFunc(h.minio.GetUserStorageHealth))).Methods("GET")
+
+	// Admin routes
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	if h.adminClientCert {
+		admin.Use(middleware.RequireClientCert)
+	}
+	admin.Use(middleware.RequireAuth, middleware.RequireAdmin(h.adminLookup))
+	admin.HandleFunc("/stats", h.admin.GetSystemStats).Methods("GET")
+	admin.HandleFunc("/users", h.admin.ListUsers).Methods("GET")
+	admin.HandleFunc("/users/{userId}", h.admin.GetUser).Methods("GET")
+	admin.HandleFunc("/users/{userId}", h.admin.DeleteUser).Methods("DELETE")
+	admin.HandleFunc("/users/{userId}/files", h.admin.ListUserFiles).Methods("GET")
+	admin.HandleFunc("/users/{userId}/storage-limit", h.admin.UpdateStorageLimit).Methods("PUT")
+	admin.HandleFunc("/users/{userId}/plan", h.plan.AssignUserPlan).Methods("PUT")
+	admin.HandleFunc("/users/{userId}/unlock", h.admin.UnlockUser).Methods("POST")
+	admin.HandleFunc("/users/{userId}/disable", h.admin.DisableUser).Methods("POST")
+	admin.HandleFunc("/users/{userId}/enable", h.admin.EnableUser).Methods("POST")
+	admin.HandleFunc("/users/{userId}/mfa", h.admin.ResetMFA).Methods("DELETE")
+	admin.HandleFunc("/login-attempts", h.admin.ListLoginAttempts).Methods("GET")
+	admin.HandleFunc("/plans", h.plan.CreatePlan).Methods("POST")
+	admin.HandleFunc("/plans/{plan}", h.plan.UpdatePlan).Methods("PUT")
+	admin.HandleFunc("/jobs", h.job.ListJobs).Methods("GET")
+	admin.HandleFunc("/jobs", h.job.EnqueueJob).Methods("POST")
+	admin.HandleFunc("/jobs/{jobId}", h.job.GetJob).Methods("GET")
+	admin.HandleFunc("/jobs/{jobId}/retry", h.job.RetryJob).Methods("POST")
+
+	// API description
+	router.HandleFunc("/openapi.json", serveOpenAPI).Methods("GET")
 
 	// Add Prometheus metrics endpoint
 	router.Handle("/metrics", promhttp.Handler())
 
 	// Routes for testing
-	router.HandleFunc("/test/post", testHandler.InsertTestData).Methods("POST")
-	router.HandleFunc("/test/last", testHandler.GetLastTestData).Methods("GET")
-
-	return router
+	router.HandleFunc("/test/post", h.test.InsertTestData).Methods("POST")
+	router.HandleFunc("/test/last", h.test.GetLastTestData).Methods("GET")
 }
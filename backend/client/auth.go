@@ -0,0 +1,120 @@
+// client/auth.go
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "backend/utils/crypto"
+)
+
+// User is the account returned by Login.
+type User struct {
+    UserID       string    `json:"userID"`
+    Username     string    `json:"username"`
+    Email        string    `json:"email"`
+    Role         string    `json:"role"`
+    Plan         string    `json:"plan"`
+    StorageUsed  float64   `json:"storageUsed"`
+    StorageLimit float64   `json:"storageLimit"`
+    CreatedAt    time.Time `json:"createdAt"`
+}
+
+type envelope struct {
+    Data string `json:"data"`
+}
+
+func (c *Client) seal(v interface{}) (*envelope, error) {
+    if c.encryptionKey == "" {
+        return nil, errors.New("storely: an encryption key is required for auth requests")
+    }
+    payload, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    data, err := crypto.EncryptWithKey(payload, c.encryptionKey)
+    if err != nil {
+        return nil, err
+    }
+    return &envelope{Data: data}, nil
+}
+
+// Register creates an account.
+func (c *Client) Register(ctx context.Context, username, email, password string) error {
+    in, err := c.seal(map[string]string{
+        "username": username,
+        "email":    email,
+        "password": password,
+    })
+    if err != nil {
+        return err
+    }
+    return c.do(ctx, http.MethodPost, "/api/auth/register", nil, in, nil)
+}
+
+// MFARequiredError is returned by Login for accounts with two-factor
+// authentication. Pass Token and a code to CompleteLogin.
+type MFARequiredError struct {
+    Token string
+}
+
+func (e *MFARequiredError) Error() string {
+    return "storely: two-factor authentication required"
+}
+
+// Login authenticates and keeps the returned token for later calls. For
+// accounts with two-factor authentication it returns *MFARequiredError.
+func (c *Client) Login(ctx context.Context, email, password string) (*User, error) {
+    in, err := c.seal(map[string]string{
+        "email":    email,
+        "password": password,
+    })
+    if err != nil {
+        return nil, err
+    }
+    return c.login(ctx, "/api/auth/login", in)
+}
+
+// CompleteLogin finishes a two-factor login with a TOTP or recovery code.
+func (c *Client) CompleteLogin(ctx context.Context, mfaToken, code string) (*User, error) {
+    in, err := c.seal(map[string]string{
+        "mfaToken": mfaToken,
+        "code":     code,
+    })
+    if err != nil {
+        return nil, err
+    }
+    return c.login(ctx, "/api/auth/login/mfa", in)
+}
+
+func (c *Client) login(ctx context.Context, path string, in *envelope) (*User, error) {
+    var out envelope
+    if err := c.do(ctx, http.MethodPost, path, nil, in, &out); err != nil {
+        return nil, err
+    }
+    payload, err := crypto.DecryptWithKey(out.Data, c.encryptionKey)
+    if err != nil {
+        return nil, fmt.Errorf("storely: failed to open login response (wrong encryption key?): %w", err)
+    }
+
+    var result struct {
+        Token       string `json:"token"`
+        User        User   `json:"user"`
+        MFARequired bool   `json:"mfaRequired"`
+        MFAToken    string `json:"mfaToken"`
+    }
+    if err := json.Unmarshal(payload, &result); err != nil {
+        return nil, fmt.Errorf("storely: failed to decode login response: %w", err)
+    }
+    if result.MFARequired {
+        return nil, &MFARequiredError{Token: result.MFAToken}
+    }
+
+    c.token = result.Token
+    c.userID = result.User.UserID
+    return &result.User, nil
+}
@@ -0,0 +1,155 @@
+// client/client.go
+
+// Package client is a typed Go client for the Storely HTTP API described in
+// api/openapi.json. It wraps authentication (including the request
+// envelope), chunked uploads straight to MinIO, downloads and deletes.
+package client
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// Client talks to one Storely server. It is safe for concurrent use once
+// logged in.
+type Client struct {
+    baseURL       string
+    encryptionKey string
+    httpClient    *http.Client
+
+    token  string
+    userID string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client (30s timeout on API calls;
+// chunk transfers use the request context only).
+func WithHTTPClient(httpClient *http.Client) Option {
+    return func(c *Client) {
+        c.httpClient = httpClient
+    }
+}
+
+// WithToken restores a session saved from an earlier Login.
+func WithToken(token, userID string) Option {
+    return func(c *Client) {
+        c.token = token
+        c.userID = userID
+    }
+}
+
+// New creates a client for the server at baseURL. encryptionKey must match
+// the server's ENCRYPTION_KEY; it is only needed for Register and Login.
+func New(baseURL string, encryptionKey string, opts ...Option) *Client {
+    c := &Client{
+        baseURL:       strings.TrimRight(baseURL, "/"),
+        encryptionKey: encryptionKey,
+        httpClient:    &http.Client{Timeout: 30 * time.Second},
+    }
+    for _, opt := range opts {
+        opt(c)
+    }
+    return c
+}
+
+// Token returns the bearer token of the current session.
+func (c *Client) Token() string {
+    return c.token
+}
+
+// UserID returns the userID of the logged-in account.
+func (c *Client) UserID() string {
+    return c.userID
+}
+
+// APIError is an error response from the server.
+type APIError struct {
+    StatusCode int                    `json:"-"`
+    Message    string                 `json:"error"`
+    Code       string                 `json:"code"`
+    RequestID  string                 `json:"requestId"`
+    Details    map[string]interface{} `json:"details"`
+}
+
+func (e *APIError) Error() string {
+    msg := fmt.Sprintf("storely: %s (%d %s)", e.Message, e.StatusCode, e.Code)
+    if e.RequestID != "" {
+        msg += " request " + e.RequestID
+    }
+    return msg
+}
+
+// IsCode reports whether err is an APIError with the given code.
+func IsCode(err error, code string) bool {
+    var apiErr *APIError
+    return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// do sends a JSON request to path and decodes a JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+    var body io.Reader
+    if in != nil {
+        payload, err := json.Marshal(in)
+        if err != nil {
+            return fmt.Errorf("failed to encode request: %w", err)
+        }
+        body = bytes.NewReader(payload)
+    }
+
+    endpoint := c.baseURL + path
+    if len(query) > 0 {
+        endpoint += "?" + query.Encode()
+    }
+    req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+    if err != nil {
+        return err
+    }
+    if in != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    if c.token != "" {
+        req.Header.Set("Authorization", "Bearer "+c.token)
+    }
+
+    resp, err := c.httpClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 400 {
+        return decodeError(resp)
+    }
+    if out == nil {
+        return nil
+    }
+    if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+        return fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+    }
+    return nil
+}
+
+func decodeError(resp *http.Response) error {
+    apiErr := &APIError{StatusCode: resp.StatusCode}
+    raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+    if err := json.Unmarshal(raw, apiErr); err != nil || apiErr.Message == "" {
+        apiErr.Message = strings.TrimSpace(string(raw))
+        if apiErr.Message == "" {
+            apiErr.Message = http.StatusText(resp.StatusCode)
+        }
+    }
+    if apiErr.RequestID == "" {
+        apiErr.RequestID = resp.Header.Get("X-Request-ID")
+    }
+    return apiErr
+}
@@ -0,0 +1,372 @@
+// Command migrate-chunks moves files uploaded through the old /upload-chunk
+// path, whose content lives in the MongoDB "chunks" collection with metadata
+// in "file_metadata", into the regular file model ("minio_files" plus chunk
+// objects in the bucket).
+//
+//	migrate-chunks -owner admin@example.com [-folder migrated] [-dry-run] [-delete]
+//
+// The old path didn't record who uploaded a file, so every migrated file is
+// given to the -owner account and counts against its quota and plan. Files
+// keep their IDs. Sizes come from the stored chunk data, since the recorded
+// sizes were estimates.
+//
+// Each file is verified after it is written: the content read back from the
+// bucket must have the size and SHA-256 of the MongoDB chunks. Only verified
+// files are removed from MongoDB, and only with -delete. Files already
+// migrated by an earlier run are verified again rather than rewritten, so
+// the command can be re-run after a failure.
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "os/signal"
+    "sort"
+    "syscall"
+
+    "backend/config"
+    "backend/internal/models"
+    "backend/internal/repository"
+    "backend/internal/service"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type migrator struct {
+    chunks    *repository.ChunkRepository
+    files     *repository.FileRepository
+    minioRepo *repository.MinIOFileRepository
+    store     *service.FileStore
+    owner     *models.User
+    folder    string
+    dryRun    bool
+    deleteOld bool
+}
+
+// legacyFile is what the old collections hold about one file.
+type legacyFile struct {
+    id       string
+    meta     *models.FileMetadata
+    infos    []repository.ChunkInfo
+    fileName string
+    fileType string
+    size     int64
+}
+
+func main() {
+    ownerEmail := flag.String("owner", "", "email of the account that receives the migrated files (required)")
+    folder := flag.String("folder", "", "folder to put the migrated files in")
+    dryRun := flag.Bool("dry-run", false, "only report what would be migrated")
+    deleteOld := flag.Bool("delete", false, "remove the MongoDB chunks and metadata of verified files")
+    cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+    if err != nil {
+        log.Fatal(err)
+    }
+    if *ownerEmail == "" {
+        fmt.Fprintln(os.Stderr, "migrate-chunks: -owner is required")
+        flag.Usage()
+        os.Exit(2)
+    }
+    if _, ok := service.CleanFolder(*folder); !ok {
+        log.Fatalf("Invalid folder %q", *folder)
+    }
+
+    client, err := config.ConnectDB(cfg.Mongo)
+    if err != nil {
+        log.Fatalf("Failed to connect to MongoDB: %v", err)
+    }
+    defer client.Disconnect(context.Background())
+    db := client.Database(cfg.Mongo.Database)
+    minioClient, err := config.ConnectMinIO(cfg.MinIO)
+    if err != nil {
+        log.Fatalf("Failed to connect to MinIO: %v", err)
+    }
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    userRepo := repository.NewUserRepository(db)
+    minioRepo := repository.NewMinIOFileRepository(db)
+    owner, err := userRepo.FindByEmail(ctx, *ownerEmail)
+    if err != nil {
+        log.Fatalf("Failed to find owner %s: %v", *ownerEmail, err)
+    }
+
+    planService := service.NewPlanService(repository.NewPlanRepository(db), userRepo, minioRepo, cfg.Accounts.DefaultPlan)
+
+    // Same limits as the server; post-upload jobs are only queued here and
+    // run by the server's workers
+    limits := service.UploadLimits{
+        MaxFileSize:  cfg.Uploads.MaxFileSize,
+        MaxChunks:    cfg.Uploads.MaxChunks,
+        MinChunkSize: cfg.Uploads.MinChunkSize,
+        MaxChunkSize: cfg.Uploads.MaxChunkSize,
+    }
+    jobQueue := service.NewJobQueue(repository.NewJobRepository(db), service.DefaultJobQueueOptions())
+    storage := service.NewStorageService(minioClient, cfg.MinIO.Bucket)
+
+    m := &migrator{
+        chunks:    repository.NewChunkRepository(db),
+        files:     repository.NewFileRepository(db),
+        minioRepo: minioRepo,
+        store:     service.NewFileStore(minioRepo, userRepo, planService, storage, jobQueue, limits),
+        owner:     owner,
+        folder:    *folder,
+        dryRun:    *dryRun,
+        deleteOld: *deleteOld,
+    }
+    failed, err := m.run(ctx)
+    if err != nil {
+        log.Fatal(err)
+    }
+    if failed > 0 {
+        os.Exit(1)
+    }
+}
+
+// run migrates every legacy file and returns how many failed.
+func (m *migrator) run(ctx context.Context) (int, error) {
+    files, err := m.load(ctx)
+    if err != nil {
+        return 0, err
+    }
+
+    var migrated, verified, skipped, failed int
+    for _, f := range files {
+        if ctx.Err() != nil {
+            return failed, ctx.Err()
+        }
+        outcome, err := m.migrate(ctx, f)
+        switch {
+        case err != nil:
+            failed++
+            log.Printf("FAIL %s (%s): %v", f.id, f.fileName, err)
+        case outcome == "":
+            skipped++
+        default:
+            log.Printf("%s %s (%s, %d bytes)", outcome, f.id, f.fileName, f.size)
+            if outcome == "migrated" {
+                migrated++
+            } else {
+                verified++
+            }
+        }
+    }
+    log.Printf("%d migrated, %d already migrated, %d skipped, %d failed", migrated, verified, skipped, failed)
+    return failed, nil
+}
+
+// load collects the files that have chunks or metadata, ordered by ID.
+func (m *migrator) load(ctx context.Context) ([]*legacyFile, error) {
+    byID := map[string]*legacyFile{}
+    metas, err := m.files.List(ctx)
+    if err != nil {
+        return nil, err
+    }
+    for i := range metas {
+        id := metas[i].ID.Hex()
+        byID[id] = &legacyFile{id: id, meta: &metas[i]}
+    }
+    ids, err := m.chunks.FileIDs(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list chunks: %w", err)
+    }
+    for _, id := range ids {
+        if byID[id] == nil {
+            byID[id] = &legacyFile{id: id}
+        }
+    }
+
+    files := make([]*legacyFile, 0, len(byID))
+    for _, f := range byID {
+        if f.infos, err = m.chunks.ChunkInfos(ctx, f.id); err != nil {
+            return nil, fmt.Errorf("failed to read chunks of %s: %w", f.id, err)
+        }
+        for _, info := range f.infos {
+            f.size += info.Size
+            f.fileName, f.fileType = info.FileName, info.FileType
+        }
+        if f.meta != nil {
+            f.fileName = firstNonEmpty(f.meta.FileName, f.fileName)
+            f.fileType = firstNonEmpty(f.meta.FileType, f.fileType)
+        }
+        f.fileType = firstNonEmpty(f.fileType, "application/octet-stream")
+        files = append(files, f)
+    }
+    sort.Slice(files, func(i, j int) bool { return files[i].id < files[j].id })
+    return files, nil
+}
+
+// migrate moves one file and reports "migrated" or "verified", or "" when
+// the file is skipped.
+func (m *migrator) migrate(ctx context.Context, f *legacyFile) (string, error) {
+    id, err := primitive.ObjectIDFromHex(f.id)
+    if err != nil {
+        log.Printf("SKIP %s: not an ObjectID", f.id)
+        return "", nil
+    }
+    if len(f.infos) == 0 {
+        log.Printf("SKIP %s (%s): metadata without chunks", f.id, f.fileName)
+        return "", nil
+    }
+    if missing := missingChunks(f.infos); len(missing) > 0 {
+        log.Printf("SKIP %s (%s): incomplete, missing chunks %v", f.id, f.fileName, missing)
+        return "", nil
+    }
+    for _, info := range f.infos {
+        if info.Copies > 1 {
+            log.Printf("NOTE %s: chunk %d was stored %d times; using the newest copy", f.id, info.Index, info.Copies)
+        }
+    }
+
+    existing, err := m.minioRepo.GetFileByID_MinIO(ctx, f.id)
+    if err != nil && !errors.Is(err, repository.ErrFileNotFound) {
+        return "", err
+    }
+    if existing != nil && !existing.Complete {
+        return "", fmt.Errorf("an incomplete file with this ID already exists")
+    }
+    if m.dryRun {
+        if existing != nil {
+            log.Printf("DRY-RUN %s (%s): already migrated, would verify", f.id, f.fileName)
+        } else {
+            log.Printf("DRY-RUN %s (%s): would migrate %d chunks, %d bytes", f.id, f.fileName, len(f.infos), f.size)
+        }
+        return "", nil
+    }
+
+    outcome := "verified"
+    source := sha256.New()
+    if existing == nil {
+        file, err := m.store.Put(ctx, m.owner, service.PutRequest{
+            ID:       id,
+            Folder:   m.folder,
+            FileName: f.fileName,
+            FileType: f.fileType,
+            Size:     f.size,
+            Body:     io.TeeReader(m.open(ctx, f), source),
+        })
+        if err != nil {
+            return "", err
+        }
+        existing, outcome = file, "migrated"
+    } else if _, err := io.Copy(source, m.open(ctx, f)); err != nil {
+        return "", err
+    }
+
+    if err := m.verify(ctx, existing, f.size, source.Sum(nil)); err != nil {
+        return "", err
+    }
+    if m.deleteOld {
+        if err := m.remove(ctx, f); err != nil {
+            return "", fmt.Errorf("verified, but failed to remove the MongoDB copy: %w", err)
+        }
+    }
+    return outcome, nil
+}
+
+// verify reads file back from the bucket and compares it with the source.
+func (m *migrator) verify(ctx context.Context, file *models.FileMinIO, size int64, sum []byte) error {
+    if int64(file.Size) != size {
+        return fmt.Errorf("verification failed: record has %d bytes, source has %d", int64(file.Size), size)
+    }
+    stored := m.store.Storage().OpenFile(ctx, file)
+    defer stored.Close()
+    h := sha256.New()
+    n, err := io.Copy(h, stored)
+    if err != nil {
+        return fmt.Errorf("verification failed: %w", err)
+    }
+    if n != size {
+        return fmt.Errorf("verification failed: bucket holds %d bytes, source has %d", n, size)
+    }
+    if got := h.Sum(nil); string(got) != string(sum) {
+        return fmt.Errorf("verification failed: SHA-256 %s, source %s", hex.EncodeToString(got), hex.EncodeToString(sum))
+    }
+    return nil
+}
+
+func (m *migrator) remove(ctx context.Context, f *legacyFile) error {
+    if _, err := m.chunks.DeleteFileChunks(ctx, f.id); err != nil {
+        return err
+    }
+    if f.meta != nil {
+        return m.files.Delete(ctx, f.id)
+    }
+    return nil
+}
+
+// open returns the content of f, fetching one chunk at a time.
+func (m *migrator) open(ctx context.Context, f *legacyFile) io.Reader {
+    return &legacyReader{ctx: ctx, chunks: m.chunks, file: f}
+}
+
+type legacyReader struct {
+    ctx     context.Context
+    chunks  *repository.ChunkRepository
+    file    *legacyFile
+    next    int
+    current []byte
+}
+
+func (r *legacyReader) Read(p []byte) (int, error) {
+    for len(r.current) == 0 {
+        if r.next >= len(r.file.infos) {
+            return 0, io.EOF
+        }
+        info := r.file.infos[r.next]
+        chunk, err := r.chunks.GetChunk(r.ctx, r.file.id, info.Index)
+        if err != nil {
+            return 0, fmt.Errorf("failed to read chunk %d: %w", info.Index, err)
+        }
+        if int64(len(chunk.Data)) != info.Size {
+            return 0, fmt.Errorf("chunk %d changed during migration", info.Index)
+        }
+        r.current = chunk.Data
+        r.next++
+    }
+    n := copy(p, r.current)
+    r.current = r.current[n:]
+    return n, nil
+}
+
+// missingChunks returns the chunk indexes below the declared total that have
+// no data. infos is ordered by index.
+func missingChunks(infos []repository.ChunkInfo) []int {
+    total := 0
+    for _, info := range infos {
+        if info.TotalChunks > total {
+            total = info.TotalChunks
+        }
+        if info.Index+1 > total {
+            total = info.Index + 1
+        }
+    }
+    present := map[int]bool{}
+    for _, info := range infos {
+        present[info.Index] = true
+    }
+    var missing []int
+    for i := 0; i < total; i++ {
+        if !present[i] {
+            missing = append(missing, i)
+        }
+    }
+    return missing
+}
+
+func firstNonEmpty(values ...string) string {
+    for _, v := range values {
+        if v != "" {
+            return v
+        }
+    }
+    return ""
+}
@@ -2,18 +2,30 @@ package main
 
 import (
     "context"
+    "crypto/tls"
+    "crypto/x509"
+    "flag"
+    "fmt"
     "log"
+    "net"
     "net/http"
     "os"
     "os/signal"
+    "strconv"
+    "strings"
     "syscall"
     "time"
 
     "backend/config"
+    "backend/internal/dav"
+    "backend/internal/mailer"
+    "backend/internal/oidc"
     "backend/internal/repository"
+    "backend/internal/s3api"
     "backend/internal/service"
     "backend/api"
     "backend/middleware"
+    "backend/utils"
     "backend/utils/crypto"
     "backend/utils/logger"
     "go.mongodb.org/mongo-driver/mongo"
@@ -23,63 +35,291 @@ import (
 
 
 func main() {
-    // Load environment variables
-    config.LoadEnv()
+    printConfig := flag.Bool("print-config", false, "print the configuration with secrets redacted and exit")
+    cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+    if err != nil {
+        log.Fatal(err)
+    }
+    if *printConfig {
+        fmt.Print(cfg)
+        return
+    }
 
-    encryptionKey := os.Getenv("ENCRYPTION_KEY")
-    if err := crypto.InitCrypto(encryptionKey); err != nil {
+    if err := crypto.InitCrypto(cfg.Security.EncryptionKey.Value()); err != nil {
         log.Fatalf("Failed to initialize crypto: %v", err)
     }
+    if err := utils.InitJWT(cfg.Security.JWTSecret.Value(), cfg.Security.JWTExpiry); err != nil {
+        log.Fatalf("Failed to initialize JWT: %v", err)
+    }
 
     // Initialize MongoDB client
-    client, err := config.ConnectDB()
+    client, err := config.ConnectDB(cfg.Mongo)
     if err != nil {
         log.Fatalf("Failed to connect to MongoDB: %v", err)
     }
+    db := client.Database(cfg.Mongo.Database)
     
     // Initialize MinIO client (kept for future use)
-    minioClient, err := config.ConnectMinIO()
+    minioClient, err := config.ConnectMinIO(cfg.MinIO)
     if err != nil {
         log.Fatalf("Failed to connect to MinIO: %v", err)
     }
     
+    // Presigned URLs are signed for the address clients reach MinIO at
+    presignClient, err := config.PresignClient(cfg.MinIO, minioClient)
+    if err != nil {
+        log.Fatalf("Failed to create MinIO presign client: %v", err)
+    }
+
+    // Forwarded headers are only believed from these peers
+    trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+    if err != nil {
+        log.Fatal(err)
+    }
+    
     defer func() {
         if err := disconnectMongo(client); err != nil {
             log.Printf("Error disconnecting MongoDB: %v", err)
         }
     }()
 
-    fileRepo := repository.NewFileRepository(client)
-    chunkRepo := repository.NewChunkRepository(client)
-    userRepo := repository.NewUserRepository(client)
-    logRepo := repository.NewLogRepository(client)
+    fileRepo := repository.NewFileRepository(db)
+    userRepo := repository.NewUserRepository(db)
+    logRepo := repository.NewLogRepository(db)
+    jobRepo := repository.NewJobRepository(db)
+    minioRepo := repository.NewMinIOFileRepository(db)
+    planRepo := repository.NewPlanRepository(db)
 
     
     // Initialize services
     fileService := service.NewFileService(fileRepo)
-    userService := service.NewUserService(userRepo)
+    // Brute-force protection for sign-in; CAPTCHAs are optional
+    var captcha service.CaptchaVerifier
+    if cfg.Login.CaptchaVerifyURL != "" {
+        captcha = service.NewSiteVerifyCaptcha(cfg.Login.CaptchaVerifyURL, cfg.Login.CaptchaSiteKey, cfg.Login.CaptchaSecret.Value())
+    }
+    loginGuard := service.NewLoginGuard(repository.NewLoginFailureRepository(db), repository.NewLoginAttemptRepository(db), captcha, service.LoginPolicy{
+        FreeAttempts:   cfg.Login.FreeAttempts,
+        IPFreeAttempts: cfg.Login.IPFreeAttempts,
+        BaseDelay:      cfg.Login.BaseDelay,
+        MaxDelay:       cfg.Login.MaxDelay,
+        Window:         cfg.Login.FailureWindow,
+        CaptchaAfter:   cfg.Login.CaptchaAfter,
+        AuditRetention: cfg.Login.AuditRetention,
+    })
+    userService := service.NewUserService(userRepo, loginGuard)
+    // Session tokens stop working when the account is deleted or its
+    // password changes
+    middleware.SetSessionCheck(userService.SessionValid)
+
+    // TOTP secrets are sealed with their own key, or one derived from the
+    // JWT secret
+    mfaKey := cfg.Security.MFAKey.Value()
+    if mfaKey == "" {
+        mfaKey = "mfa:" + cfg.Security.JWTSecret.Value()
+    }
+    mfaSealer, err := crypto.NewSealer(mfaKey)
+    if err != nil {
+        log.Fatalf("Failed to initialize MFA key: %v", err)
+    }
+    mfaService := service.NewMFAService(userRepo, loginGuard, mfaSealer, cfg.Security.MFAIssuer)
+
+    // Verification and password reset emails; without SMTP they are only
+    // written to disk or the log
+    var accountMailer mailer.Mailer
+    if cfg.Mail.Driver == "smtp" {
+        accountMailer, err = mailer.NewSMTPMailer(mailer.SMTPConfig{
+            Host:     cfg.Mail.SMTPHost,
+            Port:     cfg.Mail.SMTPPort,
+            Username: cfg.Mail.SMTPUsername,
+            Password: cfg.Mail.SMTPPassword.Value(),
+            TLS:      cfg.Mail.SMTPTLS,
+        }, cfg.Mail.From)
+    } else {
+        log.Printf("Mail driver is %q: account emails are not delivered", cfg.Mail.Driver)
+        accountMailer, err = mailer.NewLogMailer(cfg.Mail.Dir, cfg.Mail.From)
+    }
+    if err != nil {
+        log.Fatalf("Failed to initialize mailer: %v", err)
+    }
+    emailService := service.NewAccountEmailService(userRepo, repository.NewEmailTokenRepository(db), accountMailer, loginGuard, service.AccountEmailPolicy{
+        AppURL:           cfg.Accounts.AppURL,
+        VerificationTTL:  cfg.Accounts.VerificationTTL,
+        PasswordResetTTL: cfg.Accounts.PasswordResetTTL,
+    })
     logger.InitializeLogger(logRepo)
 
-    
+    // Storage plans; new accounts get the default plan
+    planService := service.NewPlanService(planRepo, userRepo, minioRepo, cfg.Accounts.DefaultPlan)
+    planCtx, planCancel := createTimeoutContext(10 * time.Second)
+    err = planService.EnsureDefaults(planCtx)
+    planCancel()
+    if err != nil {
+        log.Fatalf("Failed to initialize storage plans: %v", err)
+    }
+
+    // Single sign-on with an OpenID Connect provider, when configured
+    var ssoService *service.SSOService
+    if cfg.OIDC.Enabled() {
+        redirectURL := cfg.OIDC.RedirectURL
+        if redirectURL == "" {
+            redirectURL = strings.TrimSuffix(cfg.Server.PublicURL, "/") + "/api/auth/oidc/callback"
+        }
+        provider := oidc.NewProvider(oidc.Config{
+            Issuer:       cfg.OIDC.Issuer,
+            ClientID:     cfg.OIDC.ClientID,
+            ClientSecret: cfg.OIDC.ClientSecret.Value(),
+            RedirectURL:  redirectURL,
+            Scopes:       cfg.OIDC.Scopes,
+        })
+        ssoSealer, err := crypto.NewSealer("oidc:" + cfg.Security.JWTSecret.Value())
+        if err != nil {
+            log.Fatalf("Failed to initialize single sign-on key: %v", err)
+        }
+        ssoService = service.NewSSOService(provider, userRepo, repository.NewLoginCodeRepository(db), planService, loginGuard, ssoSealer, service.SSOPolicy{
+            AppURL:        cfg.Accounts.AppURL,
+            AutoProvision: cfg.OIDC.AutoProvision,
+            SecureCookie:  strings.HasPrefix(redirectURL, "https://"),
+        })
+        log.Printf("Single sign-on enabled with %s", cfg.OIDC.Issuer)
+    }
+
+    // Grant the admin role to the configured accounts
+    if len(cfg.Accounts.AdminEmails) > 0 {
+        ctx, cancel := createTimeoutContext(10 * time.Second)
+        promoted, err := userRepo.PromoteByEmail(ctx, cfg.Accounts.AdminEmails)
+        cancel()
+        if err != nil {
+            log.Printf("Failed to promote admin accounts: %v", err)
+        } else if promoted > 0 {
+            log.Printf("Promoted %d account(s) to admin", promoted)
+        }
+    }
+
+    // Accounts created before email verification keep sharing
+    verifyCtx, verifyCancel := createTimeoutContext(10 * time.Second)
+    verified, err := userRepo.MarkExistingEmailsVerified(verifyCtx)
+    verifyCancel()
+    if err != nil {
+        log.Printf("Failed to mark existing accounts verified: %v", err)
+    } else if verified > 0 {
+        log.Printf("Marked %d existing account(s) as verified", verified)
+    }
+
+    // Bounds enforced when a client initializes an upload
+    uploadLimits := service.UploadLimits{
+        MaxFileSize:  cfg.Uploads.MaxFileSize,
+        MaxChunks:    cfg.Uploads.MaxChunks,
+        MinChunkSize: cfg.Uploads.MinChunkSize,
+        MaxChunkSize: cfg.Uploads.MaxChunkSize,
+    }
+
+    // Background job queue for post-upload processing
+    bucket := cfg.MinIO.Bucket
+    jobOpts := service.DefaultJobQueueOptions()
+    jobOpts.Workers = cfg.Jobs.Workers
+    jobOpts.MaxAttempts = cfg.Jobs.MaxAttempts
+    jobOpts.PollInterval = cfg.Jobs.PollInterval
+    jobOpts.LeaseDuration = cfg.Jobs.LeaseDuration
+    jobQueue := service.NewJobQueue(jobRepo, jobOpts)
+    multipartUploads := repository.NewMultipartUploadRepository(db)
+    service.NewUploadJobs(minioRepo, userRepo, multipartUploads, service.NewStorageService(minioClient, bucket), service.NoScanner{}).Register(jobQueue)
+
+    // Front ends that receive file content themselves (chunk uploads, tus,
+    // WebDAV, S3)
+    fileStore := service.NewFileStore(minioRepo, userRepo, planService, service.NewStorageService(minioClient, bucket), jobQueue, uploadLimits)
+    accessKeys := service.NewAccessKeyService(repository.NewAccessKeyRepository(db), userRepo)
+    tusService := service.NewTusService(fileStore, cfg.Uploads.TusExpiry)
+    tusService.Register(jobQueue)
+
+    // ZIP downloads of several files or a folder
+    archiveService := service.NewArchiveService(minioRepo, fileStore.Storage(), cfg.Uploads.ArchiveMaxSize)
+
+    // Server-side extraction of uploaded ZIP and tar archives
+    extractLimits := service.ExtractLimits{
+        MaxEntries:   cfg.Uploads.ExtractMaxEntries,
+        MaxTotalSize: cfg.Uploads.ExtractMaxSize,
+        MaxRatio:     cfg.Uploads.ExtractMaxRatio,
+    }
+    extractor := service.NewExtractor(fileStore, extractLimits)
+    extractor.Register(jobQueue)
+
+    // S3-compatible gateway; its expiry job runs even when it isn't served
+    // so that uploads left over from earlier runs are discarded
+    gateway := s3api.NewGateway(accessKeys, fileStore, multipartUploads, jobQueue, cfg.Server.S3Region, cfg.Uploads.MultipartExpiry)
+    gateway.Register(jobQueue)
+
+    jobQueue.Start(context.Background())
+
+    // Throttling of sign-in, registration and presigned URL minting
+    var rateLimitStore middleware.RateLimitStore = middleware.NewMemoryRateLimitStore()
+    if cfg.RateLimits.Store == "mongo" {
+        rateLimitStore = repository.NewRateLimitRepository(db)
+    }
+    limiter := middleware.NewRateLimiter(rateLimitStore,
+        middleware.RateLimitPolicy{Name: "login", Limit: cfg.RateLimits.Login.Limit, Period: cfg.RateLimits.Login.Period},
+        middleware.RateLimitPolicy{Name: "register", Limit: cfg.RateLimits.Register.Limit, Period: cfg.RateLimits.Register.Period},
+        middleware.RateLimitPolicy{Name: "upload_init", Limit: cfg.RateLimits.UploadInit.Limit, Period: cfg.RateLimits.UploadInit.Period, ByUser: true},
+        middleware.RateLimitPolicy{Name: "presign", Limit: cfg.RateLimits.Presign.Limit, Period: cfg.RateLimits.Presign.Period, ByUser: true},
+        middleware.RateLimitPolicy{Name: "email", Limit: cfg.RateLimits.Email.Limit, Period: cfg.RateLimits.Email.Period, ByUser: true},
+    )
 
     // Create router and register API routes
-    bucket := os.Getenv("MINIO_BUCKET_NAME")
-    router := api.NewRouter(client,fileService, minioClient, chunkRepo,fileRepo,userRepo,userService, bucket)
+    router := api.NewRouter(db,fileService, minioClient, presignClient, userRepo,userService, loginGuard, mfaService, emailService, ssoService, jobQueue, planService, uploadLimits, fileStore, tusService, archiveService, extractor, bucket, cfg.Server.TLSClientCA != "", limiter)
 
-    // Configure CORS middleware
-    corsMiddleware := middleware.CORS(router)
+    // WebDAV answers its own OPTIONS requests, so it is mounted next to the
+    // API rather than behind the CORS middleware
+    root := http.NewServeMux()
+    root.Handle("/dav/", dav.NewHandler("/dav", userService, accessKeys, fileStore, repository.NewFolderRepository(db)))
+    root.Handle("/", middleware.CORS(middleware.CORSOptions{
+        AllowedOrigins: cfg.CORS.AllowedOrigins,
+        AllowedMethods: cfg.CORS.AllowedMethods,
+        AllowedHeaders: cfg.CORS.AllowedHeaders,
+    })(router))
+
+    // Every request gets an ID first so error responses and logs can be
+    // correlated, then the client address and the base URL links are
+    // built from
+    corsMiddleware := middleware.RequestID(middleware.RealIP(trustedProxies)(middleware.ExternalURL(cfg.Server.PublicURL, trustedProxies)(root)))
     router.Use(middleware.MetricsMiddleware)
 
     // Start the HTTP server
-    port := os.Getenv("SERVER_PORT")
-    if port == "" {
-        port = "8080"
-    }
-    logger.L().Info("Server started", zap.String("port", os.Getenv("SERVER_PORT")))
+    port := strconv.Itoa(cfg.Server.Port)
+    logger.L().Info("Server started", zap.String("port", port))
 	logger.L().Error("Example error log", zap.String("context", "example"))
 
-    server := startServer(corsMiddleware, port)
-    gracefulShutdown(server)
+    // TLS termination; the certificate is re-read on SIGHUP. Client
+    // certificates are only asked for on the API port.
+    var apiTLS, gatewayTLS *tls.Config
+    if cfg.Server.TLSEnabled() {
+        certs, err := config.NewCertReloader(cfg.Server.TLSCert, cfg.Server.TLSKey)
+        if err != nil {
+            log.Fatal(err)
+        }
+        var clientCAs *x509.CertPool
+        if cfg.Server.TLSClientCA != "" {
+            if clientCAs, err = config.LoadCAPool(cfg.Server.TLSClientCA, false); err != nil {
+                log.Fatalf("Failed to load client CA bundle: %v", err)
+            }
+        }
+        apiTLS = config.ServerTLS(certs, clientCAs)
+        gatewayTLS = config.ServerTLS(certs, nil)
+        go reloadOnHangup(certs)
+    }
+
+    servers := []*http.Server{startServer(corsMiddleware, port, apiTLS)}
+
+    // Optional S3-compatible gateway on its own port
+    if cfg.Server.S3Port != 0 {
+        servers = append(servers, startServer(middleware.RequestID(gateway), strconv.Itoa(cfg.Server.S3Port), gatewayTLS))
+    }
+
+    // Plain HTTP clients are sent to the HTTPS port
+    if cfg.Server.HTTPRedirectPort != 0 {
+        servers = append(servers, startServer(redirectToHTTPS(port), strconv.Itoa(cfg.Server.HTTPRedirectPort), nil))
+    }
+
+    gracefulShutdown(jobQueue, servers...)
 }
 
 func disconnectMongo(client *mongo.Client) error {
@@ -88,16 +328,25 @@ func disconnectMongo(client *mongo.Client) error {
     return client.Disconnect(ctx)
 }
 
-// startServer initializes and starts the HTTP server.
-func startServer(handler http.Handler, port string) *http.Server {
+// startServer initializes and starts the HTTP server. With tlsConfig it
+// serves HTTPS.
+func startServer(handler http.Handler, port string, tlsConfig *tls.Config) *http.Server {
     server := &http.Server{
-        Addr:    ":" + port,
-        Handler: handler,
+        Addr:      ":" + port,
+        Handler:   handler,
+        TLSConfig: tlsConfig,
     }
 
     go func() {
-        log.Printf("🚀 Server starting on http://localhost:%s\n", port)
-        if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+        var err error
+        if tlsConfig != nil {
+            log.Printf("🚀 Server starting on https://localhost:%s\n", port)
+            err = server.ListenAndServeTLS("", "")
+        } else {
+            log.Printf("🚀 Server starting on http://localhost:%s\n", port)
+            err = server.ListenAndServe()
+        }
+        if err != nil && err != http.ErrServerClosed {
             log.Fatalf("Server error: %v", err)
         }
     }()
@@ -105,8 +354,44 @@ func startServer(handler http.Handler, port string) *http.Server {
     return server
 }
 
+// redirectToHTTPS sends every request to the same host and path on the
+// HTTPS port. 308 keeps the method and body of API calls.
+func redirectToHTTPS(httpsPort string) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        host := r.Host
+        if h, _, err := net.SplitHostPort(host); err == nil {
+            host = h
+        }
+        host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+        if host == "" {
+            http.Error(w, "Host header required", http.StatusBadRequest)
+            return
+        }
+        if httpsPort != "443" {
+            host = net.JoinHostPort(host, httpsPort)
+        } else if strings.Contains(host, ":") {
+            host = "[" + host + "]"
+        }
+        http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+    })
+}
+
+// reloadOnHangup re-reads the TLS certificate whenever the process receives
+// SIGHUP, e.g. after a renewal.
+func reloadOnHangup(certs *config.CertReloader) {
+    hangup := make(chan os.Signal, 1)
+    signal.Notify(hangup, syscall.SIGHUP)
+    for range hangup {
+        if err := certs.Reload(); err != nil {
+            log.Printf("Failed to reload TLS certificate, keeping the old one: %v", err)
+            continue
+        }
+        log.Println("Reloaded TLS certificate")
+    }
+}
+
 // gracefulShutdown handles server shutdown gracefully.
-func gracefulShutdown(server *http.Server) {
+func gracefulShutdown(jobQueue *service.JobQueue, servers ...*http.Server) {
     shutdown := make(chan os.Signal, 1)
     signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
@@ -116,8 +401,14 @@ func gracefulShutdown(server *http.Server) {
     ctx, cancel := createTimeoutContext(10 * time.Second)
     defer cancel()
 
-    if err := server.Shutdown(ctx); err != nil {
-        log.Printf("Error shutting down server: %v", err)
+    for _, server := range servers {
+        if err := server.Shutdown(ctx); err != nil {
+            log.Printf("Error shutting down server: %v", err)
+        }
+    }
+
+    if err := jobQueue.Stop(ctx); err != nil {
+        log.Printf("Error stopping job workers: %v", err)
     }
 
     log.Println("✅ Server stopped gracefully")
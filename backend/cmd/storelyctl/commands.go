@@ -0,0 +1,364 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "errors"
+    "flag"
+    "fmt"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+    "text/tabwriter"
+
+    "backend/client"
+)
+
+func newFlagSet(name, args string) *flag.FlagSet {
+    fs := flag.NewFlagSet(name, flag.ExitOnError)
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: storelyctl %s [flags] %s\n", name, args)
+        fs.PrintDefaults()
+    }
+    return fs
+}
+
+func runLogin(ctx context.Context, a *app, args []string) error {
+    fs := newFlagSet("login", "")
+    email := fs.String("email", "", "account email (prompted when empty)")
+    saveKey := fs.Bool("save-key", true, "remember the encryption key with the session")
+    fs.Parse(args)
+
+    if a.key == "" {
+        return errors.New("the server encryption key is required: pass -key or set STORELY_ENCRYPTION_KEY")
+    }
+
+    in := bufio.NewReader(os.Stdin)
+    if *email == "" {
+        *email = prompt(in, "Email: ")
+    }
+    password := os.Getenv("STORELY_PASSWORD")
+    if password == "" {
+        password = prompt(in, "Password: ")
+    }
+
+    c := client.New(a.server, a.key)
+    user, err := c.Login(ctx, *email, password)
+    var mfa *client.MFARequiredError
+    if errors.As(err, &mfa) {
+        code := prompt(in, "Two-factor code: ")
+        user, err = c.CompleteLogin(ctx, mfa.Token, code)
+    }
+    if err != nil {
+        return err
+    }
+
+    a.session.Server = a.server
+    a.session.Email = user.Email
+    a.session.UserID = user.UserID
+    a.session.Token = c.Token()
+    a.session.EncryptionKey = ""
+    if *saveKey {
+        a.session.EncryptionKey = a.key
+    }
+    if err := a.session.save(); err != nil {
+        return fmt.Errorf("logged in but failed to save the session: %w", err)
+    }
+    fmt.Printf("Logged in to %s as %s (%s plan)\n", a.server, user.Email, user.Plan)
+    return nil
+}
+
+func prompt(in *bufio.Reader, label string) string {
+    fmt.Fprint(os.Stderr, label)
+    line, _ := in.ReadString('\n')
+    return strings.TrimSpace(line)
+}
+
+func runLogout(ctx context.Context, a *app, args []string) error {
+    newFlagSet("logout", "").Parse(args)
+    a.session.Token = ""
+    a.session.UserID = ""
+    if err := a.session.save(); err != nil {
+        return err
+    }
+    fmt.Println("Logged out")
+    return nil
+}
+
+// uploadItem is one local file and the remote folder it goes to.
+type uploadItem struct {
+    path   string
+    folder string
+}
+
+func runUpload(ctx context.Context, a *app, args []string) error {
+    fs := newFlagSet("upload", "<file or directory>...")
+    folder := fs.String("folder", "", "remote folder to upload into")
+    chunkSize := fs.Int64("chunk-size", client.DefaultChunkSize, "chunk size in bytes")
+    parallel := fs.Int("parallel", 4, "chunks uploaded in parallel")
+    fs.Parse(args)
+
+    if fs.NArg() == 0 {
+        fs.Usage()
+        os.Exit(2)
+    }
+    if err := a.requireLogin(); err != nil {
+        return err
+    }
+
+    var items []uploadItem
+    for _, arg := range fs.Args() {
+        found, err := collectUploads(arg, *folder)
+        if err != nil {
+            return err
+        }
+        items = append(items, found...)
+    }
+
+    pending, err := loadPending()
+    if err != nil {
+        return err
+    }
+
+    c := a.client()
+    failed := 0
+    for _, item := range items {
+        if err := uploadOne(ctx, c, a.server, pending, item, *chunkSize, *parallel); err != nil {
+            if ctx.Err() != nil {
+                return ctx.Err()
+            }
+            fmt.Fprintf(os.Stderr, "%s: %v\n", item.path, err)
+            failed++
+        }
+    }
+    if failed > 0 {
+        return fmt.Errorf("%d of %d upload(s) failed; run the same command again to resume", failed, len(items))
+    }
+    return nil
+}
+
+// collectUploads expands root into files. Files inside a directory keep
+// their relative location below folder/<directory name>.
+func collectUploads(root, folder string) ([]uploadItem, error) {
+    info, err := os.Stat(root)
+    if err != nil {
+        return nil, err
+    }
+    if !info.IsDir() {
+        return []uploadItem{{path: root, folder: folder}}, nil
+    }
+
+    base := filepath.Base(filepath.Clean(root))
+    var items []uploadItem
+    err = filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if !d.Type().IsRegular() {
+            return nil
+        }
+        rel, err := filepath.Rel(root, filepath.Dir(p))
+        if err != nil {
+            return err
+        }
+        items = append(items, uploadItem{
+            path:   p,
+            folder: path.Join(folder, base, filepath.ToSlash(rel)),
+        })
+        return nil
+    })
+    return items, err
+}
+
+func uploadOne(ctx context.Context, c *client.Client, server string, pending map[string]pendingUpload, item uploadItem, chunkSize int64, parallel int) error {
+    abs, err := filepath.Abs(item.path)
+    if err != nil {
+        return err
+    }
+    f, err := os.Open(abs)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil {
+        return err
+    }
+
+    label := path.Join(item.folder, filepath.Base(abs))
+    bar := newProgress(label, info.Size())
+    defer bar.finish()
+    opts := client.UploadOptions{
+        Folder:      item.folder,
+        ChunkSize:   chunkSize,
+        Concurrency: parallel,
+        Progress:    func(sent, total int64) { bar.update(sent) },
+    }
+
+    key := pendingKey(abs, info)
+    if prev, ok := pending[key]; ok && prev.Server == server {
+        err := c.ResumeUpload(ctx, prev.FileID, f, info.Size(), opts)
+        if err == nil {
+            delete(pending, key)
+            bar.update(info.Size())
+            fmt.Fprintf(os.Stderr, "\n%s resumed as %s", label, prev.FileID)
+            return savePending(pending)
+        }
+        if !client.IsCode(err, "FILE_NOT_FOUND") {
+            return err
+        }
+        // The partial upload is gone on the server; start over
+        delete(pending, key)
+    }
+
+    opts.OnInit = func(fileID string) {
+        pending[key] = pendingUpload{Server: server, FileID: fileID}
+        if err := savePending(pending); err != nil {
+            fmt.Fprintf(os.Stderr, "warning: cannot record upload for resume: %v\n", err)
+        }
+    }
+    fileID, err := c.Upload(ctx, filepath.Base(abs), f, info.Size(), opts)
+    if err != nil {
+        return err
+    }
+    delete(pending, key)
+    bar.update(info.Size())
+    fmt.Fprintf(os.Stderr, "\n%s uploaded as %s", label, fileID)
+    return savePending(pending)
+}
+
+func runDownload(ctx context.Context, a *app, args []string) error {
+    fs := newFlagSet("download", "<file ID>...")
+    output := fs.String("o", "", "output file (one ID) or directory (several IDs); defaults to the stored name in the current directory")
+    fs.Parse(args)
+
+    if fs.NArg() == 0 {
+        fs.Usage()
+        os.Exit(2)
+    }
+    if err := a.requireLogin(); err != nil {
+        return err
+    }
+
+    c := a.client()
+    for _, fileID := range fs.Args() {
+        if err := downloadOne(ctx, c, fileID, *output, fs.NArg() > 1); err != nil {
+            return fmt.Errorf("%s: %w", fileID, err)
+        }
+    }
+    return nil
+}
+
+func downloadOne(ctx context.Context, c *client.Client, fileID, output string, outputIsDir bool) error {
+    info, err := c.DownloadURLs(ctx, fileID)
+    if err != nil {
+        return err
+    }
+
+    target := output
+    if target == "" || outputIsDir {
+        target = filepath.Join(output, filepath.Base(info.FileName))
+    } else if st, err := os.Stat(target); err == nil && st.IsDir() {
+        target = filepath.Join(target, filepath.Base(info.FileName))
+    }
+
+    tmp := target + ".part"
+    f, err := os.Create(tmp)
+    if err != nil {
+        return err
+    }
+
+    bar := newProgress(info.FileName, int64(info.Size))
+    _, err = c.Download(ctx, fileID, f, bar.update)
+    bar.finish()
+    if closeErr := f.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    if err := os.Rename(tmp, target); err != nil {
+        return err
+    }
+    fmt.Fprintf(os.Stderr, "%s saved to %s\n", fileID, target)
+    return nil
+}
+
+func runList(ctx context.Context, a *app, args []string) error {
+    fs := newFlagSet("ls", "")
+    folder := fs.String("folder", "", "only list files directly in this folder")
+    all := fs.Bool("all", false, "list files in every folder")
+    limit := fs.Int64("limit", 50, "files per page")
+    page := fs.Int64("page", 1, "page to show")
+    fs.Parse(args)
+
+    if err := a.requireLogin(); err != nil {
+        return err
+    }
+
+    var folderFilter *string
+    if !*all {
+        folderFilter = folder
+    }
+    list, err := a.client().ListFiles(ctx, folderFilter, *page, *limit)
+    if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "ID\tNAME\tSIZE\tSTATUS\tCREATED")
+    for _, f := range list.Files {
+        status := "complete"
+        if !f.Complete {
+            status = "partial"
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.ID, path.Join(f.Folder, f.FileName), humanBytes(f.Size), status, f.CreatedAt.Local().Format("2006-01-02 15:04"))
+    }
+    w.Flush()
+    fmt.Fprintf(os.Stderr, "page %d, %d of %d file(s)\n", list.Page, len(list.Files), list.Total)
+    return nil
+}
+
+func runRemove(ctx context.Context, a *app, args []string) error {
+    fs := newFlagSet("rm", "<file ID>...")
+    fs.Parse(args)
+
+    if fs.NArg() == 0 {
+        fs.Usage()
+        os.Exit(2)
+    }
+    if err := a.requireLogin(); err != nil {
+        return err
+    }
+
+    c := a.client()
+    for _, fileID := range fs.Args() {
+        if err := c.Delete(ctx, fileID); err != nil {
+            return fmt.Errorf("%s: %w", fileID, err)
+        }
+        fmt.Printf("deleted %s\n", fileID)
+    }
+    return nil
+}
+
+func runHealth(ctx context.Context, a *app, args []string) error {
+    newFlagSet("health", "").Parse(args)
+    if err := a.requireLogin(); err != nil {
+        return err
+    }
+
+    health, err := a.client().StorageHealth(ctx)
+    if err != nil {
+        return err
+    }
+    percent := 0.0
+    if health.StorageLimit > 0 {
+        percent = health.StorageUsed * 100 / health.StorageLimit
+    }
+    fmt.Printf("Used:      %s (%.1f%%)\n", humanBytes(health.StorageUsed), percent)
+    fmt.Printf("Limit:     %s\n", humanBytes(health.StorageLimit))
+    fmt.Printf("Available: %s\n", humanBytes(health.AvailableBalance))
+    return nil
+}
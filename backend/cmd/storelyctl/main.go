@@ -0,0 +1,121 @@
+// Command storelyctl is a command-line client for a Storely server.
+//
+//	storelyctl [-server URL] [-key KEY] <command> [flags] [args]
+//
+// Commands:
+//
+//	login     log in and save the session
+//	logout    forget the saved session
+//	upload    upload files or whole directories (resumable)
+//	download  download files by ID
+//	ls        list files
+//	rm        delete files by ID
+//	health    show storage usage
+//	sync      keep a local directory and a remote folder in sync
+//
+// The server URL and encryption key default to $STORELY_SERVER and
+// $STORELY_ENCRYPTION_KEY, then to the values saved by login.
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "os"
+    "os/signal"
+    "syscall"
+
+    "backend/client"
+)
+
+type command struct {
+    name    string
+    summary string
+    run     func(ctx context.Context, app *app, args []string) error
+}
+
+var commands = []command{
+    {"login", "log in and save the session", runLogin},
+    {"logout", "forget the saved session", runLogout},
+    {"upload", "upload files or directories", runUpload},
+    {"download", "download files by ID", runDownload},
+    {"ls", "list files", runList},
+    {"rm", "delete files by ID", runRemove},
+    {"health", "show storage usage", runHealth},
+    {"sync", "sync a local directory with a remote folder", runSync},
+}
+
+// app carries what every command needs.
+type app struct {
+    session *session
+    server  string
+    key     string
+}
+
+// client returns an API client for the saved session.
+func (a *app) client() *client.Client {
+    return client.New(a.server, a.key, client.WithToken(a.session.Token, a.session.UserID))
+}
+
+func (a *app) requireLogin() error {
+    if a.session.Token == "" {
+        return fmt.Errorf("not logged in; run \"storelyctl login\" first")
+    }
+    return nil
+}
+
+func usage() {
+    fmt.Fprintf(os.Stderr, "Usage: storelyctl [-server URL] [-key KEY] <command> [flags] [args]\n\nCommands:\n")
+    for _, cmd := range commands {
+        fmt.Fprintf(os.Stderr, "  %-9s %s\n", cmd.name, cmd.summary)
+    }
+    fmt.Fprintf(os.Stderr, "\nRun \"storelyctl <command> -h\" for the flags of a command.\n")
+}
+
+func main() {
+    flag.Usage = usage
+    server := flag.String("server", os.Getenv("STORELY_SERVER"), "Storely server URL")
+    key := flag.String("key", os.Getenv("STORELY_ENCRYPTION_KEY"), "server ENCRYPTION_KEY, needed for login")
+    flag.Parse()
+
+    if flag.NArg() == 0 {
+        usage()
+        os.Exit(2)
+    }
+
+    sess, err := loadSession()
+    if err != nil {
+        fatal(err)
+    }
+    a := &app{session: sess, server: *server, key: *key}
+    if a.server == "" {
+        a.server = sess.Server
+    }
+    if a.server == "" {
+        a.server = "http://localhost:8080"
+    }
+    if a.key == "" {
+        a.key = sess.EncryptionKey
+    }
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    name := flag.Arg(0)
+    for _, cmd := range commands {
+        if cmd.name == name {
+            if err := cmd.run(ctx, a, flag.Args()[1:]); err != nil {
+                fatal(err)
+            }
+            return
+        }
+    }
+    fmt.Fprintf(os.Stderr, "storelyctl: unknown command %q\n\n", name)
+    usage()
+    os.Exit(2)
+}
+
+func fatal(err error) {
+    fmt.Fprintf(os.Stderr, "storelyctl: %v\n", err)
+    os.Exit(1)
+}
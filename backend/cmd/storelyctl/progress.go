@@ -0,0 +1,60 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "sync"
+    "time"
+)
+
+// progress prints a single updating status line for one transfer to
+// stderr. Updates are throttled and safe to call from several goroutines.
+type progress struct {
+    mu    sync.Mutex
+    out   io.Writer
+    label string
+    total int64
+    last  time.Time
+    start time.Time
+}
+
+func newProgress(label string, total int64) *progress {
+    now := time.Now()
+    return &progress{out: os.Stderr, label: label, total: total, start: now}
+}
+
+func (p *progress) update(done int64) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if time.Since(p.last) < 200*time.Millisecond && done < p.total {
+        return
+    }
+    p.last = time.Now()
+
+    percent := 100.0
+    if p.total > 0 {
+        percent = float64(done) * 100 / float64(p.total)
+    }
+    rate := float64(done) / time.Since(p.start).Seconds()
+    fmt.Fprintf(p.out, "\r%-40.40s %5.1f%%  %s / %s  %s/s ", p.label, percent, humanBytes(float64(done)), humanBytes(float64(p.total)), humanBytes(rate))
+}
+
+func (p *progress) finish() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    fmt.Fprintln(p.out)
+}
+
+func humanBytes(n float64) string {
+    units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+    i := 0
+    for n >= 1024 && i < len(units)-1 {
+        n /= 1024
+        i++
+    }
+    if i == 0 {
+        return fmt.Sprintf("%.0f %s", n, units[i])
+    }
+    return fmt.Sprintf("%.1f %s", n, units[i])
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+)
+
+// session is saved by login in the user config directory.
+type session struct {
+    Server        string `json:"server"`
+    EncryptionKey string `json:"encryptionKey,omitempty"`
+    Email         string `json:"email"`
+    UserID        string `json:"userID"`
+    Token         string `json:"token"`
+}
+
+// pendingUpload records an upload that was initialized but not completed,
+// keyed by local path, size and modification time.
+type pendingUpload struct {
+    Server string `json:"server"`
+    FileID string `json:"fileId"`
+}
+
+func configDir() (string, error) {
+    dir, err := os.UserConfigDir()
+    if err != nil {
+        return "", err
+    }
+    return filepath.Join(dir, "storelyctl"), nil
+}
+
+func readJSON(name string, v interface{}) error {
+    dir, err := configDir()
+    if err != nil {
+        return err
+    }
+    data, err := os.ReadFile(filepath.Join(dir, name))
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if err := json.Unmarshal(data, v); err != nil {
+        return fmt.Errorf("corrupt %s: %w", name, err)
+    }
+    return nil
+}
+
+// writeJSON replaces name atomically; the files hold a token, so they are
+// only readable by the owner.
+func writeJSON(name string, v interface{}) error {
+    dir, err := configDir()
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(dir, 0o700); err != nil {
+        return err
+    }
+    data, err := json.MarshalIndent(v, "", "  ")
+    if err != nil {
+        return err
+    }
+    tmp := filepath.Join(dir, name+".tmp")
+    if err := os.WriteFile(tmp, data, 0o600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, filepath.Join(dir, name))
+}
+
+func loadSession() (*session, error) {
+    sess := &session{}
+    return sess, readJSON("session.json", sess)
+}
+
+func (s *session) save() error {
+    return writeJSON("session.json", s)
+}
+
+func loadPending() (map[string]pendingUpload, error) {
+    pending := map[string]pendingUpload{}
+    return pending, readJSON("uploads.json", &pending)
+}
+
+func savePending(pending map[string]pendingUpload) error {
+    return writeJSON("uploads.json", pending)
+}
+
+func pendingKey(path string, info os.FileInfo) string {
+    return fmt.Sprintf("%s|%d|%d", path, info.Size(), info.ModTime().UnixNano())
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "backend/client"
+    "backend/internal/service"
+)
+
+// partSuffix marks downloads in progress; such files are never uploaded.
+const partSuffix = ".storely-part"
+
+// syncEntry is what was last synced for one relative path: the remote file
+// and the local size, modification time and content hash at that moment.
+type syncEntry struct {
+    FileID  string `json:"fileId"`
+    Size    int64  `json:"size"`
+    ModTime int64  `json:"modTime"`
+    Hash    string `json:"hash"`
+}
+
+// syncState is the local state database of one directory/folder pair.
+type syncState struct {
+    Server string                `json:"server"`
+    Root   string                `json:"root"`
+    Folder string                `json:"folder"`
+    Files  map[string]*syncEntry `json:"files"`
+}
+
+type localFile struct {
+    abs     string
+    size    int64
+    modTime int64
+}
+
+type syncer struct {
+    c         *client.Client
+    root      string
+    folder    string
+    stateName string
+    state     *syncState
+    opts      client.UploadOptions
+    dryRun    bool
+}
+
+func runSync(ctx context.Context, a *app, args []string) error {
+    fs := newFlagSet("sync", "<local directory>")
+    folder := fs.String("folder", "", "remote folder to keep in sync")
+    watch := fs.Bool("watch", false, "keep running and sync on every change")
+    interval := fs.Duration("interval", 30*time.Second, "how often to check the server for remote changes in watch mode")
+    parallel := fs.Int("parallel", 4, "chunks uploaded in parallel")
+    dryRun := fs.Bool("dry-run", false, "only print what would be done")
+    fs.Parse(args)
+
+    if fs.NArg() != 1 {
+        fs.Usage()
+        os.Exit(2)
+    }
+    if err := a.requireLogin(); err != nil {
+        return err
+    }
+
+    root, err := filepath.Abs(fs.Arg(0))
+    if err != nil {
+        return err
+    }
+    if info, err := os.Stat(root); err != nil || !info.IsDir() {
+        return fmt.Errorf("%s is not a directory", root)
+    }
+    remote, ok := service.CleanFolder(*folder)
+    if !ok {
+        return fmt.Errorf("invalid remote folder %q", *folder)
+    }
+
+    s := &syncer{
+        c:      a.client(),
+        root:   root,
+        folder: remote,
+        opts:   client.UploadOptions{Concurrency: *parallel},
+        dryRun: *dryRun,
+    }
+    if err := s.loadState(a.server); err != nil {
+        return err
+    }
+
+    if err := s.run(ctx); err != nil || !*watch {
+        return err
+    }
+    return s.watch(ctx, *interval)
+}
+
+func (s *syncer) loadState(server string) error {
+    sum := sha256.Sum256([]byte(server + "\x00" + s.root + "\x00" + s.folder))
+    s.stateName = "sync-" + hex.EncodeToString(sum[:8]) + ".json"
+    s.state = &syncState{}
+    if err := readJSON(s.stateName, s.state); err != nil {
+        return err
+    }
+    s.state.Server, s.state.Root, s.state.Folder = server, s.root, s.folder
+    if s.state.Files == nil {
+        s.state.Files = map[string]*syncEntry{}
+    }
+    return nil
+}
+
+func (s *syncer) saveState() error {
+    if s.dryRun {
+        return nil
+    }
+    return writeJSON(s.stateName, s.state)
+}
+
+// watch re-runs the sync whenever the local tree changes and at least every
+// interval, to pick up remote changes.
+func (s *syncer) watch(ctx context.Context, interval time.Duration) error {
+    w, err := newWatcher(s.root)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "file watching unavailable (%v); polling every %s\n", err, interval)
+    } else {
+        defer w.close()
+    }
+
+    var changes <-chan struct{}
+    if w != nil {
+        changes = w.changes()
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    fmt.Fprintf(os.Stderr, "watching %s\n", s.root)
+    for {
+        select {
+        case <-ctx.Done():
+            return nil
+        case <-ticker.C:
+        case <-changes:
+            // Let a burst of writes settle before syncing
+            settle := time.NewTimer(2 * time.Second)
+        drain:
+            for {
+                select {
+                case <-changes:
+                    settle.Reset(2 * time.Second)
+                case <-settle.C:
+                    break drain
+                case <-ctx.Done():
+                    settle.Stop()
+                    return nil
+                }
+            }
+        }
+        if err := s.run(ctx); err != nil {
+            if ctx.Err() != nil {
+                return nil
+            }
+            fmt.Fprintf(os.Stderr, "sync failed: %v\n", err)
+        }
+    }
+}
+
+// run performs one full reconciliation pass.
+func (s *syncer) run(ctx context.Context) error {
+    local, err := s.scanLocal()
+    if err != nil {
+        return err
+    }
+    remote, err := s.scanRemote(ctx)
+    if err != nil {
+        return err
+    }
+
+    paths := map[string]bool{}
+    for rel := range local {
+        paths[rel] = true
+    }
+    for rel := range remote {
+        paths[rel] = true
+    }
+    for rel := range s.state.Files {
+        paths[rel] = true
+    }
+
+    failed := 0
+    for rel := range paths {
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        if err := s.reconcile(ctx, rel, local[rel], remote[rel]); err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %v\n", rel, err)
+            failed++
+        }
+    }
+    if err := s.saveState(); err != nil {
+        return err
+    }
+    if failed > 0 {
+        return fmt.Errorf("%d path(s) failed", failed)
+    }
+    return nil
+}
+
+func (s *syncer) scanLocal() (map[string]*localFile, error) {
+    files := map[string]*localFile{}
+    err := filepath.WalkDir(s.root, func(p string, d os.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if !d.Type().IsRegular() || strings.HasSuffix(p, partSuffix) {
+            return nil
+        }
+        info, err := d.Info()
+        if err != nil {
+            return err
+        }
+        rel, err := filepath.Rel(s.root, p)
+        if err != nil {
+            return err
+        }
+        files[filepath.ToSlash(rel)] = &localFile{abs: p, size: info.Size(), modTime: info.ModTime().UnixNano()}
+        return nil
+    })
+    return files, err
+}
+
+// scanRemote returns the newest complete file for each relative path under
+// the remote folder.
+func (s *syncer) scanRemote(ctx context.Context) (map[string]*client.File, error) {
+    files := map[string]*client.File{}
+    for page := int64(1); ; page++ {
+        list, err := s.c.ListTree(ctx, s.folder, page, 200)
+        if err != nil {
+            return nil, err
+        }
+        for i := range list.Files {
+            f := &list.Files[i]
+            if !f.Complete {
+                continue
+            }
+            rel := path.Join(strings.TrimPrefix(strings.TrimPrefix(f.Folder, s.folder), "/"), f.FileName)
+            if cur, ok := files[rel]; !ok || f.CreatedAt.After(cur.CreatedAt) {
+                files[rel] = f
+            }
+        }
+        if page*list.Limit >= list.Total || len(list.Files) == 0 {
+            return files, nil
+        }
+    }
+}
+
+// reconcile decides what to do with one path from its local file, the
+// newest remote file and what was synced last time.
+func (s *syncer) reconcile(ctx context.Context, rel string, l *localFile, r *client.File) error {
+    st := s.state.Files[rel]
+
+    switch {
+    case l == nil && r == nil:
+        delete(s.state.Files, rel)
+        return nil
+
+    case st == nil && l != nil && r == nil:
+        return s.upload(ctx, rel, l, "")
+
+    case st == nil && l == nil && r != nil:
+        return s.download(ctx, rel, r)
+
+    case st == nil:
+        // New on both sides; identical content needs no transfer
+        same, hash, err := s.sameContent(ctx, l, r)
+        if err != nil {
+            return err
+        }
+        if same {
+            s.state.Files[rel] = &syncEntry{FileID: r.ID, Size: l.size, ModTime: l.modTime, Hash: hash}
+            return nil
+        }
+        return s.conflict(ctx, rel, l, r)
+    }
+
+    localChanged, err := s.localChanged(st, l)
+    if err != nil {
+        return err
+    }
+    remoteChanged := r == nil || r.ID != st.FileID
+
+    switch {
+    case l == nil && r == nil:
+        delete(s.state.Files, rel)
+        return nil
+    case l == nil && !remoteChanged:
+        return s.deleteRemote(ctx, rel, st.FileID)
+    case l == nil:
+        return s.download(ctx, rel, r)
+    case r == nil && !localChanged:
+        return s.deleteLocal(rel, l)
+    case r == nil:
+        return s.upload(ctx, rel, l, "")
+    case localChanged && remoteChanged:
+        return s.conflict(ctx, rel, l, r)
+    case localChanged:
+        return s.upload(ctx, rel, l, st.FileID)
+    case remoteChanged:
+        return s.download(ctx, rel, r)
+    }
+    return nil
+}
+
+// localChanged compares a local file with its last synced state. A changed
+// modification time alone is confirmed by hashing.
+func (s *syncer) localChanged(st *syncEntry, l *localFile) (bool, error) {
+    if l == nil {
+        return true, nil
+    }
+    if l.size != st.Size {
+        return true, nil
+    }
+    if l.modTime == st.ModTime {
+        return false, nil
+    }
+    hash, err := hashFile(l.abs)
+    if err != nil {
+        return false, err
+    }
+    if hash != st.Hash {
+        return true, nil
+    }
+    st.ModTime = l.modTime
+    return false, nil
+}
+
+func (s *syncer) sameContent(ctx context.Context, l *localFile, r *client.File) (bool, string, error) {
+    hash, err := hashFile(l.abs)
+    if err != nil {
+        return false, "", err
+    }
+    if int64(r.Size) != l.size {
+        return false, hash, nil
+    }
+    remoteHash := r.Checksum
+    if remoteHash == "" {
+        // The checksum job hasn't run yet; hash the remote content instead
+        h := sha256.New()
+        if _, err := s.c.Download(ctx, r.ID, h, nil); err != nil {
+            return false, "", err
+        }
+        remoteHash = hex.EncodeToString(h.Sum(nil))
+    }
+    return remoteHash == hash, hash, nil
+}
+
+func (s *syncer) remoteFolder(rel string) string {
+    dir := path.Dir(rel)
+    if dir == "." {
+        dir = ""
+    }
+    return strings.Trim(path.Join(s.folder, dir), "/")
+}
+
+// upload sends a local file and, when it replaces replaceID, deletes the
+// previous remote version afterwards.
+func (s *syncer) upload(ctx context.Context, rel string, l *localFile, replaceID string) error {
+    fmt.Printf("upload    %s\n", rel)
+    if s.dryRun {
+        return nil
+    }
+
+    f, err := os.Open(l.abs)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    hash, err := hashReader(f)
+    if err != nil {
+        return err
+    }
+    opts := s.opts
+    opts.Folder = s.remoteFolder(rel)
+    fileID, err := s.c.Upload(ctx, path.Base(rel), f, l.size, opts)
+    if err != nil {
+        return err
+    }
+    s.state.Files[rel] = &syncEntry{FileID: fileID, Size: l.size, ModTime: l.modTime, Hash: hash}
+
+    if replaceID != "" {
+        if err := s.c.Delete(ctx, replaceID); err != nil && !client.IsCode(err, "FILE_NOT_FOUND") {
+            return fmt.Errorf("uploaded, but failed to delete the previous version: %w", err)
+        }
+    }
+    return nil
+}
+
+// download fetches a remote file into place through a temporary file and
+// verifies its checksum when the server has one.
+func (s *syncer) download(ctx context.Context, rel string, r *client.File) error {
+    fmt.Printf("download  %s\n", rel)
+    if s.dryRun {
+        return nil
+    }
+
+    target := filepath.Join(s.root, filepath.FromSlash(rel))
+    if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+        return err
+    }
+    tmp := target + partSuffix
+    f, err := os.Create(tmp)
+    if err != nil {
+        return err
+    }
+
+    h := sha256.New()
+    _, err = s.c.Download(ctx, r.ID, io.MultiWriter(f, h), nil)
+    if closeErr := f.Close(); err == nil {
+        err = closeErr
+    }
+    hash := hex.EncodeToString(h.Sum(nil))
+    if err == nil && r.Checksum != "" && r.Checksum != hash {
+        err = errors.New("downloaded content does not match the stored checksum")
+    }
+    if err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    if err := os.Rename(tmp, target); err != nil {
+        return err
+    }
+
+    info, err := os.Stat(target)
+    if err != nil {
+        return err
+    }
+    s.state.Files[rel] = &syncEntry{FileID: r.ID, Size: info.Size(), ModTime: info.ModTime().UnixNano(), Hash: hash}
+    return nil
+}
+
+// conflict keeps both versions: the local file is renamed to a conflict
+// copy and uploaded, and the remote version takes the original name.
+func (s *syncer) conflict(ctx context.Context, rel string, l *localFile, r *client.File) error {
+    ext := path.Ext(rel)
+    copyRel := fmt.Sprintf("%s (conflict %s)%s", strings.TrimSuffix(rel, ext), time.Now().Format("2006-01-02 150405"), ext)
+    fmt.Printf("conflict  %s -> %s\n", rel, copyRel)
+    if s.dryRun {
+        return nil
+    }
+
+    copyAbs := filepath.Join(s.root, filepath.FromSlash(copyRel))
+    if err := os.Rename(l.abs, copyAbs); err != nil {
+        return err
+    }
+    if err := s.upload(ctx, copyRel, &localFile{abs: copyAbs, size: l.size, modTime: l.modTime}, ""); err != nil {
+        return err
+    }
+    return s.download(ctx, rel, r)
+}
+
+func (s *syncer) deleteRemote(ctx context.Context, rel, fileID string) error {
+    fmt.Printf("delete    %s (remote)\n", rel)
+    if s.dryRun {
+        return nil
+    }
+    if err := s.c.Delete(ctx, fileID); err != nil && !client.IsCode(err, "FILE_NOT_FOUND") {
+        return err
+    }
+    delete(s.state.Files, rel)
+    return nil
+}
+
+func (s *syncer) deleteLocal(rel string, l *localFile) error {
+    fmt.Printf("delete    %s (local)\n", rel)
+    if s.dryRun {
+        return nil
+    }
+    if err := os.Remove(l.abs); err != nil && !errors.Is(err, os.ErrNotExist) {
+        return err
+    }
+    delete(s.state.Files, rel)
+    return nil
+}
+
+func hashFile(name string) (string, error) {
+    f, err := os.Open(name)
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+    return hashReader(f)
+}
+
+// hashReader hashes r from its current position to EOF and rewinds it.
+func hashReader(r io.ReadSeeker) (string, error) {
+    h := sha256.New()
+    if _, err := io.Copy(h, r); err != nil {
+        return "", err
+    }
+    if _, err := r.Seek(0, io.SeekStart); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
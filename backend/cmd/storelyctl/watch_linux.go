@@ -0,0 +1,88 @@
+//go:build linux
+
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "sync"
+    "syscall"
+    "unsafe"
+)
+
+const watchMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE |
+    syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB |
+    syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// watcher reports changes below a directory tree using inotify. Every
+// directory gets its own watch; new directories are added as they appear.
+type watcher struct {
+    fd   int
+    root string
+    out  chan struct{}
+    once sync.Once
+}
+
+func newWatcher(root string) (*watcher, error) {
+    fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+    if err != nil {
+        return nil, err
+    }
+    w := &watcher{fd: fd, root: root, out: make(chan struct{}, 1)}
+    if err := w.addTree(); err != nil {
+        syscall.Close(fd)
+        return nil, err
+    }
+    go w.loop()
+    return w, nil
+}
+
+func (w *watcher) changes() <-chan struct{} {
+    return w.out
+}
+
+func (w *watcher) close() {
+    w.once.Do(func() { syscall.Close(w.fd) })
+}
+
+// addTree watches every directory below root. Adding a watch that already
+// exists only updates its mask.
+func (w *watcher) addTree() error {
+    return filepath.WalkDir(w.root, func(p string, d os.DirEntry, err error) error {
+        if err != nil || !d.IsDir() {
+            return nil
+        }
+        _, err = syscall.InotifyAddWatch(w.fd, p, watchMask)
+        return err
+    })
+}
+
+func (w *watcher) loop() {
+    buf := make([]byte, 64*1024)
+    for {
+        n, err := syscall.Read(w.fd, buf)
+        if err == syscall.EINTR {
+            continue
+        }
+        if err != nil || n <= 0 {
+            return
+        }
+
+        newDir := false
+        for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+            ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+            if ev.Mask&syscall.IN_ISDIR != 0 && ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+                newDir = true
+            }
+            off += syscall.SizeofInotifyEvent + int(ev.Len)
+        }
+        if newDir {
+            w.addTree()
+        }
+
+        select {
+        case w.out <- struct{}{}:
+        default:
+        }
+    }
+}
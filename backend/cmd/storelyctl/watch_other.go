@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// watcher is only implemented with inotify; elsewhere sync falls back to
+// polling.
+type watcher struct{}
+
+func newWatcher(root string) (*watcher, error) {
+    return nil, errors.New("not supported on this platform")
+}
+
+func (w *watcher) changes() <-chan struct{} {
+    return nil
+}
+
+func (w *watcher) close() {}
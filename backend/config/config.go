@@ -3,46 +3,23 @@ package config
 import (
     "context"
     "log"
+    "net/url"
     "time"
-    "os"
     "fmt"
 
-    "github.com/joho/godotenv"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
     "github.com/minio/minio-go/v7"
     "github.com/minio/minio-go/v7/pkg/credentials"
 )
 
-// LoadEnv loads environment variables from a .env file or system environment.
-func LoadEnv() {
-    // Specify the relative path to the .env file
-    err := godotenv.Load("../../.env")
-    if err != nil {
-        log.Println("No .env file found, using system environment variables")
-    }
-
-    requiredVars := []string{"MONGODB_URI", "DB_NAME", "SERVER_PORT"}
-    for _, v := range requiredVars {
-        if os.Getenv(v) == "" {
-            log.Fatalf("%s is not set in the environment variables", v)
-        }
-    }
-}
-
-// ConnectDB establishes a connection to MongoDB using URI from environment variables.
-func ConnectDB() (*mongo.Client, error) {
+// ConnectDB establishes a connection to MongoDB.
+func ConnectDB(cfg MongoConfig) (*mongo.Client, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
 
-    // Get MongoDB URI from environment variables
-    uri := os.Getenv("MONGODB_URI")
-    if uri == "" {
-        log.Fatal("MONGODB_URI is not set in the environment variables")
-    }
-
-    log.Printf("Connecting to Database: %s", uri)
-    clientOptions := options.Client().ApplyURI(uri)
+    log.Printf("Connecting to Database: %s", RedactURL(cfg.URI))
+    clientOptions := options.Client().ApplyURI(cfg.URI)
     client, err := mongo.Connect(ctx, clientOptions)
     if err != nil {
         return nil, err
@@ -59,20 +36,19 @@ func ConnectDB() (*mongo.Client, error) {
 
 //Connection to MinIO client
 // In config/config.go
-func ConnectMinIO() (*minio.Client, error) {
-    endpoint := os.Getenv("MINIO_ENDPOINT")
-    accessKey := os.Getenv("MINIO_ACCESS_KEY")
-    secretKey := os.Getenv("MINIO_SECRET_KEY")
-    bucketName := os.Getenv("MINIO_BUCKET_NAME")
+func ConnectMinIO(cfg MinIOConfig) (*minio.Client, error) {
+    endpoint := cfg.Endpoint
+    bucketName := cfg.Bucket
 
-    if endpoint == "" || accessKey == "" || secretKey == "" {
-        log.Fatal("MinIO environment variables not set")
+    transport, err := minioTransport(cfg)
+    if err != nil {
+        return nil, fmt.Errorf("failed to configure MinIO TLS: %w", err)
     }
 
-    // Initialize MinIO client with HTTP
     client, err := minio.New(endpoint, &minio.Options{
-        Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-        Secure: false,  // Set to false for HTTP
+        Creds:     credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey.Value(), ""),
+        Secure:    cfg.UseSSL,
+        Transport: transport,
     })
     if err != nil {
         return nil, fmt.Errorf("failed to create MinIO client: %w", err)
@@ -101,6 +77,29 @@ func ConnectMinIO() (*minio.Client, error) {
     return client, nil
 }
 
+// PresignClient returns the client presigned URLs are made with. With
+// cfg.PublicURL set it is a client for that address instead; the bucket's
+// region is looked up through client, so signing never has to reach the
+// public address from the server.
+func PresignClient(cfg MinIOConfig, client *minio.Client) (*minio.Client, error) {
+    if cfg.PublicURL == "" {
+        return client, nil
+    }
+    public, err := url.Parse(cfg.PublicURL)
+    if err != nil {
+        return nil, fmt.Errorf("invalid MinIO public URL: %w", err)
+    }
+    region, err := client.GetBucketLocation(context.Background(), cfg.Bucket)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get bucket location: %w", err)
+    }
+    return minio.New(public.Host, &minio.Options{
+        Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey.Value(), ""),
+        Secure: public.Scheme == "https",
+        Region: region,
+    })
+}
+
 // Add this function to config.go
 func setPublicBucketPolicy(client *minio.Client, bucketName string) error {
     policy := `{
@@ -0,0 +1,567 @@
+package config
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "io/fs"
+    "net"
+    "net/mail"
+    "net/url"
+    "os"
+    "path/filepath"
+    "regexp"
+    "slices"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/joho/godotenv"
+    "github.com/pelletier/go-toml/v2"
+    "gopkg.in/yaml.v3"
+)
+
+// minJWTSecretLength keeps token signing keys out of guessing range.
+const minJWTSecretLength = 32
+
+// placeholderMarkers appear in example secrets that get copied into real
+// deployments; secrets containing one are refused.
+var placeholderMarkers = []string{"change-me", "changeme", "change_me", "replace-me", "replaceme", "your-secret", "yoursecret", "example", "placeholder"}
+
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// setting ties one configuration value to its key in a config file
+// ("section.name"), its environment variable and its flag. Flag names are
+// the environment variable in lower case with dashes, e.g. -minio-endpoint.
+type setting struct {
+    key   string
+    env   string
+    usage string
+    value interface{}
+}
+
+func (s setting) flagName() string {
+    return strings.ReplaceAll(strings.ToLower(s.env), "_", "-")
+}
+
+func (c *Config) settings() []setting {
+    return []setting{
+        {"server.port", "SERVER_PORT", "HTTP port of the API", &c.Server.Port},
+        {"server.s3_port", "S3_PORT", "port of the S3-compatible gateway; 0 disables it", &c.Server.S3Port},
+        {"server.s3_region", "S3_REGION", "region the S3 gateway expects in signatures", &c.Server.S3Region},
+        {"server.tls_cert", "TLS_CERT_FILE", "PEM certificate chain; enables HTTPS", &c.Server.TLSCert},
+        {"server.tls_key", "TLS_KEY_FILE", "PEM private key of the certificate", &c.Server.TLSKey},
+        {"server.tls_client_ca", "TLS_CLIENT_CA_FILE", "PEM CA bundle; admin routes then require a client certificate it issued", &c.Server.TLSClientCA},
+        {"server.http_redirect_port", "HTTP_REDIRECT_PORT", "plain HTTP port redirecting to HTTPS; 0 disables it", &c.Server.HTTPRedirectPort},
+        {"server.public_url", "PUBLIC_URL", "base URL clients reach the API at; default: each request's scheme and host", &c.Server.PublicURL},
+        {"server.trusted_proxies", "TRUSTED_PROXIES", "comma-separated proxy addresses or CIDRs whose forwarding headers are believed for client IPs and URLs", &c.Server.TrustedProxies},
+        {"mongo.uri", "MONGODB_URI", "MongoDB connection string", &c.Mongo.URI},
+        {"mongo.database", "DB_NAME", "MongoDB database", &c.Mongo.Database},
+        {"minio.endpoint", "MINIO_ENDPOINT", "MinIO host:port", &c.MinIO.Endpoint},
+        {"minio.access_key", "MINIO_ACCESS_KEY", "MinIO access key", &c.MinIO.AccessKey},
+        {"minio.secret_key", "MINIO_SECRET_KEY", "MinIO secret key", &c.MinIO.SecretKey},
+        {"minio.bucket", "MINIO_BUCKET_NAME", "bucket holding file content", &c.MinIO.Bucket},
+        {"minio.use_ssl", "MINIO_USE_SSL", "connect to MinIO over HTTPS", &c.MinIO.UseSSL},
+        {"minio.ca_file", "MINIO_CA_FILE", "PEM CA bundle trusted for MinIO in addition to the system roots", &c.MinIO.CAFile},
+        {"minio.public_url", "MINIO_PUBLIC_URL", "URL clients reach MinIO at; presigned URLs are signed for it", &c.MinIO.PublicURL},
+        {"cors.allowed_origins", "CORS_ALLOWED_ORIGINS", "comma-separated origins allowed to call the API; *.example.com labels match subdomains", &c.CORS.AllowedOrigins},
+        {"cors.allowed_methods", "CORS_ALLOWED_METHODS", "comma-separated methods allowed in cross-origin requests", &c.CORS.AllowedMethods},
+        {"cors.allowed_headers", "CORS_ALLOWED_HEADERS", "comma-separated request headers allowed in cross-origin requests", &c.CORS.AllowedHeaders},
+        {"security.encryption_key", "ENCRYPTION_KEY", "key sealing login and register payloads", &c.Security.EncryptionKey},
+        {"security.jwt_secret", "JWT_SECRET", "key signing session tokens", &c.Security.JWTSecret},
+        {"security.jwt_expiry", "JWT_EXPIRY", "lifetime of session tokens", &c.Security.JWTExpiry},
+        {"security.mfa_key", "MFA_ENCRYPTION_KEY", "key sealing TOTP secrets at rest; defaults to one derived from the JWT secret", &c.Security.MFAKey},
+        {"security.mfa_issuer", "MFA_ISSUER", "service name shown in authenticator apps", &c.Security.MFAIssuer},
+        {"login.free_attempts", "LOGIN_FREE_ATTEMPTS", "failed logins per email before delays start", &c.Login.FreeAttempts},
+        {"login.ip_free_attempts", "LOGIN_IP_FREE_ATTEMPTS", "failed logins per client IP before delays start", &c.Login.IPFreeAttempts},
+        {"login.base_delay", "LOGIN_BASE_DELAY", "first delay after the free attempts; doubles with each failure", &c.Login.BaseDelay},
+        {"login.max_delay", "LOGIN_MAX_DELAY", "longest delay between failed logins", &c.Login.MaxDelay},
+        {"login.failure_window", "LOGIN_FAILURE_WINDOW", "time without failures after which they are forgotten", &c.Login.FailureWindow},
+        {"login.captcha_after", "LOGIN_CAPTCHA_AFTER", "failed logins per email after which a CAPTCHA is required instead of delays; 0 disables", &c.Login.CaptchaAfter},
+        {"login.captcha_verify_url", "CAPTCHA_VERIFY_URL", "siteverify endpoint of reCAPTCHA, hCaptcha or Turnstile; enables CAPTCHAs", &c.Login.CaptchaVerifyURL},
+        {"login.captcha_site_key", "CAPTCHA_SITE_KEY", "public CAPTCHA site key handed to clients", &c.Login.CaptchaSiteKey},
+        {"login.captcha_secret", "CAPTCHA_SECRET", "CAPTCHA secret key", &c.Login.CaptchaSecret},
+        {"login.audit_retention", "LOGIN_AUDIT_RETENTION", "how long login attempt records are kept", &c.Login.AuditRetention},
+        {"accounts.default_plan", "DEFAULT_PLAN", "plan of new accounts", &c.Accounts.DefaultPlan},
+        {"accounts.admin_emails", "ADMIN_EMAILS", "comma-separated emails promoted to admin at startup", &c.Accounts.AdminEmails},
+        {"accounts.app_url", "APP_URL", "web app URL that verification and password reset emails link to", &c.Accounts.AppURL},
+        {"accounts.verification_ttl", "EMAIL_VERIFICATION_TTL", "how long email verification links stay valid", &c.Accounts.VerificationTTL},
+        {"accounts.password_reset_ttl", "PASSWORD_RESET_TTL", "how long password reset links stay valid", &c.Accounts.PasswordResetTTL},
+        {"mail.driver", "MAIL_DRIVER", "how emails are sent: smtp, or log for local development", &c.Mail.Driver},
+        {"mail.from", "MAIL_FROM", "sender address of account emails", &c.Mail.From},
+        {"mail.dir", "MAIL_DIR", "directory the log driver writes .eml files to; empty logs them", &c.Mail.Dir},
+        {"mail.smtp_host", "SMTP_HOST", "SMTP server host", &c.Mail.SMTPHost},
+        {"mail.smtp_port", "SMTP_PORT", "SMTP server port", &c.Mail.SMTPPort},
+        {"mail.smtp_username", "SMTP_USERNAME", "SMTP user name; empty sends without authentication", &c.Mail.SMTPUsername},
+        {"mail.smtp_password", "SMTP_PASSWORD", "SMTP password", &c.Mail.SMTPPassword},
+        {"mail.smtp_tls", "SMTP_TLS", "SMTP transport security: starttls, tls or none", &c.Mail.SMTPTLS},
+        {"oidc.issuer", "OIDC_ISSUER", "issuer URL of an OpenID Connect provider; enables single sign-on", &c.OIDC.Issuer},
+        {"oidc.client_id", "OIDC_CLIENT_ID", "client ID registered with the provider", &c.OIDC.ClientID},
+        {"oidc.client_secret", "OIDC_CLIENT_SECRET", "client secret; empty for a public client", &c.OIDC.ClientSecret},
+        {"oidc.redirect_url", "OIDC_REDIRECT_URL", "callback URL registered with the provider; default: /api/auth/oidc/callback under the public URL", &c.OIDC.RedirectURL},
+        {"oidc.scopes", "OIDC_SCOPES", "comma-separated scopes requested from the provider", &c.OIDC.Scopes},
+        {"oidc.auto_provision", "OIDC_AUTO_PROVISION", "create accounts for unknown identities with a verified email", &c.OIDC.AutoProvision},
+        {"uploads.max_file_size", "MAX_UPLOAD_FILE_SIZE", "largest file in bytes", &c.Uploads.MaxFileSize},
+        {"uploads.max_chunks", "MAX_UPLOAD_CHUNKS", "most chunks per file", &c.Uploads.MaxChunks},
+        {"uploads.min_chunk_size", "MIN_UPLOAD_CHUNK_SIZE", "smallest chunk in bytes", &c.Uploads.MinChunkSize},
+        {"uploads.max_chunk_size", "MAX_UPLOAD_CHUNK_SIZE", "largest chunk in bytes", &c.Uploads.MaxChunkSize},
+        {"uploads.tus_expiry", "TUS_UPLOAD_EXPIRY", "how long an unfinished tus upload is kept", &c.Uploads.TusExpiry},
+        {"uploads.multipart_expiry", "MULTIPART_UPLOAD_EXPIRY", "how long an unfinished S3 multipart upload is kept", &c.Uploads.MultipartExpiry},
+        {"uploads.archive_max_size", "ARCHIVE_MAX_SIZE", "largest ZIP download in bytes", &c.Uploads.ArchiveMaxSize},
+        {"uploads.extract_max_entries", "EXTRACT_MAX_ENTRIES", "most entries an extracted archive may hold", &c.Uploads.ExtractMaxEntries},
+        {"uploads.extract_max_size", "EXTRACT_MAX_SIZE", "largest unpacked size of an extracted archive in bytes", &c.Uploads.ExtractMaxSize},
+        {"uploads.extract_max_ratio", "EXTRACT_MAX_RATIO", "largest unpacked-to-packed size ratio of an extracted archive", &c.Uploads.ExtractMaxRatio},
+        {"jobs.workers", "JOB_WORKERS", "background job workers", &c.Jobs.Workers},
+        {"jobs.max_attempts", "JOB_MAX_ATTEMPTS", "attempts before a job is dead-lettered", &c.Jobs.MaxAttempts},
+        {"jobs.poll_interval", "JOB_POLL_INTERVAL", "how often idle workers look for jobs", &c.Jobs.PollInterval},
+        {"jobs.lease_duration", "JOB_LEASE_DURATION", "how long a job may run before it is retried", &c.Jobs.LeaseDuration},
+        {"rate_limits.store", "RATE_LIMIT_STORE", "where rate limit buckets live: memory or mongo (shared between instances)", &c.RateLimits.Store},
+        {"rate_limits.login", "RATE_LIMIT_LOGIN", "logins per client IP, e.g. 10/1m, or off", &c.RateLimits.Login},
+        {"rate_limits.register", "RATE_LIMIT_REGISTER", "registrations per client IP, e.g. 5/1h, or off", &c.RateLimits.Register},
+        {"rate_limits.upload_init", "RATE_LIMIT_UPLOAD_INIT", "upload initializations per account or client IP, e.g. 60/1m, or off", &c.RateLimits.UploadInit},
+        {"rate_limits.presign", "RATE_LIMIT_PRESIGN", "requests minting presigned URLs per account or client IP, e.g. 120/1m, or off", &c.RateLimits.Presign},
+        {"rate_limits.email", "RATE_LIMIT_EMAIL", "verification and password reset email requests per account or client IP, e.g. 5/1h, or off", &c.RateLimits.Email},
+    }
+}
+
+// ValidationError lists every problem found while loading the
+// configuration.
+type ValidationError struct {
+    Problems []string
+}
+
+func (e *ValidationError) Error() string {
+    return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load builds the configuration. It registers a flag for every setting on
+// flags, plus -config (a .yaml, .yml or .toml file; CONFIG_FILE in the
+// environment) and -env-file (a dotenv file loaded into the environment
+// without overriding it), then parses args. Values come from Defaults, the
+// config file, the environment and the flags, each overriding the one
+// before. Malformed values and failed validations are returned together as
+// a *ValidationError.
+func Load(flags *flag.FlagSet, args []string) (*Config, error) {
+    cfg := Defaults()
+    settings := cfg.settings()
+
+    configFile := flags.String("config", "", "YAML or TOML configuration file (default $CONFIG_FILE)")
+    envFile := flags.String("env-file", ".env", "dotenv file loaded into the environment when present")
+    flagValues := map[string]string{}
+    for _, s := range settings {
+        name := s.flagName()
+        flags.Func(name, s.usage+" ($"+s.env+")", func(raw string) error {
+            flagValues[name] = raw
+            return nil
+        })
+    }
+    if err := flags.Parse(args); err != nil {
+        return nil, err
+    }
+    explicit := map[string]bool{}
+    flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+    var problems []string
+    if err := godotenv.Load(*envFile); err != nil && (explicit["env-file"] || !errors.Is(err, fs.ErrNotExist)) {
+        problems = append(problems, fmt.Sprintf("env file %s: %v", *envFile, err))
+    }
+
+    path := *configFile
+    if path == "" {
+        path = os.Getenv("CONFIG_FILE")
+    }
+    var fileValues map[string]string
+    if path != "" {
+        var err error
+        if fileValues, err = readFile(path); err != nil {
+            problems = append(problems, fmt.Sprintf("config file %s: %v", path, err))
+        }
+    }
+
+    known := map[string]bool{}
+    for _, s := range settings {
+        known[s.key] = true
+        if raw, ok := fileValues[s.key]; ok {
+            if err := set(s.value, raw); err != nil {
+                problems = append(problems, fmt.Sprintf("%s in %s: %v", s.key, path, err))
+            }
+        }
+        if raw := os.Getenv(s.env); raw != "" {
+            if err := set(s.value, raw); err != nil {
+                problems = append(problems, fmt.Sprintf("$%s: %v", s.env, err))
+            }
+        }
+        if raw, ok := flagValues[s.flagName()]; ok {
+            if err := set(s.value, raw); err != nil {
+                problems = append(problems, fmt.Sprintf("-%s: %v", s.flagName(), err))
+            }
+        }
+    }
+    var unknown []string
+    for key := range fileValues {
+        if !known[key] {
+            unknown = append(unknown, key)
+        }
+    }
+    sort.Strings(unknown)
+    for _, key := range unknown {
+        problems = append(problems, fmt.Sprintf("%s in %s: unknown setting", key, path))
+    }
+
+    problems = append(problems, cfg.validate()...)
+    if len(problems) > 0 {
+        return nil, &ValidationError{Problems: problems}
+    }
+    return &cfg, nil
+}
+
+// validate checks every setting and returns one message per problem.
+func (c *Config) validate() []string {
+    var problems []string
+    envOf := map[string]string{}
+    for _, s := range c.settings() {
+        envOf[s.key] = s.env
+    }
+    check := func(ok bool, key, format string, args ...interface{}) {
+        if !ok {
+            problems = append(problems, fmt.Sprintf("%s ($%s) %s", key, envOf[key], fmt.Sprintf(format, args...)))
+        }
+    }
+
+    check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port", "must be between 1 and 65535")
+    check(c.Server.S3Port >= 0 && c.Server.S3Port <= 65535, "server.s3_port", "must be between 0 and 65535")
+    check(c.Server.S3Port != c.Server.Port, "server.s3_port", "must differ from server.port")
+    check((c.Server.TLSCert == "") == (c.Server.TLSKey == ""), "server.tls_key", "must be set together with server.tls_cert")
+    check(readable(c.Server.TLSCert), "server.tls_cert", "must be a readable file")
+    check(readable(c.Server.TLSKey), "server.tls_key", "must be a readable file")
+    check(c.Server.TLSClientCA == "" || c.Server.TLSEnabled(), "server.tls_client_ca", "requires server.tls_cert")
+    check(readable(c.Server.TLSClientCA), "server.tls_client_ca", "must be a readable file")
+    check(c.Server.HTTPRedirectPort >= 0 && c.Server.HTTPRedirectPort <= 65535, "server.http_redirect_port", "must be between 0 and 65535")
+    check(c.Server.HTTPRedirectPort == 0 || c.Server.TLSEnabled(), "server.http_redirect_port", "requires server.tls_cert")
+    check(c.Server.HTTPRedirectPort == 0 || (c.Server.HTTPRedirectPort != c.Server.Port && c.Server.HTTPRedirectPort != c.Server.S3Port),
+        "server.http_redirect_port", "must differ from server.port and server.s3_port")
+    check(c.Server.PublicURL == "" || isBaseURL(c.Server.PublicURL, true), "server.public_url", "must be an http or https URL without query or fragment")
+    for _, proxy := range c.Server.TrustedProxies {
+        check(isAddrOrCIDR(proxy), "server.trusted_proxies", "has an invalid address or CIDR %q", proxy)
+    }
+
+    check(c.Mongo.URI != "", "mongo.uri", "is required")
+    check(c.Mongo.URI == "" || strings.HasPrefix(c.Mongo.URI, "mongodb://") || strings.HasPrefix(c.Mongo.URI, "mongodb+srv://"),
+        "mongo.uri", "must start with mongodb:// or mongodb+srv://")
+    check(c.Mongo.Database != "" && !strings.ContainsAny(c.Mongo.Database, `/\. "$`), "mongo.database", "must be a non-empty name without /, \\, ., spaces, quotes or $")
+
+    check(c.MinIO.Endpoint != "", "minio.endpoint", "is required")
+    check(!strings.Contains(c.MinIO.Endpoint, "://"), "minio.endpoint", "must be host:port without a scheme; set minio.use_ssl for HTTPS")
+    check(c.MinIO.AccessKey != "", "minio.access_key", "is required")
+    check(c.MinIO.SecretKey != "", "minio.secret_key", "is required")
+    check(c.MinIO.CAFile == "" || c.MinIO.UseSSL, "minio.ca_file", "requires minio.use_ssl")
+    check(readable(c.MinIO.CAFile), "minio.ca_file", "must be a readable file")
+    check(c.MinIO.PublicURL == "" || isBaseURL(c.MinIO.PublicURL, false), "minio.public_url", "must be an http or https URL without path, query or fragment")
+    check(bucketNamePattern.MatchString(c.MinIO.Bucket), "minio.bucket", "must be a valid bucket name (3-63 lower-case letters, digits, dots and dashes)")
+
+    check(len(c.CORS.AllowedOrigins) > 0, "cors.allowed_origins", "must list at least one origin")
+    for _, origin := range c.CORS.AllowedOrigins {
+        check(isOriginPattern(origin), "cors.allowed_origins", "has an invalid origin %q; use scheme://host[:port], optionally with a leading *. label, or *", origin)
+    }
+    check(len(c.CORS.AllowedMethods) > 0, "cors.allowed_methods", "must list at least one method")
+
+    check(c.Login.FreeAttempts >= 0, "login.free_attempts", "must not be negative")
+    check(c.Login.IPFreeAttempts >= 0, "login.ip_free_attempts", "must not be negative")
+    check(c.Login.BaseDelay > 0, "login.base_delay", "must be positive")
+    check(c.Login.MaxDelay >= c.Login.BaseDelay, "login.max_delay", "must not be below login.base_delay")
+    check(c.Login.FailureWindow >= c.Login.MaxDelay, "login.failure_window", "must not be below login.max_delay")
+    check(c.Login.CaptchaAfter >= 0, "login.captcha_after", "must not be negative")
+    check(c.Login.CaptchaVerifyURL == "" || isBaseURL(c.Login.CaptchaVerifyURL, true), "login.captcha_verify_url", "must be an http or https URL")
+    check(c.Login.CaptchaVerifyURL == "" || (c.Login.CaptchaSecret != "" && c.Login.CaptchaSiteKey != ""),
+        "login.captcha_secret", "and login.captcha_site_key are required with login.captcha_verify_url")
+    check(c.Login.AuditRetention >= time.Hour, "login.audit_retention", "must be at least 1h")
+
+    check(c.Security.EncryptionKey != "", "security.encryption_key", "is required")
+    check(len(c.Security.JWTSecret) >= minJWTSecretLength, "security.jwt_secret", "must be at least %d characters", minJWTSecretLength)
+    check(!isPlaceholder(c.Security.JWTSecret.Value()), "security.jwt_secret", "is an example value; generate a random secret")
+    check(c.Security.JWTExpiry > 0, "security.jwt_expiry", "must be positive")
+    check(c.Security.MFAKey == "" || len(c.Security.MFAKey) >= minJWTSecretLength, "security.mfa_key", "must be at least %d characters", minJWTSecretLength)
+    check(!isPlaceholder(c.Security.MFAKey.Value()), "security.mfa_key", "is an example value; generate a random key")
+    check(c.Security.MFAIssuer != "" && !strings.Contains(c.Security.MFAIssuer, ":"), "security.mfa_issuer", "must be set and not contain ':'")
+
+    check(c.Accounts.DefaultPlan != "", "accounts.default_plan", "is required")
+    for _, email := range c.Accounts.AdminEmails {
+        check(strings.Contains(email, "@"), "accounts.admin_emails", "has an invalid email %q", email)
+    }
+    check(isBaseURL(c.Accounts.AppURL, true), "accounts.app_url", "must be an http or https URL")
+    check(c.Accounts.VerificationTTL >= time.Minute, "accounts.verification_ttl", "must be at least 1m")
+    check(c.Accounts.PasswordResetTTL >= time.Minute, "accounts.password_reset_ttl", "must be at least 1m")
+
+    check(c.Mail.Driver == "log" || c.Mail.Driver == "smtp", "mail.driver", "must be log or smtp")
+    _, fromErr := mail.ParseAddress(c.Mail.From)
+    check(fromErr == nil, "mail.from", "must be an email address")
+    if c.Mail.Driver == "smtp" {
+        check(c.Mail.SMTPHost != "", "mail.smtp_host", "is required with the smtp driver")
+        check(c.Mail.SMTPPort > 0 && c.Mail.SMTPPort < 65536, "mail.smtp_port", "must be a port number")
+        check(c.Mail.SMTPTLS == "starttls" || c.Mail.SMTPTLS == "tls" || c.Mail.SMTPTLS == "none", "mail.smtp_tls", "must be starttls, tls or none")
+        check(c.Mail.SMTPUsername == "" || c.Mail.SMTPTLS != "none", "mail.smtp_tls", "must not be none when authenticating")
+    }
+
+    if c.OIDC.Enabled() {
+        check(isBaseURL(c.OIDC.Issuer, true), "oidc.issuer", "must be an http or https URL")
+        check(c.OIDC.ClientID != "", "oidc.client_id", "is required with oidc.issuer")
+        check(c.OIDC.RedirectURL != "" || c.Server.PublicURL != "", "oidc.redirect_url", "is required without server.public_url")
+        check(c.OIDC.RedirectURL == "" || isBaseURL(c.OIDC.RedirectURL, true), "oidc.redirect_url", "must be an http or https URL")
+        check(slices.Contains(c.OIDC.Scopes, "openid"), "oidc.scopes", "must include openid")
+    }
+
+    check(c.Uploads.MaxFileSize > 0, "uploads.max_file_size", "must be positive")
+    check(c.Uploads.MaxChunks > 0, "uploads.max_chunks", "must be positive")
+    check(c.Uploads.MinChunkSize > 0, "uploads.min_chunk_size", "must be positive")
+    check(c.Uploads.MaxChunkSize >= c.Uploads.MinChunkSize, "uploads.max_chunk_size", "must not be below uploads.min_chunk_size")
+    check(c.Uploads.TusExpiry > 0, "uploads.tus_expiry", "must be positive")
+    check(c.Uploads.MultipartExpiry > 0, "uploads.multipart_expiry", "must be positive")
+    check(c.Uploads.ArchiveMaxSize > 0, "uploads.archive_max_size", "must be positive")
+    check(c.Uploads.ExtractMaxEntries > 0, "uploads.extract_max_entries", "must be positive")
+    check(c.Uploads.ExtractMaxSize > 0, "uploads.extract_max_size", "must be positive")
+    check(c.Uploads.ExtractMaxRatio >= 1, "uploads.extract_max_ratio", "must be at least 1")
+
+    check(c.Jobs.Workers > 0, "jobs.workers", "must be positive")
+    check(c.Jobs.MaxAttempts > 0, "jobs.max_attempts", "must be positive")
+    check(c.Jobs.PollInterval > 0, "jobs.poll_interval", "must be positive")
+    check(c.Jobs.LeaseDuration >= time.Second, "jobs.lease_duration", "must be at least 1s")
+
+    check(c.RateLimits.Store == "memory" || c.RateLimits.Store == "mongo", "rate_limits.store", "must be memory or mongo")
+    for _, limit := range []struct {
+        key  string
+        rate Rate
+    }{
+        {"rate_limits.login", c.RateLimits.Login},
+        {"rate_limits.register", c.RateLimits.Register},
+        {"rate_limits.upload_init", c.RateLimits.UploadInit},
+        {"rate_limits.presign", c.RateLimits.Presign},
+        {"rate_limits.email", c.RateLimits.Email},
+    } {
+        check(limit.rate.Limit == 0 || limit.rate.Period/time.Duration(limit.rate.Limit) >= time.Millisecond,
+            limit.key, "must not allow more than one request per millisecond")
+    }
+    return problems
+}
+
+// isBaseURL reports whether raw is an absolute http or https URL without
+// query or fragment, and with withPath also without a path.
+// isPlaceholder reports whether secret looks like an example value.
+func isPlaceholder(secret string) bool {
+    lower := strings.ToLower(secret)
+    for _, marker := range placeholderMarkers {
+        if strings.Contains(lower, marker) {
+            return true
+        }
+    }
+    return false
+}
+
+func isBaseURL(raw string, withPath bool) bool {
+    u, err := url.Parse(raw)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+        return false
+    }
+    if u.RawQuery != "" || u.Fragment != "" {
+        return false
+    }
+    return withPath || u.Path == "" || u.Path == "/"
+}
+
+func isAddrOrCIDR(raw string) bool {
+    if _, _, err := net.ParseCIDR(raw); err == nil {
+        return true
+    }
+    return net.ParseIP(raw) != nil
+}
+
+// isOriginPattern reports whether raw is "*" or an origin whose host may
+// start with a "*." label.
+func isOriginPattern(raw string) bool {
+    if raw == "*" {
+        return true
+    }
+    scheme, host, ok := strings.Cut(raw, "://")
+    if !ok || scheme == "" || host == "" || strings.ContainsAny(host, "/?#@") {
+        return false
+    }
+    host = strings.TrimPrefix(host, "*.")
+    return !strings.Contains(host, "*") && host != "" && !strings.HasPrefix(host, ".")
+}
+
+// readable reports whether path is empty or names a file that can be
+// opened.
+func readable(path string) bool {
+    if path == "" {
+        return true
+    }
+    f, err := os.Open(path)
+    if err != nil {
+        return false
+    }
+    f.Close()
+    return true
+}
+
+// String renders the configuration as a YAML config file with secrets
+// redacted and passwords removed from URLs, so it can be printed or logged.
+func (c *Config) String() string {
+    var b strings.Builder
+    section := ""
+    for _, s := range c.settings() {
+        prefix, name, _ := strings.Cut(s.key, ".")
+        if prefix != section {
+            section = prefix
+            fmt.Fprintf(&b, "%s:\n", section)
+        }
+        fmt.Fprintf(&b, "  %s: %s\n", name, format(s.value))
+    }
+    return b.String()
+}
+
+// readFile flattens a YAML or TOML file into "section.name" keys.
+func readFile(path string) (map[string]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    doc := map[string]interface{}{}
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".yaml", ".yml":
+        err = yaml.Unmarshal(data, &doc)
+    case ".toml":
+        err = toml.Unmarshal(data, &doc)
+    default:
+        return nil, fmt.Errorf("unsupported format; use .yaml, .yml or .toml")
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    values := map[string]string{}
+    var flatten func(prefix string, node map[string]interface{})
+    flatten = func(prefix string, node map[string]interface{}) {
+        for key, value := range node {
+            switch v := value.(type) {
+            case map[string]interface{}:
+                flatten(prefix+key+".", v)
+            case []interface{}:
+                items := make([]string, len(v))
+                for i, item := range v {
+                    items[i] = fmt.Sprint(item)
+                }
+                values[prefix+key] = strings.Join(items, ",")
+            case nil:
+            default:
+                values[prefix+key] = fmt.Sprint(v)
+            }
+        }
+    }
+    flatten("", doc)
+    return values, nil
+}
+
+// set parses raw into the setting value points to.
+func set(value interface{}, raw string) error {
+    raw = strings.TrimSpace(raw)
+    switch v := value.(type) {
+    case *string:
+        *v = raw
+    case *Secret:
+        *v = Secret(raw)
+    case *int:
+        n, err := strconv.Atoi(raw)
+        if err != nil {
+            return fmt.Errorf("expected an integer, got %q", raw)
+        }
+        *v = n
+    case *int64:
+        n, err := strconv.ParseInt(raw, 10, 64)
+        if err != nil {
+            return fmt.Errorf("expected an integer, got %q", raw)
+        }
+        *v = n
+    case *float64:
+        f, err := strconv.ParseFloat(raw, 64)
+        if err != nil {
+            return fmt.Errorf("expected a number, got %q", raw)
+        }
+        *v = f
+    case *bool:
+        b, err := strconv.ParseBool(raw)
+        if err != nil {
+            return fmt.Errorf("expected true or false, got %q", raw)
+        }
+        *v = b
+    case *time.Duration:
+        d, err := time.ParseDuration(raw)
+        if err != nil {
+            return fmt.Errorf("expected a duration such as 30s or 5m, got %q", raw)
+        }
+        *v = d
+    case *Rate:
+        if raw == "off" || raw == "0" {
+            *v = Rate{}
+            return nil
+        }
+        limit, period, ok := strings.Cut(raw, "/")
+        n, err := strconv.Atoi(limit)
+        d, perr := time.ParseDuration(period)
+        if !ok || err != nil || perr != nil || n <= 0 || d <= 0 {
+            return fmt.Errorf("expected requests per period such as 10/1m, or off, got %q", raw)
+        }
+        *v = Rate{Limit: n, Period: d}
+    case *[]string:
+        *v = nil
+        for _, item := range strings.Split(raw, ",") {
+            if item = strings.TrimSpace(item); item != "" {
+                *v = append(*v, item)
+            }
+        }
+    default:
+        return fmt.Errorf("unsupported setting type %T", value)
+    }
+    return nil
+}
+
+func format(value interface{}) string {
+    switch v := value.(type) {
+    case *string:
+        return strconv.Quote(RedactURL(*v))
+    case *Secret:
+        return strconv.Quote(v.String())
+    case *int:
+        return strconv.Itoa(*v)
+    case *int64:
+        return strconv.FormatInt(*v, 10)
+    case *float64:
+        return strconv.FormatFloat(*v, 'g', -1, 64)
+    case *bool:
+        return strconv.FormatBool(*v)
+    case *time.Duration:
+        return strconv.Quote(v.String())
+    case *Rate:
+        return strconv.Quote(v.String())
+    case *[]string:
+        items := make([]string, len(*v))
+        for i, item := range *v {
+            items[i] = strconv.Quote(item)
+        }
+        return "[" + strings.Join(items, ", ") + "]"
+    }
+    return fmt.Sprint(value)
+}
+
+// RedactURL replaces the password of a URL such as a MongoDB connection
+// string. Anything that isn't a URL with a password is returned as is.
+func RedactURL(raw string) string {
+    u, err := url.Parse(raw)
+    if err != nil || u.User == nil {
+        return raw
+    }
+    if _, ok := u.User.Password(); !ok {
+        return raw
+    }
+    u.User = url.UserPassword(u.User.Username(), "redacted")
+    return u.String()
+}
@@ -0,0 +1,309 @@
+package config
+
+import (
+    "fmt"
+    "strings"
+    "time"
+)
+
+// Config is the complete server configuration. Load fills it from, in
+// increasing precedence, Defaults, a YAML or TOML file, the environment and
+// command-line flags.
+type Config struct {
+    Server     ServerConfig
+    Mongo      MongoConfig
+    MinIO      MinIOConfig
+    Security   SecurityConfig
+    CORS       CORSConfig
+    Login      LoginConfig
+    Accounts   AccountsConfig
+    Mail       MailConfig
+    OIDC       OIDCConfig
+    Uploads    UploadsConfig
+    Jobs       JobsConfig
+    RateLimits RateLimitsConfig
+}
+
+type ServerConfig struct {
+    Port int
+    // S3Port serves the S3-compatible gateway; 0 disables it
+    S3Port   int
+    S3Region string
+    // TLSCert and TLSKey enable HTTPS on both ports. The files are re-read
+    // on SIGHUP.
+    TLSCert string
+    TLSKey  string
+    // TLSClientCA, when set, makes admin routes require a client
+    // certificate issued by one of its CAs
+    TLSClientCA string
+    // HTTPRedirectPort serves plain HTTP redirecting to HTTPS; 0 disables it
+    HTTPRedirectPort int
+    // PublicURL is the base URL clients reach the API at, used in links the
+    // server hands out. Empty means the scheme and host of each request.
+    PublicURL string
+    // TrustedProxies are the addresses and CIDRs whose Forwarded,
+    // X-Forwarded-* and X-Real-IP headers are believed
+    TrustedProxies []string
+}
+
+// TLSEnabled reports whether the server terminates TLS itself.
+func (s ServerConfig) TLSEnabled() bool {
+    return s.TLSCert != ""
+}
+
+type MongoConfig struct {
+    URI      string
+    Database string
+}
+
+type MinIOConfig struct {
+    Endpoint  string
+    AccessKey string
+    SecretKey Secret
+    Bucket    string
+    UseSSL    bool
+    // CAFile is a PEM bundle trusted for MinIO's certificate in addition to
+    // the system roots
+    CAFile string
+    // PublicURL is where clients reach MinIO, e.g. through a reverse proxy.
+    // Presigned URLs are signed for it; empty means Endpoint.
+    PublicURL string
+}
+
+type SecurityConfig struct {
+    // EncryptionKey is shared with clients to seal login and register
+    // payloads
+    EncryptionKey Secret
+    JWTSecret     Secret
+    JWTExpiry     time.Duration
+    // MFAKey seals TOTP secrets in the database. Empty derives it from
+    // JWTSecret, so changing that secret then disables every authenticator.
+    MFAKey Secret
+    // MFAIssuer names the service in authenticator apps
+    MFAIssuer string
+}
+
+type CORSConfig struct {
+    // AllowedOrigins are origins such as https://app.example.com. A "*"
+    // label matches any subdomain (https://*.example.com); "*" alone
+    // allows every origin, but without credentials.
+    AllowedOrigins []string
+    AllowedMethods []string
+    AllowedHeaders []string
+}
+
+// LoginConfig tunes brute-force protection of sign-in. Failures are
+// counted per client IP and per email.
+type LoginConfig struct {
+    // FreeAttempts failures per email cost nothing; each further one
+    // doubles the wait before the next attempt, from BaseDelay to MaxDelay
+    FreeAttempts   int
+    IPFreeAttempts int
+    BaseDelay      time.Duration
+    MaxDelay       time.Duration
+    // FailureWindow without a new failure resets the counters
+    FailureWindow time.Duration
+    // CaptchaAfter failures an email needs a CAPTCHA instead of waiting,
+    // when CaptchaVerifyURL is set; 0 disables it
+    CaptchaAfter     int
+    CaptchaVerifyURL string
+    CaptchaSiteKey   string
+    CaptchaSecret    Secret
+    AuditRetention   time.Duration
+}
+
+type AccountsConfig struct {
+    DefaultPlan string
+    // AdminEmails are promoted to admin at startup
+    AdminEmails []string
+    // AppURL is the web app that links in emails open, at
+    // /verify-email?token= and /reset-password?token=
+    AppURL           string
+    VerificationTTL  time.Duration
+    PasswordResetTTL time.Duration
+}
+
+// MailConfig selects how account emails are sent.
+type MailConfig struct {
+    // Driver is "smtp", or "log" to write messages to Dir, or to the log
+    // when Dir is empty, for local development
+    Driver       string
+    From         string
+    Dir          string
+    SMTPHost     string
+    SMTPPort     int
+    SMTPUsername string
+    SMTPPassword Secret
+    // SMTPTLS is "starttls", "tls" (implicit TLS, usually port 465) or
+    // "none"
+    SMTPTLS string
+}
+
+// OIDCConfig enables single sign-on with an OpenID Connect provider.
+type OIDCConfig struct {
+    // Issuer is the provider's issuer URL; empty disables single sign-on
+    Issuer       string
+    ClientID     string
+    ClientSecret Secret
+    // RedirectURL is the callback registered with the provider. Empty
+    // means /api/auth/oidc/callback under Server.PublicURL.
+    RedirectURL string
+    Scopes      []string
+    // AutoProvision creates accounts for unknown identities
+    AutoProvision bool
+}
+
+// Enabled reports whether single sign-on is configured.
+func (o OIDCConfig) Enabled() bool {
+    return o.Issuer != ""
+}
+
+type UploadsConfig struct {
+    MaxFileSize       int64
+    MaxChunks         int
+    MinChunkSize      int64
+    MaxChunkSize      int64
+    TusExpiry         time.Duration
+    MultipartExpiry   time.Duration
+    ArchiveMaxSize    int64
+    ExtractMaxEntries int
+    ExtractMaxSize    int64
+    ExtractMaxRatio   float64
+}
+
+type JobsConfig struct {
+    Workers       int
+    MaxAttempts   int
+    PollInterval  time.Duration
+    LeaseDuration time.Duration
+}
+
+type RateLimitsConfig struct {
+    // Store is "memory", or "mongo" to share limits between instances
+    Store string
+    // Login and Register are per client IP; UploadInit, Presign and Email
+    // are per account when authenticated
+    Login      Rate
+    Register   Rate
+    UploadInit Rate
+    Presign    Rate
+    // Email limits requests that send verification and reset emails
+    Email Rate
+}
+
+// Rate allows Limit requests per Period, written as "10/1m". A zero Limit
+// ("off") disables the limit.
+type Rate struct {
+    Limit  int
+    Period time.Duration
+}
+
+func (r Rate) String() string {
+    if r.Limit == 0 {
+        return "off"
+    }
+    period := r.Period.String()
+    if strings.HasSuffix(period, "m0s") {
+        period = strings.TrimSuffix(period, "0s")
+    }
+    if strings.HasSuffix(period, "h0m") {
+        period = strings.TrimSuffix(period, "0m")
+    }
+    return fmt.Sprintf("%d/%s", r.Limit, period)
+}
+
+// Defaults returns the configuration used for everything that isn't set.
+// Connection settings and secrets have no defaults.
+func Defaults() Config {
+    return Config{
+        Server: ServerConfig{Port: 8080, S3Region: "us-east-1"},
+        Mongo:  MongoConfig{Database: "Storely"},
+        Security: SecurityConfig{
+            JWTExpiry: 24 * time.Hour,
+            MFAIssuer: "Storely",
+        },
+        CORS: CORSConfig{
+            AllowedOrigins: []string{"http://localhost:3000"},
+            AllowedMethods: []string{"POST", "GET", "OPTIONS", "PUT", "DELETE", "HEAD", "PATCH"},
+            AllowedHeaders: []string{
+                "Accept", "Content-Type", "Content-Length", "Accept-Encoding", "Authorization", "X-Requested-With",
+                "X-Content-Encrypted", "X-Request-ID", "Tus-Resumable", "Upload-Length", "Upload-Metadata",
+                "Upload-Offset", "Upload-Checksum", "Upload-Defer-Length",
+            },
+        },
+        Login: LoginConfig{
+            FreeAttempts:   3,
+            IPFreeAttempts: 20,
+            BaseDelay:      time.Second,
+            MaxDelay:       15 * time.Minute,
+            FailureWindow:  time.Hour,
+            CaptchaAfter:   5,
+            AuditRetention: 90 * 24 * time.Hour,
+        },
+        Accounts: AccountsConfig{
+            DefaultPlan:      "free",
+            AppURL:           "http://localhost:3000",
+            VerificationTTL:  48 * time.Hour,
+            PasswordResetTTL: time.Hour,
+        },
+        Mail: MailConfig{
+            Driver:   "log",
+            From:     "Storely <no-reply@localhost>",
+            SMTPPort: 587,
+            SMTPTLS:  "starttls",
+        },
+        OIDC: OIDCConfig{
+            Scopes:        []string{"openid", "email", "profile"},
+            AutoProvision: true,
+        },
+        Uploads: UploadsConfig{
+            MaxFileSize:       10 * 1024 * 1024 * 1024,
+            MaxChunks:         10000,
+            MinChunkSize:      256 * 1024,
+            MaxChunkSize:      64 * 1024 * 1024,
+            TusExpiry:         24 * time.Hour,
+            MultipartExpiry:   7 * 24 * time.Hour,
+            ArchiveMaxSize:    4 * 1024 * 1024 * 1024,
+            ExtractMaxEntries: 10000,
+            ExtractMaxSize:    10 * 1024 * 1024 * 1024,
+            ExtractMaxRatio:   100,
+        },
+        Jobs: JobsConfig{
+            Workers:       4,
+            MaxAttempts:   5,
+            PollInterval:  2 * time.Second,
+            LeaseDuration: 5 * time.Minute,
+        },
+        RateLimits: RateLimitsConfig{
+            Store:      "memory",
+            Login:      Rate{Limit: 10, Period: time.Minute},
+            Register:   Rate{Limit: 5, Period: time.Hour},
+            UploadInit: Rate{Limit: 60, Period: time.Minute},
+            Presign:    Rate{Limit: 120, Period: time.Minute},
+            Email:      Rate{Limit: 5, Period: time.Hour},
+        },
+    }
+}
+
+// Secret is a configuration value that must not end up in logs. It prints
+// as "[redacted]"; Value returns the real value.
+type Secret string
+
+func (s Secret) Value() string {
+    return string(s)
+}
+
+func (s Secret) String() string {
+    if s == "" {
+        return ""
+    }
+    return "[redacted]"
+}
+
+func (s Secret) GoString() string {
+    return `"` + s.String() + `"`
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+    return []byte(s.String()), nil
+}
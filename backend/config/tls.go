@@ -0,0 +1,103 @@
+package config
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "net/http"
+    "os"
+    "sync"
+
+    "github.com/minio/minio-go/v7"
+)
+
+// CertReloader serves a certificate and key pair read from disk. Reload
+// re-reads the files, so renewed certificates are picked up without a
+// restart; handshakes in progress keep the pair they started with.
+type CertReloader struct {
+    certFile string
+    keyFile  string
+
+    mu   sync.RWMutex
+    cert *tls.Certificate
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+    r := &CertReloader{certFile: certFile, keyFile: keyFile}
+    if err := r.Reload(); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+// Reload reads the pair again. On error the previous pair stays in use.
+func (r *CertReloader) Reload() error {
+    cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+    if err != nil {
+        return fmt.Errorf("failed to load TLS certificate: %w", err)
+    }
+    r.mu.Lock()
+    r.cert = &cert
+    r.mu.Unlock()
+    return nil
+}
+
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    return r.cert, nil
+}
+
+// ServerTLS returns the TLS configuration of a server presenting certs.
+// With clientCAs, clients may present a certificate, which is verified
+// against them; whether one is required is up to the routes.
+func ServerTLS(certs *CertReloader, clientCAs *x509.CertPool) *tls.Config {
+    cfg := &tls.Config{
+        MinVersion:     tls.VersionTLS12,
+        GetCertificate: certs.GetCertificate,
+    }
+    if clientCAs != nil {
+        cfg.ClientCAs = clientCAs
+        cfg.ClientAuth = tls.VerifyClientCertIfGiven
+    }
+    return cfg
+}
+
+// LoadCAPool reads a PEM bundle into a new pool. With system set, the pool
+// starts from the system roots.
+func LoadCAPool(path string, system bool) (*x509.CertPool, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+    }
+    pool := x509.NewCertPool()
+    if system {
+        if pool, err = x509.SystemCertPool(); err != nil {
+            return nil, fmt.Errorf("failed to load system CA pool: %w", err)
+        }
+    }
+    if !pool.AppendCertsFromPEM(data) {
+        return nil, fmt.Errorf("no certificates found in %s", path)
+    }
+    return pool, nil
+}
+
+// minioTransport is minio's default transport, trusting cfg.CAFile when
+// set.
+func minioTransport(cfg MinIOConfig) (http.RoundTripper, error) {
+    transport, err := minio.DefaultTransport(cfg.UseSSL)
+    if err != nil {
+        return nil, err
+    }
+    if cfg.CAFile != "" {
+        pool, err := LoadCAPool(cfg.CAFile, true)
+        if err != nil {
+            return nil, err
+        }
+        if transport.TLSClientConfig == nil {
+            transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+        }
+        transport.TLSClientConfig.RootCAs = pool
+    }
+    return transport, nil
+}
@@ -0,0 +1,196 @@
+// Package apperr defines the error type returned by every API endpoint.
+//
+// Handlers and middleware write errors with Write, which produces:
+//
+//	{"error": "human readable message", "code": "QUOTA_EXCEEDED",
+//	 "requestId": "...", "details": {...}}
+//
+// Services and repositories return the sentinel values declared in their
+// own packages (built with New) or wrap them with fmt.Errorf("...: %w"), so
+// callers match them with errors.Is instead of comparing strings.
+package apperr
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+)
+
+// Code is a stable, machine-readable error identifier.
+type Code string
+
+const (
+    CodeBadRequest         Code = "BAD_REQUEST"
+    CodeValidationFailed   Code = "VALIDATION_FAILED"
+    CodeUnauthorized       Code = "UNAUTHORIZED"
+    CodeInvalidToken       Code = "INVALID_TOKEN"
+    CodeForbidden          Code = "FORBIDDEN"
+    CodeNotFound           Code = "NOT_FOUND"
+    CodeFileNotFound       Code = "FILE_NOT_FOUND"
+    CodeUserNotFound       Code = "USER_NOT_FOUND"
+    CodeJobNotFound        Code = "JOB_NOT_FOUND"
+    CodeAccessKeyNotFound  Code = "ACCESS_KEY_NOT_FOUND"
+    CodePlanNotFound       Code = "PLAN_NOT_FOUND"
+    CodeConflict           Code = "CONFLICT"
+    CodeEmailTaken         Code = "EMAIL_ALREADY_REGISTERED"
+    CodeUsernameTaken      Code = "USERNAME_TAKEN"
+    CodeInvalidCredentials Code = "INVALID_CREDENTIALS"
+    CodeAccountLocked      Code = "ACCOUNT_LOCKED"
+    CodeAccountDisabled    Code = "ACCOUNT_DISABLED"
+    CodeLoginThrottled     Code = "LOGIN_THROTTLED"
+    CodeCaptchaRequired    Code = "CAPTCHA_REQUIRED"
+    CodeMFARequired        Code = "MFA_REQUIRED"
+    CodeInvalidMFACode     Code = "INVALID_MFA_CODE"
+    CodeInvalidEmailToken  Code = "INVALID_EMAIL_TOKEN"
+    CodeEmailNotVerified   Code = "EMAIL_NOT_VERIFIED"
+    CodeSSOFailed          Code = "SSO_FAILED"
+    CodeReauthRequired     Code = "REAUTH_REQUIRED"
+    CodeQuotaExceeded      Code = "QUOTA_EXCEEDED"
+    CodePlanLimitExceeded  Code = "PLAN_LIMIT_EXCEEDED"
+    CodeFileTooLarge       Code = "FILE_TOO_LARGE"
+    CodeMissingChunks      Code = "MISSING_CHUNKS"
+    CodeChecksumMismatch   Code = "CHECKSUM_MISMATCH"
+    CodeUploadExpired      Code = "UPLOAD_EXPIRED"
+    CodeUploadLocked       Code = "UPLOAD_LOCKED"
+    CodeRateLimited        Code = "RATE_LIMITED"
+    CodeStorageError       Code = "STORAGE_ERROR"
+    CodeInternal           Code = "INTERNAL_ERROR"
+)
+
+// Error is an API error with an HTTP status, a code and optional details.
+type Error struct {
+    Status  int
+    Code    Code
+    Message string
+    Details map[string]interface{}
+    cause   error
+    base    *Error
+}
+
+// New creates an error. Package-level values created with New serve as
+// sentinels for errors.Is.
+func New(status int, code Code, message string) *Error {
+    return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+    if e.cause != nil {
+        return fmt.Sprintf("%s: %v", e.Message, e.cause)
+    }
+    return e.Message
+}
+
+func (e *Error) Unwrap() error {
+    return e.cause
+}
+
+// Is matches copies made by WithDetails, WithMessage and Wrap against the
+// sentinel they were derived from.
+func (e *Error) Is(target error) bool {
+    t, ok := target.(*Error)
+    if !ok {
+        return false
+    }
+    return e == t || (e.base != nil && e.base == t)
+}
+
+func (e *Error) derive() *Error {
+    c := *e
+    if e.base == nil {
+        c.base = e
+    }
+    return &c
+}
+
+// WithDetails returns a copy of e carrying details.
+func (e *Error) WithDetails(details map[string]interface{}) *Error {
+    c := e.derive()
+    c.Details = details
+    return c
+}
+
+// WithMessage returns a copy of e with a more specific message.
+func (e *Error) WithMessage(format string, args ...interface{}) *Error {
+    c := e.derive()
+    c.Message = fmt.Sprintf(format, args...)
+    return c
+}
+
+// Wrap returns a copy of e that records cause. The cause is logged but never
+// sent to the client.
+func (e *Error) Wrap(cause error) *Error {
+    c := e.derive()
+    c.cause = cause
+    return c
+}
+
+// Generic errors for cases without a more specific sentinel.
+var (
+    ErrBadRequest   = New(http.StatusBadRequest, CodeBadRequest, "Invalid request")
+    ErrValidation   = New(http.StatusBadRequest, CodeValidationFailed, "Validation failed")
+    ErrUnauthorized = New(http.StatusUnauthorized, CodeUnauthorized, "Authorization header missing")
+    ErrInvalidToken = New(http.StatusUnauthorized, CodeInvalidToken, "Invalid token")
+    ErrForbidden    = New(http.StatusForbidden, CodeForbidden, "Forbidden")
+    ErrNotFound     = New(http.StatusNotFound, CodeNotFound, "Not found")
+    ErrConflict     = New(http.StatusConflict, CodeConflict, "Conflict")
+    ErrRateLimited  = New(http.StatusTooManyRequests, CodeRateLimited, "Too many requests")
+    ErrStorage      = New(http.StatusInternalServerError, CodeStorageError, "Object storage error")
+    ErrInternal     = New(http.StatusInternalServerError, CodeInternal, "Internal server error")
+)
+
+// BadRequest is shorthand for ErrBadRequest with a specific message.
+func BadRequest(format string, args ...interface{}) *Error {
+    return ErrBadRequest.WithMessage(format, args...)
+}
+
+// From returns the *Error in err's chain, or ErrInternal wrapping err.
+func From(err error) *Error {
+    var appErr *Error
+    if errors.As(err, &appErr) {
+        return appErr
+    }
+    return ErrInternal.Wrap(err)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID stores the request ID used in error responses.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+    return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID stored in ctx, if any.
+func RequestID(ctx context.Context) string {
+    id, _ := ctx.Value(requestIDKey{}).(string)
+    return id
+}
+
+type body struct {
+    Error     string                 `json:"error"`
+    Code      Code                   `json:"code"`
+    RequestID string                 `json:"requestId,omitempty"`
+    Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Write sends err as a JSON error response. Errors that aren't *Error are
+// reported as INTERNAL_ERROR without exposing their text.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+    appErr := From(err)
+    requestID := RequestID(r.Context())
+
+    if appErr.Status >= http.StatusInternalServerError {
+        log.Printf("[%s] %s %s: %v", requestID, r.Method, r.URL.Path, err)
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(appErr.Status)
+    json.NewEncoder(w).Encode(body{
+        Error:     appErr.Message,
+        Code:      appErr.Code,
+        RequestID: requestID,
+        Details:   appErr.Details,
+    })
+}
@@ -0,0 +1,299 @@
+package dav
+
+import (
+    "context"
+    "errors"
+    "io"
+    "io/fs"
+    "log"
+    "mime"
+    "os"
+    "path"
+    "syscall"
+    "time"
+
+    "backend/internal/models"
+    "backend/internal/service"
+
+    "golang.org/x/net/webdav"
+)
+
+// fileInfo describes a file (file set) or a directory.
+type fileInfo struct {
+    name    string
+    dir     bool
+    file    *models.FileMinIO
+    size    int64
+    modTime time.Time
+}
+
+func (fi *fileInfo) Name() string     { return fi.name }
+func (fi *fileInfo) IsDir() bool      { return fi.dir }
+func (fi *fileInfo) Sys() interface{} { return nil }
+
+func (fi *fileInfo) Size() int64 {
+    if fi.file != nil {
+        return int64(fi.file.Size)
+    }
+    return fi.size
+}
+
+func (fi *fileInfo) Mode() fs.FileMode {
+    if fi.dir {
+        return fs.ModeDir | 0755
+    }
+    return 0644
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+    if fi.file != nil {
+        return fi.file.CreatedAt
+    }
+    return fi.modTime
+}
+
+// ContentType implements webdav.ContentTyper with the type recorded at
+// upload, so listings don't have to read the content to sniff it.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+    if fi.file == nil || fi.file.FileType == "" {
+        return "", webdav.ErrNotImplemented
+    }
+    return fi.file.FileType, nil
+}
+
+// ETag implements webdav.ETager with the same entity tag the S3 gateway
+// reports.
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+    if fi.file == nil || fi.file.ETag == "" {
+        return "", webdav.ErrNotImplemented
+    }
+    return `"` + fi.file.ETag + `"`, nil
+}
+
+var errReadOnly = errors.New("file is open for reading")
+
+// readFile streams a stored file. A Seek only moves the offset; the next
+// Read opens the chunks from there, which is how ranged GETs are served.
+type readFile struct {
+    fs     *fileSystem
+    ctx    context.Context
+    info   *fileInfo
+    offset int64
+    body   io.ReadCloser
+}
+
+func (f *readFile) Read(p []byte) (int, error) {
+    size := f.info.Size()
+    if f.offset >= size {
+        return 0, io.EOF
+    }
+    if f.body == nil {
+        body, err := f.fs.store.Open(f.ctx, f.info.file, f.offset, size-f.offset)
+        if err != nil {
+            return 0, err
+        }
+        f.body = body
+    }
+    n, err := f.body.Read(p)
+    f.offset += int64(n)
+    return n, err
+}
+
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+    switch whence {
+    case io.SeekCurrent:
+        offset += f.offset
+    case io.SeekEnd:
+        offset += f.info.Size()
+    }
+    if offset < 0 {
+        return 0, &os.PathError{Op: "seek", Path: f.info.name, Err: syscall.EINVAL}
+    }
+    if offset != f.offset && f.body != nil {
+        f.body.Close()
+        f.body = nil
+    }
+    f.offset = offset
+    return offset, nil
+}
+
+func (f *readFile) Readdir(count int) ([]fs.FileInfo, error) {
+    return nil, &os.PathError{Op: "readdir", Path: f.info.name, Err: syscall.ENOTDIR}
+}
+
+func (f *readFile) Stat() (fs.FileInfo, error)  { return f.info, nil }
+func (f *readFile) Write(p []byte) (int, error) { return 0, errReadOnly }
+
+func (f *readFile) Close() error {
+    if f.body != nil {
+        return f.body.Close()
+    }
+    return nil
+}
+
+// dirFile lists a directory.
+type dirFile struct {
+    fs       *fileSystem
+    ctx      context.Context
+    path     string
+    info     *fileInfo
+    children []fs.FileInfo
+    listed   bool
+}
+
+func (f *dirFile) Readdir(count int) ([]fs.FileInfo, error) {
+    if !f.listed {
+        children, err := f.fs.readdir(f.ctx, f.path)
+        if err != nil {
+            return nil, err
+        }
+        f.children, f.listed = children, true
+    }
+    if count <= 0 {
+        children := f.children
+        f.children = nil
+        return children, nil
+    }
+    if len(f.children) == 0 {
+        return nil, io.EOF
+    }
+    if count > len(f.children) {
+        count = len(f.children)
+    }
+    children := f.children[:count]
+    f.children = f.children[count:]
+    return children, nil
+}
+
+func (f *dirFile) Read(p []byte) (int, error) {
+    return 0, &os.PathError{Op: "read", Path: f.info.name, Err: syscall.EISDIR}
+}
+
+func (f *dirFile) Write(p []byte) (int, error) {
+    return 0, &os.PathError{Op: "write", Path: f.info.name, Err: syscall.EISDIR}
+}
+
+func (f *dirFile) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+func (f *dirFile) Stat() (fs.FileInfo, error)                  { return f.info, nil }
+func (f *dirFile) Close() error                                 { return nil }
+
+// writeFile stores what is written to it as a new version of a path when
+// closed. With a known size (a PUT with Content-Length) the content is
+// streamed straight into the chunk storage; otherwise it is spooled to a
+// temporary file first, because the chunk layout needs the size upfront.
+type writeFile struct {
+    fs      *fileSystem
+    ctx     context.Context
+    folder  string
+    info    *fileInfo
+    written int64
+
+    // Streaming
+    pipe *io.PipeWriter
+    done chan error
+
+    // Spooling
+    spool *os.File
+}
+
+func newWriteFile(ctx context.Context, fsys *fileSystem, folder, name string, size int64) (*writeFile, error) {
+    f := &writeFile{
+        fs:     fsys,
+        ctx:    ctx,
+        folder: folder,
+        info:   &fileInfo{name: name, modTime: time.Now()},
+    }
+    if size < 0 {
+        spool, err := os.CreateTemp("", "storely-dav-*")
+        if err != nil {
+            return nil, err
+        }
+        f.spool = spool
+        return f, nil
+    }
+
+    reader, writer := io.Pipe()
+    f.pipe = writer
+    f.done = make(chan error, 1)
+    go func() {
+        err := f.store(size, reader)
+        reader.CloseWithError(err)
+        f.done <- err
+    }()
+    return f, nil
+}
+
+// store puts the content and fills in the file info, so the ETag the
+// webdav package computes after Close is the stored one.
+func (f *writeFile) store(size int64, body io.Reader) error {
+    file, err := f.fs.store.Replace(f.ctx, f.fs.user, service.PutRequest{
+        Folder:   f.folder,
+        FileName: f.info.name,
+        FileType: contentType(f.info.name),
+        Size:     size,
+        Body:     body,
+    })
+    if file == nil {
+        return f.fs.fail(err)
+    }
+    if err != nil {
+        log.Printf("WebDAV put %s: %v", path.Join(f.folder, f.info.name), err)
+    }
+    f.info.file = file
+    return nil
+}
+
+// contentType guesses a file's type from its extension; WebDAV clients
+// rarely send one.
+func contentType(name string) string {
+    if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+        return t
+    }
+    return "application/octet-stream"
+}
+
+func (f *writeFile) Write(p []byte) (int, error) {
+    var n int
+    var err error
+    if f.pipe != nil {
+        n, err = f.pipe.Write(p)
+    } else {
+        n, err = f.spool.Write(p)
+    }
+    f.written += int64(n)
+    f.info.size = f.written
+    return n, err
+}
+
+func (f *writeFile) Close() error {
+    if f.pipe != nil {
+        // A short body fails the put instead of storing a truncated file
+        if f.written < f.fs.putSize {
+            f.pipe.CloseWithError(io.ErrUnexpectedEOF)
+        } else {
+            f.pipe.Close()
+        }
+        return <-f.done
+    }
+
+    defer os.Remove(f.spool.Name())
+    defer f.spool.Close()
+    if _, err := f.spool.Seek(0, io.SeekStart); err != nil {
+        return err
+    }
+    return f.store(f.written, f.spool)
+}
+
+func (f *writeFile) Read(p []byte) (int, error) {
+    return 0, &os.PathError{Op: "read", Path: f.info.name, Err: syscall.EBADF}
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+    return 0, &os.PathError{Op: "seek", Path: f.info.name, Err: syscall.ESPIPE}
+}
+
+func (f *writeFile) Readdir(count int) ([]fs.FileInfo, error) {
+    return nil, &os.PathError{Op: "readdir", Path: f.info.name, Err: syscall.ENOTDIR}
+}
+
+func (f *writeFile) Stat() (fs.FileInfo, error) { return f.info, nil }
@@ -0,0 +1,280 @@
+package dav
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path"
+    "strings"
+    "syscall"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+    "backend/internal/service"
+
+    "golang.org/x/net/webdav"
+)
+
+// fileSystem is one user's files as a webdav.FileSystem. A path is a file
+// when a file has that folder and name, and a directory when it was
+// created with MKCOL or has files below it.
+type fileSystem struct {
+    store   *service.FileStore
+    folders *repository.FolderRepository
+    user    *models.User
+
+    // putSize is the Content-Length of a PUT, -1 when unknown or for
+    // other methods.
+    putSize int64
+
+    // failure is the first service error of the request; the webdav
+    // package only reports generic statuses.
+    failure error
+}
+
+var _ webdav.FileSystem = (*fileSystem)(nil)
+
+// splitPath turns a webdav name into a Storely path ("" is the root) and
+// its folder and file name.
+func splitPath(name string) (p, folder, base string, err error) {
+    p, ok := service.CleanFolder(name)
+    if !ok {
+        return "", "", "", os.ErrInvalid
+    }
+    folder, base = path.Split(p)
+    return p, strings.TrimSuffix(folder, "/"), base, nil
+}
+
+// fail records err when it is a client error from the services, so the
+// handler can answer with its status.
+func (fs *fileSystem) fail(err error) error {
+    var appErr *apperr.Error
+    if fs.failure == nil && errors.As(err, &appErr) && appErr.Status < 500 {
+        fs.failure = err
+    }
+    return err
+}
+
+func (fs *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+    p, _, _, err := splitPath(name)
+    if err != nil {
+        return nil, err
+    }
+    return fs.stat(ctx, p)
+}
+
+func (fs *fileSystem) stat(ctx context.Context, p string) (*fileInfo, error) {
+    if p == "" {
+        return &fileInfo{name: "/", dir: true}, nil
+    }
+    folder, base := path.Split(p)
+    folder = strings.TrimSuffix(folder, "/")
+
+    file, err := fs.store.Lookup(ctx, fs.user, folder, base)
+    if err == nil {
+        return &fileInfo{name: base, file: file}, nil
+    }
+    if !errors.Is(err, repository.ErrFileNotFound) {
+        return nil, err
+    }
+
+    record, err := fs.folders.Find(ctx, fs.user.UserID, p)
+    if err != nil {
+        return nil, err
+    }
+    if record != nil {
+        return &fileInfo{name: base, dir: true, modTime: record.CreatedAt}, nil
+    }
+    exists, err := fs.store.FolderExists(ctx, fs.user, p)
+    if err != nil {
+        return nil, err
+    }
+    if !exists {
+        return nil, os.ErrNotExist
+    }
+    return &fileInfo{name: base, dir: true}, nil
+}
+
+// requireDir fails with os.ErrNotExist unless p is a directory, which is
+// what the webdav package turns into 409 Conflict for a missing parent.
+func (fs *fileSystem) requireDir(ctx context.Context, p string) error {
+    info, err := fs.stat(ctx, p)
+    if err != nil {
+        return err
+    }
+    if !info.dir {
+        return os.ErrNotExist
+    }
+    return nil
+}
+
+// keepDir records folder so it doesn't disappear when its last file is
+// deleted or moved away.
+func (fs *fileSystem) keepDir(ctx context.Context, folder string) error {
+    if folder == "" {
+        return nil
+    }
+    return fs.folders.Create(ctx, fs.user.UserID, folder)
+}
+
+func (fs *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+    p, folder, _, err := splitPath(name)
+    if err != nil {
+        return err
+    }
+    if _, err := fs.stat(ctx, p); err == nil {
+        return os.ErrExist
+    } else if !os.IsNotExist(err) {
+        return err
+    }
+    if err := fs.requireDir(ctx, folder); err != nil {
+        return err
+    }
+    return fs.folders.Create(ctx, fs.user.UserID, p)
+}
+
+func (fs *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+    p, folder, base, err := splitPath(name)
+    if err != nil {
+        return nil, err
+    }
+
+    if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) == 0 {
+        info, err := fs.stat(ctx, p)
+        if err != nil {
+            return nil, err
+        }
+        if info.dir {
+            return &dirFile{fs: fs, ctx: ctx, path: p, info: info}, nil
+        }
+        return &readFile{fs: fs, ctx: ctx, info: info}, nil
+    }
+
+    // Files are only ever written whole, which is all PUT and COPY need
+    if flag&os.O_TRUNC == 0 || p == "" {
+        return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EPERM}
+    }
+    if err := fs.requireDir(ctx, folder); err != nil {
+        return nil, err
+    }
+    if info, err := fs.stat(ctx, p); err == nil && info.dir {
+        return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+    }
+    return newWriteFile(ctx, fs, folder, base, fs.putSize)
+}
+
+func (fs *fileSystem) RemoveAll(ctx context.Context, name string) error {
+    p, folder, base, err := splitPath(name)
+    if err != nil {
+        return err
+    }
+    if p == "" {
+        return &os.PathError{Op: "remove", Path: name, Err: syscall.EPERM}
+    }
+    info, err := fs.stat(ctx, p)
+    if err != nil {
+        return err
+    }
+
+    if info.dir {
+        if err := fs.store.RemoveTree(ctx, fs.user, p); err != nil {
+            return err
+        }
+        if err := fs.folders.DeleteTree(ctx, fs.user.UserID, p); err != nil {
+            return err
+        }
+    } else if err := fs.store.RemovePath(ctx, fs.user, folder, base); err != nil {
+        return err
+    }
+    return fs.keepDir(ctx, folder)
+}
+
+func (fs *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+    oldPath, oldFolder, oldBase, err := splitPath(oldName)
+    if err != nil {
+        return err
+    }
+    newPath, newFolder, newBase, err := splitPath(newName)
+    if err != nil {
+        return err
+    }
+    if oldPath == "" || newPath == "" || strings.HasPrefix(newPath+"/", oldPath+"/") {
+        return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: syscall.EINVAL}
+    }
+
+    info, err := fs.stat(ctx, oldPath)
+    if err != nil {
+        return err
+    }
+    if err := fs.requireDir(ctx, newFolder); err != nil {
+        return err
+    }
+
+    if info.dir {
+        if err := fs.store.MoveFolder(ctx, fs.user, oldPath, newPath); err != nil {
+            return err
+        }
+        if err := fs.folders.Move(ctx, fs.user.UserID, oldPath, newPath); err != nil {
+            return err
+        }
+        // A directory that only held files has no record of its own
+        if err := fs.keepDir(ctx, newPath); err != nil {
+            return err
+        }
+    } else if err := fs.store.Move(ctx, fs.user, oldFolder, oldBase, newFolder, newBase); err != nil {
+        return err
+    }
+    return fs.keepDir(ctx, oldFolder)
+}
+
+// readdir lists the children of directory p: the current file of every
+// name directly in it, and a directory for every folder below it.
+func (fs *fileSystem) readdir(ctx context.Context, p string) ([]os.FileInfo, error) {
+    files, err := fs.store.ListTree(ctx, fs.user, p)
+    if err != nil {
+        return nil, err
+    }
+    records, err := fs.folders.ListTree(ctx, fs.user.UserID, p)
+    if err != nil {
+        return nil, err
+    }
+
+    var children []os.FileInfo
+    current := map[string]bool{}
+    dirs := map[string]*fileInfo{}
+    addDir := func(folder string, modTime time.Time) {
+        rel := folder
+        if p != "" {
+            rel = strings.TrimPrefix(folder, p+"/")
+        }
+        name, _, _ := strings.Cut(rel, "/")
+        dir, ok := dirs[name]
+        if !ok {
+            dir = &fileInfo{name: name, dir: true}
+            dirs[name] = dir
+            children = append(children, dir)
+        }
+        if modTime.After(dir.modTime) {
+            dir.modTime = modTime
+        }
+    }
+
+    for i := range files {
+        file := &files[i]
+        if file.Folder != p {
+            addDir(file.Folder, file.CreatedAt)
+            continue
+        }
+        // Newest first, so the first file with a name is current
+        if !current[file.FileName] {
+            current[file.FileName] = true
+            children = append(children, &fileInfo{name: file.FileName, file: file})
+        }
+    }
+    for _, record := range records {
+        addDir(record.Path, record.CreatedAt)
+    }
+    return children, nil
+}
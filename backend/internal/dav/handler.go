@@ -0,0 +1,178 @@
+// Package dav serves a user's files over WebDAV so Storely can be mounted
+// as a network drive. Paths map to folder/file name exactly as in the S3
+// gateway; files written here are ordinary Storely files (same quota, plan
+// limits, chunk layout and post-upload jobs). Empty directories created
+// with MKCOL are kept in the "folders" collection.
+//
+// Clients authenticate with HTTP Basic auth, either with the account's
+// email and password or with an access key ID and its secret as an app
+// password.
+package dav
+
+import (
+    "crypto/subtle"
+    "errors"
+    "log"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+    "backend/internal/service"
+    "backend/middleware"
+
+    "golang.org/x/net/webdav"
+)
+
+// Handler is the http.Handler of the WebDAV endpoint.
+type Handler struct {
+    prefix  string
+    users   *service.UserService
+    keys    *service.AccessKeyService
+    store   *service.FileStore
+    folders *repository.FolderRepository
+
+    mu    sync.Mutex
+    locks map[string]webdav.LockSystem
+}
+
+// NewHandler serves WebDAV below prefix (e.g. "/dav").
+func NewHandler(prefix string, users *service.UserService, keys *service.AccessKeyService, store *service.FileStore, folders *repository.FolderRepository) *Handler {
+    return &Handler{
+        prefix:  strings.TrimSuffix(prefix, "/"),
+        users:   users,
+        keys:    keys,
+        store:   store,
+        folders: folders,
+        locks:   map[string]webdav.LockSystem{},
+    }
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    user, err := h.authenticate(r)
+    if err != nil {
+        appErr := apperr.From(err)
+        if appErr.Status == http.StatusUnauthorized {
+            w.Header().Set("WWW-Authenticate", `Basic realm="Storely", charset="UTF-8"`)
+        }
+        if retryAfter, ok := appErr.Details["retryAfter"].(int); ok {
+            w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+        }
+        if appErr.Status >= http.StatusInternalServerError {
+            log.Printf("[%s] WebDAV authentication: %v", apperr.RequestID(r.Context()), err)
+        }
+        http.Error(w, appErr.Message, appErr.Status)
+        return
+    }
+
+    fsys := &fileSystem{
+        store:   h.store,
+        folders: h.folders,
+        user:    user,
+        putSize: -1,
+    }
+    if r.Method == http.MethodPut {
+        fsys.putSize = r.ContentLength
+    }
+
+    dav := &webdav.Handler{
+        Prefix:     h.prefix,
+        FileSystem: fsys,
+        LockSystem: h.lockSystem(user.UserID),
+        Logger: func(r *http.Request, err error) {
+            if err != nil && !os.IsNotExist(err) && fsys.failure == nil {
+                log.Printf("[%s] WebDAV %s %s: %v", apperr.RequestID(r.Context()), r.Method, r.URL.Path, err)
+            }
+        },
+    }
+    dav.ServeHTTP(&statusWriter{ResponseWriter: w, fs: fsys}, r)
+}
+
+var (
+    errBadCredentials = apperr.New(http.StatusUnauthorized, apperr.CodeInvalidCredentials, "Invalid credentials")
+    errNeedAccessKey  = apperr.New(http.StatusUnauthorized, apperr.CodeMFARequired, "Two-factor authentication is enabled; sign in with an access key")
+)
+
+// authenticate accepts an email and password, or an access key ID and
+// secret. Access keys avoid a password hash per request, which matters for
+// clients that send many small requests.
+func (h *Handler) authenticate(r *http.Request) (*models.User, error) {
+    username, password, ok := r.BasicAuth()
+    if !ok || username == "" {
+        return nil, apperr.ErrUnauthorized
+    }
+
+    if !strings.Contains(username, "@") {
+        key, user, err := h.keys.Resolve(r.Context(), username)
+        if errors.Is(err, repository.ErrAccessKeyNotFound) {
+            return nil, errBadCredentials
+        }
+        if err != nil {
+            return nil, err
+        }
+        if subtle.ConstantTimeCompare([]byte(key.SecretKey), []byte(password)) != 1 {
+            return nil, errBadCredentials
+        }
+        return user, nil
+    }
+
+    // Passwords go through the login guard like any other sign-in, so
+    // WebDAV can't be used to guess them faster
+    user, err := h.users.HandleLoginAttempt(r.Context(), username, password, "", middleware.GetIP(r))
+    if err != nil {
+        return nil, err
+    }
+    // A password alone would bypass the second factor
+    if user.TOTPEnabled {
+        return nil, errNeedAccessKey
+    }
+    return user, nil
+}
+
+// lockSystem returns the user's lock system; lock names are paths, which
+// are only unique per user.
+func (h *Handler) lockSystem(userID string) webdav.LockSystem {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    ls, ok := h.locks[userID]
+    if !ok {
+        ls = webdav.NewMemLS()
+        h.locks[userID] = ls
+    }
+    return ls
+}
+
+// statusWriter replaces the generic error status the webdav package
+// answers a failed write with (405, 403, ...) with the status of the
+// service error behind it, e.g. 507 Insufficient Storage for quota.
+type statusWriter struct {
+    http.ResponseWriter
+    fs       *fileSystem
+    replaced bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+    if status < http.StatusBadRequest || w.fs.failure == nil {
+        w.ResponseWriter.WriteHeader(status)
+        return
+    }
+
+    appErr := apperr.From(w.fs.failure)
+    status = appErr.Status
+    if errors.Is(appErr, repository.ErrStorageLimitExceeded) || errors.Is(appErr, service.ErrPlanLimitExceeded) {
+        status = http.StatusInsufficientStorage
+    }
+    w.replaced = true
+    http.Error(w.ResponseWriter, appErr.Message, status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+    if w.replaced {
+        return len(p), nil
+    }
+    return w.ResponseWriter.Write(p)
+}
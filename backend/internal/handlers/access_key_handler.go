@@ -0,0 +1,99 @@
+// handlers/access_key_handler.go
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "backend/internal/apperr"
+    "backend/internal/service"
+    "backend/middleware"
+    "backend/utils/logger"
+
+    "github.com/gorilla/mux"
+    "go.uber.org/zap"
+)
+
+// AccessKeyHandler lets users manage the access keys they sign S3 gateway
+// requests with.
+type AccessKeyHandler struct {
+    keyService *service.AccessKeyService
+    lookup     middleware.UserLookup
+}
+
+func NewAccessKeyHandler(keyService *service.AccessKeyService, lookup middleware.UserLookup) *AccessKeyHandler {
+    return &AccessKeyHandler{keyService: keyService, lookup: lookup}
+}
+
+// CreateAccessKey issues a key pair. The secret is only part of this
+// response.
+func (h *AccessKeyHandler) CreateAccessKey(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+
+    var req struct {
+        Name string `json:"name"`
+    }
+    if r.ContentLength != 0 {
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+            return
+        }
+    }
+
+    key, err := h.keyService.Create(r.Context(), user, req.Name)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    logger.L().Info("Access key created",
+        zap.String("userID", user.UserID),
+        zap.String("accessKeyId", key.AccessKeyID))
+    writeJSON(w, http.StatusCreated, map[string]interface{}{
+        "accessKeyId":     key.AccessKeyID,
+        "secretAccessKey": key.SecretKey,
+        "name":            key.Name,
+        "createdAt":       key.CreatedAt,
+    })
+}
+
+func (h *AccessKeyHandler) ListAccessKeys(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+
+    keys, err := h.keyService.List(r.Context(), user)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"accessKeys": keys})
+}
+
+func (h *AccessKeyHandler) DeleteAccessKey(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+
+    accessKeyID := mux.Vars(r)["accessKeyId"]
+    if err := h.keyService.Revoke(r.Context(), user, accessKeyID); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    logger.L().Info("Access key revoked",
+        zap.String("userID", user.UserID),
+        zap.String("accessKeyId", accessKeyID))
+    writeJSON(w, http.StatusOK, map[string]string{
+        "status":      "deleted",
+        "accessKeyId": accessKeyID,
+    })
+}
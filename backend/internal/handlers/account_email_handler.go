@@ -0,0 +1,104 @@
+// handlers/account_email_handler.go
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "backend/internal/apperr"
+    "backend/internal/service"
+    "backend/middleware"
+    "backend/utils/logger"
+
+    "go.uber.org/zap"
+)
+
+// AccountEmailHandler serves email verification and password reset.
+type AccountEmailHandler struct {
+    emailService *service.AccountEmailService
+    lookup       middleware.UserLookup
+}
+
+func NewAccountEmailHandler(emailService *service.AccountEmailService, lookup middleware.UserLookup) *AccountEmailHandler {
+    return &AccountEmailHandler{emailService: emailService, lookup: lookup}
+}
+
+// ResendVerification emails the signed-in user a new verification link.
+func (h *AccountEmailHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    if err := h.emailService.SendVerification(r.Context(), user); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusAccepted, map[string]string{"status": "sent"})
+}
+
+func (h *AccountEmailHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Token string `json:"token"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+        apperr.Write(w, r, apperr.BadRequest("token is required"))
+        return
+    }
+    if err := h.emailService.VerifyEmail(r.Context(), req.Token); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]string{"status": "verified"})
+}
+
+// ConfirmEmailChange completes an email change with the token sent to the
+// new address.
+func (h *AccountEmailHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Token string `json:"token"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+        apperr.Write(w, r, apperr.BadRequest("token is required"))
+        return
+    }
+    if err := h.emailService.ConfirmEmailChange(r.Context(), req.Token); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]string{"status": "changed"})
+}
+
+// RequestPasswordReset always answers 202, whether or not the email has an
+// account.
+func (h *AccountEmailHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Email string `json:"email"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+        apperr.Write(w, r, apperr.BadRequest("email is required"))
+        return
+    }
+    h.emailService.RequestPasswordReset(r.Context(), req.Email)
+    writeJSON(w, http.StatusAccepted, map[string]string{
+        "status":  "accepted",
+        "message": "If the address belongs to an account, a reset link is on its way",
+    })
+}
+
+func (h *AccountEmailHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Token    string `json:"token"`
+        Password string `json:"password"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+        apperr.Write(w, r, apperr.BadRequest("token and password are required"))
+        return
+    }
+    if err := h.emailService.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    logger.L().Info("Password reset", zap.String("ipAddress", middleware.GetIP(r)))
+    writeJSON(w, http.StatusOK, map[string]string{"status": "reset"})
+}
@@ -0,0 +1,138 @@
+// handlers/account_handler.go
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "backend/internal/apperr"
+    "backend/internal/service"
+    "backend/middleware"
+    "backend/utils/logger"
+
+    "go.uber.org/zap"
+)
+
+// AccountHandler lets signed-in users manage their own account.
+type AccountHandler struct {
+    accounts *service.AccountService
+    lookup   middleware.UserLookup
+}
+
+func NewAccountHandler(accounts *service.AccountService, lookup middleware.UserLookup) *AccountHandler {
+    return &AccountHandler{accounts: accounts, lookup: lookup}
+}
+
+func (h *AccountHandler) GetAccount(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    writeJSON(w, http.StatusOK, user)
+}
+
+// UpdateAccount changes the profile; the username is all there is to it.
+func (h *AccountHandler) UpdateAccount(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    var req struct {
+        Username *string `json:"username"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+        return
+    }
+
+    if req.Username != nil {
+        if err := h.accounts.Rename(r.Context(), user, *req.Username); err != nil {
+            apperr.Write(w, r, err)
+            return
+        }
+    }
+    updated, err := h.lookup(r.Context(), user.ID.Hex())
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, updated)
+}
+
+// ChangePassword ends every session and returns a token for a new one.
+func (h *AccountHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    var req struct {
+        CurrentPassword string `json:"currentPassword"`
+        NewPassword     string `json:"newPassword"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+        return
+    }
+
+    token, err := h.accounts.ChangePassword(r.Context(), user, req.CurrentPassword, req.NewPassword, middleware.AuthSignedInAt(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    logger.L().Info("Password changed",
+        zap.String("userID", user.UserID),
+        zap.String("ipAddress", middleware.GetIP(r)))
+    writeJSON(w, http.StatusOK, map[string]string{"token": token})
+}
+
+// ChangeEmail sends a confirmation link to the new address.
+func (h *AccountHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    var req struct {
+        Email    string `json:"email"`
+        Password string `json:"password"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+        apperr.Write(w, r, apperr.BadRequest("email and password are required"))
+        return
+    }
+
+    if err := h.accounts.ChangeEmail(r.Context(), user, req.Password, req.Email, middleware.AuthSignedInAt(r.Context())); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusAccepted, map[string]string{"status": "sent"})
+}
+
+// DeleteAccount deletes the account and all its files. It takes the
+// password, and a code when two-factor authentication is on.
+func (h *AccountHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    var req mfaRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+        return
+    }
+
+    if err := h.accounts.DeleteSelf(r.Context(), user, req.Password, req.Code, middleware.GetIP(r), middleware.AuthSignedInAt(r.Context())); err != nil {
+        setRetryAfter(w, err)
+        apperr.Write(w, r, err)
+        return
+    }
+    logger.L().Info("Account deleted",
+        zap.String("userID", user.UserID),
+        zap.String("email", user.Email),
+        zap.String("ipAddress", middleware.GetIP(r)))
+    writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
@@ -0,0 +1,246 @@
+// handlers/admin_handler.go
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+
+    "backend/internal/apperr"
+    "backend/internal/service"
+    "backend/middleware"
+    "backend/utils/logger"
+
+    "github.com/gorilla/mux"
+    "go.uber.org/zap"
+)
+
+type AdminHandler struct {
+    adminService *service.AdminService
+}
+
+func NewAdminHandler(adminService *service.AdminService) *AdminHandler {
+    return &AdminHandler{adminService: adminService}
+}
+
+// parsePage reads ?page= and ?limit= with defaults of 1 and 50.
+func parsePage(r *http.Request) (int64, int64, error) {
+    page, limit := int64(1), int64(50)
+    query := r.URL.Query()
+    if raw := query.Get("page"); raw != "" {
+        parsed, err := strconv.ParseInt(raw, 10, 64)
+        if err != nil || parsed < 1 {
+            return 0, 0, apperr.BadRequest("page must be a positive integer")
+        }
+        page = parsed
+    }
+    if raw := query.Get("limit"); raw != "" {
+        parsed, err := strconv.ParseInt(raw, 10, 64)
+        if err != nil || parsed < 1 || parsed > 200 {
+            return 0, 0, apperr.BadRequest("limit must be between 1 and 200")
+        }
+        limit = parsed
+    }
+    return page, limit, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(body)
+}
+
+// ListUsers lists or searches accounts. Supports ?q=, ?page= and ?limit=.
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+    page, limit, err := parsePage(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    users, total, err := h.adminService.ListUsers(r.Context(), r.URL.Query().Get("q"), page, limit)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "users": users,
+        "total": total,
+        "page":  page,
+        "limit": limit,
+    })
+}
+
+func (h *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+    overview, err := h.adminService.GetUserOverview(r.Context(), mux.Vars(r)["userId"])
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, overview)
+}
+
+func (h *AdminHandler) ListUserFiles(w http.ResponseWriter, r *http.Request) {
+    page, limit, err := parsePage(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    files, total, err := h.adminService.ListUserFiles(r.Context(), mux.Vars(r)["userId"], page, limit)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "files": files,
+        "total": total,
+        "page":  page,
+        "limit": limit,
+    })
+}
+
+// UpdateStorageLimit sets a user's limit in bytes.
+func (h *AdminHandler) UpdateStorageLimit(w http.ResponseWriter, r *http.Request) {
+    userID := mux.Vars(r)["userId"]
+
+    var req struct {
+        StorageLimit float64 `json:"storageLimit"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+        return
+    }
+
+    if err := h.adminService.UpdateStorageLimit(r.Context(), userID, req.StorageLimit); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    adminAudit(r, "Storage limit changed", userID, zap.Float64("storageLimit", req.StorageLimit))
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "status":       "updated",
+        "userId":       userID,
+        "storageLimit": req.StorageLimit,
+    })
+}
+
+func (h *AdminHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+    userID := mux.Vars(r)["userId"]
+    if err := h.adminService.UnlockUser(r.Context(), userID); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    adminAudit(r, "User unlocked", userID)
+    writeJSON(w, http.StatusOK, map[string]string{"status": "unlocked", "userId": userID})
+}
+
+func (h *AdminHandler) ResetMFA(w http.ResponseWriter, r *http.Request) {
+    userID := mux.Vars(r)["userId"]
+    if err := h.adminService.ResetMFA(r.Context(), userID); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    adminAudit(r, "Two-factor authentication reset", userID)
+    writeJSON(w, http.StatusOK, map[string]string{"status": "mfa_disabled", "userId": userID})
+}
+
+// ListLoginAttempts pages through the sign-in audit trail. Supports
+// ?email=, ?ip=, ?page= and ?limit=.
+func (h *AdminHandler) ListLoginAttempts(w http.ResponseWriter, r *http.Request) {
+    page, limit, err := parsePage(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    query := r.URL.Query()
+    attempts, total, err := h.adminService.ListLoginAttempts(r.Context(), query.Get("email"), query.Get("ip"), page, limit)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "attempts": attempts,
+        "total":    total,
+        "page":     page,
+        "limit":    limit,
+    })
+}
+
+func (h *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+    h.setDisabled(w, r, true)
+}
+
+func (h *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+    h.setDisabled(w, r, false)
+}
+
+func (h *AdminHandler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+    userID := mux.Vars(r)["userId"]
+    if disabled && h.isSelf(r, userID) {
+        apperr.Write(w, r, apperr.BadRequest("Admins cannot disable their own account"))
+        return
+    }
+
+    if err := h.adminService.SetUserDisabled(r.Context(), userID, disabled); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    status := "enabled"
+    if disabled {
+        status = "disabled"
+    }
+    adminAudit(r, "User "+status, userID)
+    writeJSON(w, http.StatusOK, map[string]string{"status": status, "userId": userID})
+}
+
+// DeleteUser removes the account along with all of its files.
+func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+    userID := mux.Vars(r)["userId"]
+    if h.isSelf(r, userID) {
+        apperr.Write(w, r, apperr.BadRequest("Admins cannot delete their own account"))
+        return
+    }
+
+    if err := h.adminService.DeleteUser(r.Context(), userID); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    adminAudit(r, "User deleted", userID)
+    writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "userId": userID})
+}
+
+func (h *AdminHandler) GetSystemStats(w http.ResponseWriter, r *http.Request) {
+    stats, err := h.adminService.SystemStats(r.Context())
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, stats)
+}
+
+func (h *AdminHandler) isSelf(r *http.Request, userID string) bool {
+    admin := middleware.AuthUser(r.Context())
+    return admin != nil && admin.UserID == userID
+}
+
+// adminAudit logs an administrative action together with the acting admin.
+func adminAudit(r *http.Request, action string, userID string, fields ...zap.Field) {
+    adminID := ""
+    if admin := middleware.AuthUser(r.Context()); admin != nil {
+        adminID = admin.UserID
+    }
+    fields = append(fields,
+        zap.String("adminID", adminID),
+        zap.String("userID", userID),
+        zap.String("ipAddress", middleware.GetIP(r)),
+    )
+    logger.L().Info(action, fields...)
+}
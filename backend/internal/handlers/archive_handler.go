@@ -0,0 +1,73 @@
+// handlers/archive_handler.go
+package handlers
+
+import (
+    "encoding/json"
+    "log"
+    "mime"
+    "net/http"
+
+    "backend/internal/apperr"
+    "backend/internal/service"
+    "backend/middleware"
+    "backend/utils/logger"
+
+    "go.uber.org/zap"
+)
+
+// ArchiveHandler serves ZIP downloads of several files or a folder.
+type ArchiveHandler struct {
+    archives *service.ArchiveService
+    lookup   middleware.UserLookup
+}
+
+func NewArchiveHandler(archives *service.ArchiveService, lookup middleware.UserLookup) *ArchiveHandler {
+    return &ArchiveHandler{archives: archives, lookup: lookup}
+}
+
+// DownloadArchive streams a ZIP of the files listed in fileIds, or of
+// everything below folder.
+func (h *ArchiveHandler) DownloadArchive(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+
+    var req struct {
+        FileIDs []string `json:"fileIds"`
+        Folder  *string  `json:"folder"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+        return
+    }
+    if req.Folder != nil && len(req.FileIDs) > 0 {
+        apperr.Write(w, r, apperr.BadRequest("Send either fileIds or folder, not both"))
+        return
+    }
+
+    archiveReq := service.ArchiveRequest{FileIDs: req.FileIDs}
+    if req.Folder != nil {
+        archiveReq.Folder, archiveReq.ByFolder = *req.Folder, true
+    }
+    archive, err := h.archives.Prepare(r.Context(), user, archiveReq)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/zip")
+    w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archive.Name}))
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(http.StatusOK)
+    if err := h.archives.Write(r.Context(), w, archive); err != nil {
+        log.Printf("[%s] Archive download aborted: %v", apperr.RequestID(r.Context()), err)
+        return
+    }
+
+    logger.L().Info("Archive downloaded",
+        zap.String("userID", user.UserID),
+        zap.Int("files", len(archive.Entries)),
+        zap.Int64("bytes", archive.Size))
+}
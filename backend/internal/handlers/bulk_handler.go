@@ -0,0 +1,111 @@
+// handlers/bulk_handler.go
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/service"
+    "backend/middleware"
+    "backend/utils/logger"
+
+    "go.uber.org/zap"
+)
+
+// BulkHandler applies delete, move, tag and share to many files at once.
+type BulkHandler struct {
+    bulk   *service.BulkService
+    lookup middleware.UserLookup
+}
+
+func NewBulkHandler(bulk *service.BulkService, lookup middleware.UserLookup) *BulkHandler {
+    return &BulkHandler{bulk: bulk, lookup: lookup}
+}
+
+type bulkRequest struct {
+    FileIDs   []string   `json:"fileIds"`
+    Folder    *string    `json:"folder"`
+    Add       []string   `json:"add"`
+    Remove    []string   `json:"remove"`
+    ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// BulkDelete deletes the files listed in fileIds.
+func (h *BulkHandler) BulkDelete(w http.ResponseWriter, r *http.Request) {
+    h.serve(w, r, "delete", func(user *models.User, req bulkRequest) ([]service.BulkResult, error) {
+        return h.bulk.Delete(r.Context(), user, req.FileIDs)
+    })
+}
+
+// BulkMove moves the files listed in fileIds into folder.
+func (h *BulkHandler) BulkMove(w http.ResponseWriter, r *http.Request) {
+    h.serve(w, r, "move", func(user *models.User, req bulkRequest) ([]service.BulkResult, error) {
+        if req.Folder == nil {
+            return nil, apperr.BadRequest("folder is required")
+        }
+        return h.bulk.Move(r.Context(), user, req.FileIDs, *req.Folder)
+    })
+}
+
+// BulkTag adds the tags in add and removes those in remove.
+func (h *BulkHandler) BulkTag(w http.ResponseWriter, r *http.Request) {
+    h.serve(w, r, "tag", func(user *models.User, req bulkRequest) ([]service.BulkResult, error) {
+        return h.bulk.Tag(r.Context(), user, req.FileIDs, req.Add, req.Remove)
+    })
+}
+
+// BulkShare creates a share link per file, optionally expiring at
+// expiresAt.
+func (h *BulkHandler) BulkShare(w http.ResponseWriter, r *http.Request) {
+    h.serve(w, r, "share", func(user *models.User, req bulkRequest) ([]service.BulkResult, error) {
+        results, err := h.bulk.Share(r.Context(), user, req.FileIDs, req.ExpiresAt)
+        for _, result := range results {
+            if result.ShareLink != nil {
+                result.ShareLink.URL = middleware.BaseURL(r) + "/s/" + result.ShareLink.Token
+            }
+        }
+        return results, err
+    })
+}
+
+// serve decodes the request, runs op and writes the per-file results. The
+// status is 200 even when some files failed; callers check each result.
+func (h *BulkHandler) serve(w http.ResponseWriter, r *http.Request, name string, op func(*models.User, bulkRequest) ([]service.BulkResult, error)) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    var req bulkRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+        return
+    }
+
+    results, err := op(user, req)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    succeeded := 0
+    for _, result := range results {
+        if result.OK {
+            succeeded++
+        }
+    }
+
+    logger.L().Info("Bulk operation",
+        zap.String("operation", name),
+        zap.String("userID", user.UserID),
+        zap.Int("succeeded", succeeded),
+        zap.Int("failed", len(results)-succeeded))
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "results":   results,
+        "succeeded": succeeded,
+        "failed":    len(results) - succeeded,
+    })
+}
@@ -2,197 +2,214 @@
 package handlers
 
 import (
+    "context"
     "fmt"
     "io"
     "encoding/json"
-    "encoding/base64"
 	"log"
+    "mime/multipart"
     "net/http"
     "strconv"
     "time"
-    "context"
-    "bytes"
 
+    "backend/internal/apperr"
     "backend/internal/models"
     "backend/internal/repository"
-    
+    "backend/internal/service"
+    "backend/middleware"
+    "backend/utils/logger"
+
     "github.com/gorilla/mux"
     "github.com/minio/minio-go/v7"
-    "go.mongodb.org/mongo-driver/bson/primitive"
-
+    "go.uber.org/zap"
 )
+
+// maxChunkFieldSize bounds the form fields sent before the file part.
+const maxChunkFieldSize = 4096
+
+// ChunkHandler serves the form-based chunk upload (/upload-chunk), where
+// every chunk is posted through the server, and presigned chunk downloads.
 type ChunkHandler struct {
-    chunkRepo    *repository.ChunkRepository
-    fileRepo     *repository.FileRepository
+    store        *service.FileStore
+    lookup       middleware.UserLookup
     minioRepo    *repository.MinIOFileRepository
-    minioClient  *minio.Client
+    // presigner signs download URLs for MinIO's public address
+    presigner    *minio.Client
     bucketName   string
 }
 
-type ErrorResponse struct {
-    Error   string `json:"error"`
-    Details string `json:"details"`
-}
 type ChunkUploadResponse struct {
     FileID      string `json:"fileId"`
     FileName    string `json:"fileName"`
     FileType    string `json:"fileType"`
     TotalChunks int    `json:"totalChunks"`
     ChunksReceived int `json:"chunksReceived"`
+    Complete    bool   `json:"complete"`
 }
 
 func NewChunkHandler(
-    chunkRepo *repository.ChunkRepository,
-    fileRepo *repository.FileRepository,
-    minioRepo *repository.MinIOFileRepository, 
-    minioClient *minio.Client,
+    store *service.FileStore,
+    lookup middleware.UserLookup,
+    minioRepo *repository.MinIOFileRepository,
+    presigner *minio.Client,
     bucketName string,
 ) *ChunkHandler {
     return &ChunkHandler{
-        chunkRepo:   chunkRepo,
-        fileRepo:    fileRepo,
-        minioRepo:   minioRepo,                  
-        minioClient: minioClient,
+        store:       store,
+        lookup:      lookup,
+        minioRepo:   minioRepo,
+        presigner:   presigner,
         bucketName:  bucketName,
     }
 }
 
+// HandleChunkUpload stores one chunk posted as multipart/form-data. The
+// fields (fileId, chunkIndex, totalChunks and, on the first chunk, fileSize,
+// chunkSize and folder) must come before the file part, which is streamed
+// to object storage as it arrives. The first chunk, sent without fileId,
+// creates the file; the response carries its ID for the following chunks.
 func (h *ChunkHandler) HandleChunkUpload(w http.ResponseWriter, r *http.Request) {
-    var fileID string
-    isFirstChunk := false
-    
-    // Get or create fileID
-    fileID = r.FormValue("fileId")
-    if fileID == "" {
-        fileID = primitive.NewObjectID().Hex()
-        isFirstChunk = true
-    }
-
-    chunkIndex, _ := strconv.Atoi(r.FormValue("chunkIndex"))
-    totalChunks, _ := strconv.Atoi(r.FormValue("totalChunks"))
-    
-    file, header, err := r.FormFile("file")
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
     if err != nil {
-        log.Printf("Error getting file: %v", err)
-        http.Error(w, "Failed to get file", http.StatusBadRequest)
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
         return
     }
-    defer file.Close()
 
-    data, err := io.ReadAll(file)
+    reader, err := r.MultipartReader()
     if err != nil {
-        log.Printf("Error reading file: %v", err)
-        http.Error(w, "Failed to read file", http.StatusInternalServerError)
+        apperr.Write(w, r, apperr.BadRequest("Request must be multipart/form-data"))
         return
     }
-
-    // If first chunk, create file metadata
-    if isFirstChunk {
-        fileMetadata := &models.File{
-            ID:        func() primitive.ObjectID {
-                id, err := primitive.ObjectIDFromHex(fileID)
-                if err != nil {
-                    log.Printf("Error converting fileID to ObjectID: %v", err)
-                    http.Error(w, "Invalid file ID", http.StatusBadRequest)
-                    return primitive.NilObjectID
-                }
-                return id
-            }(),
-            FileName:  header.Filename,
-            FileType:  header.Header.Get("Content-Type"),
-            Size:      r.ContentLength * int64(totalChunks),
-            CreatedAt: time.Now(),
-            Complete:  false,
+    fields := map[string]string{}
+    for {
+        part, err := reader.NextPart()
+        if err == io.EOF {
+            apperr.Write(w, r, apperr.BadRequest("Missing file part"))
+            return
+        }
+        if err != nil {
+            apperr.Write(w, r, apperr.BadRequest("Malformed multipart body"))
+            return
         }
-        
-        if err := h.fileRepo.CreateFile(r.Context(), fileMetadata); err != nil {
-            log.Printf("Error creating file metadata: %v", err)
-            http.Error(w, "Failed to create file metadata", http.StatusInternalServerError)
+        if part.FormName() == "file" {
+            h.storeChunk(w, r, user, fields, part)
+            part.Close()
             return
         }
-    }
 
-    chunk := &models.FileChunk{
-        FileID:      fileID,
-        ChunkIndex:  chunkIndex,
-        TotalChunks: totalChunks,
-        Data:        data,
-        FileName:    header.Filename,
-        FileType:    header.Header.Get("Content-Type"),
-        UploadedAt:  time.Now(),
+        value, err := io.ReadAll(io.LimitReader(part, maxChunkFieldSize+1))
+        part.Close()
+        if err != nil || len(value) > maxChunkFieldSize {
+            apperr.Write(w, r, apperr.BadRequest("Form field %q is too long", part.FormName()))
+            return
+        }
+        fields[part.FormName()] = string(value)
     }
+}
 
-    // Save to MongoDB
-    if err := h.chunkRepo.SaveChunk(r.Context(), chunk); err != nil {
-        log.Printf("Error saving chunk: %v", err)
-        http.Error(w, "Failed to save chunk", http.StatusInternalServerError)
+func (h *ChunkHandler) storeChunk(w http.ResponseWriter, r *http.Request, user *models.User, fields map[string]string, part *multipart.Part) {
+    chunkIndex, err := strconv.Atoi(fields["chunkIndex"])
+    if err != nil {
+        apperr.Write(w, r, apperr.BadRequest("chunkIndex must be an integer"))
         return
     }
-
-      // Additional MinIO storage
-    chunkData, _ := base64.StdEncoding.DecodeString(string(chunk.Data))
-    objectName := fmt.Sprintf("%s/chunk_%d", chunk.FileID, chunk.ChunkIndex)
-    
-    _, err = h.minioClient.PutObject(
-        context.Background(),
-        h.bucketName,
-        objectName,
-        bytes.NewReader(chunkData),
-        int64(len(chunkData)),
-        minio.PutObjectOptions{},
-    )
+    totalChunks, err := strconv.Atoi(fields["totalChunks"])
     if err != nil {
-        log.Printf("MinIO storage error: %v", err)
-        errorResponse := ErrorResponse{
-            Error:   "Failed to store chunk in MinIO",
-            Details: err.Error(),
-        }
-        w.Header().Set("Content-Type", "application/json")
-        w.WriteHeader(http.StatusInternalServerError)
-        json.NewEncoder(w).Encode(errorResponse)
+        apperr.Write(w, r, apperr.BadRequest("totalChunks must be an integer"))
         return
     }
 
-    // Count received chunks
-    chunksReceived, err := h.chunkRepo.CountChunks(r.Context(), fileID)
-    if err != nil {
-        log.Printf("Error counting chunks: %v", err)
+    fileID := fields["fileId"]
+    var created *models.FileMinIO
+    if fileID == "" {
+        fileSize, err := strconv.ParseInt(fields["fileSize"], 10, 64)
+        if err != nil || fileSize < 0 {
+            apperr.Write(w, r, apperr.BadRequest("fileSize is required on the first chunk"))
+            return
+        }
+        var chunkSize int64
+        if fields["chunkSize"] != "" {
+            if chunkSize, err = strconv.ParseInt(fields["chunkSize"], 10, 64); err != nil {
+                apperr.Write(w, r, apperr.BadRequest("chunkSize must be an integer"))
+                return
+            }
+        }
+        fileType := part.Header.Get("Content-Type")
+        if fileType == "" {
+            fileType = "application/octet-stream"
+        }
+
+        created, err = h.store.StartChunked(r.Context(), user, service.PutRequest{
+            Folder:   fields["folder"],
+            FileName: firstNonEmpty(fields["fileName"], part.FileName()),
+            FileType: fileType,
+            Size:     fileSize,
+        }, chunkSize, totalChunks)
+        if err != nil {
+            apperr.Write(w, r, err)
+            return
+        }
+        fileID = created.ID.Hex()
     }
 
-    // Update file completion status if all chunks received
-    if chunksReceived == totalChunks {
-        if err := h.fileRepo.MarkFileComplete(r.Context(), fileID); err != nil {
-            log.Printf("Error marking file complete: %v", err)
-        } else {
-            log.Printf("Successfully marked file %s as complete", fileID)
+    file, received := created, 0
+    if created == nil || !created.Complete {
+        file, received, err = h.store.WriteChunk(r.Context(), user, fileID, chunkIndex, part)
+        if err != nil {
+            // Nobody knows the ID of a file whose first chunk failed
+            if created != nil {
+                if cleanupErr := h.store.Delete(context.WithoutCancel(r.Context()), created); cleanupErr != nil {
+                    log.Printf("Failed to clean up upload %s: %v", fileID, cleanupErr)
+                }
+            }
+            apperr.Write(w, r, err)
+            return
         }
     }
 
+    if file.Complete {
+        logger.L().Info("File Upload Completed",
+            zap.String("File ID", fileID),
+            zap.String("userID", file.UserID),
+            zap.String("File Name", file.FileName),
+            zap.Float64("File Size", file.Size))
+    }
+
     response := ChunkUploadResponse{
         FileID:         fileID,
-        FileName:       header.Filename,
-        FileType:       header.Header.Get("Content-Type"),
-        TotalChunks:    totalChunks,
-        ChunksReceived: chunksReceived,
+        FileName:       file.FileName,
+        FileType:       file.FileType,
+        TotalChunks:    file.TotalChunks,
+        ChunksReceived: received,
+        Complete:       file.Complete,
     }
 
     w.Header().Set("Content-Type", "application/json")
     if err := json.NewEncoder(w).Encode(response); err != nil {
         log.Printf("Error encoding response: %v", err)
-        http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-        return
     }
 }
 
 
+// GetFileFromMinIO returns presigned download URLs for the chunks of one of
+// the caller's files.
 func (h *ChunkHandler) GetFileFromMinIO(w http.ResponseWriter, r *http.Request) {
     vars := mux.Vars(r)
     fileID := vars["fileId"]
 
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
     fileMetadata, err := h.minioRepo.GetFileByID_MinIO(r.Context(), fileID)
     if err != nil {
         log.Printf("Error getting file metadata: %v", err)
-        http.Error(w, "File not found", http.StatusNotFound)
+        apperr.Write(w, r, err)
+        return
+    }
+    if fileMetadata.UserID != user.UserID {
+        apperr.Write(w, r, repository.ErrFileNotFound)
         return
     }
 
@@ -200,7 +217,7 @@ func (h *ChunkHandler) GetFileFromMinIO(w http.ResponseWriter, r *http.Request)
     // Generate presigned URLs for each chunk
     for i := 0; i < fileMetadata.TotalChunks; i++ {
         objectName := fmt.Sprintf("%s/chunk_%d", fileID, i)
-        presignedURL, err := h.minioClient.PresignedGetObject(
+        presignedURL, err := h.presigner.PresignedGetObject(
             r.Context(),
             h.bucketName,
             objectName,
@@ -209,7 +226,7 @@ func (h *ChunkHandler) GetFileFromMinIO(w http.ResponseWriter, r *http.Request)
         )
         if err != nil {
             log.Printf("Error generating presigned URL for chunk %d: %v", i, err)
-            http.Error(w, "Failed to generate download URLs", http.StatusInternalServerError)
+            apperr.Write(w, r, apperr.ErrStorage.WithMessage("Failed to generate download URLs").Wrap(err))
             return
         }
         downloadUrls = append(downloadUrls, presignedURL.String())
@@ -219,6 +236,7 @@ func (h *ChunkHandler) GetFileFromMinIO(w http.ResponseWriter, r *http.Request)
         "downloadUrls": downloadUrls,
         "fileName":    fileMetadata.FileName,
         "fileType":    fileMetadata.FileType,
+        "size":        fileMetadata.Size,
         "totalChunks": fileMetadata.TotalChunks,
         "expiresIn":   "1 hour",
     }
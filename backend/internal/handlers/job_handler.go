@@ -0,0 +1,129 @@
+// handlers/job_handler.go
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+
+    "backend/internal/apperr"
+    "backend/internal/repository"
+    "backend/internal/service"
+    "backend/middleware"
+
+    "github.com/gorilla/mux"
+)
+
+type JobHandler struct {
+    queue  *service.JobQueue
+    lookup middleware.UserLookup
+}
+
+func NewJobHandler(queue *service.JobQueue, lookup middleware.UserLookup) *JobHandler {
+    return &JobHandler{queue: queue, lookup: lookup}
+}
+
+// ListJobs returns recent jobs. Supports ?status=, ?type= and ?limit=.
+func (h *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+
+    limit := int64(50)
+    if raw := query.Get("limit"); raw != "" {
+        parsed, err := strconv.ParseInt(raw, 10, 64)
+        if err != nil || parsed <= 0 || parsed > 500 {
+            apperr.Write(w, r, apperr.BadRequest("limit must be between 1 and 500"))
+            return
+        }
+        limit = parsed
+    }
+
+    jobs, err := h.queue.ListJobs(r.Context(), query.Get("status"), query.Get("type"), limit)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    stats, err := h.queue.Stats(r.Context())
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "jobs":  jobs,
+        "stats": stats,
+    })
+}
+
+func (h *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+    job, err := h.queue.GetJob(r.Context(), mux.Vars(r)["jobId"])
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(job)
+}
+
+// EnqueueJob lets an operator schedule a job by hand, e.g. a quota
+// reconciliation or a chunk compose.
+func (h *JobHandler) EnqueueJob(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Type    string            `json:"type"`
+        Payload map[string]string `json:"payload"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Type == "" {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+        return
+    }
+
+    job, err := h.queue.Enqueue(r.Context(), req.Type, req.Payload)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusAccepted)
+    json.NewEncoder(w).Encode(job)
+}
+
+// RetryJob moves a dead-lettered job back to the queue.
+func (h *JobHandler) RetryJob(w http.ResponseWriter, r *http.Request) {
+    jobID := mux.Vars(r)["jobId"]
+    if err := h.queue.RetryJob(r.Context(), jobID); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "status": "requeued",
+        "jobId":  jobID,
+    })
+}
+
+// GetOwnJob reports the status and progress of one of the caller's jobs,
+// e.g. an archive extraction.
+func (h *JobHandler) GetOwnJob(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    job, err := h.queue.GetJob(r.Context(), mux.Vars(r)["jobId"])
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    if job.Payload["userId"] != user.UserID {
+        apperr.Write(w, r, repository.ErrJobNotFound)
+        return
+    }
+
+    // the lease is the workers' business
+    job.LeaseOwner, job.LeaseExpiresAt = "", nil
+    writeJSON(w, http.StatusOK, job)
+}
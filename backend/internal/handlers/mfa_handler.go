@@ -0,0 +1,138 @@
+// handlers/mfa_handler.go
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "backend/internal/apperr"
+    "backend/internal/service"
+    "backend/middleware"
+    "backend/utils/logger"
+
+    "go.uber.org/zap"
+)
+
+// MFAHandler lets users set up and manage TOTP two-factor authentication.
+type MFAHandler struct {
+    mfaService *service.MFAService
+    lookup     middleware.UserLookup
+}
+
+func NewMFAHandler(mfaService *service.MFAService, lookup middleware.UserLookup) *MFAHandler {
+    return &MFAHandler{mfaService: mfaService, lookup: lookup}
+}
+
+type mfaRequest struct {
+    Code     string `json:"code"`
+    Password string `json:"password"`
+}
+
+func decodeMFARequest(r *http.Request) (*mfaRequest, error) {
+    var req mfaRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        return nil, apperr.BadRequest("Invalid request body")
+    }
+    if req.Code == "" {
+        return nil, apperr.BadRequest("code is required")
+    }
+    return &req, nil
+}
+
+func (h *MFAHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    writeJSON(w, http.StatusOK, h.mfaService.Status(user))
+}
+
+// Enroll starts TOTP enrollment. The secret is only part of this response;
+// Activate completes it.
+func (h *MFAHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+
+    secret, uri, err := h.mfaService.Enroll(r.Context(), user)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]string{
+        "secret":     secret,
+        "otpauthUri": uri,
+    })
+}
+
+// Activate turns on two-factor authentication with a code from the newly
+// enrolled authenticator and returns the recovery codes.
+func (h *MFAHandler) Activate(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    req, err := decodeMFARequest(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    codes, err := h.mfaService.Activate(r.Context(), user, req.Code)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    logger.L().Info("Two-factor authentication enabled", zap.String("userID", user.UserID))
+    writeJSON(w, http.StatusOK, map[string]interface{}{"recoveryCodes": codes})
+}
+
+// Disable turns off two-factor authentication; it takes the password and a
+// code.
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    req, err := decodeMFARequest(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    if err := h.mfaService.Disable(r.Context(), user, req.Password, req.Code, middleware.GetIP(r), middleware.AuthSignedInAt(r.Context())); err != nil {
+        setRetryAfter(w, err)
+        apperr.Write(w, r, err)
+        return
+    }
+    logger.L().Info("Two-factor authentication disabled", zap.String("userID", user.UserID))
+    writeJSON(w, http.StatusOK, map[string]string{"status": "disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes, given a code.
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return
+    }
+    req, err := decodeMFARequest(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    codes, err := h.mfaService.RegenerateRecoveryCodes(r.Context(), user, req.Code, middleware.GetIP(r))
+    if err != nil {
+        setRetryAfter(w, err)
+        apperr.Write(w, r, err)
+        return
+    }
+    logger.L().Info("Recovery codes regenerated", zap.String("userID", user.UserID))
+    writeJSON(w, http.StatusOK, map[string]interface{}{"recoveryCodes": codes})
+}
@@ -2,16 +2,20 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"backend/internal/apperr"
 	"backend/internal/models"
 	"backend/internal/repository"
-	"backend/utils"
+	"backend/internal/service"
+	"backend/middleware"
     "backend/utils/logger"
 
 	"github.com/gorilla/mux"
@@ -20,48 +24,104 @@ import (
     "go.uber.org/zap"
 )
 
+var errMissingChunks = apperr.New(http.StatusBadRequest, apperr.CodeMissingChunks, "Missing chunks")
+
 type MinIOFileHandler struct {
     minioRepo   *repository.MinIOFileRepository
     userRepo   *repository.UserRepository
     minioClient *minio.Client
+    // presigner signs the URLs handed to clients, for MinIO's public address
+    presigner   *minio.Client
     bucketName  string
+    storage     *service.StorageService
+    jobQueue    *service.JobQueue
+    planService *service.PlanService
+    limits      service.UploadLimits
+    extractor   *service.Extractor
 }
 
-func NewMinIOFileHandler(minioRepo *repository.MinIOFileRepository,userRepo *repository.UserRepository, minioClient *minio.Client, bucketName string) *MinIOFileHandler {
+func NewMinIOFileHandler(minioRepo *repository.MinIOFileRepository,userRepo *repository.UserRepository, minioClient *minio.Client, presigner *minio.Client, bucketName string, jobQueue *service.JobQueue, planService *service.PlanService, limits service.UploadLimits, extractor *service.Extractor) *MinIOFileHandler {
     return &MinIOFileHandler{
         minioRepo:   minioRepo,
         userRepo:   userRepo,
         minioClient: minioClient,
+        presigner:   presigner,
         bucketName:  bucketName,
+        storage:     service.NewStorageService(minioClient, bucketName),
+        jobQueue:    jobQueue,
+        planService: planService,
+        limits:      limits,
+        extractor:   extractor,
     }
 }
 
+// extractOptions asks for an uploaded archive to be unpacked. Folder
+// defaults to a folder named after the archive.
+type extractOptions struct {
+    Folder        *string `json:"folder"`
+    DeleteArchive bool    `json:"deleteArchive"`
+}
+
+// InitializeMinIOUpload creates a file record for the caller and returns
+// presigned PUT URLs for its chunks. A userID in the body is ignored.
 func (h *MinIOFileHandler) InitializeMinIOUpload(w http.ResponseWriter, r *http.Request) {
     var req struct {
-        UserID      string `json:"userID"`
         FileName    string `json:"fileName"`
         FileType    string `json:"fileType"`
+        Folder      string `json:"folder"`
         FileSize    float64  `json:"fileSize"`
+        ChunkSize   int64  `json:"chunkSize"`
         TotalChunks int    `json:"totalChunks"`
     }
 
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
+        apperr.Write(w, r, apperr.ErrValidation.WithMessage("request body must be a JSON object: %v", err).WithDetails(map[string]interface{}{
+            "field":      "body",
+            "constraint": "json",
+        }))
+        return
+    }
+
+    // Reject malformed or oversized requests before touching the database
+    // or minting any presigned URLs
+    if verr := h.limits.Validate(service.UploadRequest{
+        FileName:    req.FileName,
+        Folder:      req.Folder,
+        FileSize:    req.FileSize,
+        ChunkSize:   req.ChunkSize,
+        TotalChunks: req.TotalChunks,
+    }); verr != nil {
+        apperr.Write(w, r, verr)
         return
     }
 
-    if err := h.userRepo.CheckUserStorageLimit(r.Context(), req.UserID, req.FileSize); err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
+    user, err := h.authUser(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    // Enforce the per-file limits of the user's plan before reserving space
+    if err := h.planService.CheckUpload(r.Context(), user, req.FileSize, req.FileType); err != nil {
+        apperr.Write(w, r, err)
         return
     }
 
+    if err := h.userRepo.CheckUserStorageLimit(r.Context(), user.UserID, req.FileSize); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    folder, _ := service.CleanFolder(req.Folder)
     file := &models.FileMinIO{
         ID:          primitive.NewObjectID(),
-        UserID:      req.UserID,
+        UserID:      user.UserID,
         FileName:    req.FileName,
         FileType:    req.FileType,
+        Folder:      folder,
         Size:        req.FileSize,
         TotalChunks: req.TotalChunks,
+        ChunkSize:   req.ChunkSize,
         CreatedAt:   time.Now(),
         UpdatedAt:   time.Now(),
         Complete:    false,
@@ -69,7 +129,11 @@ func (h *MinIOFileHandler) InitializeMinIOUpload(w http.ResponseWriter, r *http.
     }
 
     if err := h.minioRepo.CreateFile_MinIO(r.Context(), file); err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        // Give back the space charged above
+        if err := h.userRepo.DecreaseUsedStorage(context.WithoutCancel(r.Context()), user.UserID, req.FileSize); err != nil {
+            log.Printf("Failed to release storage of %s: %v", user.UserID, err)
+        }
+        apperr.Write(w, r, err)
         logger.L().Error("File Creation failed",
         zap.String("userID",file.UserID),
                 zap.String("File Name",file.FileName),
@@ -82,9 +146,17 @@ func (h *MinIOFileHandler) InitializeMinIOUpload(w http.ResponseWriter, r *http.
     var uploadURLs []map[string]interface{}
     for i := 0; i < req.TotalChunks; i++ {
         objectName := fmt.Sprintf("%s/chunk_%d", file.ID.Hex(), i)
-        url, err := h.minioClient.PresignedPutObject(r.Context(), h.bucketName, objectName, time.Hour)
+        url, err := h.presigner.PresignedPutObject(r.Context(), h.bucketName, objectName, time.Hour)
         if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            // Nothing can be uploaded, so undo the record and the charge
+            ctx := context.WithoutCancel(r.Context())
+            if err := h.minioRepo.DeleteMinIOFile(ctx, file.ID.Hex()); err != nil {
+                log.Printf("Failed to delete file %s: %v", file.ID.Hex(), err)
+            }
+            if err := h.userRepo.DecreaseUsedStorage(ctx, user.UserID, req.FileSize); err != nil {
+                log.Printf("Failed to release storage of %s: %v", user.UserID, err)
+            }
+            apperr.Write(w, r, apperr.ErrStorage.Wrap(err))
             return
         }
         uploadURLs = append(uploadURLs, map[string]interface{}{
@@ -96,7 +168,7 @@ func (h *MinIOFileHandler) InitializeMinIOUpload(w http.ResponseWriter, r *http.
     response := map[string]interface{}{
         "fileId":      file.ID.Hex(),
         "uploadUrls":  uploadURLs,
-        "callbackUrl": fmt.Sprintf("http://localhost:8080/api/minio/files/%s/complete", file.ID.Hex()),
+        "callbackUrl": fmt.Sprintf("%s/api/minio/files/%s/complete", middleware.BaseURL(r), file.ID.Hex()),
     }
 
     logger.L().Info("File Upload Initialized",
@@ -115,30 +187,41 @@ func (h *MinIOFileHandler) CompleteMinIOUpload(w http.ResponseWriter, r *http.Re
     vars := mux.Vars(r)
     fileID := vars["fileId"]
 
-    file, err := h.minioRepo.GetFileByID_MinIO(r.Context(), fileID)
+    user, err := h.authUser(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    file, err := h.ownedFile(r, user, fileID)
     if err != nil {
-        http.Error(w, "File not found", http.StatusNotFound)
+        apperr.Write(w, r, err)
         logger.L().Error("File Not found in MinIO",
-        zap.String("userID",file.UserID),
-                zap.String("File Name",file.FileName),
-                zap.String("File Type",file.FileType),
-                zap.Float64("File Size",file.Size),
+            zap.String("File ID",fileID),
             zap.Error(err))
         return
     }
 
+    // Completing twice is harmless, but only the first call queues jobs
+    if file.Complete {
+        writeUploadCompleted(w, fileID)
+        return
+    }
+
     // Verify all chunks exist
     for i := 0; i < file.TotalChunks; i++ {
         objectName := fmt.Sprintf("%s/chunk_%d", fileID, i)
         _, err := h.minioClient.StatObject(r.Context(), h.bucketName, objectName, minio.StatObjectOptions{})
         if err != nil {
-            http.Error(w, "Missing chunks", http.StatusBadRequest)
+            apperr.Write(w, r, errMissingChunks.WithDetails(map[string]interface{}{
+                "chunkIndex": i,
+            }))
             return
         }
     }
 
-    if err := h.minioRepo.MarkFileComplete_MinIO(r.Context(), fileID); err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+    completed, err := h.minioRepo.MarkFileComplete_MinIO(r.Context(), fileID)
+    if err != nil {
+        apperr.Write(w, r, err)
         logger.L().Error("Failed to mark file complete",
         zap.String("userID",file.UserID),
                 zap.String("File Name",file.FileName),
@@ -148,6 +231,20 @@ func (h *MinIOFileHandler) CompleteMinIOUpload(w http.ResponseWriter, r *http.Re
         return
     }
 
+    // A concurrent call got there first and queued the jobs
+    if !completed {
+        writeUploadCompleted(w, fileID)
+        return
+    }
+
+    // Post-upload processing runs in the background; a failure to enqueue
+    // must not fail the upload itself.
+    if err := service.EnqueueForCompletedUpload(r.Context(), h.jobQueue, file); err != nil {
+        logger.L().Error("Failed to enqueue post-upload jobs",
+            zap.String("File ID",fileID),
+            zap.Error(err))
+    }
+
     logger.L().Info("File Upload Completed",
      zap.String("File ID",file.ID.String()),
      zap.String("userID",file.UserID),
@@ -156,6 +253,11 @@ func (h *MinIOFileHandler) CompleteMinIOUpload(w http.ResponseWriter, r *http.Re
      zap.Float64("File Size",file.Size),
     )
 
+    // Extraction is only started through the /extract route
+    writeUploadCompleted(w, fileID)
+}
+
+func writeUploadCompleted(w http.ResponseWriter, fileID string) {
     w.WriteHeader(http.StatusOK)
     json.NewEncoder(w).Encode(map[string]string{
         "status": "success",
@@ -163,38 +265,23 @@ func (h *MinIOFileHandler) CompleteMinIOUpload(w http.ResponseWriter, r *http.Re
     })
 }
 
+// GetUserStorageHealth reports the signed-in user's storage usage.
 func (h *MinIOFileHandler) GetUserStorageHealth(w http.ResponseWriter, r *http.Request) {
-    log.Println("Received request to get user storage health")
-    
-    // Validate JWT token
-    tokenString := r.Header.Get("Authorization")
-    if tokenString == "" {
-        http.Error(w, "Authorization header missing", http.StatusUnauthorized)
-        return
-    }
-    tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-    token, err := utils.ValidateJWT(tokenString)
-    if err != nil || !token.Valid {
-        http.Error(w, "Invalid token", http.StatusUnauthorized)
-        return
-    }
-
-    // Get userID from query parameters instead of body
-    userID := r.URL.Query().Get("userID")
-    if userID == "" {
-        http.Error(w, "Missing userID parameter", http.StatusBadRequest)
+    user, err := h.authUser(r)
+    if err != nil {
+        apperr.Write(w, r, err)
         return
     }
 
-    used, limit, err := h.userRepo.GetStorageUsedAndLimit(r.Context(), userID)
+    used, limit, err := h.userRepo.GetStorageUsedAndLimit(r.Context(), user.UserID)
     if err != nil {
-        http.Error(w, "Unable to retrieve storage data", http.StatusInternalServerError)
+        apperr.Write(w, r, err)
         return
     }
     balance := limit - used
 
     logger.L().Info("User Calling for Storage Health Data",
-     zap.String("userID",userID),
+     zap.String("userID",user.UserID),
      zap.String("Storage Balance",fmt.Sprintf("%f",balance)),
     )
 
@@ -206,62 +293,41 @@ func (h *MinIOFileHandler) GetUserStorageHealth(w http.ResponseWriter, r *http.R
     })
 }
 
-// In handlers/minio_file_handler.go
+// DeleteFileFromMinIO deletes one of the signed-in user's files with all
+// its objects.
 func (h *MinIOFileHandler) DeleteFileFromMinIO(w http.ResponseWriter, r *http.Request) {
-
-    log.Println("Received request to delete file from MinIO")
-
-    // Validate JWT token
-    tokenString := r.Header.Get("Authorization")
-    if tokenString == "" {
-        http.Error(w, "Authorization header missing", http.StatusUnauthorized)
-        return
-    }
-    tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-    token, err := utils.ValidateJWT(tokenString)
-    if err != nil || !token.Valid {
-        http.Error(w, "Invalid token", http.StatusUnauthorized)
+    user, err := h.authUser(r)
+    if err != nil {
+        apperr.Write(w, r, err)
         return
     }
 
-    // Parse request body for userId and fileId
+    // userId is still accepted from older clients but not trusted; the
+    // owner is the signed-in user
     var req struct {
         FileID string `json:"fileId"`
-        UserID string `json:"userId"`
     }
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
         return
     }
-    log.Println("FileID:",req.FileID,"UserID:",req.UserID)
 
-    // Retrieve file from DB
-    file, err := h.minioRepo.GetFileByID_MinIO(r.Context(), req.FileID)
+    file, err := h.ownedFile(r, user, req.FileID)
     if err != nil {
-        http.Error(w, "File not found", http.StatusNotFound)
+        apperr.Write(w, r, err)
         return
     }
 
-    // Check user mismatch
-    if file.UserID != req.UserID {
-        http.Error(w, "Not authorized to delete this file", http.StatusForbidden)
+    // Remove all chunks and derived objects (thumbnail, composed object)
+    if removeErr := h.storage.RemoveFileObjects(r.Context(), req.FileID); removeErr != nil {
+        apperr.Write(w, r, apperr.ErrStorage.WithMessage("Failed removing chunk(s)").Wrap(removeErr))
         return
     }
 
-    // Remove all chunks
-    for i := 0; i < file.TotalChunks; i++ {
-        objectName := fmt.Sprintf("%s/chunk_%d", req.FileID, i)
-        removeErr := h.minioClient.RemoveObject(r.Context(), h.bucketName, objectName, minio.RemoveObjectOptions{})
-        if removeErr != nil {
-            http.Error(w, "Failed removing chunk(s)", http.StatusInternalServerError)
-            return
-        }
-    }
-
     // Remove metadata
     err = h.minioRepo.DeleteMinIOFile(r.Context(), req.FileID)
     if err != nil {
-        http.Error(w, "Failed to remove metadata", http.StatusInternalServerError)
+        apperr.Write(w, r, err)
         return
     }
 
@@ -274,4 +340,166 @@ func (h *MinIOFileHandler) DeleteFileFromMinIO(w http.ResponseWriter, r *http.Re
         "status": "deleted",
         "fileId": req.FileID,
     })
-}
\ No newline at end of file
+}
+
+// authUser resolves the account behind the token validated by RequireAuth.
+func (h *MinIOFileHandler) authUser(r *http.Request) (*models.User, error) {
+    user, err := h.userRepo.FindByObjectID(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        return nil, apperr.ErrInvalidToken.Wrap(err)
+    }
+    return user, nil
+}
+
+// ownedFile loads a file and checks that user owns it.
+func (h *MinIOFileHandler) ownedFile(r *http.Request, user *models.User, fileID string) (*models.FileMinIO, error) {
+    file, err := h.minioRepo.GetFileByID_MinIO(r.Context(), fileID)
+    if err != nil {
+        return nil, err
+    }
+    if file.UserID != user.UserID {
+        return nil, repository.ErrFileNotFound
+    }
+    return file, nil
+}
+
+// ListFiles lists the caller's files, newest first. Supports ?page=,
+// ?limit=, ?folder= ("" lists the root folder only), ?recursive=true to
+// include the subfolders of folder and ?tag= to list tagged files.
+func (h *MinIOFileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+    user, err := h.authUser(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    page, limit, err := parsePage(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    var files []models.FileMinIO
+    var total int64
+    query := r.URL.Query()
+    if query.Has("folder") && query.Has("tag") {
+        apperr.Write(w, r, apperr.BadRequest("Filter by either folder or tag, not both"))
+        return
+    }
+    if query.Has("tag") {
+        files, total, err = h.minioRepo.ListByTag(r.Context(), user.UserID, strings.TrimSpace(query.Get("tag")), (page-1)*limit, limit)
+    } else if query.Has("folder") {
+        folder, ok := service.CleanFolder(query.Get("folder"))
+        if !ok {
+            apperr.Write(w, r, apperr.BadRequest("Invalid folder"))
+            return
+        }
+        recursive := query.Get("recursive") == "true"
+        files, total, err = h.minioRepo.ListByFolder(r.Context(), user.UserID, folder, recursive, (page-1)*limit, limit)
+    } else {
+        files, total, err = h.minioRepo.ListByUser(r.Context(), user.UserID, (page-1)*limit, limit)
+    }
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "files": files,
+        "total": total,
+        "page":  page,
+        "limit": limit,
+    })
+}
+
+// GetUploadStatus reports which chunks of an upload are already stored and
+// returns fresh presigned URLs for the missing ones, so an interrupted
+// upload can be resumed.
+func (h *MinIOFileHandler) GetUploadStatus(w http.ResponseWriter, r *http.Request) {
+    user, err := h.authUser(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    fileID := mux.Vars(r)["fileId"]
+    file, err := h.ownedFile(r, user, fileID)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    uploaded, err := h.storage.UploadedChunks(r.Context(), fileID)
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrStorage.Wrap(err))
+        return
+    }
+
+    uploadedChunks := []int{}
+    missing := []map[string]interface{}{}
+    for i := 0; i < file.TotalChunks; i++ {
+        if uploaded[i] {
+            uploadedChunks = append(uploadedChunks, i)
+            continue
+        }
+        if file.Complete {
+            continue
+        }
+        url, err := h.presigner.PresignedPutObject(r.Context(), h.bucketName, service.ChunkObjectName(fileID, i), time.Hour)
+        if err != nil {
+            apperr.Write(w, r, apperr.ErrStorage.Wrap(err))
+            return
+        }
+        missing = append(missing, map[string]interface{}{
+            "chunkIndex": i,
+            "uploadUrl":  url.String(),
+        })
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "fileId":         fileID,
+        "fileName":       file.FileName,
+        "folder":         file.Folder,
+        "size":           file.Size,
+        "chunkSize":      file.ChunkSize,
+        "totalChunks":    file.TotalChunks,
+        "complete":       file.Complete,
+        "uploadedChunks": uploadedChunks,
+        "missingChunks":  missing,
+    })
+}
+
+// ExtractArchive unpacks one of the caller's uploaded ZIP or tar archives
+// in the background. Progress is reported at GET /api/jobs/{jobId}.
+func (h *MinIOFileHandler) ExtractArchive(w http.ResponseWriter, r *http.Request) {
+    user, err := h.authUser(r)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    file, err := h.ownedFile(r, user, mux.Vars(r)["fileId"])
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    var opts extractOptions
+    if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && err != io.EOF {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+        return
+    }
+    job, folder, err := h.extractor.Enqueue(r.Context(), file, opts.Folder, opts.DeleteArchive)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    logger.L().Info("Archive extraction queued",
+        zap.String("userID", user.UserID),
+        zap.String("File ID", file.ID.Hex()),
+        zap.String("folder", folder))
+
+    writeJSON(w, http.StatusAccepted, map[string]string{
+        "jobId":  job.ID.Hex(),
+        "folder": folder,
+    })
+}
+
@@ -0,0 +1,94 @@
+// handlers/plan_handler.go
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/service"
+
+    "github.com/gorilla/mux"
+    "go.uber.org/zap"
+)
+
+type PlanHandler struct {
+    planService *service.PlanService
+}
+
+func NewPlanHandler(planService *service.PlanService) *PlanHandler {
+    return &PlanHandler{planService: planService}
+}
+
+func (h *PlanHandler) ListPlans(w http.ResponseWriter, r *http.Request) {
+    plans, err := h.planService.ListPlans(r.Context())
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"plans": plans})
+}
+
+func (h *PlanHandler) CreatePlan(w http.ResponseWriter, r *http.Request) {
+    var plan models.Plan
+    if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+        return
+    }
+    if err := h.planService.CreatePlan(r.Context(), &plan); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, plan)
+}
+
+// UpdatePlan changes a plan's limits; users on the plan get the new storage
+// limit straight away.
+func (h *PlanHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
+    name := mux.Vars(r)["plan"]
+
+    var plan models.Plan
+    if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+        return
+    }
+    if err := h.planService.UpdatePlan(r.Context(), name, &plan); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    updated, err := h.planService.GetPlan(r.Context(), name)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, updated)
+}
+
+// AssignUserPlan moves a user to another plan.
+func (h *PlanHandler) AssignUserPlan(w http.ResponseWriter, r *http.Request) {
+    userID := mux.Vars(r)["userId"]
+
+    var req struct {
+        Plan string `json:"plan"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Plan == "" {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request body"))
+        return
+    }
+
+    plan, err := h.planService.AssignPlan(r.Context(), userID, req.Plan)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    adminAudit(r, "User plan changed", userID, zap.String("plan", plan.Name))
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "status":       "updated",
+        "userId":       userID,
+        "plan":         plan.Name,
+        "storageLimit": plan.StorageLimit,
+    })
+}
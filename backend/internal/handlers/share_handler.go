@@ -0,0 +1,46 @@
+// handlers/share_handler.go
+package handlers
+
+import (
+    "io"
+    "log"
+    "mime"
+    "net/http"
+    "strconv"
+
+    "backend/internal/apperr"
+    "backend/internal/service"
+
+    "github.com/gorilla/mux"
+)
+
+// ShareHandler serves files through their public share links.
+type ShareHandler struct {
+    shares *service.ShareService
+}
+
+func NewShareHandler(shares *service.ShareService) *ShareHandler {
+    return &ShareHandler{shares: shares}
+}
+
+// DownloadShared streams the file behind a share link. No account is
+// needed; the token is the credential.
+func (h *ShareHandler) DownloadShared(w http.ResponseWriter, r *http.Request) {
+    file, content, err := h.shares.Open(r.Context(), mux.Vars(r)["token"])
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    defer content.Close()
+
+    w.Header().Set("Content-Type", file.FileType)
+    w.Header().Set("Content-Length", strconv.FormatInt(int64(file.Size), 10))
+    w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.FileName}))
+    w.Header().Set("Cache-Control", "private, no-store")
+    if r.Method == http.MethodHead {
+        return
+    }
+    if _, err := io.Copy(w, content); err != nil {
+        log.Printf("[%s] Shared download of %s aborted: %v", apperr.RequestID(r.Context()), file.ID.Hex(), err)
+    }
+}
@@ -0,0 +1,111 @@
+// handlers/sso_handler.go
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+
+    "backend/internal/apperr"
+    "backend/internal/service"
+    "backend/middleware"
+    "backend/utils/crypto"
+    "backend/utils/logger"
+
+    "go.uber.org/zap"
+)
+
+// OIDCLogin sends the browser to the OpenID Connect provider.
+func (h *UserHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+    if h.ssoService == nil {
+        apperr.Write(w, r, service.ErrSSONotConfigured)
+        return
+    }
+    redirect, flow, err := h.ssoService.Start(r.Context())
+    if err != nil {
+        logger.L().Error("Single sign-on could not start", zap.Error(err))
+        apperr.Write(w, r, err)
+        return
+    }
+    http.SetCookie(w, h.ssoService.FlowCookie(flow))
+    http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// OIDCCallback is where the provider sends the browser back. It always
+// ends at the web app, with a login code or an error code.
+func (h *UserHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+    if h.ssoService == nil {
+        apperr.Write(w, r, service.ErrSSONotConfigured)
+        return
+    }
+    http.SetCookie(w, h.ssoService.FlowCookie(""))
+
+    query := r.URL.Query()
+    var code string
+    var err error
+    if providerErr := query.Get("error"); providerErr != "" {
+        // e.g. the user declined consent
+        err = service.ErrSSOFailed.WithMessage(providerErr + ": " + query.Get("error_description"))
+    } else if cookie, cookieErr := r.Cookie("storely_oidc"); cookieErr != nil {
+        err = service.ErrSSOFailed.WithMessage("Sign-in session is missing, try again")
+    } else {
+        code, err = h.ssoService.Finish(r.Context(), cookie.Value, query.Get("state"), query.Get("code"), middleware.GetIP(r))
+    }
+    if err != nil {
+        logger.L().Error("Single sign-on failed",
+            zap.String("ipAddress", middleware.GetIP(r)),
+            zap.Error(err))
+    }
+    http.Redirect(w, r, h.ssoService.AppRedirect(code, err), http.StatusFound)
+}
+
+// OIDCToken trades the login code the web app got from OIDCCallback for a
+// session token. Like Login it takes and returns encrypted envelopes, and
+// asks for a second factor when the account has one.
+func (h *UserHandler) OIDCToken(w http.ResponseWriter, r *http.Request) {
+    if h.ssoService == nil {
+        apperr.Write(w, r, service.ErrSSONotConfigured)
+        return
+    }
+    var encryptedData struct {
+        Data string `json:"data"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&encryptedData); err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request format"))
+        return
+    }
+    decryptedData, err := crypto.Decrypt(encryptedData.Data)
+    if err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Failed to decrypt data"))
+        return
+    }
+    var req struct {
+        Code string `json:"code"`
+    }
+    if err := json.Unmarshal(decryptedData, &req); err != nil || req.Code == "" {
+        apperr.Write(w, r, apperr.BadRequest("code is required"))
+        return
+    }
+
+    user, err := h.ssoService.Redeem(r.Context(), req.Code)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    if user.TOTPEnabled {
+        mfaToken, err := h.mfaService.Challenge(user)
+        if err != nil {
+            apperr.Write(w, r, apperr.ErrInternal.Wrap(err))
+            return
+        }
+        if err := h.sendEncrypted(w, map[string]interface{}{
+            "mfaRequired": true,
+            "mfaToken":    mfaToken,
+            "message":     "Two-factor authentication required",
+        }); err != nil {
+            apperr.Write(w, r, err)
+        }
+        return
+    }
+
+    h.completeLogin(w, r, user)
+}
@@ -6,6 +6,7 @@ import (
     "encoding/json"
     "net/http"
 
+    "backend/internal/apperr"
     "backend/internal/repository"
 )
 
@@ -20,11 +21,11 @@ func NewTestHandler(testRepo *repository.TestRepository) *TestHandler {
 func (h *TestHandler) InsertTestData(w http.ResponseWriter, r *http.Request) {
     var payload interface{}
     if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-        http.Error(w, "Invalid payload", http.StatusBadRequest)
+        apperr.Write(w, r, apperr.BadRequest("Invalid payload"))
         return
     }
     if err := h.testRepo.InsertTestData(context.Background(), payload); err != nil {
-        http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+        apperr.Write(w, r, err)
         return
     }
     w.WriteHeader(http.StatusCreated)
@@ -33,7 +34,7 @@ func (h *TestHandler) InsertTestData(w http.ResponseWriter, r *http.Request) {
 func (h *TestHandler) GetLastTestData(w http.ResponseWriter, r *http.Request) {
     data, err := h.testRepo.GetLastTestData(context.Background())
     if err != nil {
-        http.Error(w, "Failed to retrieve data", http.StatusInternalServerError)
+        apperr.Write(w, r, err)
         return
     }
     json.NewEncoder(w).Encode(data)
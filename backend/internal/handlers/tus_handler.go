@@ -0,0 +1,281 @@
+// handlers/tus_handler.go
+package handlers
+
+import (
+    "crypto/md5"
+    "crypto/sha1"
+    "crypto/sha256"
+    "encoding/base64"
+    "hash"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/service"
+    "backend/middleware"
+    "backend/utils/logger"
+
+    "github.com/gorilla/mux"
+    "go.uber.org/zap"
+)
+
+const (
+    tusVersion    = "1.0.0"
+    tusExtensions = "creation,termination,checksum,expiration"
+)
+
+var (
+    errTusVersion     = apperr.New(http.StatusPreconditionFailed, apperr.CodeBadRequest, "Unsupported tus version; expected Tus-Resumable: "+tusVersion)
+    errTusContentType = apperr.New(http.StatusUnsupportedMediaType, apperr.CodeBadRequest, "Content-Type must be application/offset+octet-stream")
+)
+
+// tusChecksums are the algorithms accepted in Upload-Checksum.
+var tusChecksums = map[string]func() hash.Hash{
+    "md5":    md5.New,
+    "sha1":   sha1.New,
+    "sha256": sha256.New,
+}
+
+// TusHandler serves the tus 1.0 resumable upload protocol with the
+// creation, termination, checksum and expiration extensions. Uploads are
+// regular files; see service.TusService.
+type TusHandler struct {
+    tus    *service.TusService
+    lookup middleware.UserLookup
+}
+
+func NewTusHandler(tus *service.TusService, lookup middleware.UserLookup) *TusHandler {
+    return &TusHandler{tus: tus, lookup: lookup}
+}
+
+// begin sets the headers every tus response carries and rejects requests
+// for another protocol version.
+func (h *TusHandler) begin(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+    w.Header().Set("Tus-Resumable", tusVersion)
+    if r.Header.Get("Tus-Resumable") != tusVersion {
+        w.Header().Set("Tus-Version", tusVersion)
+        apperr.Write(w, r, errTusVersion)
+        return nil, false
+    }
+
+    user, err := h.lookup(r.Context(), middleware.AuthUserID(r.Context()))
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInvalidToken.Wrap(err))
+        return nil, false
+    }
+    return user, true
+}
+
+// Options describes the server's tus support.
+func (h *TusHandler) Options(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Tus-Resumable", tusVersion)
+    w.Header().Set("Tus-Version", tusVersion)
+    w.Header().Set("Tus-Extension", tusExtensions)
+    if max := h.tus.MaxSize(); max > 0 {
+        w.Header().Set("Tus-Max-Size", strconv.FormatInt(max, 10))
+    }
+
+    algorithms := make([]string, 0, len(tusChecksums))
+    for name := range tusChecksums {
+        algorithms = append(algorithms, name)
+    }
+    sort.Strings(algorithms)
+    w.Header().Set("Tus-Checksum-Algorithm", strings.Join(algorithms, ","))
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateUpload starts an upload. Upload-Metadata may carry filename (or
+// name), filetype (or type) and folder.
+func (h *TusHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+    user, ok := h.begin(w, r)
+    if !ok {
+        return
+    }
+
+    if r.Header.Get("Upload-Defer-Length") != "" {
+        apperr.Write(w, r, apperr.BadRequest("Upload-Defer-Length is not supported"))
+        return
+    }
+    size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+    if err != nil || size < 0 {
+        apperr.Write(w, r, apperr.BadRequest("Upload-Length must be a non-negative integer"))
+        return
+    }
+    if max := h.tus.MaxSize(); max > 0 && size > max {
+        apperr.Write(w, r, service.ErrFileTooLarge.WithMessage("Upload-Length exceeds the maximum of %d bytes", max))
+        return
+    }
+    metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    fileName := firstNonEmpty(metadata["filename"], metadata["name"])
+    fileType := firstNonEmpty(metadata["filetype"], metadata["type"], "application/octet-stream")
+    file, err := h.tus.Create(r.Context(), user, service.PutRequest{
+        Folder:   metadata["folder"],
+        FileName: fileName,
+        FileType: fileType,
+        Size:     size,
+    })
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    logger.L().Info("Resumable upload created",
+        zap.String("File ID", file.ID.Hex()),
+        zap.String("userID", file.UserID),
+        zap.String("File Name", file.FileName),
+        zap.Float64("File Size", file.Size))
+    setUploadExpires(w, file)
+    w.Header().Set("Location", "/api/tus/"+file.ID.Hex())
+    w.WriteHeader(http.StatusCreated)
+}
+
+// GetUploadOffset reports how much of an upload is stored (HEAD).
+func (h *TusHandler) GetUploadOffset(w http.ResponseWriter, r *http.Request) {
+    user, ok := h.begin(w, r)
+    if !ok {
+        return
+    }
+    file, err := h.tus.Get(r.Context(), user, mux.Vars(r)["uploadId"])
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    offset := file.UploadOffset
+    if file.Complete {
+        offset = int64(file.Size)
+    }
+    w.Header().Set("Cache-Control", "no-store")
+    w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+    w.Header().Set("Upload-Length", strconv.FormatInt(int64(file.Size), 10))
+    w.Header().Set("Upload-Metadata", formatUploadMetadata(file))
+    setUploadExpires(w, file)
+    w.WriteHeader(http.StatusOK)
+}
+
+// PatchUpload appends the body to an upload at Upload-Offset.
+func (h *TusHandler) PatchUpload(w http.ResponseWriter, r *http.Request) {
+    user, ok := h.begin(w, r)
+    if !ok {
+        return
+    }
+
+    if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+        apperr.Write(w, r, errTusContentType)
+        return
+    }
+    offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+    if err != nil || offset < 0 {
+        apperr.Write(w, r, apperr.BadRequest("Upload-Offset must be a non-negative integer"))
+        return
+    }
+    checksum, err := parseUploadChecksum(r.Header.Get("Upload-Checksum"))
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    file, err := h.tus.Patch(r.Context(), user, mux.Vars(r)["uploadId"], offset, r.Body, checksum)
+    if err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+
+    if file.Complete {
+        logger.L().Info("File Upload Completed",
+            zap.String("File ID", file.ID.Hex()),
+            zap.String("userID", file.UserID),
+            zap.String("File Name", file.FileName),
+            zap.Float64("File Size", file.Size))
+    } else {
+        setUploadExpires(w, file)
+    }
+    w.Header().Set("Upload-Offset", strconv.FormatInt(file.UploadOffset, 10))
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// TerminateUpload discards an unfinished upload.
+func (h *TusHandler) TerminateUpload(w http.ResponseWriter, r *http.Request) {
+    user, ok := h.begin(w, r)
+    if !ok {
+        return
+    }
+    if err := h.tus.Terminate(r.Context(), user, mux.Vars(r)["uploadId"]); err != nil {
+        apperr.Write(w, r, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func firstNonEmpty(values ...string) string {
+    for _, v := range values {
+        if v != "" {
+            return v
+        }
+    }
+    return ""
+}
+
+func setUploadExpires(w http.ResponseWriter, file *models.FileMinIO) {
+    if file.UploadExpiresAt != nil && !file.Complete {
+        w.Header().Set("Upload-Expires", file.UploadExpiresAt.UTC().Format(http.TimeFormat))
+    }
+}
+
+// parseUploadMetadata decodes "key base64value,key base64value". Values
+// may be omitted.
+func parseUploadMetadata(header string) (map[string]string, error) {
+    metadata := map[string]string{}
+    if strings.TrimSpace(header) == "" {
+        return metadata, nil
+    }
+    for _, pair := range strings.Split(header, ",") {
+        key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+        if key == "" {
+            return nil, apperr.BadRequest("Upload-Metadata is malformed")
+        }
+        value, err := base64.StdEncoding.DecodeString(encoded)
+        if err != nil {
+            return nil, apperr.BadRequest("Upload-Metadata value of %q is not valid base64", key)
+        }
+        metadata[key] = string(value)
+    }
+    return metadata, nil
+}
+
+func formatUploadMetadata(file *models.FileMinIO) string {
+    pairs := []string{
+        "filename " + base64.StdEncoding.EncodeToString([]byte(file.FileName)),
+        "filetype " + base64.StdEncoding.EncodeToString([]byte(file.FileType)),
+    }
+    if file.Folder != "" {
+        pairs = append(pairs, "folder "+base64.StdEncoding.EncodeToString([]byte(file.Folder)))
+    }
+    return strings.Join(pairs, ",")
+}
+
+// parseUploadChecksum decodes "algorithm base64digest"; an empty header
+// means no checksum.
+func parseUploadChecksum(header string) (*service.Checksum, error) {
+    if header == "" {
+        return nil, nil
+    }
+    name, encoded, _ := strings.Cut(header, " ")
+    newHash, ok := tusChecksums[name]
+    if !ok {
+        return nil, apperr.BadRequest("Unsupported checksum algorithm %q", name)
+    }
+    expected, err := base64.StdEncoding.DecodeString(encoded)
+    if err != nil {
+        return nil, apperr.BadRequest("Upload-Checksum digest is not valid base64")
+    }
+    return &service.Checksum{Hash: newHash(), Expected: expected}, nil
+}
@@ -2,11 +2,15 @@
 package handlers
 
 import (
+    "context"
+    "backend/internal/apperr"
     "backend/internal/models"
     "backend/internal/service"
     "encoding/json"
+    "errors"
     "net/http"
     "log"
+    "strconv"
     "time"
     "fmt"
     "backend/utils/crypto"
@@ -18,16 +22,31 @@ import (
 )
 
 type UserHandler struct {
-    userService *service.UserService
+    userService  *service.UserService
+    planService  *service.PlanService
+    mfaService   *service.MFAService
+    emailService *service.AccountEmailService
+    // ssoService is nil when single sign-on isn't configured
+    ssoService *service.SSOService
 }
 
 type LoginCredentials struct {
     Email    string `json:"email"`
     Password string `json:"password"`
+    // CaptchaToken is the solved CAPTCHA, once a login answered CAPTCHA_REQUIRED
+    CaptchaToken string `json:"captchaToken,omitempty"`
 }
 
-func NewUserHandler(userService *service.UserService) *UserHandler {
-    return &UserHandler{userService: userService}
+// MFACredentials are the second login step for accounts with two-factor
+// authentication.
+type MFACredentials struct {
+    MFAToken string `json:"mfaToken"`
+    // Code is a current TOTP code or an unused recovery code
+    Code string `json:"code"`
+}
+
+func NewUserHandler(userService *service.UserService, planService *service.PlanService, mfaService *service.MFAService, emailService *service.AccountEmailService, ssoService *service.SSOService) *UserHandler {
+    return &UserHandler{userService: userService, planService: planService, mfaService: mfaService, emailService: emailService, ssoService: ssoService}
 }
 
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -36,14 +55,14 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
         Data string `json:"data"`
     }
     if err := json.NewDecoder(r.Body).Decode(&encryptedData); err != nil {
-        http.Error(w, "Invalid request format", http.StatusBadRequest)
+        apperr.Write(w, r, apperr.BadRequest("Invalid request format"))
         return
     }
 
     // Decrypt the request data
     decryptedData, err := crypto.Decrypt(encryptedData.Data)
     if err != nil {
-        http.Error(w, "Failed to decrypt data", http.StatusBadRequest)
+        apperr.Write(w, r, apperr.BadRequest("Failed to decrypt data"))
         return
     }
 
@@ -54,7 +73,15 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
         Password string `json:"password"`
     }
     if err := json.Unmarshal(decryptedData, &userData); err != nil {
-        http.Error(w, "Invalid data format", http.StatusBadRequest)
+        apperr.Write(w, r, apperr.BadRequest("Invalid data format"))
+        return
+    }
+
+    // New accounts start on the configured default plan
+    plan, err := h.planService.DefaultPlan(r.Context())
+    if err != nil {
+        log.Printf("Failed to load default plan: %v", err)
+        apperr.Write(w, r, apperr.ErrInternal.WithMessage("Registration failed").Wrap(err))
         return
     }
 
@@ -63,33 +90,40 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
         Name:         userData.UserName,
         Email:        userData.Email,
         Password:     userData.Password,
+        Role:         models.RoleUser,
+        Plan:         plan.Name,
         IPAddress:    middleware.GetIP(r),
         StorageUsed:  float64(utils.MBToBytes(0)),
-        StorageLimit: float64(utils.MBToBytes(10240)),
+        StorageLimit: plan.StorageLimit,
         CreatedAt:    time.Now(),
     }
-    user.UserID = utils.GenerateUserID(user.Name, user.Email, user.Password)
+    user.UserID, err = utils.GenerateUserID()
+    if err != nil {
+        apperr.Write(w, r, apperr.ErrInternal.WithMessage("Registration failed").Wrap(err))
+        return
+    }
 
     // Register user in database
     if err := h.userService.RegisterUser(*user); err != nil {
-        // Check for duplicate error messages
-        if err.Error() == "Email already registered" || err.Error() == "Username already taken" {
-            w.WriteHeader(http.StatusConflict)
-            json.NewEncoder(w).Encode(map[string]string{
-                "error": err.Error(),
-            })
-            logger.L().Error("Registration failed",
-                zap.String("username",user.Name),
-                zap.String("email",user.Email),
-                zap.String("ipAddress",user.IPAddress),
-            zap.Error(err))
-            return
-        }
-        
-        http.Error(w, "Registration failed", http.StatusInternalServerError)
+        logger.L().Error("Registration failed",
+            zap.String("username",user.Name),
+            zap.String("email",user.Email),
+            zap.String("ipAddress",user.IPAddress),
+        zap.Error(err))
+        apperr.Write(w, r, err)
         return
     }
 
+    // Ask the new user to confirm their address; registration doesn't wait
+    // for the mail server
+    go func(user models.User) {
+        ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+        defer cancel()
+        if err := h.emailService.SendVerification(ctx, &user); err != nil {
+            log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+        }
+    }(*user)
+
     // Send encrypted response
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]string{
@@ -137,13 +171,19 @@ func (h *UserHandler) sendEncryptedResponse(w http.ResponseWriter, user *models.
             "userID": user.UserID,
             "username": user.Name,
             "email": user.Email,
+            "role": user.Role,
+            "plan": user.Plan,
             "storageUsed": user.StorageUsed,
             "storageLimit": user.StorageLimit,
             "createdAt": user.CreatedAt,
+            "emailVerified": user.EmailVerified,
         },
         "message": "Login successful",
     }
+    return h.sendEncrypted(w, responseData)
+}
 
+func (h *UserHandler) sendEncrypted(w http.ResponseWriter, responseData map[string]interface{}) error {
     jsonData, err := json.Marshal(responseData)
     if err != nil {
         return fmt.Errorf("failed to marshal response: %w", err)
@@ -171,7 +211,7 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
     creds, err := h.parseLoginRequest(r)
     if err != nil {
         log.Printf("Login request parsing failed: %v", err)
-        http.Error(w, "Invalid request format", http.StatusBadRequest)
+        apperr.Write(w, r, apperr.BadRequest("Invalid request format"))
         return
     }
 
@@ -180,42 +220,111 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
         r.Context(),
         creds.Email,
         creds.Password,
+        creds.CaptchaToken,
         middleware.GetIP(r),
     )
 
     // Handle different types of errors
     if err != nil {
-        switch err {
-        case service.ErrAccountLocked:
-            log.Printf("Login attempted on locked account: %s", creds.Email)
-            http.Error(w, "Account is locked", http.StatusForbidden)
-        case service.ErrInvalidCredentials:
+        switch {
+        case errors.Is(err, service.ErrLoginThrottled):
+            log.Printf("Login throttled for: %s", creds.Email)
+            setRetryAfter(w, err)
+        case errors.Is(err, service.ErrCaptchaRequired):
+            log.Printf("CAPTCHA required for: %s", creds.Email)
+        case errors.Is(err, service.ErrAccountDisabled):
+            log.Printf("Login attempted on disabled account: %s", creds.Email)
+        case errors.Is(err, service.ErrInvalidCredentials):
             log.Printf("Invalid credentials for: %s", creds.Email)
-            http.Error(w, "Invalid credentials", http.StatusUnauthorized)
         default:
             log.Printf("Login error for %s: %v", creds.Email, err)
-            http.Error(w, "Internal server error", http.StatusInternalServerError)
         }
+        apperr.Write(w, r, err)
         logger.L().Error("Login failed",
-                zap.String("username",user.Name),
-                zap.String("email",user.Email),
-                zap.String("ipAddress",user.IPAddress),
+                zap.String("email",creds.Email),
+                zap.String("ipAddress",middleware.GetIP(r)),
+            zap.Error(err))
+        return
+    }
+
+    // Accounts with two-factor authentication continue at /api/auth/login/mfa
+    if user.TOTPEnabled {
+        mfaToken, err := h.mfaService.Challenge(user)
+        if err != nil {
+            apperr.Write(w, r, apperr.ErrInternal.Wrap(err))
+            return
+        }
+        if err := h.sendEncrypted(w, map[string]interface{}{
+            "mfaRequired": true,
+            "mfaToken":    mfaToken,
+            "message":     "Two-factor authentication required",
+        }); err != nil {
+            apperr.Write(w, r, err)
+        }
+        return
+    }
+
+    h.completeLogin(w, r, user)
+}
+
+// LoginMFA is the second login step for accounts with two-factor
+// authentication. Like Login it takes and returns encrypted envelopes.
+func (h *UserHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+    var encryptedData struct {
+        Data string `json:"data"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&encryptedData); err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Invalid request format"))
+        return
+    }
+    decryptedData, err := crypto.Decrypt(encryptedData.Data)
+    if err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Failed to decrypt data"))
+        return
+    }
+    var creds MFACredentials
+    if err := json.Unmarshal(decryptedData, &creds); err != nil {
+        apperr.Write(w, r, apperr.BadRequest("Invalid data format"))
+        return
+    }
+
+    user, err := h.mfaService.CompleteLogin(r.Context(), creds.MFAToken, creds.Code, middleware.GetIP(r))
+    if err != nil {
+        setRetryAfter(w, err)
+        logger.L().Error("Two-factor login failed",
+            zap.String("ipAddress", middleware.GetIP(r)),
             zap.Error(err))
+        apperr.Write(w, r, err)
         return
     }
 
+    h.completeLogin(w, r, user)
+}
+
+// setRetryAfter copies the wait of a throttled login into Retry-After.
+func setRetryAfter(w http.ResponseWriter, err error) {
+    var appErr *apperr.Error
+    if errors.As(err, &appErr) {
+        if retryAfter, ok := appErr.Details["retryAfter"].(int); ok {
+            w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+        }
+    }
+}
+
+// completeLogin issues the session token of a signed-in user.
+func (h *UserHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User) {
     // Generate JWT token
     token, err := h.userService.GenerateToken(user)
     if err != nil {
-        log.Printf("Token generation failed for %s: %v", creds.Email, err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        log.Printf("Token generation failed for %s: %v", user.Email, err)
+        apperr.Write(w, r, err)
         return
     }
 
     // Send encrypted response
     if err := h.sendEncryptedResponse(w, user, token); err != nil {
-        log.Printf("Failed to send response for %s: %v", creds.Email, err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        log.Printf("Failed to send response for %s: %v", user.Email, err)
+        apperr.Write(w, r, err)
         return
     }
     logger.L().Info("User Logged In",
@@ -226,7 +335,7 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
      zap.String("ipAddress",user.IPAddress),
     )
 
-    log.Printf("Login successful for user: %s", creds.Email)
+    log.Printf("Login successful for user: %s", user.Email)
 }
 
 func (h *UserHandler) handleCORS(w http.ResponseWriter) {
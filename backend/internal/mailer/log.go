@@ -0,0 +1,53 @@
+package mailer
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "net/mail"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// LogMailer is for local development: it writes each message to Dir as an
+// .eml file, or to the log when Dir is empty, instead of sending it.
+type LogMailer struct {
+    dir  string
+    from *mail.Address
+}
+
+func NewLogMailer(dir, from string) (*LogMailer, error) {
+    address, err := mail.ParseAddress(from)
+    if err != nil {
+        return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+    }
+    if dir != "" {
+        if err := os.MkdirAll(dir, 0o700); err != nil {
+            return nil, fmt.Errorf("failed to create mail directory: %w", err)
+        }
+    }
+    return &LogMailer{dir: dir, from: address}, nil
+}
+
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+    if m.dir == "" {
+        log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+        return nil
+    }
+    now := time.Now()
+    data, err := msg.format(m.from, now)
+    if err != nil {
+        return err
+    }
+    file, err := os.CreateTemp(m.dir, now.UTC().Format("20060102T150405")+"-*.eml")
+    if err != nil {
+        return fmt.Errorf("failed to write mail: %w", err)
+    }
+    defer file.Close()
+    if _, err := file.Write(data); err != nil {
+        return fmt.Errorf("failed to write mail: %w", err)
+    }
+    log.Printf("Mail to %s written to %s", msg.To, filepath.Base(file.Name()))
+    return nil
+}
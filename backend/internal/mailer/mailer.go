@@ -0,0 +1,63 @@
+// Package mailer sends the emails accounts receive, such as verification
+// and password reset links.
+package mailer
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "mime"
+    "mime/quotedprintable"
+    "net/mail"
+    "strings"
+    "time"
+)
+
+// Mailer delivers messages.
+type Mailer interface {
+    Send(ctx context.Context, msg Message) error
+}
+
+// Message is a plain-text email.
+type Message struct {
+    To      string
+    Subject string
+    Text    string
+}
+
+// headerSafe keeps values from starting new header lines.
+var headerSafe = strings.NewReplacer("\r", " ", "\n", " ")
+
+// format renders msg as an RFC 5322 message from from.
+func (msg Message) format(from *mail.Address, now time.Time) ([]byte, error) {
+    to, err := mail.ParseAddress(msg.To)
+    if err != nil {
+        return nil, fmt.Errorf("invalid recipient %q: %w", msg.To, err)
+    }
+    id := make([]byte, 16)
+    if _, err := rand.Read(id); err != nil {
+        return nil, err
+    }
+    domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+    var buf bytes.Buffer
+    fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+    fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+    fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerSafe.Replace(msg.Subject)))
+    fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+    fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+    buf.WriteString("MIME-Version: 1.0\r\n")
+    buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+    buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+    body := quotedprintable.NewWriter(&buf)
+    if _, err := body.Write([]byte(strings.ReplaceAll(msg.Text, "\n", "\r\n"))); err != nil {
+        return nil, err
+    }
+    if err := body.Close(); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
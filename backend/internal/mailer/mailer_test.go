@@ -0,0 +1,65 @@
+package mailer
+
+import (
+	"context"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageFormat(t *testing.T) {
+	from, _ := mail.ParseAddress("Storely <no-reply@example.com>")
+	msg := Message{
+		To:      "alice@example.com",
+		Subject: "Grüße\r\nBcc: eve@example.com",
+		Text:    "Hello\nhttps://app.example.com/verify-email?token=abc",
+	}
+	data, err := msg.format(from, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Header.Get("To"); got != "<alice@example.com>" {
+		t.Errorf("To = %q", got)
+	}
+	if got := parsed.Header.Get("Bcc"); got != "" {
+		t.Errorf("subject injected a Bcc header: %q", got)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Grüße  Bcc: eve@example.com" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if !strings.HasSuffix(parsed.Header.Get("Message-ID"), "@example.com>") {
+		t.Errorf("Message-ID = %q", parsed.Header.Get("Message-ID"))
+	}
+	if !strings.Contains(string(data), "\r\nHello\r\nhttps://app.example.com/verify-email?token=3Dabc") {
+		t.Errorf("unexpected body:\n%s", data)
+	}
+}
+
+func TestLogMailerWritesFile(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewLogMailer(dir, "no-reply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(context.Background(), Message{To: "bob@example.com", Subject: "Hi", Text: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: <bob@example.com>") {
+		t.Errorf("unexpected message:\n%s", data)
+	}
+}
@@ -0,0 +1,129 @@
+package mailer
+
+import (
+    "context"
+    "crypto/tls"
+    "fmt"
+    "net"
+    "net/mail"
+    "net/smtp"
+    "strconv"
+    "time"
+)
+
+// TLS modes of SMTPMailer.
+const (
+    TLSStartTLS = "starttls"
+    TLSImplicit = "tls"
+    TLSNone     = "none"
+)
+
+// SMTPConfig is where and how SMTPMailer delivers.
+type SMTPConfig struct {
+    Host     string
+    Port     int
+    Username string
+    Password string
+    // TLS is TLSStartTLS, TLSImplicit or TLSNone. STARTTLS is required,
+    // not opportunistic.
+    TLS string
+    // TLSConfig overrides the defaults, e.g. with a private CA
+    TLSConfig *tls.Config
+}
+
+// SMTPMailer sends each message over a new SMTP connection.
+type SMTPMailer struct {
+    cfg  SMTPConfig
+    from *mail.Address
+}
+
+func NewSMTPMailer(cfg SMTPConfig, from string) (*SMTPMailer, error) {
+    address, err := mail.ParseAddress(from)
+    if err != nil {
+        return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+    }
+    return &SMTPMailer{cfg: cfg, from: address}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+    data, err := msg.format(m.from, time.Now())
+    if err != nil {
+        return err
+    }
+    to, err := mail.ParseAddress(msg.To)
+    if err != nil {
+        return err
+    }
+
+    client, err := m.dial(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to connect to SMTP server: %w", err)
+    }
+    defer client.Close()
+
+    if m.cfg.Username != "" {
+        if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+            return fmt.Errorf("SMTP authentication failed: %w", err)
+        }
+    }
+    if err := client.Mail(m.from.Address); err != nil {
+        return fmt.Errorf("SMTP server refused sender: %w", err)
+    }
+    if err := client.Rcpt(to.Address); err != nil {
+        return fmt.Errorf("SMTP server refused recipient: %w", err)
+    }
+    w, err := client.Data()
+    if err != nil {
+        return fmt.Errorf("SMTP DATA failed: %w", err)
+    }
+    if _, err := w.Write(data); err != nil {
+        return fmt.Errorf("failed to send message: %w", err)
+    }
+    if err := w.Close(); err != nil {
+        return fmt.Errorf("SMTP server rejected message: %w", err)
+    }
+    return client.Quit()
+}
+
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+    addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+    tlsConfig := m.cfg.TLSConfig
+    if tlsConfig == nil {
+        tlsConfig = &tls.Config{ServerName: m.cfg.Host, MinVersion: tls.VersionTLS12}
+    }
+
+    dialer := &net.Dialer{Timeout: 30 * time.Second}
+    var conn net.Conn
+    var err error
+    if m.cfg.TLS == TLSImplicit {
+        conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+    } else {
+        conn, err = dialer.DialContext(ctx, "tcp", addr)
+    }
+    if err != nil {
+        return nil, err
+    }
+    // Bound the whole conversation, not just the dial
+    deadline, ok := ctx.Deadline()
+    if !ok {
+        deadline = time.Now().Add(time.Minute)
+    }
+    conn.SetDeadline(deadline)
+
+    client, err := smtp.NewClient(conn, m.cfg.Host)
+    if err != nil {
+        conn.Close()
+        return nil, err
+    }
+    if m.cfg.TLS == TLSStartTLS {
+        if ok, _ := client.Extension("STARTTLS"); !ok {
+            client.Close()
+            return nil, fmt.Errorf("server does not support STARTTLS")
+        }
+        if err := client.StartTLS(tlsConfig); err != nil {
+            client.Close()
+            return nil, err
+        }
+    }
+    return client, nil
+}
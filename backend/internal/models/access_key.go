@@ -0,0 +1,42 @@
+// internal/models/access_key.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AccessKey is an S3-style credential pair owned by a user. SigV4 needs the
+// secret itself to verify signatures, so it is stored as issued and never
+// returned after creation.
+type AccessKey struct {
+    ID          primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+    UserID      string            `bson:"user_id" json:"-"`
+    AccessKeyID string            `bson:"access_key_id" json:"accessKeyId"`
+    SecretKey   string            `bson:"secret_key" json:"-"`
+    Name        string            `bson:"name" json:"name"`
+    CreatedAt   time.Time         `bson:"created_at" json:"createdAt"`
+    LastUsedAt  *time.Time        `bson:"last_used_at,omitempty" json:"lastUsedAt,omitempty"`
+}
+
+// MultipartUpload is an S3 multipart upload in progress. Parts are kept as
+// separate objects until the upload is completed into a regular file.
+type MultipartUpload struct {
+    ID          primitive.ObjectID       `bson:"_id,omitempty" json:"uploadId"`
+    UserID      string                   `bson:"user_id" json:"-"`
+    Key         string                   `bson:"key" json:"key"`
+    ContentType string                   `bson:"content_type" json:"contentType"`
+    Parts       map[string]MultipartPart `bson:"parts" json:"parts"`
+    CreatedAt   time.Time                `bson:"created_at" json:"createdAt"`
+    // ExpiresAt is when an unfinished upload is discarded
+    ExpiresAt   time.Time                `bson:"expires_at" json:"expiresAt"`
+}
+
+// MultipartPart is one uploaded part, keyed by its part number.
+type MultipartPart struct {
+    Number     int       `bson:"number" json:"partNumber"`
+    ETag       string    `bson:"etag" json:"etag"`
+    Size       int64     `bson:"size" json:"size"`
+    UploadedAt time.Time `bson:"uploaded_at" json:"uploadedAt"`
+}
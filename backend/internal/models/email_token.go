@@ -0,0 +1,30 @@
+// internal/models/email_token.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Email token purposes
+const (
+    TokenVerifyEmail   = "verify_email"
+    TokenResetPassword = "reset_password"
+    TokenChangeEmail   = "change_email"
+)
+
+// EmailToken is a single-use link sent by email. Only the SHA-256 hash of
+// the token is stored.
+type EmailToken struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty"`
+    Purpose   string             `bson:"purpose"`
+    TokenHash string             `bson:"token_hash"`
+    UserID    string             `bson:"user_id"`
+    // Email is the address the token was sent to. Verifying it only
+    // counts while the account still has it; for an email change it is
+    // the new address.
+    Email     string    `bson:"email"`
+    CreatedAt time.Time `bson:"created_at"`
+    ExpiresAt time.Time `bson:"expires_at"`
+}
@@ -0,0 +1,17 @@
+// models/folder.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Folder is a folder created explicitly (e.g. WebDAV MKCOL). Folders that
+// contain files exist implicitly and need no record.
+type Folder struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID    string             `bson:"user_id" json:"-"`
+    Path      string             `bson:"path" json:"path"`
+    CreatedAt time.Time          `bson:"created_at" json:"createdAt"`
+}
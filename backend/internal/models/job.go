@@ -0,0 +1,46 @@
+// internal/models/job.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobStatus describes where a job is in its lifecycle.
+type JobStatus string
+
+const (
+    JobPending   JobStatus = "pending"
+    JobRunning   JobStatus = "running"
+    JobSucceeded JobStatus = "succeeded"
+    JobDead      JobStatus = "dead"
+)
+
+// Job is a unit of background work stored in the jobs collection.
+// Payload holds the job-specific arguments (file ID, user ID, ...).
+type Job struct {
+    ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Type           string            `bson:"type" json:"type"`
+    Payload        map[string]string `bson:"payload" json:"payload"`
+    Status         JobStatus         `bson:"status" json:"status"`
+    Attempts       int               `bson:"attempts" json:"attempts"`
+    MaxAttempts    int               `bson:"max_attempts" json:"maxAttempts"`
+    LastError      string            `bson:"last_error,omitempty" json:"lastError,omitempty"`
+    RunAt          time.Time         `bson:"run_at" json:"runAt"`
+    LeaseOwner     string            `bson:"lease_owner,omitempty" json:"leaseOwner,omitempty"`
+    LeaseExpiresAt *time.Time        `bson:"lease_expires_at,omitempty" json:"leaseExpiresAt,omitempty"`
+    CreatedAt      time.Time         `bson:"created_at" json:"createdAt"`
+    UpdatedAt      time.Time         `bson:"updated_at" json:"updatedAt"`
+    CompletedAt    *time.Time        `bson:"completed_at,omitempty" json:"completedAt,omitempty"`
+    Progress       *JobProgress      `bson:"progress,omitempty" json:"progress,omitempty"`
+}
+
+// JobProgress is what a long-running job reports while it works. Total is
+// 0 when it isn't known in advance.
+type JobProgress struct {
+    Done    int64  `bson:"done" json:"done"`
+    Total   int64  `bson:"total" json:"total"`
+    Bytes   int64  `bson:"bytes,omitempty" json:"bytes,omitempty"`
+    Message string `bson:"message,omitempty" json:"message,omitempty"`
+}
@@ -0,0 +1,34 @@
+// internal/models/login_attempt.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Login attempt outcomes
+const (
+    LoginSucceeded       = "success"
+    LoginBadPassword     = "invalid_password"
+    LoginUnknownEmail    = "unknown_email"
+    LoginThrottled       = "throttled"
+    LoginCaptchaRequired = "captcha_required"
+    LoginCaptchaFailed   = "captcha_failed"
+    LoginDisabled        = "disabled"
+    LoginMFARequired     = "mfa_required"
+    LoginMFAFailed       = "mfa_failed"
+    LoginSSOFailed       = "sso_failed"
+)
+
+// LoginAttempt is the audit record of one sign-in attempt. UserID is empty
+// when the email doesn't belong to an account.
+type LoginAttempt struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Email     string             `bson:"email" json:"email"`
+    UserID    string             `bson:"user_id,omitempty" json:"userID,omitempty"`
+    IPAddress string             `bson:"ip_address" json:"ipAddress"`
+    Outcome   string             `bson:"outcome" json:"outcome"`
+    At        time.Time          `bson:"at" json:"at"`
+    ExpiresAt time.Time          `bson:"expires_at" json:"-"`
+}
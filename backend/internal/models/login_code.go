@@ -0,0 +1,17 @@
+// internal/models/login_code.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginCode is a single-use code that trades a finished single sign-on
+// for a session token. Only its SHA-256 hash is stored.
+type LoginCode struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty"`
+    CodeHash  string             `bson:"code_hash"`
+    AccountID string             `bson:"account_id"`
+    ExpiresAt time.Time          `bson:"expires_at"`
+}
@@ -13,11 +13,43 @@ type FileMinIO struct {
     UserID      string            `bson:"user_id" json:"userID"`
     FileName    string            `bson:"file_name" json:"fileName"`
     FileType    string            `bson:"file_type" json:"fileType"`
+    Folder      string            `bson:"folder,omitempty" json:"folder,omitempty"`
     Size        float64             `bson:"size" json:"size"`
     TotalChunks int               `bson:"total_chunks" json:"totalChunks"`
+    ChunkSize   int64             `bson:"chunk_size,omitempty" json:"chunkSize,omitempty"`
     CreatedAt   time.Time         `bson:"created_at" json:"createdAt"`
     UpdatedAt   time.Time         `bson:"updated_at" json:"updatedAt"`
     Complete    bool              `bson:"complete" json:"complete"`
     MinioPath   string           `bson:"minio_path" json:"minioPath"`
     BucketName  string           `bson:"bucket_name" json:"bucketName"`
-}
\ No newline at end of file
+    Checksum    string           `bson:"checksum,omitempty" json:"checksum,omitempty"`
+    // SizeMismatch is set when the stored content differed from the
+    // declared size; Size is then the stored size
+    SizeMismatch bool            `bson:"size_mismatch,omitempty" json:"sizeMismatch,omitempty"`
+    ThumbnailPath string         `bson:"thumbnail_path,omitempty" json:"thumbnailPath,omitempty"`
+    Scan        *ScanResult      `bson:"scan,omitempty" json:"scan,omitempty"`
+    ETag        string           `bson:"etag,omitempty" json:"etag,omitempty"`
+    Tags        []string         `bson:"tags,omitempty" json:"tags,omitempty"`
+    // Resumable (tus) uploads only: bytes stored so far and when an
+    // unfinished upload is discarded
+    UploadOffset    int64      `bson:"upload_offset,omitempty" json:"uploadOffset,omitempty"`
+    UploadExpiresAt *time.Time `bson:"upload_expires_at,omitempty" json:"uploadExpiresAt,omitempty"`
+    // The PATCH request currently writing the upload, and until when
+    UploadLease      string     `bson:"upload_lease,omitempty" json:"-"`
+    UploadLeaseUntil *time.Time `bson:"upload_lease_until,omitempty" json:"-"`
+}
+
+// Scan statuses.
+const (
+    ScanClean    = "clean"
+    ScanInfected = "infected"
+    // ScanSkipped is recorded when no scanner is configured
+    ScanSkipped  = "skipped"
+)
+
+// ScanResult is the outcome of the malware scan of a file.
+type ScanResult struct {
+    Status    string    `bson:"status" json:"status"`
+    Threats   []string  `bson:"threats,omitempty" json:"threats,omitempty"`
+    ScannedAt time.Time `bson:"scanned_at" json:"scannedAt"`
+}
@@ -0,0 +1,23 @@
+// internal/models/plan.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Plan is a storage tier. Numeric limits of zero mean "unlimited" and an
+// empty AllowedTypes list allows every file type.
+type Plan struct {
+    ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Name          string            `bson:"name" json:"name"`
+    DisplayName   string            `bson:"display_name" json:"displayName"`
+    StorageLimit  float64           `bson:"storage_limit" json:"storageLimit"`
+    MaxFileSize   float64           `bson:"max_file_size" json:"maxFileSize"`
+    MaxFiles      int64             `bson:"max_files" json:"maxFiles"`
+    AllowedTypes  []string          `bson:"allowed_types" json:"allowedTypes"`
+    MaxShareLinks int64             `bson:"max_share_links" json:"maxShareLinks"`
+    CreatedAt     time.Time         `bson:"created_at" json:"createdAt"`
+    UpdatedAt     time.Time         `bson:"updated_at" json:"updatedAt"`
+}
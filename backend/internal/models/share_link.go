@@ -0,0 +1,21 @@
+// internal/models/share_link.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShareLink lets anyone holding Token download one file without an
+// account. A link without ExpiresAt lasts until it or the file is deleted.
+type ShareLink struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Token     string             `bson:"token" json:"token"`
+    FileID    primitive.ObjectID `bson:"file_id" json:"fileId"`
+    UserID    string             `bson:"user_id" json:"-"`
+    CreatedAt time.Time          `bson:"created_at" json:"createdAt"`
+    ExpiresAt *time.Time         `bson:"expires_at,omitempty" json:"expiresAt,omitempty"`
+    // URL is the public download address, filled in for responses
+    URL       string             `bson:"-" json:"url,omitempty"`
+}
@@ -6,17 +6,67 @@ import (
     "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// User roles
+const (
+    RoleUser  = "user"
+    RoleAdmin = "admin"
+)
+
 type User struct {
-    ID           primitive.ObjectID `bson:"_id,omitempty"`
-    UserID       string            `bson:"user_id"`
-    Name         string            `bson:"name"`
-    Email        string            `bson:"email"`
-    Password     string            `bson:"password"`
-    StorageUsed  float64          `bson:"storage_used"`
-    StorageLimit float64          `bson:"storage_limit"`
-    CreatedAt    time.Time        `bson:"created_at"`
-    IPAddress    string           `bson:"ip_address"`
-    IsLocked     bool             `bson:"is_locked"`
-    LockExpiresAt *time.Time      `bson:"lock_expires_at,omitempty"`
-    FailedAttempts int            `bson:"failed_attempts"`
-}
\ No newline at end of file
+    ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID       string            `bson:"user_id" json:"userID"`
+    Name         string            `bson:"name" json:"username"`
+    Email        string            `bson:"email" json:"email"`
+    Password     string            `bson:"password" json:"-"`
+    Role         string            `bson:"role,omitempty" json:"role"`
+    Plan         string            `bson:"plan,omitempty" json:"plan"`
+    StorageUsed  float64          `bson:"storage_used" json:"storageUsed"`
+    StorageLimit float64          `bson:"storage_limit" json:"storageLimit"`
+    CreatedAt    time.Time        `bson:"created_at" json:"createdAt"`
+    IPAddress    string           `bson:"ip_address" json:"ipAddress"`
+    IsLocked     bool             `bson:"is_locked" json:"isLocked"`
+    LockExpiresAt *time.Time      `bson:"lock_expires_at,omitempty" json:"lockExpiresAt,omitempty"`
+    FailedAttempts int            `bson:"failed_attempts" json:"failedAttempts"`
+    IsDisabled   bool             `bson:"is_disabled" json:"isDisabled"`
+    EmailVerified   bool          `bson:"email_verified" json:"emailVerified"`
+    EmailVerifiedAt *time.Time    `bson:"email_verified_at,omitempty" json:"emailVerifiedAt,omitempty"`
+    // SessionVersion is carried in session tokens; raising it ends every
+    // session of the account
+    SessionVersion int           `bson:"session_version,omitempty" json:"-"`
+    // Two-factor authentication. Secrets are sealed with the server's MFA
+    // key; recovery codes are SHA-256 hashes and removed once used.
+    TOTPEnabled       bool     `bson:"totp_enabled" json:"totpEnabled"`
+    TOTPSecret        string   `bson:"totp_secret,omitempty" json:"-"`
+    TOTPPendingSecret string   `bson:"totp_pending_secret,omitempty" json:"-"`
+    TOTPLastStep      int64    `bson:"totp_last_step,omitempty" json:"-"`
+    RecoveryCodes     []string `bson:"recovery_codes,omitempty" json:"-"`
+    // UsedMFAChallenges are the login challenges already completed, kept
+    // until they expire so each one works once
+    UsedMFAChallenges []UsedMFAChallenge `bson:"used_mfa_challenges,omitempty" json:"-"`
+    // ShareLease is held while share links are counted and created, so
+    // concurrent requests can't exceed the plan's limit together
+    ShareLease      string     `bson:"share_lease,omitempty" json:"-"`
+    ShareLeaseUntil *time.Time `bson:"share_lease_until,omitempty" json:"-"`
+    // Identities are the single sign-on accounts linked to this one.
+    // Accounts created by single sign-on have no password.
+    Identities []ExternalIdentity `bson:"identities,omitempty" json:"identities,omitempty"`
+}
+
+// UsedMFAChallenge is a completed two-factor login challenge.
+type UsedMFAChallenge struct {
+    ID        string    `bson:"id"`
+    ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// ExternalIdentity is an account at an OpenID Connect provider, named by
+// the provider's issuer URL and its subject identifier.
+type ExternalIdentity struct {
+    Issuer   string    `bson:"issuer" json:"issuer"`
+    Subject  string    `bson:"subject" json:"subject"`
+    LinkedAt time.Time `bson:"linked_at" json:"linkedAt"`
+}
+
+// IsAdmin reports whether the user has the admin role.
+func (u *User) IsAdmin() bool {
+    return u.Role == RoleAdmin
+}
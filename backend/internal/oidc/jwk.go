@@ -0,0 +1,97 @@
+package oidc
+
+import (
+    "crypto/ecdh"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rsa"
+    "encoding/base64"
+    "math/big"
+)
+
+// jwkSet is a JSON Web Key Set (RFC 7517).
+type jwkSet struct {
+    Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    N   string `json:"n"`
+    E   string `json:"e"`
+    Crv string `json:"crv"`
+    X   string `json:"x"`
+    Y   string `json:"y"`
+}
+
+// publicKeys returns the set's signing keys by ID. Keys of other types or
+// uses, and ones that don't parse, are left out.
+func (s jwkSet) publicKeys() map[string]interface{} {
+    keys := make(map[string]interface{}, len(s.Keys))
+    for _, k := range s.Keys {
+        if k.Use != "" && k.Use != "sig" {
+            continue
+        }
+        var key interface{}
+        switch k.Kty {
+        case "RSA":
+            key = k.rsaKey()
+        case "EC":
+            key = k.ecKey()
+        }
+        if key != nil {
+            keys[k.Kid] = key
+        }
+    }
+    return keys
+}
+
+func (k jwk) rsaKey() *rsa.PublicKey {
+    n, err := base64.RawURLEncoding.DecodeString(k.N)
+    if err != nil || len(n) == 0 {
+        return nil
+    }
+    e, err := base64.RawURLEncoding.DecodeString(k.E)
+    if err != nil || len(e) == 0 || len(e) > 4 {
+        return nil
+    }
+    exponent := 0
+    for _, b := range e {
+        exponent = exponent<<8 | int(b)
+    }
+    return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}
+}
+
+func (k jwk) ecKey() *ecdsa.PublicKey {
+    var curve elliptic.Curve
+    var check ecdh.Curve
+    switch k.Crv {
+    case "P-256":
+        curve, check = elliptic.P256(), ecdh.P256()
+    case "P-384":
+        curve, check = elliptic.P384(), ecdh.P384()
+    case "P-521":
+        curve, check = elliptic.P521(), ecdh.P521()
+    default:
+        return nil
+    }
+    x, err := base64.RawURLEncoding.DecodeString(k.X)
+    if err != nil {
+        return nil
+    }
+    y, err := base64.RawURLEncoding.DecodeString(k.Y)
+    if err != nil {
+        return nil
+    }
+    size := (curve.Params().BitSize + 7) / 8
+    if len(x) != size || len(y) != size {
+        return nil
+    }
+    // crypto/ecdh rejects points that aren't on the curve
+    point := append(append([]byte{4}, x...), y...)
+    if _, err := check.NewPublicKey(point); err != nil {
+        return nil
+    }
+    return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+}
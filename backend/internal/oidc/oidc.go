@@ -0,0 +1,344 @@
+// Package oidc signs users in with an OpenID Connect provider, using the
+// authorization code flow with PKCE (RFC 7636). The provider is found
+// through its discovery document and ID tokens are checked against its
+// published keys (JWKS).
+package oidc
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/golang-jwt/jwt/v4"
+)
+
+// ErrInvalidIDToken is returned for ID tokens that fail verification.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+const (
+    // keysRefreshInterval is the least time between two JWKS downloads
+    // caused by tokens signed with unknown keys
+    keysRefreshInterval = time.Minute
+    // maxResponseSize bounds documents read from the provider
+    maxResponseSize = 1 << 20
+)
+
+// signingMethods are the ID token algorithms accepted. "none" and HMAC
+// never are.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Config identifies the provider and this client to it.
+type Config struct {
+    Issuer       string
+    ClientID     string
+    ClientSecret string
+    RedirectURL  string
+    Scopes       []string
+    // HTTPClient talks to the provider; nil means a client with a 10s
+    // timeout
+    HTTPClient *http.Client
+}
+
+// Claims are the parts of a verified ID token Storely uses.
+type Claims struct {
+    Issuer            string
+    Subject           string
+    Email             string
+    EmailVerified     bool
+    Name              string
+    PreferredUsername string
+}
+
+// Provider is a client of one OpenID Connect provider. Discovery happens
+// on first use, so the provider needn't be up when the server starts.
+type Provider struct {
+    cfg    Config
+    client *http.Client
+
+    mu        sync.Mutex
+    discovery *discovery
+    keys      map[string]interface{}
+    keysAt    time.Time
+}
+
+type discovery struct {
+    Issuer                string   `json:"issuer"`
+    AuthorizationEndpoint string   `json:"authorization_endpoint"`
+    TokenEndpoint         string   `json:"token_endpoint"`
+    JWKSURI               string   `json:"jwks_uri"`
+    CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+func NewProvider(cfg Config) *Provider {
+    client := cfg.HTTPClient
+    if client == nil {
+        client = &http.Client{Timeout: 10 * time.Second}
+    }
+    return &Provider{cfg: cfg, client: client}
+}
+
+// Issuer returns the provider's issuer URL.
+func (p *Provider) Issuer() string {
+    return p.cfg.Issuer
+}
+
+// RandomValue returns a URL-safe random string for states, nonces and
+// code verifiers.
+func RandomValue() (string, error) {
+    raw := make([]byte, 32)
+    if _, err := rand.Read(raw); err != nil {
+        return "", fmt.Errorf("failed to generate random value: %w", err)
+    }
+    return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// codeChallenge is the S256 PKCE challenge of verifier.
+func codeChallenge(verifier string) string {
+    sum := sha256.Sum256([]byte(verifier))
+    return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the provider URL that starts a login. state and nonce
+// come back in the callback and ID token; verifier must be passed to
+// Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+    d, err := p.discover(ctx)
+    if err != nil {
+        return "", err
+    }
+    query := url.Values{}
+    query.Set("response_type", "code")
+    query.Set("client_id", p.cfg.ClientID)
+    query.Set("redirect_uri", p.cfg.RedirectURL)
+    query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+    query.Set("state", state)
+    query.Set("nonce", nonce)
+    query.Set("code_challenge", codeChallenge(verifier))
+    query.Set("code_challenge_method", "S256")
+
+    separator := "?"
+    if strings.Contains(d.AuthorizationEndpoint, "?") {
+        separator = "&"
+    }
+    return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the raw ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+    d, err := p.discover(ctx)
+    if err != nil {
+        return "", err
+    }
+    form := url.Values{}
+    form.Set("grant_type", "authorization_code")
+    form.Set("code", code)
+    form.Set("redirect_uri", p.cfg.RedirectURL)
+    form.Set("code_verifier", verifier)
+    if p.cfg.ClientSecret == "" {
+        form.Set("client_id", p.cfg.ClientID)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    req.Header.Set("Accept", "application/json")
+    if p.cfg.ClientSecret != "" {
+        // client_secret_basic; RFC 6749 2.3.1 form-encodes both parts
+        req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+    }
+
+    var body struct {
+        IDToken          string `json:"id_token"`
+        Error            string `json:"error"`
+        ErrorDescription string `json:"error_description"`
+    }
+    status, err := p.getJSON(req, &body)
+    if err != nil {
+        return "", fmt.Errorf("token request failed: %w", err)
+    }
+    if status != http.StatusOK || body.Error != "" {
+        return "", fmt.Errorf("token request failed with status %d: %s %s", status, body.Error, body.ErrorDescription)
+    }
+    if body.IDToken == "" {
+        return "", fmt.Errorf("token response has no id_token")
+    }
+    return body.IDToken, nil
+}
+
+// idTokenClaims is the ID token payload. email_verified is a string in
+// some providers' tokens.
+type idTokenClaims struct {
+    jwt.RegisteredClaims
+    AuthorizedParty   string      `json:"azp"`
+    Nonce             string      `json:"nonce"`
+    Email             string      `json:"email"`
+    EmailVerified     interface{} `json:"email_verified"`
+    Name              string      `json:"name"`
+    PreferredUsername string      `json:"preferred_username"`
+}
+
+// Verify checks an ID token's signature against the provider's keys, its
+// issuer, audience, expiry and nonce, and returns its claims.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+    if _, err := p.discover(ctx); err != nil {
+        return nil, err
+    }
+
+    var claims idTokenClaims
+    parser := jwt.NewParser(jwt.WithValidMethods(signingMethods))
+    _, err := parser.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+        kid, _ := token.Header["kid"].(string)
+        return p.key(ctx, kid)
+    })
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+    }
+
+    switch {
+    case claims.Issuer != p.cfg.Issuer:
+        return nil, fmt.Errorf("%w: issued by %q", ErrInvalidIDToken, claims.Issuer)
+    case !claims.VerifyAudience(p.cfg.ClientID, true):
+        return nil, fmt.Errorf("%w: not issued to this client", ErrInvalidIDToken)
+    case len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID:
+        return nil, fmt.Errorf("%w: authorized party is %q", ErrInvalidIDToken, claims.AuthorizedParty)
+    case claims.ExpiresAt == nil:
+        return nil, fmt.Errorf("%w: no expiry", ErrInvalidIDToken)
+    case claims.Subject == "":
+        return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+    case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+        return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+    }
+
+    verified := false
+    switch v := claims.EmailVerified.(type) {
+    case bool:
+        verified = v
+    case string:
+        verified = v == "true"
+    }
+    return &Claims{
+        Issuer:            claims.Issuer,
+        Subject:           claims.Subject,
+        Email:             claims.Email,
+        EmailVerified:     verified,
+        Name:              claims.Name,
+        PreferredUsername: claims.PreferredUsername,
+    }, nil
+}
+
+// discover loads and caches the discovery document. Failures aren't
+// cached, so a provider that was down is tried again.
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if p.discovery != nil {
+        return p.discovery, nil
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+    if err != nil {
+        return nil, err
+    }
+    var d discovery
+    status, err := p.getJSON(req, &d)
+    if err != nil {
+        return nil, fmt.Errorf("discovery failed: %w", err)
+    }
+    if status != http.StatusOK {
+        return nil, fmt.Errorf("discovery failed with status %d", status)
+    }
+    if d.Issuer != p.cfg.Issuer {
+        return nil, fmt.Errorf("discovery document is for issuer %q, not %q", d.Issuer, p.cfg.Issuer)
+    }
+    if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+        return nil, fmt.Errorf("discovery document lacks an authorization, token or JWKS endpoint")
+    }
+    if len(d.CodeChallengeMethods) > 0 && !contains(d.CodeChallengeMethods, "S256") {
+        return nil, fmt.Errorf("provider doesn't support PKCE with S256")
+    }
+    p.discovery = &d
+    return p.discovery, nil
+}
+
+// key returns the signing key with ID kid, downloading the JWKS again when
+// it's unknown. A token without kid is accepted if the provider has one key.
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    if key := p.cachedKey(kid); key != nil {
+        return key, nil
+    }
+    if time.Since(p.keysAt) < keysRefreshInterval {
+        return nil, fmt.Errorf("unknown signing key %q", kid)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.discovery.JWKSURI, nil)
+    if err != nil {
+        return nil, err
+    }
+    var set jwkSet
+    status, err := p.getJSON(req, &set)
+    if err != nil {
+        return nil, fmt.Errorf("JWKS request failed: %w", err)
+    }
+    if status != http.StatusOK {
+        return nil, fmt.Errorf("JWKS request failed with status %d", status)
+    }
+    p.keys = set.publicKeys()
+    p.keysAt = time.Now()
+
+    if key := p.cachedKey(kid); key != nil {
+        return key, nil
+    }
+    return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) cachedKey(kid string) interface{} {
+    if kid == "" && len(p.keys) == 1 {
+        for _, key := range p.keys {
+            return key
+        }
+    }
+    return p.keys[kid]
+}
+
+// getJSON sends req and decodes the JSON response into v, whatever the
+// status, which it returns.
+func (p *Provider) getJSON(req *http.Request, v interface{}) (int, error) {
+    resp, err := p.client.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+    data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+    if err != nil {
+        return 0, err
+    }
+    if err := json.Unmarshal(data, v); err != nil {
+        return resp.StatusCode, fmt.Errorf("invalid JSON response (status %d): %w", resp.StatusCode, err)
+    }
+    return resp.StatusCode, nil
+}
+
+func contains(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
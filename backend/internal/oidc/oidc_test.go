@@ -0,0 +1,170 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// stubIdP is a minimal OpenID provider: it hands out one ID token per code
+// and checks the PKCE verifier.
+type stubIdP struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	claims    jwt.MapClaims
+	kid       string
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{key: key, kid: "key-1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                           idp.server.URL,
+			"authorization_endpoint":           idp.server.URL + "/authorize",
+			"token_endpoint":                   idp.server.URL + "/token",
+			"jwks_uri":                         idp.server.URL + "/jwks",
+			"code_challenge_methods_supported": []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key-1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || codeChallenge(r.FormValue("code_verifier")) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		token.Header["kid"] = idp.kid
+		signed, err := token.SignedString(idp.key)
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func TestProviderLogin(t *testing.T) {
+	idp := newStubIdP(t)
+	provider := NewProvider(Config{
+		Issuer:      idp.server.URL,
+		ClientID:    "storely",
+		RedirectURL: "https://storely.example/api/auth/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	})
+	ctx := context.Background()
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"sub":            "user-1",
+			"aud":            "storely",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          "nonce-1",
+			"email":          "ada@example.com",
+			"email_verified": "true",
+		}
+	}
+	tests := []struct {
+		name    string
+		modify  func(jwt.MapClaims)
+		kid     string
+		wantErr bool
+	}{
+		{"valid", func(jwt.MapClaims) {}, "key-1", false},
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "other" }, "key-1", true},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "someone-else" }, "key-1", true},
+		{"untrusted azp", func(c jwt.MapClaims) { c["aud"] = []string{"storely", "other"}; c["azp"] = "other" }, "key-1", true},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, "key-1", true},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, "key-1", true},
+		{"unknown key", func(jwt.MapClaims) {}, "key-2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := RandomValue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := url.Parse(authURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := parsed.Query()
+			if query.Get("code_challenge_method") != "S256" || query.Get("state") != "state-1" {
+				t.Fatalf("authorization URL %s lacks PKCE or state", authURL)
+			}
+			idp.challenge = query.Get("code_challenge")
+			idp.claims = valid()
+			tt.modify(idp.claims)
+			idp.kid = tt.kid
+
+			raw, err := provider.Exchange(ctx, "good-code", verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := provider.Verify(ctx, raw, "nonce-1")
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidIDToken) {
+					t.Fatalf("Verify() error = %v, want ErrInvalidIDToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "user-1" || claims.Email != "ada@example.com" || !claims.EmailVerified {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestProviderExchangeChecksVerifier(t *testing.T) {
+	idp := newStubIdP(t)
+	provider := NewProvider(Config{Issuer: idp.server.URL, ClientID: "storely"})
+	ctx := context.Background()
+
+	if _, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier"); err != nil {
+		t.Fatal(err)
+	}
+	idp.challenge = codeChallenge("verifier")
+	if _, err := provider.Exchange(ctx, "good-code", "another-verifier"); err == nil {
+		t.Error("Exchange() with the wrong verifier succeeded")
+	}
+}
@@ -0,0 +1,110 @@
+// internal/repository/access_key_repository.go
+package repository
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "time"
+
+    "backend/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AccessKeyRepository stores S3 access keys in the "access_keys" collection.
+type AccessKeyRepository struct {
+    collection *mongo.Collection
+}
+
+func NewAccessKeyRepository(db *mongo.Database) *AccessKeyRepository {
+    collection := db.Collection("access_keys")
+
+    indexes := []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "access_key_id", Value: 1}},
+            Options: options.Index().SetUnique(true),
+        },
+        {Keys: bson.D{{Key: "user_id", Value: 1}}},
+    }
+    if _, err := collection.Indexes().CreateMany(context.Background(), indexes); err != nil {
+        log.Printf("failed to create access key indexes: %v", err)
+    }
+
+    return &AccessKeyRepository{collection: collection}
+}
+
+func (r *AccessKeyRepository) Create(ctx context.Context, key *models.AccessKey) error {
+    if key == nil {
+        return fmt.Errorf("access key cannot be nil")
+    }
+    if _, err := r.collection.InsertOne(ctx, key); err != nil {
+        return fmt.Errorf("failed to insert access key: %w", err)
+    }
+    return nil
+}
+
+func (r *AccessKeyRepository) FindByAccessKeyID(ctx context.Context, accessKeyID string) (*models.AccessKey, error) {
+    var key models.AccessKey
+    if err := r.collection.FindOne(ctx, bson.M{"access_key_id": accessKeyID}).Decode(&key); err != nil {
+        if err == mongo.ErrNoDocuments {
+            return nil, ErrAccessKeyNotFound
+        }
+        return nil, fmt.Errorf("failed to find access key: %w", err)
+    }
+    return &key, nil
+}
+
+// ListByUser returns a user's access keys, newest first.
+func (r *AccessKeyRepository) ListByUser(ctx context.Context, userID string) ([]models.AccessKey, error) {
+    opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+    cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list access keys: %w", err)
+    }
+
+    keys := []models.AccessKey{}
+    if err := cursor.All(ctx, &keys); err != nil {
+        return nil, fmt.Errorf("failed to decode access keys: %w", err)
+    }
+    return keys, nil
+}
+
+func (r *AccessKeyRepository) CountByUser(ctx context.Context, userID string) (int64, error) {
+    count, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+    if err != nil {
+        return 0, fmt.Errorf("failed to count access keys: %w", err)
+    }
+    return count, nil
+}
+
+// Delete removes one of a user's access keys.
+func (r *AccessKeyRepository) Delete(ctx context.Context, userID, accessKeyID string) error {
+    result, err := r.collection.DeleteOne(ctx, bson.M{"user_id": userID, "access_key_id": accessKeyID})
+    if err != nil {
+        return fmt.Errorf("failed to delete access key: %w", err)
+    }
+    if result.DeletedCount == 0 {
+        return ErrAccessKeyNotFound
+    }
+    return nil
+}
+
+// DeleteByUser removes all of a user's access keys.
+func (r *AccessKeyRepository) DeleteByUser(ctx context.Context, userID string) error {
+    if _, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+        return fmt.Errorf("failed to delete access keys: %w", err)
+    }
+    return nil
+}
+
+// TouchLastUsed records that a key was just used to sign a request.
+func (r *AccessKeyRepository) TouchLastUsed(ctx context.Context, accessKeyID string) error {
+    _, err := r.collection.UpdateOne(ctx, bson.M{"access_key_id": accessKeyID}, bson.M{"$set": bson.M{"last_used_at": time.Now()}})
+    if err != nil {
+        return fmt.Errorf("failed to update access key: %w", err)
+    }
+    return nil
+}
@@ -10,18 +10,19 @@ import (
     "go.mongodb.org/mongo-driver/mongo"
 	  "go.mongodb.org/mongo-driver/bson"
 	  "go.mongodb.org/mongo-driver/bson/primitive"
+	  "go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ChunkRepository struct {
 	db *mongo.Database
 }
 
-func NewChunkRepository(client *mongo.Client) *ChunkRepository {
-	if client == nil {
-			log.Fatal("MongoDB client is nil")
+func NewChunkRepository(db *mongo.Database) *ChunkRepository {
+	if db == nil {
+			log.Fatal("MongoDB database is nil")
 	}
 	return &ChunkRepository{
-			db: client.Database("Storely"),
+			db: db,
 	}
 }
 
@@ -56,11 +57,84 @@ func (r *ChunkRepository) CountChunks(ctx context.Context, fileID string) (int,
 	return int(count), err
 }
 
+// ChunkInfo describes the stored copies of one chunk index of a legacy
+// upload. Size is the size of the newest copy.
+type ChunkInfo struct {
+    Index       int    `bson:"_id"`
+    Size        int64  `bson:"size"`
+    Copies      int    `bson:"copies"`
+    TotalChunks int    `bson:"total_chunks"`
+    FileName    string `bson:"file_name"`
+    FileType    string `bson:"file_type"`
+}
+
+// FileIDs returns the IDs of the files that have chunks stored.
+func (r *ChunkRepository) FileIDs(ctx context.Context) ([]string, error) {
+    values, err := r.db.Collection("chunks").Distinct(ctx, "file_id", bson.M{})
+    if err != nil {
+        return nil, err
+    }
+    ids := make([]string, 0, len(values))
+    for _, v := range values {
+        if id, ok := v.(string); ok {
+            ids = append(ids, id)
+        }
+    }
+    return ids, nil
+}
+
+// ChunkInfos summarizes the chunks of fileID by index, without loading
+// their data.
+func (r *ChunkRepository) ChunkInfos(ctx context.Context, fileID string) ([]ChunkInfo, error) {
+    pipeline := mongo.Pipeline{
+        {{Key: "$match", Value: bson.M{"file_id": fileID}}},
+        {{Key: "$sort", Value: bson.D{{Key: "chunk_index", Value: 1}, {Key: "uploaded_at", Value: 1}}}},
+        {{Key: "$group", Value: bson.M{
+            "_id":          "$chunk_index",
+            "size":         bson.M{"$last": bson.M{"$binarySize": "$data"}},
+            "copies":       bson.M{"$sum": 1},
+            "total_chunks": bson.M{"$max": "$total_chunks"},
+            "file_name":    bson.M{"$last": "$file_name"},
+            "file_type":    bson.M{"$last": "$file_type"},
+        }}},
+        {{Key: "$sort", Value: bson.M{"_id": 1}}},
+    }
+    cursor, err := r.db.Collection("chunks").Aggregate(ctx, pipeline)
+    if err != nil {
+        return nil, err
+    }
+    var infos []ChunkInfo
+    if err := cursor.All(ctx, &infos); err != nil {
+        return nil, err
+    }
+    return infos, nil
+}
+
+// GetChunk returns the newest copy of chunk index of fileID.
+func (r *ChunkRepository) GetChunk(ctx context.Context, fileID string, index int) (*models.FileChunk, error) {
+    opts := options.FindOne().SetSort(bson.M{"uploaded_at": -1})
+    var chunk models.FileChunk
+    err := r.db.Collection("chunks").FindOne(ctx, bson.M{"file_id": fileID, "chunk_index": index}, opts).Decode(&chunk)
+    if err != nil {
+        return nil, err
+    }
+    return &chunk, nil
+}
+
+// DeleteFileChunks removes every chunk of fileID.
+func (r *ChunkRepository) DeleteFileChunks(ctx context.Context, fileID string) (int64, error) {
+    result, err := r.db.Collection("chunks").DeleteMany(ctx, bson.M{"file_id": fileID})
+    if err != nil {
+        return 0, err
+    }
+    return result.DeletedCount, nil
+}
+
 func (r *FileRepository) MarkFileComplete(ctx context.Context, fileID string) error {
 	// Convert string ID to ObjectID
 	objectID, err := primitive.ObjectIDFromHex(fileID)
 	if err != nil {
-			return fmt.Errorf("invalid file ID format: %w", err)
+			return ErrInvalidID.Wrap(err)
 	}
 
 	// Update the file metadata to mark it as complete
@@ -75,7 +149,7 @@ func (r *FileRepository) MarkFileComplete(ctx context.Context, fileID string) er
 	}
 
 	if result.MatchedCount == 0 {
-			return fmt.Errorf("no file found with ID: %s", fileID)
+			return ErrFileNotFound
 	}
 
 	log.Printf("Successfully marked file %s as complete", fileID)
@@ -0,0 +1,100 @@
+// internal/repository/email_token_repository.go
+package repository
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "backend/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EmailTokenRepository stores verification and password reset tokens in
+// the "email_tokens" collection. A TTL index removes expired ones.
+type EmailTokenRepository struct {
+    collection *mongo.Collection
+}
+
+func NewEmailTokenRepository(db *mongo.Database) *EmailTokenRepository {
+    collection := db.Collection("email_tokens")
+
+    indexes := []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "token_hash", Value: 1}},
+            Options: options.Index().SetUnique(true),
+        },
+        {Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}},
+        {
+            Keys:    bson.D{{Key: "expires_at", Value: 1}},
+            Options: options.Index().SetExpireAfterSeconds(0),
+        },
+    }
+    if _, err := collection.Indexes().CreateMany(context.Background(), indexes); err != nil {
+        log.Printf("failed to create email token indexes: %v", err)
+    }
+
+    return &EmailTokenRepository{collection: collection}
+}
+
+func (r *EmailTokenRepository) Create(ctx context.Context, token *models.EmailToken) error {
+    if _, err := r.collection.InsertOne(ctx, token); err != nil {
+        return fmt.Errorf("failed to insert email token: %w", err)
+    }
+    return nil
+}
+
+// Consume deletes and returns the unexpired token with tokenHash, so it
+// works only once. The TTL index is not relied on for expiry, since it
+// only runs once a minute.
+func (r *EmailTokenRepository) Consume(ctx context.Context, purpose, tokenHash string, now time.Time) (*models.EmailToken, error) {
+    var token models.EmailToken
+    err := r.collection.FindOneAndDelete(ctx, bson.M{
+        "token_hash": tokenHash,
+        "purpose":    purpose,
+        "expires_at": bson.M{"$gt": now},
+    }).Decode(&token)
+    if errors.Is(err, mongo.ErrNoDocuments) {
+        return nil, ErrEmailTokenInvalid
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to consume email token: %w", err)
+    }
+    return &token, nil
+}
+
+// LatestCreatedAt returns when the user's newest token for purpose was
+// issued, or the zero time.
+func (r *EmailTokenRepository) LatestCreatedAt(ctx context.Context, userID, purpose string) (time.Time, error) {
+    var token models.EmailToken
+    opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+    err := r.collection.FindOne(ctx, bson.M{"user_id": userID, "purpose": purpose}, opts).Decode(&token)
+    if errors.Is(err, mongo.ErrNoDocuments) {
+        return time.Time{}, nil
+    }
+    if err != nil {
+        return time.Time{}, fmt.Errorf("failed to find email token: %w", err)
+    }
+    return token.CreatedAt, nil
+}
+
+// DeleteForUser revokes the user's outstanding tokens for purpose.
+func (r *EmailTokenRepository) DeleteForUser(ctx context.Context, userID, purpose string) error {
+    if _, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose}); err != nil {
+        return fmt.Errorf("failed to delete email tokens: %w", err)
+    }
+    return nil
+}
+
+// DeleteByUser removes all of a user's tokens.
+func (r *EmailTokenRepository) DeleteByUser(ctx context.Context, userID string) error {
+    if _, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+        return fmt.Errorf("failed to delete email tokens: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,26 @@
+// internal/repository/errors.go
+package repository
+
+import (
+    "net/http"
+
+    "backend/internal/apperr"
+)
+
+// Errors returned by the repositories. Match them with errors.Is.
+var (
+    ErrInvalidID            = apperr.New(http.StatusBadRequest, apperr.CodeBadRequest, "Invalid ID format")
+    ErrUserNotFound         = apperr.New(http.StatusNotFound, apperr.CodeUserNotFound, "User not found")
+    ErrFileNotFound         = apperr.New(http.StatusNotFound, apperr.CodeFileNotFound, "File not found")
+    ErrJobNotFound          = apperr.New(http.StatusNotFound, apperr.CodeJobNotFound, "Job not found")
+    ErrAccessKeyNotFound    = apperr.New(http.StatusNotFound, apperr.CodeAccessKeyNotFound, "Access key not found")
+    ErrUploadNotFound       = apperr.New(http.StatusNotFound, apperr.CodeNotFound, "Upload not found")
+    ErrShareLinkNotFound    = apperr.New(http.StatusNotFound, apperr.CodeNotFound, "Share link not found")
+    ErrEmailTaken           = apperr.New(http.StatusConflict, apperr.CodeEmailTaken, "Email already registered")
+    ErrUsernameTaken        = apperr.New(http.StatusConflict, apperr.CodeUsernameTaken, "Username already taken")
+    ErrStorageLimitExceeded = apperr.New(http.StatusForbidden, apperr.CodeQuotaExceeded, "Storage limit exceeded")
+    ErrTOTPNotPending       = apperr.New(http.StatusConflict, apperr.CodeConflict, "No two-factor enrollment in progress")
+    ErrEmailTokenInvalid    = apperr.New(http.StatusBadRequest, apperr.CodeInvalidEmailToken, "Link is invalid or has expired")
+    ErrLoginCodeInvalid     = apperr.New(http.StatusUnauthorized, apperr.CodeInvalidToken, "Sign-in code is invalid or has expired")
+    ErrIdentityLinked       = apperr.New(http.StatusConflict, apperr.CodeConflict, "Single sign-on identity is already linked to an account")
+)
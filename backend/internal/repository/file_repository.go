@@ -18,9 +18,9 @@ type FileRepository struct {
 }
 
 // NewFileRepository initializes a new instance of FileRepository.
-// It sets up a connection to the "file_metadata" collection in the "Storely" database.
-func NewFileRepository(client *mongo.Client) *FileRepository {
-    collection := client.Database("Storely").Collection("file_metadata")
+// It sets up a connection to the "file_metadata" collection of db.
+func NewFileRepository(db *mongo.Database) *FileRepository {
+    collection := db.Collection("file_metadata")
     return &FileRepository{collection: collection}
 }
 
@@ -66,17 +66,43 @@ func (r *FileRepository) CreateFile(ctx context.Context, file *models.File) erro
 func (r *FileRepository) GetFileByID(ctx context.Context, fileID string) (*models.File, error) {
     objectID, err := primitive.ObjectIDFromHex(fileID)
     if err != nil {
-        return nil, fmt.Errorf("invalid file ID format: %w", err)
+        return nil, ErrInvalidID.Wrap(err)
     }
 
     var file models.File
     err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&file)
     if err != nil {
         if err == mongo.ErrNoDocuments {
-            return nil, fmt.Errorf("file not found")
+            return nil, ErrFileNotFound
         }
         return nil, fmt.Errorf("error retrieving file: %w", err)
     }
 
     return &file, nil
 }
+
+
+// List returns every file metadata record.
+func (r *FileRepository) List(ctx context.Context) ([]models.FileMetadata, error) {
+    cursor, err := r.collection.Find(ctx, bson.M{})
+    if err != nil {
+        return nil, fmt.Errorf("error listing files: %w", err)
+    }
+    var files []models.FileMetadata
+    if err := cursor.All(ctx, &files); err != nil {
+        return nil, fmt.Errorf("error listing files: %w", err)
+    }
+    return files, nil
+}
+
+// Delete removes the metadata record of fileID.
+func (r *FileRepository) Delete(ctx context.Context, fileID string) error {
+    objectID, err := primitive.ObjectIDFromHex(fileID)
+    if err != nil {
+        return ErrInvalidID.Wrap(err)
+    }
+    if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+        return fmt.Errorf("error deleting file: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,103 @@
+// internal/repository/folder_repository.go
+package repository
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "regexp"
+    "time"
+
+    "backend/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FolderRepository stores explicitly created folders in the "folders"
+// collection.
+type FolderRepository struct {
+    collection *mongo.Collection
+}
+
+func NewFolderRepository(db *mongo.Database) *FolderRepository {
+    collection := db.Collection("folders")
+
+    index := mongo.IndexModel{
+        Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "path", Value: 1}},
+        Options: options.Index().SetUnique(true),
+    }
+    if _, err := collection.Indexes().CreateOne(context.Background(), index); err != nil {
+        log.Printf("failed to create folder indexes: %v", err)
+    }
+
+    return &FolderRepository{collection: collection}
+}
+
+// Create records a folder. Creating a folder that already exists is not an
+// error.
+func (r *FolderRepository) Create(ctx context.Context, userID, path string) error {
+    filter := bson.M{"user_id": userID, "path": path}
+    update := bson.M{"$setOnInsert": bson.M{"created_at": time.Now()}}
+    if _, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+        return fmt.Errorf("failed to create folder: %w", err)
+    }
+    return nil
+}
+
+// Find returns the record of a folder, or nil when there is none.
+func (r *FolderRepository) Find(ctx context.Context, userID, path string) (*models.Folder, error) {
+    var folder models.Folder
+    if err := r.collection.FindOne(ctx, bson.M{"user_id": userID, "path": path}).Decode(&folder); err != nil {
+        if err == mongo.ErrNoDocuments {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("failed to find folder: %w", err)
+    }
+    return &folder, nil
+}
+
+// ListTree returns the folders below path ("" is the whole account),
+// ordered by path.
+func (r *FolderRepository) ListTree(ctx context.Context, userID, path string) ([]models.Folder, error) {
+    filter := bson.M{"user_id": userID}
+    if path != "" {
+        filter["path"] = bson.M{"$regex": "^" + regexp.QuoteMeta(path) + "/"}
+    }
+    cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "path", Value: 1}}))
+    if err != nil {
+        return nil, fmt.Errorf("failed to list folders: %w", err)
+    }
+
+    folders := []models.Folder{}
+    if err := cursor.All(ctx, &folders); err != nil {
+        return nil, fmt.Errorf("failed to decode folders: %w", err)
+    }
+    return folders, nil
+}
+
+// Move renames path and every folder below it to newPath.
+func (r *FolderRepository) Move(ctx context.Context, userID, path, newPath string) error {
+    filter := bson.M{"user_id": userID, "path": subtree(path)}
+    if _, err := r.collection.UpdateMany(ctx, filter, bson.A{replacePrefix("path", path, newPath)}); err != nil {
+        return fmt.Errorf("failed to move folders: %w", err)
+    }
+    return nil
+}
+
+// DeleteTree removes path and every folder below it.
+func (r *FolderRepository) DeleteTree(ctx context.Context, userID, path string) error {
+    if _, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID, "path": subtree(path)}); err != nil {
+        return fmt.Errorf("failed to delete folders: %w", err)
+    }
+    return nil
+}
+
+// DeleteByUser removes all of a user's folders.
+func (r *FolderRepository) DeleteByUser(ctx context.Context, userID string) error {
+    if _, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+        return fmt.Errorf("failed to delete folders: %w", err)
+    }
+    return nil
+}
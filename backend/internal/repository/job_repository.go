@@ -0,0 +1,226 @@
+// internal/repository/job_repository.go
+package repository
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "time"
+
+    "backend/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// JobRepository stores background jobs in the "jobs" collection.
+type JobRepository struct {
+    collection *mongo.Collection
+}
+
+// NewJobRepository creates a new job repository and makes sure the
+// indexes used by the worker poll query exist.
+func NewJobRepository(db *mongo.Database) *JobRepository {
+    collection := db.Collection("jobs")
+
+    indexes := []mongo.IndexModel{
+        {Keys: bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}}},
+        {Keys: bson.D{{Key: "type", Value: 1}, {Key: "created_at", Value: -1}}},
+    }
+    if _, err := collection.Indexes().CreateMany(context.Background(), indexes); err != nil {
+        log.Printf("failed to create job indexes: %v", err)
+    }
+
+    return &JobRepository{collection: collection}
+}
+
+// Enqueue inserts a new job.
+func (r *JobRepository) Enqueue(ctx context.Context, job *models.Job) error {
+    if job == nil {
+        return fmt.Errorf("job cannot be nil")
+    }
+    if job.ID.IsZero() {
+        job.ID = primitive.NewObjectID()
+    }
+    if _, err := r.collection.InsertOne(ctx, job); err != nil {
+        return fmt.Errorf("failed to enqueue job: %w", err)
+    }
+    return nil
+}
+
+// ClaimNext leases the next runnable job to owner. A job is runnable when it
+// is pending and due, or when it is running but its lease has expired (the
+// worker holding it died). Returns nil when nothing is runnable.
+func (r *JobRepository) ClaimNext(ctx context.Context, owner string, lease time.Duration) (*models.Job, error) {
+    now := time.Now()
+    filter := bson.M{
+        "$or": bson.A{
+            bson.M{"status": models.JobPending, "run_at": bson.M{"$lte": now}},
+            bson.M{"status": models.JobRunning, "lease_expires_at": bson.M{"$lte": now}},
+        },
+    }
+    update := bson.M{
+        "$set": bson.M{
+            "status":           models.JobRunning,
+            "lease_owner":      owner,
+            "lease_expires_at": now.Add(lease),
+            "updated_at":       now,
+        },
+        "$inc": bson.M{"attempts": 1},
+    }
+    opts := options.FindOneAndUpdate().
+        SetSort(bson.D{{Key: "run_at", Value: 1}}).
+        SetReturnDocument(options.After)
+
+    var job models.Job
+    err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+    if err != nil {
+        if err == mongo.ErrNoDocuments {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("failed to claim job: %w", err)
+    }
+    return &job, nil
+}
+
+// MarkSucceeded records a successful run. The update only applies while
+// owner still holds the lease.
+func (r *JobRepository) MarkSucceeded(ctx context.Context, jobID primitive.ObjectID, owner string) error {
+    now := time.Now()
+    update := bson.M{
+        "$set": bson.M{
+            "status":       models.JobSucceeded,
+            "updated_at":   now,
+            "completed_at": now,
+            "last_error":   "",
+        },
+        "$unset": bson.M{"lease_owner": "", "lease_expires_at": ""},
+    }
+    _, err := r.collection.UpdateOne(ctx, bson.M{"_id": jobID, "lease_owner": owner}, update)
+    return err
+}
+
+// MarkFailed records a failed run. When retryAt is nil the job is
+// dead-lettered, otherwise it goes back to pending until retryAt.
+func (r *JobRepository) MarkFailed(ctx context.Context, jobID primitive.ObjectID, owner string, errMsg string, retryAt *time.Time) error {
+    now := time.Now()
+    set := bson.M{
+        "last_error": errMsg,
+        "updated_at": now,
+    }
+    if retryAt != nil {
+        set["status"] = models.JobPending
+        set["run_at"] = *retryAt
+    } else {
+        set["status"] = models.JobDead
+        set["completed_at"] = now
+    }
+    update := bson.M{
+        "$set":   set,
+        "$unset": bson.M{"lease_owner": "", "lease_expires_at": ""},
+    }
+    _, err := r.collection.UpdateOne(ctx, bson.M{"_id": jobID, "lease_owner": owner}, update)
+    return err
+}
+
+// SetProgress records the progress of a running job while owner holds its
+// lease.
+func (r *JobRepository) SetProgress(ctx context.Context, jobID primitive.ObjectID, owner string, progress models.JobProgress) error {
+    update := bson.M{"$set": bson.M{"progress": progress, "updated_at": time.Now()}}
+    _, err := r.collection.UpdateOne(ctx, bson.M{"_id": jobID, "lease_owner": owner}, update)
+    return err
+}
+
+// Requeue puts a dead job back in the queue with a fresh attempt budget.
+func (r *JobRepository) Requeue(ctx context.Context, jobID string) error {
+    objectID, err := primitive.ObjectIDFromHex(jobID)
+    if err != nil {
+        return ErrInvalidID.Wrap(err)
+    }
+
+    now := time.Now()
+    update := bson.M{
+        "$set": bson.M{
+            "status":     models.JobPending,
+            "attempts":   0,
+            "run_at":     now,
+            "updated_at": now,
+        },
+        "$unset": bson.M{"completed_at": ""},
+    }
+    result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID, "status": models.JobDead}, update)
+    if err != nil {
+        return fmt.Errorf("failed to requeue job: %w", err)
+    }
+    if result.MatchedCount == 0 {
+        return ErrJobNotFound.WithMessage("No dead-lettered job with ID %s", jobID)
+    }
+    return nil
+}
+
+// GetByID retrieves a job by its ID.
+func (r *JobRepository) GetByID(ctx context.Context, jobID string) (*models.Job, error) {
+    objectID, err := primitive.ObjectIDFromHex(jobID)
+    if err != nil {
+        return nil, ErrInvalidID.Wrap(err)
+    }
+
+    var job models.Job
+    if err := r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&job); err != nil {
+        if err == mongo.ErrNoDocuments {
+            return nil, ErrJobNotFound
+        }
+        return nil, fmt.Errorf("error retrieving job: %w", err)
+    }
+    return &job, nil
+}
+
+// List returns the most recent jobs, optionally filtered by status and type.
+func (r *JobRepository) List(ctx context.Context, status, jobType string, limit int64) ([]models.Job, error) {
+    filter := bson.M{}
+    if status != "" {
+        filter["status"] = status
+    }
+    if jobType != "" {
+        filter["type"] = jobType
+    }
+
+    opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+    cursor, err := r.collection.Find(ctx, filter, opts)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list jobs: %w", err)
+    }
+
+    jobs := []models.Job{}
+    if err := cursor.All(ctx, &jobs); err != nil {
+        return nil, fmt.Errorf("failed to decode jobs: %w", err)
+    }
+    return jobs, nil
+}
+
+// CountByStatus returns the number of jobs in each status.
+func (r *JobRepository) CountByStatus(ctx context.Context) (map[string]int64, error) {
+    pipeline := mongo.Pipeline{
+        {{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+    }
+    cursor, err := r.collection.Aggregate(ctx, pipeline)
+    if err != nil {
+        return nil, fmt.Errorf("failed to count jobs: %w", err)
+    }
+
+    var rows []struct {
+        Status string `bson:"_id"`
+        Count  int64  `bson:"count"`
+    }
+    if err := cursor.All(ctx, &rows); err != nil {
+        return nil, fmt.Errorf("failed to decode job counts: %w", err)
+    }
+
+    counts := map[string]int64{}
+    for _, row := range rows {
+        counts[row.Status] = row.Count
+    }
+    return counts, nil
+}
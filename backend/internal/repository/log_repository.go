@@ -14,10 +14,10 @@ type LogRepository struct {
 
 // NewLogRepository creates a new instance of LogRepository.
 // It accepts a MongoDB client and sets up collections for logs and error logs.
-func NewLogRepository(client *mongo.Client) *LogRepository {
+func NewLogRepository(db *mongo.Database) *LogRepository {
     return &LogRepository{
-        logCollection:      client.Database("Storely").Collection("logs"),
-        errorLogCollection: client.Database("Storely").Collection("error_logs"),
+        logCollection:      db.Collection("logs"),
+        errorLogCollection: db.Collection("error_logs"),
     }
 }
 
@@ -0,0 +1,77 @@
+// internal/repository/login_attempt_repository.go
+package repository
+
+import (
+    "context"
+    "fmt"
+    "log"
+
+    "backend/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttemptRepository keeps the audit trail of sign-in attempts in the
+// "login_attempts" collection. Records are removed at their ExpiresAt.
+type LoginAttemptRepository struct {
+    collection *mongo.Collection
+}
+
+func NewLoginAttemptRepository(db *mongo.Database) *LoginAttemptRepository {
+    collection := db.Collection("login_attempts")
+
+    indexes := []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "expires_at", Value: 1}},
+            Options: options.Index().SetExpireAfterSeconds(0),
+        },
+        {Keys: bson.D{{Key: "email", Value: 1}, {Key: "at", Value: -1}}},
+        {Keys: bson.D{{Key: "ip_address", Value: 1}, {Key: "at", Value: -1}}},
+    }
+    if _, err := collection.Indexes().CreateMany(context.Background(), indexes); err != nil {
+        log.Printf("failed to create login attempt indexes: %v", err)
+    }
+
+    return &LoginAttemptRepository{collection: collection}
+}
+
+func (r *LoginAttemptRepository) Insert(ctx context.Context, attempt *models.LoginAttempt) error {
+    if _, err := r.collection.InsertOne(ctx, attempt); err != nil {
+        return fmt.Errorf("failed to insert login attempt: %w", err)
+    }
+    return nil
+}
+
+// List returns attempts, newest first, optionally only those for email or
+// from ipAddress, with the total number matching.
+func (r *LoginAttemptRepository) List(ctx context.Context, email, ipAddress string, skip, limit int64) ([]models.LoginAttempt, int64, error) {
+    filter := bson.M{}
+    if email != "" {
+        filter["email"] = email
+    }
+    if ipAddress != "" {
+        filter["ip_address"] = ipAddress
+    }
+
+    total, err := r.collection.CountDocuments(ctx, filter)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to count login attempts: %w", err)
+    }
+
+    opts := options.Find().
+        SetSort(bson.D{{Key: "at", Value: -1}}).
+        SetSkip(skip).
+        SetLimit(limit)
+    cursor, err := r.collection.Find(ctx, filter, opts)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to list login attempts: %w", err)
+    }
+
+    attempts := []models.LoginAttempt{}
+    if err := cursor.All(ctx, &attempts); err != nil {
+        return nil, 0, fmt.Errorf("failed to decode login attempts: %w", err)
+    }
+    return attempts, total, nil
+}
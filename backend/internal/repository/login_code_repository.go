@@ -0,0 +1,66 @@
+// internal/repository/login_code_repository.go
+package repository
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "backend/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginCodeRepository stores single sign-on login codes in the
+// "login_codes" collection. A TTL index removes expired ones.
+type LoginCodeRepository struct {
+    collection *mongo.Collection
+}
+
+func NewLoginCodeRepository(db *mongo.Database) *LoginCodeRepository {
+    collection := db.Collection("login_codes")
+
+    indexes := []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "code_hash", Value: 1}},
+            Options: options.Index().SetUnique(true),
+        },
+        {
+            Keys:    bson.D{{Key: "expires_at", Value: 1}},
+            Options: options.Index().SetExpireAfterSeconds(0),
+        },
+    }
+    if _, err := collection.Indexes().CreateMany(context.Background(), indexes); err != nil {
+        log.Printf("failed to create login code indexes: %v", err)
+    }
+
+    return &LoginCodeRepository{collection: collection}
+}
+
+func (r *LoginCodeRepository) Create(ctx context.Context, code *models.LoginCode) error {
+    if _, err := r.collection.InsertOne(ctx, code); err != nil {
+        return fmt.Errorf("failed to insert login code: %w", err)
+    }
+    return nil
+}
+
+// Consume deletes and returns the unexpired code with codeHash, so it
+// works only once.
+func (r *LoginCodeRepository) Consume(ctx context.Context, codeHash string, now time.Time) (*models.LoginCode, error) {
+    var code models.LoginCode
+    err := r.collection.FindOneAndDelete(ctx, bson.M{
+        "code_hash":  codeHash,
+        "expires_at": bson.M{"$gt": now},
+    }).Decode(&code)
+    if errors.Is(err, mongo.ErrNoDocuments) {
+        return nil, ErrLoginCodeInvalid
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to consume login code: %w", err)
+    }
+    return &code, nil
+}
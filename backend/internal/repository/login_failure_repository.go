@@ -0,0 +1,127 @@
+// internal/repository/login_failure_repository.go
+package repository
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginFailureRepository counts recent failed logins per key, such as a
+// client IP or an email, in the "login_failures" collection. A counter is
+// forgotten once no failure has been added for a window.
+type LoginFailureRepository struct {
+    collection *mongo.Collection
+}
+
+func NewLoginFailureRepository(db *mongo.Database) *LoginFailureRepository {
+    collection := db.Collection("login_failures")
+
+    index := mongo.IndexModel{
+        Keys:    bson.D{{Key: "expires_at", Value: 1}},
+        Options: options.Index().SetExpireAfterSeconds(0),
+    }
+    if _, err := collection.Indexes().CreateOne(context.Background(), index); err != nil {
+        log.Printf("failed to create login failure indexes: %v", err)
+    }
+
+    return &LoginFailureRepository{collection: collection}
+}
+
+// Get returns the failures counted for key and when the last one
+// happened, or 0 when the counter has expired by now.
+func (r *LoginFailureRepository) Get(ctx context.Context, key string, now time.Time) (int, time.Time, error) {
+    var counter struct {
+        Failures     int       `bson:"failures"`
+        LastFailedAt time.Time `bson:"last_failed_at"`
+        ExpiresAt    time.Time `bson:"expires_at"`
+    }
+    err := r.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&counter)
+    if errors.Is(err, mongo.ErrNoDocuments) {
+        return 0, time.Time{}, nil
+    }
+    if err != nil {
+        return 0, time.Time{}, fmt.Errorf("failed to read login failures: %w", err)
+    }
+    // The TTL monitor only runs every minute
+    if !now.Before(counter.ExpiresAt) {
+        return 0, time.Time{}, nil
+    }
+    return counter.Failures, counter.LastFailedAt, nil
+}
+
+// Reserve counts a failure for key at now, provided the counter still
+// holds what Get returned (failures, last at lastFailedAt), and reports
+// whether it did. A counter that has expired starts over. Concurrent
+// callers that read the same counter can't all reserve: one wins, the
+// others get false and have to read it again.
+func (r *LoginFailureRepository) Reserve(ctx context.Context, key string, failures int, lastFailedAt, now time.Time, window time.Duration) (bool, error) {
+    now = now.Truncate(time.Millisecond)
+    var filter, update bson.M
+    if failures == 0 {
+        // Missing, expired or fully refunded; a missing one is inserted
+        filter = bson.M{"_id": key, "$or": bson.A{
+            bson.M{"expires_at": bson.M{"$lte": now}},
+            bson.M{"failures": bson.M{"$lte": 0}},
+        }}
+        update = bson.M{"$set": bson.M{"failures": 1, "last_failed_at": now, "expires_at": now.Add(window)}}
+    } else {
+        filter = bson.M{"_id": key, "failures": failures, "last_failed_at": lastFailedAt, "expires_at": bson.M{"$gt": now}}
+        update = bson.M{
+            "$inc": bson.M{"failures": 1},
+            "$set": bson.M{"last_failed_at": now, "expires_at": now.Add(window)},
+        }
+    }
+    opts := options.FindOneAndUpdate().SetUpsert(failures == 0)
+
+    err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Err()
+    if errors.Is(err, mongo.ErrNoDocuments) {
+        if failures == 0 {
+            // Upserted
+            return true, nil
+        }
+        return false, nil
+    }
+    if mongo.IsDuplicateKeyError(err) {
+        // The counter exists but changed since it was read
+        return false, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("failed to reserve login failure: %w", err)
+    }
+    return true, nil
+}
+
+// Release takes back a failure reserved at reservedAt. Unless another has
+// been counted since, the counter's last failure goes back to
+// lastFailedAt, the one before the reservation.
+func (r *LoginFailureRepository) Release(ctx context.Context, key string, reservedAt, lastFailedAt time.Time, window time.Duration) error {
+    reservedAt = reservedAt.Truncate(time.Millisecond)
+    latest := bson.M{"$eq": bson.A{"$last_failed_at", reservedAt}}
+    pipeline := mongo.Pipeline{
+        {{Key: "$set", Value: bson.M{
+            "failures":       bson.M{"$subtract": bson.A{"$failures", 1}},
+            "last_failed_at": bson.M{"$cond": bson.A{latest, lastFailedAt, "$last_failed_at"}},
+            "expires_at":     bson.M{"$cond": bson.A{latest, lastFailedAt.Add(window), "$expires_at"}},
+        }}},
+    }
+    _, err := r.collection.UpdateOne(ctx, bson.M{"_id": key, "failures": bson.M{"$gt": 0}}, pipeline)
+    if err != nil {
+        return fmt.Errorf("failed to release login failure: %w", err)
+    }
+    return nil
+}
+
+// Reset forgets the failures counted for key.
+func (r *LoginFailureRepository) Reset(ctx context.Context, key string) error {
+    if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+        return fmt.Errorf("failed to reset login failures: %w", err)
+    }
+    return nil
+}
@@ -5,13 +5,17 @@ import (
     "context"
     "fmt"
     "log"
+    "math"
+    "regexp"
     "time"
+    "unicode/utf8"
 
     "backend/internal/models"
     
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
     "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // MinIOFileRepository handles MinIO-specific file operations
@@ -20,9 +24,9 @@ type MinIOFileRepository struct {
 }
 
 // NewMinIOFileRepository creates a new MinIO file repository
-func NewMinIOFileRepository(client *mongo.Client) *MinIOFileRepository {
+func NewMinIOFileRepository(db *mongo.Database) *MinIOFileRepository {
     return &MinIOFileRepository{
-        collection: client.Database("Storely").Collection("minio_files"),
+        collection: db.Collection("minio_files"),
     }
 }
 
@@ -47,14 +51,14 @@ func (r *MinIOFileRepository) CreateFile_MinIO(ctx context.Context, file *models
 func (r *MinIOFileRepository) GetFileByID_MinIO(ctx context.Context, fileID string) (*models.FileMinIO, error) {
     objectID, err := primitive.ObjectIDFromHex(fileID)
     if err != nil {
-        return nil, fmt.Errorf("invalid MinIO file ID format: %w", err)
+        return nil, ErrInvalidID.Wrap(err)
     }
 
     var file models.FileMinIO
     err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&file)
     if err != nil {
         if err == mongo.ErrNoDocuments {
-            return nil, fmt.Errorf("MinIO file not found")
+            return nil, ErrFileNotFound
         }
         return nil, fmt.Errorf("error retrieving MinIO file: %w", err)
     }
@@ -62,11 +66,13 @@ func (r *MinIOFileRepository) GetFileByID_MinIO(ctx context.Context, fileID stri
     return &file, nil
 }
 
-// MarkFileComplete_MinIO marks a MinIO file as complete
-func (r *MinIOFileRepository) MarkFileComplete_MinIO(ctx context.Context, fileID string) error {
+// MarkFileComplete_MinIO marks a MinIO file as complete. It reports
+// whether this call completed it; a file that already was complete is
+// left alone, so the post-upload work is only started once.
+func (r *MinIOFileRepository) MarkFileComplete_MinIO(ctx context.Context, fileID string) (bool, error) {
     objectID, err := primitive.ObjectIDFromHex(fileID)
     if err != nil {
-        return fmt.Errorf("invalid MinIO file ID format: %w", err)
+        return false, ErrInvalidID.Wrap(err)
     }
 
     update := bson.M{
@@ -76,23 +82,29 @@ func (r *MinIOFileRepository) MarkFileComplete_MinIO(ctx context.Context, fileID
         },
     }
 
-    result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+    result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID, "complete": bson.M{"$ne": true}}, update)
     if err != nil {
-        return fmt.Errorf("failed to mark MinIO file as complete: %w", err)
+        return false, fmt.Errorf("failed to mark MinIO file as complete: %w", err)
     }
-
-    if result.MatchedCount == 0 {
-        return fmt.Errorf("MinIO file not found")
+    if result.MatchedCount > 0 {
+        return true, nil
     }
 
-    return nil
+    count, err := r.collection.CountDocuments(ctx, bson.M{"_id": objectID})
+    if err != nil {
+        return false, fmt.Errorf("failed to mark MinIO file as complete: %w", err)
+    }
+    if count == 0 {
+        return false, ErrFileNotFound
+    }
+    return false, nil
 }
 
 // UpdateMinIOPath updates the MinIO path for a file
 func (r *MinIOFileRepository) UpdateMinIOPath(ctx context.Context, fileID string, minioPath string) error {
     objectID, err := primitive.ObjectIDFromHex(fileID)
     if err != nil {
-        return fmt.Errorf("invalid MinIO file ID format: %w", err)
+        return ErrInvalidID.Wrap(err)
     }
 
     update := bson.M{
@@ -108,7 +120,7 @@ func (r *MinIOFileRepository) UpdateMinIOPath(ctx context.Context, fileID string
     }
 
     if result.MatchedCount == 0 {
-        return fmt.Errorf("MinIO file not found")
+        return ErrFileNotFound
     }
 
     return nil
@@ -118,11 +130,436 @@ func (r *MinIOFileRepository) UpdateMinIOPath(ctx context.Context, fileID string
 func (r *MinIOFileRepository) DeleteMinIOFile(ctx context.Context, fileID string) error {
     objectID, err := primitive.ObjectIDFromHex(fileID)
     if err != nil {
-        return fmt.Errorf("invalid MinIO file ID format: %w", err)
+        return ErrInvalidID.Wrap(err)
     }
     _, err = r.collection.DeleteOne(ctx, bson.M{"_id": objectID})
     if err != nil {
         return fmt.Errorf("failed to delete MinIO file metadata: %w", err)
     }
     return nil
-}
\ No newline at end of file
+}
+
+// LeaseUpload gives lease the exclusive right to write an unfinished
+// upload at offset until the given time. It reports false when the upload
+// is no longer at offset or another unexpired lease holds it. Calling it
+// again with the same lease extends it.
+func (r *MinIOFileRepository) LeaseUpload(ctx context.Context, fileID string, offset int64, lease string, until, now time.Time) (bool, error) {
+    objectID, err := primitive.ObjectIDFromHex(fileID)
+    if err != nil {
+        return false, ErrInvalidID.Wrap(err)
+    }
+
+    filter := uploadAtOffset(objectID, offset)
+    filter["$or"] = bson.A{
+        bson.M{"upload_lease": bson.M{"$exists": false}},
+        bson.M{"upload_lease": lease},
+        bson.M{"upload_lease_until": bson.M{"$lte": now}},
+    }
+    update := bson.M{"$set": bson.M{"upload_lease": lease, "upload_lease_until": until}}
+    result, err := r.collection.UpdateOne(ctx, filter, update)
+    if err != nil {
+        return false, fmt.Errorf("failed to lease upload: %w", err)
+    }
+    return result.MatchedCount == 1, nil
+}
+
+// ReleaseUpload ends lease, if it still holds the upload.
+func (r *MinIOFileRepository) ReleaseUpload(ctx context.Context, fileID string, lease string) error {
+    objectID, err := primitive.ObjectIDFromHex(fileID)
+    if err != nil {
+        return ErrInvalidID.Wrap(err)
+    }
+    _, err = r.collection.UpdateOne(ctx,
+        bson.M{"_id": objectID, "upload_lease": lease},
+        bson.M{"$unset": bson.M{"upload_lease": "", "upload_lease_until": ""}})
+    if err != nil {
+        return fmt.Errorf("failed to release upload: %w", err)
+    }
+    return nil
+}
+
+// AdvanceUploadOffset moves the offset of an unfinished upload from
+// offset to newOffset and ends lease. It reports false when the upload is
+// no longer at offset or lease no longer holds it.
+func (r *MinIOFileRepository) AdvanceUploadOffset(ctx context.Context, fileID string, offset, newOffset int64, lease string) (bool, error) {
+    objectID, err := primitive.ObjectIDFromHex(fileID)
+    if err != nil {
+        return false, ErrInvalidID.Wrap(err)
+    }
+
+    filter := uploadAtOffset(objectID, offset)
+    filter["upload_lease"] = lease
+    update := bson.M{
+        "$set": bson.M{
+            "upload_offset": newOffset,
+            "updated_at":    primitive.DateTime(time.Now().UnixNano() / 1e6),
+        },
+        "$unset": bson.M{"upload_lease": "", "upload_lease_until": ""},
+    }
+    result, err := r.collection.UpdateOne(ctx, filter, update)
+    if err != nil {
+        return false, fmt.Errorf("failed to update upload offset: %w", err)
+    }
+    return result.MatchedCount == 1, nil
+}
+
+// UpdateChecksum stores the SHA-256 checksum computed for a file
+// uploadAtOffset matches an unfinished upload at offset; uploads that
+// haven't received anything may lack the field.
+func uploadAtOffset(objectID primitive.ObjectID, offset int64) bson.M {
+    filter := bson.M{"_id": objectID, "complete": false, "upload_offset": offset}
+    if offset == 0 {
+        filter["upload_offset"] = bson.M{"$in": bson.A{0, nil}}
+    }
+    return filter
+}
+
+// CorrectSize replaces the declared size of a file with the size of its
+// stored content and flags the mismatch. It reports whether the size was
+// still the declared one, so the difference is only charged once.
+func (r *MinIOFileRepository) CorrectSize(ctx context.Context, fileID string, declared, stored float64) (bool, error) {
+    objectID, err := primitive.ObjectIDFromHex(fileID)
+    if err != nil {
+        return false, ErrInvalidID.Wrap(err)
+    }
+    result, err := r.collection.UpdateOne(ctx,
+        bson.M{"_id": objectID, "size": declared},
+        bson.M{"$set": bson.M{"size": stored, "size_mismatch": true, "updated_at": primitive.DateTime(time.Now().UnixNano() / 1e6)}})
+    if err != nil {
+        return false, fmt.Errorf("failed to correct MinIO file size: %w", err)
+    }
+    return result.MatchedCount > 0, nil
+}
+
+func (r *MinIOFileRepository) UpdateChecksum(ctx context.Context, fileID string, checksum string) error {
+    return r.setFields(ctx, fileID, bson.M{"checksum": checksum})
+}
+
+// UpdateETag stores the S3 entity tag of a file
+func (r *MinIOFileRepository) UpdateETag(ctx context.Context, fileID string, etag string) error {
+    return r.setFields(ctx, fileID, bson.M{"etag": etag})
+}
+
+// UpdateThumbnailPath stores the object key of a file's thumbnail
+func (r *MinIOFileRepository) UpdateThumbnailPath(ctx context.Context, fileID string, thumbnailPath string) error {
+    return r.setFields(ctx, fileID, bson.M{"thumbnail_path": thumbnailPath})
+}
+
+// UpdateScanResult stores the outcome of a file's malware scan
+func (r *MinIOFileRepository) UpdateScanResult(ctx context.Context, fileID string, result models.ScanResult) error {
+    return r.setFields(ctx, fileID, bson.M{"scan": result})
+}
+
+// SumSizeByUser returns the total size of all files owned by a user
+func (r *MinIOFileRepository) SumSizeByUser(ctx context.Context, userID string) (float64, error) {
+    pipeline := mongo.Pipeline{
+        {{Key: "$match", Value: bson.M{"user_id": userID}}},
+        {{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$size"}}}},
+    }
+    cursor, err := r.collection.Aggregate(ctx, pipeline)
+    if err != nil {
+        return 0, fmt.Errorf("failed to sum MinIO file sizes: %w", err)
+    }
+
+    var rows []struct {
+        Total float64 `bson:"total"`
+    }
+    if err := cursor.All(ctx, &rows); err != nil {
+        return 0, fmt.Errorf("failed to decode MinIO file sizes: %w", err)
+    }
+    if len(rows) == 0 {
+        return 0, nil
+    }
+    return rows[0].Total, nil
+}
+
+func (r *MinIOFileRepository) setFields(ctx context.Context, fileID string, fields bson.M) error {
+    objectID, err := primitive.ObjectIDFromHex(fileID)
+    if err != nil {
+        return ErrInvalidID.Wrap(err)
+    }
+
+    fields["updated_at"] = primitive.DateTime(time.Now().UnixNano() / 1e6)
+    result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": fields})
+    if err != nil {
+        return fmt.Errorf("failed to update MinIO file: %w", err)
+    }
+    if result.MatchedCount == 0 {
+        return ErrFileNotFound
+    }
+    return nil
+}
+
+// ListByUser returns a page of a user's files, newest first, along with the
+// total number of files the user owns
+func (r *MinIOFileRepository) ListByUser(ctx context.Context, userID string, skip, limit int64) ([]models.FileMinIO, int64, error) {
+    return r.list(ctx, bson.M{"user_id": userID}, skip, limit)
+}
+
+// ListByFolder returns a page of a user's files in folder ("" is the root),
+// newest first, together with the total count. With recursive set, files
+// in subfolders of folder are included.
+func (r *MinIOFileRepository) ListByFolder(ctx context.Context, userID, folder string, recursive bool, skip, limit int64) ([]models.FileMinIO, int64, error) {
+    filter := bson.M{"user_id": userID}
+    switch {
+    case recursive && folder == "":
+    case recursive:
+        filter["folder"] = subtree(folder)
+    case folder == "":
+        filter["folder"] = bson.M{"$in": bson.A{"", nil}}
+    default:
+        filter["folder"] = folder
+    }
+    return r.list(ctx, filter, skip, limit)
+}
+
+// FindByPath returns the complete files named fileName in folder, newest
+// first. Several files may share a path; the newest one is current.
+func (r *MinIOFileRepository) FindByPath(ctx context.Context, userID, folder, fileName string) ([]models.FileMinIO, error) {
+    filter := bson.M{"user_id": userID, "file_name": fileName, "complete": true}
+    if folder == "" {
+        filter["folder"] = bson.M{"$in": bson.A{"", nil}}
+    } else {
+        filter["folder"] = folder
+    }
+    return r.findAll(ctx, filter, bson.D{{Key: "created_at", Value: -1}})
+}
+
+// ListTree returns every complete file in folder and its subfolders ("" is
+// the whole account), ordered by folder, name and newest first.
+func (r *MinIOFileRepository) ListTree(ctx context.Context, userID, folder string) ([]models.FileMinIO, error) {
+    filter := bson.M{"user_id": userID, "complete": true}
+    if folder != "" {
+        filter["folder"] = subtree(folder)
+    }
+    return r.findAll(ctx, filter, bson.D{
+        {Key: "folder", Value: 1},
+        {Key: "file_name", Value: 1},
+        {Key: "created_at", Value: -1},
+    })
+}
+
+// FindByIDs returns the complete files of userID among ids, ordered by
+// folder and name. IDs that don't match such a file are left out.
+func (r *MinIOFileRepository) FindByIDs(ctx context.Context, userID string, ids []primitive.ObjectID) ([]models.FileMinIO, error) {
+    filter := bson.M{"_id": bson.M{"$in": ids}, "user_id": userID, "complete": true}
+    return r.findAll(ctx, filter, bson.D{
+        {Key: "folder", Value: 1},
+        {Key: "file_name", Value: 1},
+        {Key: "created_at", Value: -1},
+    })
+}
+
+// FindOwnedByIDs returns the files of userID among ids, complete or not.
+func (r *MinIOFileRepository) FindOwnedByIDs(ctx context.Context, userID string, ids []primitive.ObjectID) ([]models.FileMinIO, error) {
+    filter := bson.M{"_id": bson.M{"$in": ids}, "user_id": userID}
+    return r.findAll(ctx, filter, bson.D{{Key: "_id", Value: 1}})
+}
+
+// DeleteByIDs removes the metadata of the files of userID among ids.
+func (r *MinIOFileRepository) DeleteByIDs(ctx context.Context, userID string, ids []primitive.ObjectID) (int64, error) {
+    result, err := r.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_id": userID})
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete MinIO file metadata: %w", err)
+    }
+    return result.DeletedCount, nil
+}
+
+// MoveByIDs puts the files of userID among ids into folder.
+func (r *MinIOFileRepository) MoveByIDs(ctx context.Context, userID string, ids []primitive.ObjectID, folder string) error {
+    update := bson.M{"$set": bson.M{
+        "folder":     folder,
+        "updated_at": primitive.DateTime(time.Now().UnixNano() / 1e6),
+    }}
+    if _, err := r.collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_id": userID}, update); err != nil {
+        return fmt.Errorf("failed to move MinIO files: %w", err)
+    }
+    return nil
+}
+
+// SetTags replaces the tags of several files of userID in one round trip.
+func (r *MinIOFileRepository) SetTags(ctx context.Context, userID string, tags map[primitive.ObjectID][]string) error {
+    if len(tags) == 0 {
+        return nil
+    }
+    now := primitive.DateTime(time.Now().UnixNano() / 1e6)
+    writes := make([]mongo.WriteModel, 0, len(tags))
+    for id, fileTags := range tags {
+        writes = append(writes, mongo.NewUpdateOneModel().
+            SetFilter(bson.M{"_id": id, "user_id": userID}).
+            SetUpdate(bson.M{"$set": bson.M{"tags": fileTags, "updated_at": now}}))
+    }
+    if _, err := r.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+        return fmt.Errorf("failed to tag MinIO files: %w", err)
+    }
+    return nil
+}
+
+// ListByTag returns a page of a user's files carrying tag, newest first,
+// together with the total count.
+func (r *MinIOFileRepository) ListByTag(ctx context.Context, userID, tag string, skip, limit int64) ([]models.FileMinIO, int64, error) {
+    return r.list(ctx, bson.M{"user_id": userID, "tags": tag}, skip, limit)
+}
+
+// HasFolder reports whether any complete file lies in folder or below it.
+func (r *MinIOFileRepository) HasFolder(ctx context.Context, userID, folder string) (bool, error) {
+    filter := bson.M{"user_id": userID, "complete": true, "folder": subtree(folder)}
+    n, err := r.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+    if err != nil {
+        return false, fmt.Errorf("failed to look up folder: %w", err)
+    }
+    return n > 0, nil
+}
+
+// MovePath moves every file at folder/fileName to newFolder/newName and
+// returns how many were moved.
+func (r *MinIOFileRepository) MovePath(ctx context.Context, userID, folder, fileName, newFolder, newName string) (int64, error) {
+    filter := bson.M{"user_id": userID, "file_name": fileName}
+    if folder == "" {
+        filter["folder"] = bson.M{"$in": bson.A{"", nil}}
+    } else {
+        filter["folder"] = folder
+    }
+    update := bson.M{"$set": bson.M{
+        "folder":     newFolder,
+        "file_name":  newName,
+        "updated_at": primitive.DateTime(time.Now().UnixNano() / 1e6),
+    }}
+    result, err := r.collection.UpdateMany(ctx, filter, update)
+    if err != nil {
+        return 0, fmt.Errorf("failed to move MinIO files: %w", err)
+    }
+    return result.ModifiedCount, nil
+}
+
+// MoveFolder moves the files in folder and its subfolders below newFolder.
+func (r *MinIOFileRepository) MoveFolder(ctx context.Context, userID, folder, newFolder string) error {
+    filter := bson.M{"user_id": userID, "folder": subtree(folder)}
+    if _, err := r.collection.UpdateMany(ctx, filter, bson.A{
+        replacePrefix("folder", folder, newFolder),
+        bson.M{"$set": bson.M{"updated_at": "$$NOW"}},
+    }); err != nil {
+        return fmt.Errorf("failed to move MinIO files: %w", err)
+    }
+    return nil
+}
+
+// subtree matches a folder path and every path below it.
+func subtree(folder string) bson.M {
+    return bson.M{"$regex": "^" + regexp.QuoteMeta(folder) + "(/|$)"}
+}
+
+// replacePrefix is an update pipeline stage replacing the leading prefix of
+// field, which must match subtree(prefix), with newPrefix.
+func replacePrefix(field, prefix, newPrefix string) bson.M {
+    rest := bson.M{"$substrCP": bson.A{"$" + field, utf8.RuneCountInString(prefix), math.MaxInt32}}
+    return bson.M{"$set": bson.M{field: bson.M{"$concat": bson.A{newPrefix, rest}}}}
+}
+
+func (r *MinIOFileRepository) findAll(ctx context.Context, filter bson.M, sort bson.D) ([]models.FileMinIO, error) {
+    cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(sort))
+    if err != nil {
+        return nil, fmt.Errorf("failed to list MinIO files: %w", err)
+    }
+
+    files := []models.FileMinIO{}
+    if err := cursor.All(ctx, &files); err != nil {
+        return nil, fmt.Errorf("failed to decode MinIO files: %w", err)
+    }
+    return files, nil
+}
+
+func (r *MinIOFileRepository) list(ctx context.Context, filter bson.M, skip, limit int64) ([]models.FileMinIO, int64, error) {
+    total, err := r.collection.CountDocuments(ctx, filter)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to count MinIO files: %w", err)
+    }
+
+    opts := options.Find().
+        SetSort(bson.D{{Key: "created_at", Value: -1}}).
+        SetSkip(skip).
+        SetLimit(limit)
+    cursor, err := r.collection.Find(ctx, filter, opts)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to list MinIO files: %w", err)
+    }
+
+    files := []models.FileMinIO{}
+    if err := cursor.All(ctx, &files); err != nil {
+        return nil, 0, fmt.Errorf("failed to decode MinIO files: %w", err)
+    }
+    return files, total, nil
+}
+
+// CountByUser returns the number of files owned by a user
+func (r *MinIOFileRepository) CountByUser(ctx context.Context, userID string) (int64, error) {
+    count, err := r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+    if err != nil {
+        return 0, fmt.Errorf("failed to count MinIO files: %w", err)
+    }
+    return count, nil
+}
+
+// FileIDsByUser returns the IDs of every file owned by a user
+func (r *MinIOFileRepository) FileIDsByUser(ctx context.Context, userID string) ([]string, error) {
+    opts := options.Find().SetProjection(bson.M{"_id": 1})
+    cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list MinIO files: %w", err)
+    }
+
+    var rows []struct {
+        ID primitive.ObjectID `bson:"_id"`
+    }
+    if err := cursor.All(ctx, &rows); err != nil {
+        return nil, fmt.Errorf("failed to decode MinIO files: %w", err)
+    }
+
+    ids := make([]string, 0, len(rows))
+    for _, row := range rows {
+        ids = append(ids, row.ID.Hex())
+    }
+    return ids, nil
+}
+
+// DeleteByUser removes the metadata of every file owned by a user
+func (r *MinIOFileRepository) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+    result, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+    if err != nil {
+        return 0, fmt.Errorf("failed to delete MinIO file metadata: %w", err)
+    }
+    return result.DeletedCount, nil
+}
+
+// FileTotals summarises all stored files
+type FileTotals struct {
+    Files      int64   `bson:"files" json:"files"`
+    Complete   int64   `bson:"complete" json:"complete"`
+    Incomplete int64   `bson:"incomplete" json:"incomplete"`
+    TotalSize  float64 `bson:"total_size" json:"totalSize"`
+}
+
+func (r *MinIOFileRepository) Totals(ctx context.Context) (*FileTotals, error) {
+    pipeline := mongo.Pipeline{
+        {{Key: "$group", Value: bson.M{
+            "_id":        nil,
+            "files":      bson.M{"$sum": 1},
+            "complete":   bson.M{"$sum": bson.M{"$cond": bson.A{"$complete", 1, 0}}},
+            "incomplete": bson.M{"$sum": bson.M{"$cond": bson.A{"$complete", 0, 1}}},
+            "total_size": bson.M{"$sum": "$size"},
+        }}},
+    }
+    cursor, err := r.collection.Aggregate(ctx, pipeline)
+    if err != nil {
+        return nil, fmt.Errorf("failed to aggregate MinIO files: %w", err)
+    }
+
+    var rows []FileTotals
+    if err := cursor.All(ctx, &rows); err != nil {
+        return nil, fmt.Errorf("failed to decode MinIO file totals: %w", err)
+    }
+    if len(rows) == 0 {
+        return &FileTotals{}, nil
+    }
+    return &rows[0], nil
+}
@@ -0,0 +1,171 @@
+// internal/repository/multipart_upload_repository.go
+package repository
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "strconv"
+    "time"
+
+    "backend/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MultipartUploadRepository stores S3 multipart uploads in progress in the
+// "multipart_uploads" collection.
+type MultipartUploadRepository struct {
+    collection *mongo.Collection
+}
+
+func NewMultipartUploadRepository(db *mongo.Database) *MultipartUploadRepository {
+    collection := db.Collection("multipart_uploads")
+
+    index := mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "key", Value: 1}}}
+    if _, err := collection.Indexes().CreateOne(context.Background(), index); err != nil {
+        log.Printf("failed to create multipart upload indexes: %v", err)
+    }
+
+    return &MultipartUploadRepository{collection: collection}
+}
+
+func (r *MultipartUploadRepository) Create(ctx context.Context, upload *models.MultipartUpload) error {
+    if upload == nil {
+        return fmt.Errorf("upload cannot be nil")
+    }
+    if upload.Parts == nil {
+        upload.Parts = map[string]models.MultipartPart{}
+    }
+    if _, err := r.collection.InsertOne(ctx, upload); err != nil {
+        return fmt.Errorf("failed to insert multipart upload: %w", err)
+    }
+    return nil
+}
+
+// Get returns one of a user's uploads.
+func (r *MultipartUploadRepository) Get(ctx context.Context, userID, uploadID string) (*models.MultipartUpload, error) {
+    objectID, err := primitive.ObjectIDFromHex(uploadID)
+    if err != nil {
+        return nil, ErrUploadNotFound
+    }
+
+    var upload models.MultipartUpload
+    if err := r.collection.FindOne(ctx, bson.M{"_id": objectID, "user_id": userID}).Decode(&upload); err != nil {
+        if err == mongo.ErrNoDocuments {
+            return nil, ErrUploadNotFound
+        }
+        return nil, fmt.Errorf("failed to find multipart upload: %w", err)
+    }
+    return &upload, nil
+}
+
+// PutPart records a part, replacing an earlier upload of the same number,
+// which it returns (nil if there was none).
+func (r *MultipartUploadRepository) PutPart(ctx context.Context, uploadID primitive.ObjectID, part models.MultipartPart) (*models.MultipartPart, error) {
+    key := strconv.Itoa(part.Number)
+    opts := options.FindOneAndUpdate().
+        SetReturnDocument(options.Before).
+        SetProjection(bson.M{"parts." + key: 1})
+    var before models.MultipartUpload
+    err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": uploadID}, bson.M{"$set": bson.M{"parts." + key: part}}, opts).Decode(&before)
+    if err == mongo.ErrNoDocuments {
+        return nil, ErrUploadNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to record part: %w", err)
+    }
+    if previous, ok := before.Parts[key]; ok {
+        return &previous, nil
+    }
+    return nil, nil
+}
+
+// Delete removes an upload and returns it as it was at that moment, or
+// nil when it was already gone.
+func (r *MultipartUploadRepository) Delete(ctx context.Context, uploadID primitive.ObjectID) (*models.MultipartUpload, error) {
+    var upload models.MultipartUpload
+    err := r.collection.FindOneAndDelete(ctx, bson.M{"_id": uploadID}).Decode(&upload)
+    if err == mongo.ErrNoDocuments {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to delete multipart upload: %w", err)
+    }
+    return &upload, nil
+}
+
+// DeleteExpired removes an upload whose expiry has passed and returns it,
+// or nil when it is gone or not expired.
+func (r *MultipartUploadRepository) DeleteExpired(ctx context.Context, uploadID string, now time.Time) (*models.MultipartUpload, error) {
+    objectID, err := primitive.ObjectIDFromHex(uploadID)
+    if err != nil {
+        return nil, ErrUploadNotFound
+    }
+    var upload models.MultipartUpload
+    err = r.collection.FindOneAndDelete(ctx, bson.M{"_id": objectID, "expires_at": bson.M{"$lte": now}}).Decode(&upload)
+    if err == mongo.ErrNoDocuments {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to delete multipart upload: %w", err)
+    }
+    return &upload, nil
+}
+
+// PendingSizeByUser adds up the parts of a user's uploads in progress.
+func (r *MultipartUploadRepository) PendingSizeByUser(ctx context.Context, userID string) (float64, error) {
+    pipeline := mongo.Pipeline{
+        {{Key: "$match", Value: bson.M{"user_id": userID}}},
+        {{Key: "$project", Value: bson.M{"size": bson.M{"$sum": bson.M{"$map": bson.M{
+            "input": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$parts", bson.M{}}}},
+            "in":    "$$this.v.size",
+        }}}}}},
+        {{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$size"}}}},
+    }
+    cursor, err := r.collection.Aggregate(ctx, pipeline)
+    if err != nil {
+        return 0, fmt.Errorf("failed to sum multipart parts: %w", err)
+    }
+    var rows []struct {
+        Total float64 `bson:"total"`
+    }
+    if err := cursor.All(ctx, &rows); err != nil {
+        return 0, fmt.Errorf("failed to decode multipart parts: %w", err)
+    }
+    if len(rows) == 0 {
+        return 0, nil
+    }
+    return rows[0].Total, nil
+}
+
+// IDsByUser returns the IDs of a user's uploads in progress.
+func (r *MultipartUploadRepository) IDsByUser(ctx context.Context, userID string) ([]string, error) {
+    opts := options.Find().SetProjection(bson.M{"_id": 1})
+    cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list multipart uploads: %w", err)
+    }
+    var rows []struct {
+        ID primitive.ObjectID `bson:"_id"`
+    }
+    if err := cursor.All(ctx, &rows); err != nil {
+        return nil, fmt.Errorf("failed to decode multipart uploads: %w", err)
+    }
+    ids := make([]string, 0, len(rows))
+    for _, row := range rows {
+        ids = append(ids, row.ID.Hex())
+    }
+    return ids, nil
+}
+
+// DeleteByUser removes the records of all of a user's uploads.
+func (r *MultipartUploadRepository) DeleteByUser(ctx context.Context, userID string) error {
+    if _, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+        return fmt.Errorf("failed to delete multipart uploads: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,94 @@
+// internal/repository/plan_repository.go
+package repository
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "time"
+
+    "backend/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PlanRepository stores storage plans in the "plans" collection.
+type PlanRepository struct {
+    collection *mongo.Collection
+}
+
+func NewPlanRepository(db *mongo.Database) *PlanRepository {
+    collection := db.Collection("plans")
+
+    index := mongo.IndexModel{
+        Keys:    bson.D{{Key: "name", Value: 1}},
+        Options: options.Index().SetUnique(true),
+    }
+    if _, err := collection.Indexes().CreateOne(context.Background(), index); err != nil {
+        log.Printf("failed to create plan indexes: %v", err)
+    }
+
+    return &PlanRepository{collection: collection}
+}
+
+func (r *PlanRepository) Create(ctx context.Context, plan *models.Plan) error {
+    if plan == nil {
+        return fmt.Errorf("plan cannot be nil")
+    }
+    if _, err := r.collection.InsertOne(ctx, plan); err != nil {
+        return fmt.Errorf("failed to insert plan: %w", err)
+    }
+    return nil
+}
+
+func (r *PlanRepository) GetByName(ctx context.Context, name string) (*models.Plan, error) {
+    var plan models.Plan
+    if err := r.collection.FindOne(ctx, bson.M{"name": name}).Decode(&plan); err != nil {
+        return nil, err
+    }
+    return &plan, nil
+}
+
+// List returns all plans ordered by storage limit.
+func (r *PlanRepository) List(ctx context.Context) ([]models.Plan, error) {
+    opts := options.Find().SetSort(bson.D{{Key: "storage_limit", Value: 1}})
+    cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list plans: %w", err)
+    }
+
+    plans := []models.Plan{}
+    if err := cursor.All(ctx, &plans); err != nil {
+        return nil, fmt.Errorf("failed to decode plans: %w", err)
+    }
+    return plans, nil
+}
+
+// Update overwrites the limits of the plan with the given name.
+func (r *PlanRepository) Update(ctx context.Context, name string, plan *models.Plan) error {
+    update := bson.M{
+        "$set": bson.M{
+            "display_name":    plan.DisplayName,
+            "storage_limit":   plan.StorageLimit,
+            "max_file_size":   plan.MaxFileSize,
+            "max_files":       plan.MaxFiles,
+            "allowed_types":   plan.AllowedTypes,
+            "max_share_links": plan.MaxShareLinks,
+            "updated_at":      time.Now(),
+        },
+    }
+    result, err := r.collection.UpdateOne(ctx, bson.M{"name": name}, update)
+    if err != nil {
+        return fmt.Errorf("failed to update plan: %w", err)
+    }
+    if result.MatchedCount == 0 {
+        return mongo.ErrNoDocuments
+    }
+    return nil
+}
+
+func (r *PlanRepository) Count(ctx context.Context) (int64, error) {
+    return r.collection.CountDocuments(ctx, bson.M{})
+}
@@ -0,0 +1,79 @@
+// internal/repository/rate_limit_repository.go
+package repository
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RateLimitRepository keeps token buckets in the "rate_limits" collection
+// so that every server instance shares them. Buckets are removed by a TTL
+// index once they would have refilled.
+type RateLimitRepository struct {
+    collection *mongo.Collection
+}
+
+func NewRateLimitRepository(db *mongo.Database) *RateLimitRepository {
+    collection := db.Collection("rate_limits")
+
+    index := mongo.IndexModel{
+        Keys:    bson.D{{Key: "expires_at", Value: 1}},
+        Options: options.Index().SetExpireAfterSeconds(0),
+    }
+    if _, err := collection.Indexes().CreateOne(context.Background(), index); err != nil {
+        log.Printf("failed to create rate limit indexes: %v", err)
+    }
+
+    return &RateLimitRepository{collection: collection}
+}
+
+// Take removes one token from the bucket at key in a single atomic update.
+// It implements middleware.RateLimitStore.
+func (r *RateLimitRepository) Take(ctx context.Context, key string, capacity int, interval time.Duration, now time.Time) (bool, float64, error) {
+    // MongoDB dates have millisecond precision
+    now = now.Truncate(time.Millisecond)
+    perMilli := float64(time.Millisecond) / float64(interval)
+    pipeline := mongo.Pipeline{
+        {{Key: "$set", Value: bson.M{
+            "tokens": bson.M{"$min": bson.A{
+                capacity,
+                bson.M{"$add": bson.A{
+                    bson.M{"$ifNull": bson.A{"$tokens", capacity}},
+                    bson.M{"$multiply": bson.A{
+                        bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}}}},
+                        perMilli,
+                    }},
+                }},
+            }},
+        }}},
+        {{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+        {{Key: "$set", Value: bson.M{
+            "tokens":     bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+            "updated_at": now,
+        }}},
+        {{Key: "$set", Value: bson.M{
+            "expires_at": bson.M{"$add": bson.A{now, bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{capacity, "$tokens"}}, perMilli}}}},
+        }}},
+    }
+    opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+    var bucket struct {
+        Tokens  float64 `bson:"tokens"`
+        Allowed bool    `bson:"allowed"`
+    }
+    err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&bucket)
+    if mongo.IsDuplicateKeyError(err) {
+        // Another instance created the bucket at the same moment
+        err = r.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&bucket)
+    }
+    if err != nil {
+        return false, 0, fmt.Errorf("failed to update rate limit bucket: %w", err)
+    }
+    return bucket.Allowed, bucket.Tokens, nil
+}
@@ -0,0 +1,104 @@
+// internal/repository/share_link_repository.go
+package repository
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "time"
+
+    "backend/internal/models"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ShareLinkRepository stores public file links in the "share_links"
+// collection.
+type ShareLinkRepository struct {
+    collection *mongo.Collection
+}
+
+func NewShareLinkRepository(db *mongo.Database) *ShareLinkRepository {
+    collection := db.Collection("share_links")
+
+    indexes := []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "token", Value: 1}},
+            Options: options.Index().SetUnique(true),
+        },
+        {Keys: bson.D{{Key: "user_id", Value: 1}}},
+        {Keys: bson.D{{Key: "file_id", Value: 1}}},
+    }
+    if _, err := collection.Indexes().CreateMany(context.Background(), indexes); err != nil {
+        log.Printf("failed to create share link indexes: %v", err)
+    }
+
+    return &ShareLinkRepository{collection: collection}
+}
+
+// CreateMany inserts links in one round trip.
+func (r *ShareLinkRepository) CreateMany(ctx context.Context, links []models.ShareLink) error {
+    if len(links) == 0 {
+        return nil
+    }
+    docs := make([]interface{}, len(links))
+    for i := range links {
+        docs[i] = links[i]
+    }
+    if _, err := r.collection.InsertMany(ctx, docs); err != nil {
+        return fmt.Errorf("failed to insert share links: %w", err)
+    }
+    return nil
+}
+
+// FindByToken returns the link with token unless it has expired.
+func (r *ShareLinkRepository) FindByToken(ctx context.Context, token string) (*models.ShareLink, error) {
+    var link models.ShareLink
+    if err := r.collection.FindOne(ctx, unexpired(bson.M{"token": token})).Decode(&link); err != nil {
+        if err == mongo.ErrNoDocuments {
+            return nil, ErrShareLinkNotFound
+        }
+        return nil, fmt.Errorf("failed to find share link: %w", err)
+    }
+    return &link, nil
+}
+
+// CountActive returns how many unexpired links a user holds.
+func (r *ShareLinkRepository) CountActive(ctx context.Context, userID string) (int64, error) {
+    count, err := r.collection.CountDocuments(ctx, unexpired(bson.M{"user_id": userID}))
+    if err != nil {
+        return 0, fmt.Errorf("failed to count share links: %w", err)
+    }
+    return count, nil
+}
+
+// DeleteByFiles removes every link to the given files.
+func (r *ShareLinkRepository) DeleteByFiles(ctx context.Context, fileIDs []primitive.ObjectID) error {
+    if len(fileIDs) == 0 {
+        return nil
+    }
+    if _, err := r.collection.DeleteMany(ctx, bson.M{"file_id": bson.M{"$in": fileIDs}}); err != nil {
+        return fmt.Errorf("failed to delete share links: %w", err)
+    }
+    return nil
+}
+
+// DeleteByUser removes all of a user's links.
+func (r *ShareLinkRepository) DeleteByUser(ctx context.Context, userID string) error {
+    if _, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+        return fmt.Errorf("failed to delete share links: %w", err)
+    }
+    return nil
+}
+
+// unexpired restricts filter to links that haven't expired.
+func unexpired(filter bson.M) bson.M {
+    filter["$or"] = bson.A{
+        bson.M{"expires_at": nil},
+        bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+    }
+    return filter
+}
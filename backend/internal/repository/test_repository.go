@@ -14,9 +14,9 @@ type TestRepository struct {
     collection *mongo.Collection
 }
 
-func NewTestRepository(client *mongo.Client) *TestRepository {
+func NewTestRepository(db *mongo.Database) *TestRepository {
     return &TestRepository{
-        collection: client.Database("Storely").Collection("testData"),
+        collection: db.Collection("testData"),
     }
 }
 
@@ -5,6 +5,7 @@ import (
     "context"
     "time"
     "fmt"
+    "regexp"
     "backend/internal/models"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/bson"
@@ -16,8 +17,8 @@ type UserRepository struct {
     collection *mongo.Collection
 }
 
-func NewUserRepository(client *mongo.Client) *UserRepository {
-    collection := client.Database("Storely").Collection("users")
+func NewUserRepository(db *mongo.Database) *UserRepository {
+    collection := db.Collection("users")
 
     // Create unique indexes
     indexes := []mongo.IndexModel{
@@ -29,6 +30,12 @@ func NewUserRepository(client *mongo.Client) *UserRepository {
             Keys:    bson.D{{Key: "name", Value: 1}},
             Options: options.Index().SetUnique(true),
         },
+        {
+            // An external identity belongs to one account at most
+            Keys: bson.D{{Key: "identities.issuer", Value: 1}, {Key: "identities.subject", Value: 1}},
+            Options: options.Index().SetUnique(true).
+                SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}}),
+        },
     }
     
     _, err := collection.Indexes().CreateMany(context.Background(), indexes)
@@ -46,12 +53,7 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 }
 
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
-    var user models.User
-    err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
-    if err != nil {
-        return nil, err
-    }
-    return &user, nil
+    return r.findOne(ctx, bson.M{"email": email})
 }
 
 func (r *UserRepository) UpdateLoginStats(ctx context.Context, userID primitive.ObjectID, ipAddress string, isSuccessful bool) error {
@@ -88,26 +90,28 @@ func (r *UserRepository) UpdateLockStatus(ctx context.Context, userID primitive.
     return err
 }
 
-func (r *UserRepository) CheckDuplicate(ctx context.Context, email, username string) (bool, string, error) {
+// CheckDuplicate returns ErrEmailTaken or ErrUsernameTaken when an account
+// already uses the email or username.
+func (r *UserRepository) CheckDuplicate(ctx context.Context, email, username string) error {
     // Check email
     count, err := r.collection.CountDocuments(ctx, bson.M{"email": email})
     if err != nil {
-        return false, "", err
+        return err
     }
     if count > 0 {
-        return true, "Email already registered", nil
+        return ErrEmailTaken
     }
 
     // Check username
     count, err = r.collection.CountDocuments(ctx, bson.M{"name": username})
     if err != nil {
-        return false, "", err
+        return err
     }
     if count > 0 {
-        return true, "Username already taken", nil
+        return ErrUsernameTaken
     }
 
-    return false, "", nil
+    return nil
 }
 
 // In user_repository.go
@@ -115,46 +119,480 @@ func (r *UserRepository) GetStorageUsedAndLimit(ctx context.Context, userID stri
     filter := bson.M{"user_id": userID}
     var user models.User
     if err := r.collection.FindOne(ctx, filter).Decode(&user); err != nil {
+        if err == mongo.ErrNoDocuments {
+            return 0, 0, ErrUserNotFound
+        }
         return 0, 0, fmt.Errorf("failed to find user: %w", err)
     }
     return user.StorageUsed, user.StorageLimit, nil
 }
 
+// CheckUserStorageLimit charges fileSize to the user's storage, or returns
+// ErrStorageLimitExceeded if that would pass their limit. Checking and
+// charging are one update, so concurrent uploads can't overshoot the limit
+// together.
 func (r *UserRepository) CheckUserStorageLimit(ctx context.Context, userID string, fileSize float64) error {
-    used, limit, err := r.GetStorageUsedAndLimit(ctx, userID)
+    filter := bson.M{
+        "user_id": userID,
+        "$expr": bson.M{"$lte": bson.A{
+            bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$storage_used", 0}}, fileSize}},
+            "$storage_limit",
+        }},
+    }
+    result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"storage_used": fileSize}})
     if err != nil {
-        return err
+        return fmt.Errorf("failed to update storage: %w", err)
+    }
+    if result.MatchedCount == 0 {
+        if _, _, err := r.GetStorageUsedAndLimit(ctx, userID); err != nil {
+            return err
+        }
+        return ErrStorageLimitExceeded
     }
-    if used+fileSize > limit {
-        return fmt.Errorf("storage limit exceeded")
+    return nil
+}
+
+// DecreaseUsedStorage gives size back to the user's storage, which doesn't
+// go below zero.
+func (r *UserRepository) DecreaseUsedStorage(ctx context.Context, userID string, size float64) error {
+    pipeline := mongo.Pipeline{
+        {{Key: "$set", Value: bson.M{"storage_used": bson.M{"$max": bson.A{
+            0,
+            bson.M{"$subtract": bson.A{bson.M{"$ifNull": bson.A{"$storage_used", 0}}, size}},
+        }}}}},
     }
-    _, err = r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{"$inc": bson.M{"storage_used": fileSize}})
+    result, err := r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, pipeline)
     if err != nil {
         return fmt.Errorf("failed to update storage: %w", err)
     }
+    if result.MatchedCount == 0 {
+        return ErrUserNotFound
+    }
     return nil
 }
 
-func (r *UserRepository) DecreaseUsedStorage(ctx context.Context, userID string, size float64) error {
-    // Optionally check current storage:
-    current, _, err := r.GetStorageUsedAndLimit(ctx, userID)
+// SetStorageUsed overwrites the stored usage, e.g. after reconciling it
+// against the user's files, if it is still observed. It reports whether it
+// was; a concurrent charge or release makes it fail rather than be lost.
+func (r *UserRepository) SetStorageUsed(ctx context.Context, userID string, observed, used float64) (bool, error) {
+    result, err := r.collection.UpdateOne(ctx,
+        bson.M{"user_id": userID, "storage_used": observed},
+        bson.M{"$set": bson.M{"storage_used": used}})
     if err != nil {
-        return err
+        return false, fmt.Errorf("failed to update storage: %w", err)
     }
+    return result.MatchedCount > 0, nil
+}
+
+func (r *UserRepository) FindByObjectID(ctx context.Context, id string) (*models.User, error) {
+    objectID, err := primitive.ObjectIDFromHex(id)
+    if err != nil {
+        return nil, ErrInvalidID.Wrap(err)
+    }
+    return r.findOne(ctx, bson.M{"_id": objectID})
+}
+
+func (r *UserRepository) FindByName(ctx context.Context, name string) (*models.User, error) {
+    return r.findOne(ctx, bson.M{"name": name})
+}
+
+func (r *UserRepository) FindByUserID(ctx context.Context, userID string) (*models.User, error) {
+    return r.findOne(ctx, bson.M{"user_id": userID})
+}
+
+func (r *UserRepository) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+    var user models.User
+    if err := r.collection.FindOne(ctx, filter).Decode(&user); err != nil {
+        if err == mongo.ErrNoDocuments {
+            return nil, ErrUserNotFound
+        }
+        return nil, fmt.Errorf("failed to find user: %w", err)
+    }
+    return &user, nil
+}
 
-    // Clamp at 0
-    decrement := -size
-    if current < size {
-        decrement = -current
+// Search returns users whose name or email contains query (case-insensitive),
+// newest first, along with the total number of matches.
+func (r *UserRepository) Search(ctx context.Context, query string, skip, limit int64) ([]models.User, int64, error) {
+    filter := bson.M{}
+    if query != "" {
+        pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}
+        filter["$or"] = bson.A{
+            bson.M{"name": pattern},
+            bson.M{"email": pattern},
+        }
     }
 
-    _, err = r.collection.UpdateOne(
-        ctx,
-        bson.M{"user_id": userID},
-        bson.M{"$inc": bson.M{"storage_used": decrement}},
+    total, err := r.collection.CountDocuments(ctx, filter)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to count users: %w", err)
+    }
+
+    opts := options.Find().
+        SetSort(bson.D{{Key: "created_at", Value: -1}}).
+        SetSkip(skip).
+        SetLimit(limit)
+    cursor, err := r.collection.Find(ctx, filter, opts)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to list users: %w", err)
+    }
+
+    users := []models.User{}
+    if err := cursor.All(ctx, &users); err != nil {
+        return nil, 0, fmt.Errorf("failed to decode users: %w", err)
+    }
+    return users, total, nil
+}
+
+// SetPlan moves a user to a plan and applies the plan's storage limit.
+func (r *UserRepository) SetPlan(ctx context.Context, userID string, planName string, storageLimit float64) error {
+    return r.updateByUserID(ctx, userID, bson.M{
+        "$set": bson.M{
+            "plan":          planName,
+            "storage_limit": storageLimit,
+        },
+    })
+}
+
+// UpdateLimitsForPlan applies a plan's new storage limit to everyone on it.
+// Accounts without a plan are treated as being on the default plan.
+func (r *UserRepository) UpdateLimitsForPlan(ctx context.Context, planName string, includeUnassigned bool, storageLimit float64) (int64, error) {
+    filter := bson.M{"plan": planName}
+    if includeUnassigned {
+        filter = bson.M{"$or": bson.A{
+            bson.M{"plan": planName},
+            bson.M{"plan": bson.M{"$exists": false}},
+            bson.M{"plan": ""},
+        }}
+    }
+    result, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"storage_limit": storageLimit}})
+    if err != nil {
+        return 0, fmt.Errorf("failed to update plan limits: %w", err)
+    }
+    return result.ModifiedCount, nil
+}
+
+func (r *UserRepository) SetStorageLimit(ctx context.Context, userID string, limit float64) error {
+    return r.updateByUserID(ctx, userID, bson.M{"$set": bson.M{"storage_limit": limit}})
+}
+
+// Unlock clears the lock state set by failed logins.
+func (r *UserRepository) Unlock(ctx context.Context, userID string) error {
+    return r.updateByUserID(ctx, userID, bson.M{
+        "$set": bson.M{
+            "is_locked":       false,
+            "lock_expires_at": nil,
+            "failed_attempts": 0,
+        },
+    })
+}
+
+// MarkEmailVerified records that the user proved they own email. It
+// reports false when the account no longer has that address.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, userID, email string) (bool, error) {
+    result, err := r.collection.UpdateOne(ctx,
+        bson.M{"user_id": userID, "email": email},
+        bson.M{"$set": bson.M{"email_verified": true, "email_verified_at": time.Now()}})
+    if err != nil {
+        return false, fmt.Errorf("failed to verify email: %w", err)
+    }
+    return result.MatchedCount == 1, nil
+}
+
+// MarkExistingEmailsVerified treats accounts created before email
+// verification existed as verified, so they keep working as before.
+func (r *UserRepository) MarkExistingEmailsVerified(ctx context.Context) (int64, error) {
+    result, err := r.collection.UpdateMany(ctx,
+        bson.M{"email_verified": bson.M{"$exists": false}},
+        bson.M{"$set": bson.M{"email_verified": true}})
+    if err != nil {
+        return 0, fmt.Errorf("failed to update users: %w", err)
+    }
+    return result.ModifiedCount, nil
+}
+
+// SetPassword replaces the password hash and ends every session.
+func (r *UserRepository) SetPassword(ctx context.Context, userID, passwordHash string) error {
+    return r.updateByUserID(ctx, userID, bson.M{
+        "$set": bson.M{"password": passwordHash},
+        "$inc": bson.M{"session_version": 1},
+    })
+}
+
+// SessionVersion returns the session version of the account with ObjectID
+// id.
+func (r *UserRepository) SessionVersion(ctx context.Context, id string) (int, error) {
+    objectID, err := primitive.ObjectIDFromHex(id)
+    if err != nil {
+        return 0, ErrInvalidID.Wrap(err)
+    }
+    var user models.User
+    opts := options.FindOne().SetProjection(bson.M{"session_version": 1})
+    if err := r.collection.FindOne(ctx, bson.M{"_id": objectID}, opts).Decode(&user); err != nil {
+        if err == mongo.ErrNoDocuments {
+            return 0, ErrUserNotFound
+        }
+        return 0, fmt.Errorf("failed to find user: %w", err)
+    }
+    return user.SessionVersion, nil
+}
+
+// SetName renames the user.
+func (r *UserRepository) SetName(ctx context.Context, userID, name string) error {
+    err := r.updateByUserID(ctx, userID, bson.M{"$set": bson.M{"name": name}})
+    if mongo.IsDuplicateKeyError(err) {
+        return ErrUsernameTaken
+    }
+    return err
+}
+
+// ChangeEmail moves the account to a new, verified address.
+func (r *UserRepository) ChangeEmail(ctx context.Context, userID, email string) error {
+    err := r.updateByUserID(ctx, userID, bson.M{"$set": bson.M{
+        "email":             email,
+        "email_verified":    true,
+        "email_verified_at": time.Now(),
+    }})
+    if mongo.IsDuplicateKeyError(err) {
+        return ErrEmailTaken
+    }
+    return err
+}
+
+// FindByIdentity returns the account linked to the external identity.
+func (r *UserRepository) FindByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+    return r.findOne(ctx, bson.M{"identities": bson.M{"$elemMatch": bson.M{"issuer": issuer, "subject": subject}}})
+}
+
+// AddIdentity links an external identity to the user. It returns
+// ErrIdentityLinked when another account has the identity, or the user is
+// already linked to another identity at the same issuer.
+func (r *UserRepository) AddIdentity(ctx context.Context, userID string, identity models.ExternalIdentity) error {
+    result, err := r.collection.UpdateOne(ctx,
+        bson.M{"user_id": userID, "identities.issuer": bson.M{"$ne": identity.Issuer}},
+        bson.M{"$push": bson.M{"identities": identity}})
+    if mongo.IsDuplicateKeyError(err) {
+        return ErrIdentityLinked
+    }
+    if err != nil {
+        return fmt.Errorf("failed to link identity: %w", err)
+    }
+    if result.MatchedCount == 0 {
+        return ErrIdentityLinked
+    }
+    return nil
+}
+
+// SetPendingTOTP stores a sealed TOTP secret awaiting its first code.
+func (r *UserRepository) SetPendingTOTP(ctx context.Context, userID string, sealedSecret string) error {
+    return r.updateByUserID(ctx, userID, bson.M{"$set": bson.M{"totp_pending_secret": sealedSecret}})
+}
+
+// ActivateTOTP turns on two-factor authentication with the pending secret,
+// provided it is still sealedSecret. step is the time step of the code
+// that proved it, which can't be used again.
+func (r *UserRepository) ActivateTOTP(ctx context.Context, userID string, sealedSecret string, step int64, recoveryCodes []string) error {
+    result, err := r.collection.UpdateOne(ctx,
+        bson.M{"user_id": userID, "totp_pending_secret": sealedSecret},
+        bson.M{
+            "$set": bson.M{
+                "totp_enabled":   true,
+                "totp_secret":    sealedSecret,
+                "totp_last_step": step,
+                "recovery_codes": recoveryCodes,
+            },
+            "$unset": bson.M{"totp_pending_secret": ""},
+        })
+    if err != nil {
+        return fmt.Errorf("failed to activate TOTP: %w", err)
+    }
+    if result.MatchedCount == 0 {
+        return ErrTOTPNotPending
+    }
+    return nil
+}
+
+// UseTOTPStep records that a code for step was accepted. It reports false
+// when that step or a later one was already used, so each code works once.
+func (r *UserRepository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+    result, err := r.collection.UpdateOne(ctx,
+        bson.M{"user_id": userID, "totp_enabled": true, "$or": bson.A{
+            bson.M{"totp_last_step": bson.M{"$lt": step}},
+            bson.M{"totp_last_step": bson.M{"$exists": false}},
+        }},
+        bson.M{"$set": bson.M{"totp_last_step": step}})
+    if err != nil {
+        return false, fmt.Errorf("failed to record TOTP step: %w", err)
+    }
+    return result.MatchedCount == 1, nil
+}
+
+// UseRecoveryCode removes the hashed recovery code, reporting whether the
+// user had it.
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, userID string, codeHash string) (bool, error) {
+    result, err := r.collection.UpdateOne(ctx,
+        bson.M{"user_id": userID, "recovery_codes": codeHash},
+        bson.M{"$pull": bson.M{"recovery_codes": codeHash}})
+    if err != nil {
+        return false, fmt.Errorf("failed to use recovery code: %w", err)
+    }
+    return result.MatchedCount == 1, nil
+}
+
+// UseMFAChallenge records that the login challenge id was completed,
+// reporting false when it already was. Challenges that have expired are
+// forgotten at the same time.
+func (r *UserRepository) UseMFAChallenge(ctx context.Context, userID, id string, expiresAt time.Time) (bool, error) {
+    pipeline := mongo.Pipeline{
+        {{Key: "$set", Value: bson.M{"used_mfa_challenges": bson.M{"$concatArrays": bson.A{
+            bson.M{"$filter": bson.M{
+                "input": bson.M{"$ifNull": bson.A{"$used_mfa_challenges", bson.A{}}},
+                "cond":  bson.M{"$gt": bson.A{"$$this.expires_at", time.Now()}},
+            }},
+            bson.A{bson.M{"id": id, "expires_at": expiresAt}},
+        }}}}},
+    }
+    result, err := r.collection.UpdateOne(ctx,
+        bson.M{"user_id": userID, "used_mfa_challenges.id": bson.M{"$ne": id}},
+        pipeline)
+    if err != nil {
+        return false, fmt.Errorf("failed to record MFA challenge: %w", err)
+    }
+    return result.MatchedCount == 1, nil
+}
+
+// LeaseShareLinks gives lease the exclusive right to create share links
+// for the user until the given time. It reports false when another
+// unexpired lease holds it.
+func (r *UserRepository) LeaseShareLinks(ctx context.Context, userID, lease string, until, now time.Time) (bool, error) {
+    result, err := r.collection.UpdateOne(ctx,
+        bson.M{"user_id": userID, "$or": bson.A{
+            bson.M{"share_lease": bson.M{"$exists": false}},
+            bson.M{"share_lease_until": bson.M{"$lte": now}},
+        }},
+        bson.M{"$set": bson.M{"share_lease": lease, "share_lease_until": until}})
+    if err != nil {
+        return false, fmt.Errorf("failed to lease share links: %w", err)
+    }
+    return result.MatchedCount == 1, nil
+}
+
+// ReleaseShareLinks ends lease, if it still holds the user's share links.
+func (r *UserRepository) ReleaseShareLinks(ctx context.Context, userID, lease string) error {
+    _, err := r.collection.UpdateOne(ctx,
+        bson.M{"user_id": userID, "share_lease": lease},
+        bson.M{"$unset": bson.M{"share_lease": "", "share_lease_until": ""}})
+    if err != nil {
+        return fmt.Errorf("failed to release share links: %w", err)
+    }
+    return nil
+}
+
+func (r *UserRepository) SetRecoveryCodes(ctx context.Context, userID string, recoveryCodes []string) error {
+    return r.updateByUserID(ctx, userID, bson.M{"$set": bson.M{"recovery_codes": recoveryCodes}})
+}
+
+// DisableTOTP turns off two-factor authentication and forgets its secrets.
+func (r *UserRepository) DisableTOTP(ctx context.Context, userID string) error {
+    return r.updateByUserID(ctx, userID, bson.M{
+        "$set": bson.M{"totp_enabled": false},
+        "$unset": bson.M{
+            "totp_secret":         "",
+            "totp_pending_secret": "",
+            "totp_last_step":      "",
+            "recovery_codes":      "",
+        },
+    })
+}
+
+// SetDisabled disables or re-enables the account. Disabling it also ends
+// every session.
+func (r *UserRepository) SetDisabled(ctx context.Context, userID string, disabled bool) error {
+    update := bson.M{"$set": bson.M{"is_disabled": disabled}}
+    if disabled {
+        update["$inc"] = bson.M{"session_version": 1}
+    }
+    return r.updateByUserID(ctx, userID, update)
+}
+
+func (r *UserRepository) SetRole(ctx context.Context, userID string, role string) error {
+    return r.updateByUserID(ctx, userID, bson.M{"$set": bson.M{"role": role}})
+}
+
+// PromoteByEmail grants the admin role to the accounts with the given
+// emails. Returns the number of accounts changed.
+func (r *UserRepository) PromoteByEmail(ctx context.Context, emails []string) (int64, error) {
+    if len(emails) == 0 {
+        return 0, nil
+    }
+    result, err := r.collection.UpdateMany(ctx,
+        bson.M{"email": bson.M{"$in": emails}, "role": bson.M{"$ne": models.RoleAdmin}},
+        bson.M{"$set": bson.M{"role": models.RoleAdmin}},
     )
     if err != nil {
-        return fmt.Errorf("failed to update storage: %w", err)
+        return 0, fmt.Errorf("failed to promote admins: %w", err)
+    }
+    return result.ModifiedCount, nil
+}
+
+func (r *UserRepository) DeleteByUserID(ctx context.Context, userID string) error {
+    result, err := r.collection.DeleteOne(ctx, bson.M{"user_id": userID})
+    if err != nil {
+        return fmt.Errorf("failed to delete user: %w", err)
+    }
+    if result.DeletedCount == 0 {
+        return ErrUserNotFound
     }
     return nil
-}
\ No newline at end of file
+}
+
+// UserTotals summarises all accounts.
+type UserTotals struct {
+    Users        int64   `bson:"users" json:"users"`
+    Admins       int64   `bson:"admins" json:"admins"`
+    Locked       int64   `bson:"locked" json:"locked"`
+    Disabled     int64   `bson:"disabled" json:"disabled"`
+    StorageUsed  float64 `bson:"storage_used" json:"storageUsed"`
+    StorageLimit float64 `bson:"storage_limit" json:"storageLimit"`
+}
+
+func (r *UserRepository) Totals(ctx context.Context) (*UserTotals, error) {
+    countIf := func(cond interface{}) bson.M {
+        return bson.M{"$sum": bson.M{"$cond": bson.A{cond, 1, 0}}}
+    }
+    pipeline := mongo.Pipeline{
+        {{Key: "$group", Value: bson.M{
+            "_id":           nil,
+            "users":         bson.M{"$sum": 1},
+            "admins":        countIf(bson.M{"$eq": bson.A{"$role", models.RoleAdmin}}),
+            "locked":        countIf(bson.M{"$eq": bson.A{"$is_locked", true}}),
+            "disabled":      countIf(bson.M{"$eq": bson.A{"$is_disabled", true}}),
+            "storage_used":  bson.M{"$sum": "$storage_used"},
+            "storage_limit": bson.M{"$sum": "$storage_limit"},
+        }}},
+    }
+    cursor, err := r.collection.Aggregate(ctx, pipeline)
+    if err != nil {
+        return nil, fmt.Errorf("failed to aggregate users: %w", err)
+    }
+
+    var rows []UserTotals
+    if err := cursor.All(ctx, &rows); err != nil {
+        return nil, fmt.Errorf("failed to decode user totals: %w", err)
+    }
+    if len(rows) == 0 {
+        return &UserTotals{}, nil
+    }
+    return &rows[0], nil
+}
+
+func (r *UserRepository) updateByUserID(ctx context.Context, userID string, update bson.M) error {
+    result, err := r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
+    if err != nil {
+        return fmt.Errorf("failed to update user: %w", err)
+    }
+    if result.MatchedCount == 0 {
+        return ErrUserNotFound
+    }
+    return nil
+}
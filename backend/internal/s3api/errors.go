@@ -0,0 +1,127 @@
+package s3api
+
+import (
+    "encoding/xml"
+    "errors"
+    "log"
+    "net/http"
+
+    "backend/internal/apperr"
+    "backend/internal/repository"
+    "backend/internal/service"
+)
+
+// Error is an S3 error response. S3 clients dispatch on Code, so these use
+// the names AWS documents rather than Storely's own error codes.
+type Error struct {
+    Status  int
+    Code    string
+    Message string
+}
+
+func (e *Error) Error() string {
+    return e.Code + ": " + e.Message
+}
+
+func newError(status int, code, message string) *Error {
+    return &Error{Status: status, Code: code, Message: message}
+}
+
+// with returns a copy of e with a more specific message.
+func (e *Error) with(message string) *Error {
+    c := *e
+    c.Message = message
+    return &c
+}
+
+var (
+    errAccessDenied          = newError(http.StatusForbidden, "AccessDenied", "Access Denied")
+    errInvalidAccessKeyID    = newError(http.StatusForbidden, "InvalidAccessKeyId", "The access key ID you provided does not exist in our records")
+    errSignatureMismatch     = newError(http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided")
+    errRequestTimeTooSkewed  = newError(http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large")
+    errExpiredRequest        = newError(http.StatusForbidden, "AccessDenied", "Request has expired")
+    errMalformedAuth         = newError(http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed")
+    errUnsupportedSignature  = newError(http.StatusBadRequest, "InvalidRequest", "Only AWS Signature Version 4 (AWS4-HMAC-SHA256) is supported")
+    errContentSHA256Mismatch = newError(http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed")
+    errBadDigest             = newError(http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received")
+    errInvalidDigest         = newError(http.StatusBadRequest, "InvalidDigest", "The Content-MD5 you specified is not valid")
+    errIncompleteBody        = newError(http.StatusBadRequest, "IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header")
+    errMissingContentLength  = newError(http.StatusLengthRequired, "MissingContentLength", "You must provide the Content-Length HTTP header")
+    errInvalidArgument       = newError(http.StatusBadRequest, "InvalidArgument", "Invalid argument")
+    errInvalidRange          = newError(http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+    errMalformedXML          = newError(http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema")
+    errNoSuchBucket          = newError(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+    errNoSuchKey             = newError(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+    errNoSuchUpload          = newError(http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist")
+    errInvalidPart           = newError(http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found")
+    errInvalidPartOrder      = newError(http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order")
+    errEntityTooSmall        = newError(http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size")
+    errEntityTooLarge        = newError(http.StatusBadRequest, "EntityTooLarge", "Your proposed upload exceeds the maximum allowed object size")
+    errBucketAlreadyOwned    = newError(http.StatusConflict, "BucketAlreadyOwnedByYou", "Your bucket already exists; every account has exactly one bucket")
+    errPreconditionFailed    = newError(http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the preconditions you specified did not hold")
+    errQuotaExceeded         = newError(http.StatusForbidden, "QuotaExceeded", "Storage quota exceeded")
+    errNotImplemented        = newError(http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented")
+    errMethodNotAllowed      = newError(http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource")
+    errInternal              = newError(http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again.")
+)
+
+// toS3Error translates errors from the services into S3 errors.
+func toS3Error(err error) *Error {
+    var s3Err *Error
+    if errors.As(err, &s3Err) {
+        return s3Err
+    }
+
+    switch {
+    case errors.Is(err, repository.ErrFileNotFound):
+        return errNoSuchKey
+    case errors.Is(err, repository.ErrUploadNotFound):
+        return errNoSuchUpload
+    case errors.Is(err, repository.ErrAccessKeyNotFound):
+        return errInvalidAccessKeyID
+    case errors.Is(err, repository.ErrUserNotFound), errors.Is(err, service.ErrAccountDisabled):
+        return errAccessDenied
+    case errors.Is(err, service.ErrFileTooLarge):
+        return errEntityTooLarge.with(apperr.From(err).Message)
+    case errors.Is(err, repository.ErrStorageLimitExceeded), errors.Is(err, service.ErrPlanLimitExceeded):
+        return errQuotaExceeded.with(apperr.From(err).Message)
+    case errors.Is(err, apperr.ErrValidation), errors.Is(err, apperr.ErrBadRequest):
+        return errInvalidArgument.with(apperr.From(err).Message)
+    }
+    return errInternal
+}
+
+type errorBody struct {
+    XMLName   xml.Name `xml:"Error"`
+    Code      string   `xml:"Code"`
+    Message   string   `xml:"Message"`
+    Resource  string   `xml:"Resource,omitempty"`
+    RequestID string   `xml:"RequestId,omitempty"`
+}
+
+// writeError sends err as an S3 XML error. HEAD responses carry no body.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+    s3Err := toS3Error(err)
+    requestID := apperr.RequestID(r.Context())
+    if s3Err.Status >= http.StatusInternalServerError {
+        log.Printf("[%s] S3 %s %s: %v", requestID, r.Method, r.URL.Path, err)
+    }
+
+    if r.Method == http.MethodHead {
+        w.WriteHeader(s3Err.Status)
+        return
+    }
+    writeXML(w, s3Err.Status, errorBody{
+        Code:      s3Err.Code,
+        Message:   s3Err.Message,
+        Resource:  r.URL.Path,
+        RequestID: requestID,
+    })
+}
+
+func writeXML(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", "application/xml")
+    w.WriteHeader(status)
+    w.Write([]byte(xml.Header))
+    xml.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,218 @@
+// Package s3api serves an S3-compatible API on top of Storely's own file
+// model. Every account appears as a single bucket named after its username;
+// object keys map to folder/file name, so objects written through S3 are
+// ordinary Storely files (same quota, plan limits, chunk layout and
+// post-upload jobs) and vice versa.
+//
+// Requests are authenticated with SigV4 using per-user access keys, either
+// in the Authorization header or as a presigned URL. Only path-style
+// addressing (http://host/bucket/key) is supported.
+package s3api
+
+import (
+    "context"
+    "io"
+    "log"
+    "net/http"
+    "path"
+    "strings"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+    "backend/internal/service"
+)
+
+const xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// Gateway is the http.Handler of the S3 API.
+type Gateway struct {
+    keys    *service.AccessKeyService
+    store   *service.FileStore
+    uploads *repository.MultipartUploadRepository
+    queue   *service.JobQueue
+    region  string
+    // expiry is how long a multipart upload may stay unfinished
+    expiry time.Duration
+}
+
+func NewGateway(keys *service.AccessKeyService, store *service.FileStore, uploads *repository.MultipartUploadRepository, queue *service.JobQueue, region string, expiry time.Duration) *Gateway {
+    if region == "" {
+        region = "us-east-1"
+    }
+    if expiry <= 0 {
+        expiry = DefaultMultipartExpiry
+    }
+    return &Gateway{
+        keys:    keys,
+        store:   store,
+        uploads: uploads,
+        queue:   queue,
+        region:  region,
+        expiry:  expiry,
+    }
+}
+
+// Register adds the multipart expiry job handler to queue.
+func (g *Gateway) Register(queue *service.JobQueue) {
+    queue.Register(JobExpireMultipart, g.expireUpload)
+}
+
+// request is an authenticated S3 request.
+type request struct {
+    *http.Request
+    user   *models.User
+    bucket string
+    key    string
+    body   io.Reader
+    size   int64
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Server", "Storely")
+    if id := apperr.RequestID(r.Context()); id != "" {
+        w.Header().Set("X-Amz-Request-Id", id)
+    }
+
+    req, err := g.authenticate(r)
+    if err != nil {
+        writeError(w, r, err)
+        return
+    }
+
+    if req.bucket == "" {
+        if r.Method != http.MethodGet {
+            writeError(w, r, errMethodNotAllowed)
+            return
+        }
+        g.listBuckets(w, req)
+        return
+    }
+    if req.bucket != req.user.Name {
+        writeError(w, r, errNoSuchBucket)
+        return
+    }
+
+    query := r.URL.Query()
+    if req.key == "" {
+        switch {
+        case r.Method == http.MethodGet && query.Has("location"):
+            g.getBucketLocation(w, req)
+        case r.Method == http.MethodGet && query.Has("uploads"):
+            writeError(w, r, errNotImplemented)
+        case r.Method == http.MethodGet:
+            g.listObjects(w, req)
+        case r.Method == http.MethodHead:
+            w.Header().Set("X-Amz-Bucket-Region", g.region)
+            w.WriteHeader(http.StatusOK)
+        case r.Method == http.MethodPut:
+            writeError(w, r, errBucketAlreadyOwned)
+        case r.Method == http.MethodPost && query.Has("delete"):
+            g.deleteObjects(w, req)
+        default:
+            writeError(w, r, errMethodNotAllowed)
+        }
+        return
+    }
+
+    switch {
+    case r.Method == http.MethodPost && query.Has("uploads"):
+        g.createMultipartUpload(w, req)
+    case r.Method == http.MethodPost && query.Has("uploadId"):
+        g.completeMultipartUpload(w, req)
+    case r.Method == http.MethodPut && query.Has("uploadId"):
+        g.uploadPart(w, req)
+    case r.Method == http.MethodGet && query.Has("uploadId"):
+        g.listParts(w, req)
+    case r.Method == http.MethodDelete && query.Has("uploadId"):
+        g.abortMultipartUpload(w, req)
+    case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+        writeError(w, r, errNotImplemented.with("CopyObject is not supported"))
+    case r.Method == http.MethodPut:
+        g.putObject(w, req)
+    case r.Method == http.MethodGet, r.Method == http.MethodHead:
+        g.getObject(w, req)
+    case r.Method == http.MethodDelete:
+        g.deleteObject(w, req)
+    default:
+        writeError(w, r, errMethodNotAllowed)
+    }
+}
+
+// authenticate verifies the request signature and resolves the bucket and
+// key from the path.
+func (g *Gateway) authenticate(r *http.Request) (*request, error) {
+    sig, err := parseSignature(r, time.Now().UTC())
+    if err != nil {
+        return nil, err
+    }
+    if sig.region != g.region {
+        return nil, errMalformedAuth.with("the region '" + sig.region + "' is wrong; expecting '" + g.region + "'")
+    }
+
+    key, user, err := g.keys.Resolve(r.Context(), sig.accessKeyID)
+    if err != nil {
+        return nil, err
+    }
+    if err := sig.verify(r, key.SecretKey); err != nil {
+        return nil, err
+    }
+    go func() {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := g.keys.TouchLastUsed(ctx, key.AccessKeyID); err != nil {
+            log.Printf("Failed to record access key use: %v", err)
+        }
+    }()
+
+    body, size, err := sig.payloadReader(r, key.SecretKey)
+    if err != nil {
+        return nil, err
+    }
+
+    bucket, objKey, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+    return &request{
+        Request: r,
+        user:    user,
+        bucket:  bucket,
+        key:     objKey,
+        body:    body,
+        size:    size,
+    }, nil
+}
+
+// splitKey maps an object key to a Storely folder and file name. Keys that
+// would not survive the round trip (empty segments, "." or "..") are
+// rejected so every file has exactly one key.
+func splitKey(key string) (folder, name string, err error) {
+    folder, name = path.Split(key)
+    folder = strings.TrimSuffix(folder, "/")
+    cleaned, ok := service.CleanFolder(folder)
+    if !ok || cleaned != folder || strings.HasPrefix(key, "/") || name == "" || name == "." || name == ".." || len(key) > 1024 {
+        return "", "", errInvalidArgument.with("Object keys must be slash-separated paths without empty, \".\" or \"..\" segments")
+    }
+    return folder, name, nil
+}
+
+// objectKey is the key of a stored file.
+func objectKey(file *models.FileMinIO) string {
+    if file.Folder == "" {
+        return file.FileName
+    }
+    return file.Folder + "/" + file.FileName
+}
+
+// etagOf returns the quoted entity tag of a file. Files uploaded through
+// the browser have no MD5, so their ID stands in.
+func etagOf(file *models.FileMinIO) string {
+    if file.ETag != "" {
+        return `"` + file.ETag + `"`
+    }
+    return `"` + file.ID.Hex() + `"`
+}
+
+// modTime is the S3 Last-Modified of a file.
+func modTime(file *models.FileMinIO) time.Time {
+    return file.CreatedAt.UTC().Truncate(time.Millisecond)
+}
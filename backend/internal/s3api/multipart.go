@@ -0,0 +1,393 @@
+package s3api
+
+import (
+    "context"
+    "crypto/md5"
+    "encoding/hex"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "backend/internal/models"
+    "backend/internal/service"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobExpireMultipart discards a multipart upload that wasn't finished in
+// time.
+const JobExpireMultipart = "expire_multipart_upload"
+
+// DefaultMultipartExpiry is how long a multipart upload may take when
+// nothing is configured.
+const DefaultMultipartExpiry = 7 * 24 * time.Hour
+
+const (
+    maxPartNumber = 10000
+    minPartSize   = 5 * 1024 * 1024
+    maxPartSize   = 5 * 1024 * 1024 * 1024
+)
+
+// partObjectName is where a pending part is kept until the upload is
+// completed or aborted.
+func partObjectName(uploadID string, number int) string {
+    return fmt.Sprintf("multipart/%s/part_%d", uploadID, number)
+}
+
+func partsPrefix(uploadID string) string {
+    return "multipart/" + uploadID + "/"
+}
+
+// partsSize adds up the parts of an upload, which are all charged to the
+// owner's quota.
+func partsSize(upload *models.MultipartUpload) int64 {
+    var size int64
+    for _, part := range upload.Parts {
+        size += part.Size
+    }
+    return size
+}
+
+type initiateResult struct {
+    XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+    Xmlns    string   `xml:"xmlns,attr"`
+    Bucket   string   `xml:"Bucket"`
+    Key      string   `xml:"Key"`
+    UploadID string   `xml:"UploadId"`
+}
+
+func (g *Gateway) createMultipartUpload(w http.ResponseWriter, r *request) {
+    if _, _, err := splitKey(r.key); err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+
+    now := time.Now()
+    upload := &models.MultipartUpload{
+        ID:          primitive.NewObjectID(),
+        UserID:      r.user.UserID,
+        Key:         r.key,
+        ContentType: contentType(r.Request),
+        CreatedAt:   now,
+        ExpiresAt:   now.Add(g.expiry),
+    }
+    if err := g.uploads.Create(r.Context(), upload); err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+    if _, err := g.queue.EnqueueAt(r.Context(), JobExpireMultipart, map[string]string{"uploadId": upload.ID.Hex()}, upload.ExpiresAt); err != nil {
+        log.Printf("Failed to schedule expiry of multipart upload %s: %v", upload.ID.Hex(), err)
+    }
+    writeXML(w, http.StatusOK, initiateResult{
+        Xmlns:    xmlns,
+        Bucket:   r.bucket,
+        Key:      r.key,
+        UploadID: upload.ID.Hex(),
+    })
+}
+
+// loadUpload returns the caller's upload named by ?uploadId for the key.
+// An upload past its expiry is treated as gone.
+func (g *Gateway) loadUpload(r *request) (*models.MultipartUpload, error) {
+    upload, err := g.uploads.Get(r.Context(), r.user.UserID, r.URL.Query().Get("uploadId"))
+    if err != nil {
+        return nil, err
+    }
+    if upload.Key != r.key || (!upload.ExpiresAt.IsZero() && time.Now().After(upload.ExpiresAt)) {
+        return nil, errNoSuchUpload
+    }
+    return upload, nil
+}
+
+// uploadPart stores one part. Parts are charged to the quota as they
+// arrive, so the parts of all of a user's uploads together can't exceed
+// it; re-uploading a part gives back the charge of the one it replaces.
+func (g *Gateway) uploadPart(w http.ResponseWriter, r *request) {
+    number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+    if err != nil || number < 1 || number > maxPartNumber {
+        writeError(w, r.Request, errInvalidArgument.with("Part number must be an integer between 1 and 10000, inclusive"))
+        return
+    }
+    if r.size < 0 {
+        writeError(w, r.Request, errMissingContentLength)
+        return
+    }
+    if r.size > maxPartSize {
+        writeError(w, r.Request, errEntityTooLarge)
+        return
+    }
+    upload, err := g.loadUpload(r)
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+
+    body, err := withContentMD5(r.body, r.Header.Get("Content-MD5"))
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+    if err := g.store.ReserveStorage(r.Context(), r.user, r.size); err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+    sum := md5.New()
+    objectName := partObjectName(upload.ID.Hex(), number)
+    if err := g.store.Storage().PutObject(r.Context(), objectName, io.TeeReader(body, sum), r.size); err != nil {
+        g.store.ReleaseStorage(r.Context(), r.user.UserID, r.size)
+        writeError(w, r.Request, err)
+        return
+    }
+
+    part := models.MultipartPart{
+        Number:     number,
+        ETag:       hex.EncodeToString(sum.Sum(nil)),
+        Size:       r.size,
+        UploadedAt: time.Now(),
+    }
+    previous, err := g.uploads.PutPart(r.Context(), upload.ID, part)
+    if err != nil {
+        g.store.ReleaseStorage(r.Context(), r.user.UserID, r.size)
+        writeError(w, r.Request, err)
+        return
+    }
+    if previous != nil {
+        g.store.ReleaseStorage(r.Context(), r.user.UserID, previous.Size)
+    }
+    w.Header().Set("ETag", `"`+part.ETag+`"`)
+    w.WriteHeader(http.StatusOK)
+}
+
+type completeRequest struct {
+    Parts []struct {
+        PartNumber int    `xml:"PartNumber"`
+        ETag       string `xml:"ETag"`
+    } `xml:"Part"`
+}
+
+type completeResult struct {
+    XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+    Xmlns    string   `xml:"xmlns,attr"`
+    Location string   `xml:"Location"`
+    Bucket   string   `xml:"Bucket"`
+    Key      string   `xml:"Key"`
+    ETag     string   `xml:"ETag"`
+}
+
+// completeMultipartUpload joins the listed parts into a regular file. The
+// content is re-chunked into Storely's layout, so the parts are streamed
+// through once; the ETag follows the S3 multipart convention.
+//
+// The upload record is claimed by deleting it first, so a concurrent
+// complete, abort or expiry can't release the parts' charge twice; it is
+// put back if the upload can't be completed.
+func (g *Gateway) completeMultipartUpload(w http.ResponseWriter, r *request) {
+    loaded, err := g.loadUpload(r)
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+
+    var req completeRequest
+    if err := xml.NewDecoder(io.LimitReader(r.body, 2<<20)).Decode(&req); err != nil || len(req.Parts) == 0 {
+        writeError(w, r.Request, errMalformedXML)
+        return
+    }
+
+    upload, err := g.uploads.Delete(r.Context(), loaded.ID)
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+    if upload == nil {
+        writeError(w, r.Request, errNoSuchUpload)
+        return
+    }
+    completed := false
+    defer func() {
+        if !completed {
+            g.restoreUpload(r.Context(), upload)
+        }
+    }()
+
+    var (
+        size    int64
+        digests []byte
+        readers []io.Reader
+        closers []io.Closer
+    )
+    defer func() {
+        for _, c := range closers {
+            c.Close()
+        }
+    }()
+    for i, listed := range req.Parts {
+        if i > 0 && listed.PartNumber <= req.Parts[i-1].PartNumber {
+            writeError(w, r.Request, errInvalidPartOrder)
+            return
+        }
+        part, ok := upload.Parts[strconv.Itoa(listed.PartNumber)]
+        if !ok || strings.Trim(listed.ETag, `"`) != part.ETag {
+            writeError(w, r.Request, errInvalidPart)
+            return
+        }
+        if i < len(req.Parts)-1 && part.Size < minPartSize {
+            writeError(w, r.Request, errEntityTooSmall)
+            return
+        }
+
+        digest, _ := hex.DecodeString(part.ETag)
+        digests = append(digests, digest...)
+        size += part.Size
+
+        content, err := g.store.Storage().OpenObject(r.Context(), partObjectName(upload.ID.Hex(), part.Number))
+        if err != nil {
+            writeError(w, r.Request, err)
+            return
+        }
+        readers = append(readers, content)
+        closers = append(closers, content)
+    }
+    sum := md5.Sum(digests)
+    etag := fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(req.Parts))
+
+    // The file is charged by Replace, so the parts' charge is handed back
+    // first and taken again if the file isn't stored.
+    pending := partsSize(upload)
+    g.store.ReleaseStorage(r.Context(), upload.UserID, pending)
+    folder, name, _ := splitKey(upload.Key)
+    file, err := g.store.Replace(r.Context(), r.user, service.PutRequest{
+        Folder:   folder,
+        FileName: name,
+        FileType: upload.ContentType,
+        Size:     size,
+        Body:     io.MultiReader(readers...),
+        ETag:     etag,
+    })
+    if err != nil {
+        if file == nil {
+            g.store.ReleaseStorage(r.Context(), upload.UserID, -pending)
+            writeError(w, r.Request, err)
+            return
+        }
+        log.Printf("S3 complete %s: %v", upload.Key, err)
+    }
+
+    completed = true
+    g.removeParts(r.Context(), upload)
+    writeXML(w, http.StatusOK, completeResult{
+        Xmlns:    xmlns,
+        Location: "/" + r.bucket + "/" + upload.Key,
+        Bucket:   r.bucket,
+        Key:      upload.Key,
+        ETag:     etagOf(file),
+    })
+}
+
+func (g *Gateway) abortMultipartUpload(w http.ResponseWriter, r *request) {
+    loaded, err := g.loadUpload(r)
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+    upload, err := g.uploads.Delete(r.Context(), loaded.ID)
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+    if upload == nil {
+        writeError(w, r.Request, errNoSuchUpload)
+        return
+    }
+    g.discardUpload(r.Context(), upload)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// expireUpload is the JobExpireMultipart handler. An upload that was
+// completed, aborted or given a later expiry in the meantime is left alone.
+func (g *Gateway) expireUpload(ctx context.Context, job *models.Job) error {
+    uploadID := job.Payload["uploadId"]
+    if uploadID == "" {
+        return service.Permanent(fmt.Errorf("payload is missing uploadId"))
+    }
+    upload, err := g.uploads.DeleteExpired(ctx, uploadID, time.Now())
+    if err != nil {
+        return err
+    }
+    if upload != nil {
+        g.discardUpload(ctx, upload)
+    }
+    return nil
+}
+
+// discardUpload removes the parts of an upload whose record was already
+// deleted and gives back their charge.
+func (g *Gateway) discardUpload(ctx context.Context, upload *models.MultipartUpload) {
+    g.removeParts(ctx, upload)
+    g.store.ReleaseStorage(ctx, upload.UserID, partsSize(upload))
+}
+
+func (g *Gateway) removeParts(ctx context.Context, upload *models.MultipartUpload) {
+    if err := g.store.Storage().RemovePrefix(context.WithoutCancel(ctx), partsPrefix(upload.ID.Hex())); err != nil {
+        log.Printf("Failed to remove parts of upload %s: %v", upload.ID.Hex(), err)
+    }
+}
+
+// restoreUpload puts back an upload claimed by completeMultipartUpload.
+func (g *Gateway) restoreUpload(ctx context.Context, upload *models.MultipartUpload) {
+    if err := g.uploads.Create(context.WithoutCancel(ctx), upload); err != nil {
+        log.Printf("Failed to restore multipart upload %s: %v", upload.ID.Hex(), err)
+    }
+}
+
+type partEntry struct {
+    PartNumber   int    `xml:"PartNumber"`
+    LastModified string `xml:"LastModified"`
+    ETag         string `xml:"ETag"`
+    Size         int64  `xml:"Size"`
+}
+
+type listPartsResult struct {
+    XMLName     xml.Name    `xml:"ListPartsResult"`
+    Xmlns       string      `xml:"xmlns,attr"`
+    Bucket      string      `xml:"Bucket"`
+    Key         string      `xml:"Key"`
+    UploadID    string      `xml:"UploadId"`
+    MaxParts    int         `xml:"MaxParts"`
+    IsTruncated bool        `xml:"IsTruncated"`
+    Parts       []partEntry `xml:"Part"`
+}
+
+func (g *Gateway) listParts(w http.ResponseWriter, r *request) {
+    upload, err := g.loadUpload(r)
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+
+    result := listPartsResult{
+        Xmlns:    xmlns,
+        Bucket:   r.bucket,
+        Key:      upload.Key,
+        UploadID: upload.ID.Hex(),
+        MaxParts: maxPartNumber,
+    }
+    for _, part := range upload.Parts {
+        result.Parts = append(result.Parts, partEntry{
+            PartNumber:   part.Number,
+            LastModified: part.UploadedAt.UTC().Format(s3TimeFormat),
+            ETag:         `"` + part.ETag + `"`,
+            Size:         part.Size,
+        })
+    }
+    sort.Slice(result.Parts, func(i, j int) bool {
+        return result.Parts[i].PartNumber < result.Parts[j].PartNumber
+    })
+    writeXML(w, http.StatusOK, result)
+}
@@ -0,0 +1,489 @@
+package s3api
+
+import (
+    "crypto/md5"
+    "encoding/base64"
+    "encoding/xml"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+
+    "backend/internal/models"
+    "backend/internal/service"
+)
+
+const (
+    defaultMaxKeys = 1000
+    s3TimeFormat   = "2006-01-02T15:04:05.000Z"
+    // emptyMD5 is the ETag of a zero-byte object.
+    emptyMD5 = "d41d8cd98f00b204e9800998ecf8427e"
+)
+
+type owner struct {
+    ID          string `xml:"ID"`
+    DisplayName string `xml:"DisplayName"`
+}
+
+type bucketEntry struct {
+    Name         string `xml:"Name"`
+    CreationDate string `xml:"CreationDate"`
+}
+
+type listBucketsResult struct {
+    XMLName xml.Name      `xml:"ListAllMyBucketsResult"`
+    Xmlns   string        `xml:"xmlns,attr"`
+    Owner   owner         `xml:"Owner"`
+    Buckets []bucketEntry `xml:"Buckets>Bucket"`
+}
+
+func (g *Gateway) listBuckets(w http.ResponseWriter, r *request) {
+    writeXML(w, http.StatusOK, listBucketsResult{
+        Xmlns: xmlns,
+        Owner: owner{ID: r.user.UserID, DisplayName: r.user.Name},
+        Buckets: []bucketEntry{{
+            Name:         r.user.Name,
+            CreationDate: r.user.CreatedAt.UTC().Format(s3TimeFormat),
+        }},
+    })
+}
+
+type locationConstraint struct {
+    XMLName xml.Name `xml:"LocationConstraint"`
+    Xmlns   string   `xml:"xmlns,attr"`
+    Region  string   `xml:",chardata"`
+}
+
+func (g *Gateway) getBucketLocation(w http.ResponseWriter, r *request) {
+    // us-east-1 is reported as an empty constraint, as AWS does
+    region := g.region
+    if region == "us-east-1" {
+        region = ""
+    }
+    writeXML(w, http.StatusOK, locationConstraint{Xmlns: xmlns, Region: region})
+}
+
+type objectEntry struct {
+    Key          string `xml:"Key"`
+    LastModified string `xml:"LastModified"`
+    ETag         string `xml:"ETag"`
+    Size         int64  `xml:"Size"`
+    StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+    Prefix string `xml:"Prefix"`
+}
+
+type listObjectsResult struct {
+    XMLName        xml.Name       `xml:"ListBucketResult"`
+    Xmlns          string         `xml:"xmlns,attr"`
+    Name           string         `xml:"Name"`
+    Prefix         string         `xml:"Prefix"`
+    Delimiter      string         `xml:"Delimiter,omitempty"`
+    MaxKeys        int            `xml:"MaxKeys"`
+    EncodingType   string         `xml:"EncodingType,omitempty"`
+    IsTruncated    bool           `xml:"IsTruncated"`
+    Contents       []objectEntry  `xml:"Contents"`
+    CommonPrefixes []commonPrefix `xml:"CommonPrefixes"`
+
+    // ListObjectsV2
+    KeyCount              *int   `xml:"KeyCount,omitempty"`
+    StartAfter            string `xml:"StartAfter,omitempty"`
+    ContinuationToken     string `xml:"ContinuationToken,omitempty"`
+    NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+
+    // ListObjects (v1)
+    Marker     *string `xml:"Marker,omitempty"`
+    NextMarker string  `xml:"NextMarker,omitempty"`
+}
+
+// listObjects serves ListObjectsV2 (list-type=2) and the original
+// ListObjects. Keys are listed in lexicographic order; with a delimiter,
+// keys sharing a prefix up to the delimiter are rolled up into
+// CommonPrefixes.
+func (g *Gateway) listObjects(w http.ResponseWriter, r *request) {
+    query := r.URL.Query()
+    v2 := query.Get("list-type") == "2"
+    prefix := query.Get("prefix")
+    delimiter := query.Get("delimiter")
+    encode := query.Get("encoding-type") == "url"
+
+    maxKeys := defaultMaxKeys
+    if raw := query.Get("max-keys"); raw != "" {
+        n, err := strconv.Atoi(raw)
+        if err != nil || n < 0 {
+            writeError(w, r.Request, errInvalidArgument.with("max-keys must be a non-negative integer"))
+            return
+        }
+        if n < maxKeys {
+            maxKeys = n
+        }
+    }
+
+    after := query.Get("marker")
+    if v2 {
+        after = query.Get("start-after")
+        if token := query.Get("continuation-token"); token != "" {
+            decoded, err := base64.RawURLEncoding.DecodeString(token)
+            if err != nil {
+                writeError(w, r.Request, errInvalidArgument.with("The continuation token provided is incorrect"))
+                return
+            }
+            after = string(decoded)
+        }
+    }
+    // A continuation point that is a rolled-up prefix also skips every key
+    // below it
+    skipBelow := ""
+    if delimiter != "" && strings.HasSuffix(after, delimiter) && after != query.Get("start-after") {
+        skipBelow = after
+    }
+
+    // Only the folder that contains every key with the prefix is fetched
+    folder := ""
+    if i := strings.LastIndex(prefix, "/"); i >= 0 {
+        folder, _ = service.CleanFolder(prefix[:i])
+    }
+    files, err := g.store.ListTree(r.Context(), r.user, folder)
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+
+    // The repository returns the newest file of each path first
+    current := map[string]*models.FileMinIO{}
+    var keys []string
+    for i := range files {
+        key := objectKey(&files[i])
+        if _, seen := current[key]; seen || !strings.HasPrefix(key, prefix) {
+            continue
+        }
+        current[key] = &files[i]
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    escape := func(s string) string {
+        if encode {
+            return url.QueryEscape(s)
+        }
+        return s
+    }
+
+    result := listObjectsResult{
+        Xmlns:     xmlns,
+        Name:      r.bucket,
+        Prefix:    escape(prefix),
+        Delimiter: escape(delimiter),
+        MaxKeys:   maxKeys,
+        Contents:  []objectEntry{},
+    }
+    if encode {
+        result.EncodingType = "url"
+    }
+
+    var last string
+    count := 0
+    for _, key := range keys {
+        if key <= after || (skipBelow != "" && strings.HasPrefix(key, skipBelow)) {
+            continue
+        }
+
+        rolled := ""
+        if delimiter != "" {
+            if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+                rolled = key[:len(prefix)+i+len(delimiter)]
+            }
+        }
+        if rolled != "" && rolled == last {
+            continue
+        }
+
+        if count == maxKeys {
+            result.IsTruncated = true
+            break
+        }
+        count++
+
+        if rolled != "" {
+            result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: escape(rolled)})
+            last = rolled
+            continue
+        }
+        file := current[key]
+        result.Contents = append(result.Contents, objectEntry{
+            Key:          escape(key),
+            LastModified: modTime(file).Format(s3TimeFormat),
+            ETag:         etagOf(file),
+            Size:         int64(file.Size),
+            StorageClass: "STANDARD",
+        })
+        last = key
+    }
+
+    if v2 {
+        result.KeyCount = &count
+        result.StartAfter = escape(query.Get("start-after"))
+        result.ContinuationToken = query.Get("continuation-token")
+        if result.IsTruncated {
+            result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+        }
+    } else {
+        marker := escape(query.Get("marker"))
+        result.Marker = &marker
+        if result.IsTruncated {
+            result.NextMarker = escape(last)
+        }
+    }
+    writeXML(w, http.StatusOK, result)
+}
+
+// getObject serves GetObject and HeadObject, including single byte ranges
+// and If-Match/If-None-Match preconditions.
+func (g *Gateway) getObject(w http.ResponseWriter, r *request) {
+    folder, name, err := splitKey(r.key)
+    if err != nil {
+        writeError(w, r.Request, errNoSuchKey)
+        return
+    }
+    file, err := g.store.Lookup(r.Context(), r.user, folder, name)
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+
+    etag := etagOf(file)
+    size := int64(file.Size)
+    h := w.Header()
+    h.Set("ETag", etag)
+    h.Set("Last-Modified", modTime(file).Format(http.TimeFormat))
+    h.Set("Accept-Ranges", "bytes")
+    h.Set("Content-Type", file.FileType)
+    if file.FileType == "" {
+        h.Set("Content-Type", "application/octet-stream")
+    }
+
+    if match := r.Header.Get("If-Match"); match != "" && !etagMatches(match, etag) {
+        writeError(w, r.Request, errPreconditionFailed)
+        return
+    }
+    if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+
+    offset, length := int64(0), size
+    status := http.StatusOK
+    if spec := r.Header.Get("Range"); spec != "" {
+        var ok bool
+        offset, length, ok = parseRange(spec, size)
+        if !ok {
+            h.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+            writeError(w, r.Request, errInvalidRange)
+            return
+        }
+        h.Set("Content-Range", "bytes "+strconv.FormatInt(offset, 10)+"-"+strconv.FormatInt(offset+length-1, 10)+"/"+strconv.FormatInt(size, 10))
+        status = http.StatusPartialContent
+    }
+    h.Set("Content-Length", strconv.FormatInt(length, 10))
+
+    if r.Method == http.MethodHead {
+        w.WriteHeader(status)
+        return
+    }
+
+    content, err := g.store.Open(r.Context(), file, offset, length)
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+    defer content.Close()
+    w.WriteHeader(status)
+    io.Copy(w, content)
+}
+
+// parseRange parses a single "bytes=" range against size and returns the
+// offset and length it selects.
+func parseRange(spec string, size int64) (int64, int64, bool) {
+    spec, ok := strings.CutPrefix(spec, "bytes=")
+    if !ok || strings.Contains(spec, ",") {
+        return 0, 0, false
+    }
+    first, last, ok := strings.Cut(spec, "-")
+    if !ok {
+        return 0, 0, false
+    }
+
+    if first == "" {
+        // Suffix range: the last n bytes
+        n, err := strconv.ParseInt(last, 10, 64)
+        if err != nil || n <= 0 || size == 0 {
+            return 0, 0, false
+        }
+        if n > size {
+            n = size
+        }
+        return size - n, n, true
+    }
+
+    start, err := strconv.ParseInt(first, 10, 64)
+    if err != nil || start < 0 || start >= size {
+        return 0, 0, false
+    }
+    end := size - 1
+    if last != "" {
+        end, err = strconv.ParseInt(last, 10, 64)
+        if err != nil || end < start {
+            return 0, 0, false
+        }
+        if end > size-1 {
+            end = size - 1
+        }
+    }
+    return start, end - start + 1, true
+}
+
+func etagMatches(header, etag string) bool {
+    for _, candidate := range strings.Split(header, ",") {
+        candidate = strings.TrimSpace(candidate)
+        if candidate == "*" || strings.Trim(candidate, `"`) == strings.Trim(etag, `"`) {
+            return true
+        }
+    }
+    return false
+}
+
+// putObject stores the request body as a new file at the key, replacing
+// whatever was there.
+func (g *Gateway) putObject(w http.ResponseWriter, r *request) {
+    if strings.HasSuffix(r.key, "/") && r.size == 0 {
+        // Folder markers; Storely folders exist implicitly
+        w.Header().Set("ETag", `"`+emptyMD5+`"`)
+        w.WriteHeader(http.StatusOK)
+        return
+    }
+    folder, name, err := splitKey(r.key)
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+    if r.size < 0 {
+        writeError(w, r.Request, errMissingContentLength)
+        return
+    }
+
+    body, err := withContentMD5(r.body, r.Header.Get("Content-MD5"))
+    if err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+
+    file, err := g.store.Replace(r.Context(), r.user, service.PutRequest{
+        Folder:   folder,
+        FileName: name,
+        FileType: contentType(r.Request),
+        Size:     r.size,
+        Body:     body,
+    })
+    if err != nil {
+        if file == nil {
+            writeError(w, r.Request, err)
+            return
+        }
+        log.Printf("S3 PUT %s: %v", r.key, err)
+    }
+    w.Header().Set("ETag", etagOf(file))
+    w.WriteHeader(http.StatusOK)
+}
+
+// withContentMD5 checks the body against a Content-MD5 header, if given.
+func withContentMD5(body io.Reader, header string) (io.Reader, error) {
+    if header == "" {
+        return body, nil
+    }
+    want, err := base64.StdEncoding.DecodeString(header)
+    if err != nil || len(want) != md5.Size {
+        return nil, errInvalidDigest
+    }
+    return &digestReader{r: body, h: md5.New(), want: want, mismatch: errBadDigest}, nil
+}
+
+func contentType(r *http.Request) string {
+    if ct := r.Header.Get("Content-Type"); ct != "" {
+        return ct
+    }
+    return "application/octet-stream"
+}
+
+// deleteObject removes the file at the key. Deleting a missing key
+// succeeds, as in S3.
+func (g *Gateway) deleteObject(w http.ResponseWriter, r *request) {
+    if err := g.removeKey(r, r.key); err != nil {
+        writeError(w, r.Request, err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) removeKey(r *request, key string) error {
+    folder, name, err := splitKey(key)
+    if err != nil {
+        return nil
+    }
+    err = g.store.RemovePath(r.Context(), r.user, folder, name)
+    if err != nil && toS3Error(err) != errNoSuchKey {
+        return err
+    }
+    return nil
+}
+
+type deleteRequest struct {
+    Quiet   bool `xml:"Quiet"`
+    Objects []struct {
+        Key string `xml:"Key"`
+    } `xml:"Object"`
+}
+
+type deletedEntry struct {
+    Key string `xml:"Key"`
+}
+
+type deleteErrorEntry struct {
+    Key     string `xml:"Key"`
+    Code    string `xml:"Code"`
+    Message string `xml:"Message"`
+}
+
+type deleteResult struct {
+    XMLName xml.Name           `xml:"DeleteResult"`
+    Xmlns   string             `xml:"xmlns,attr"`
+    Deleted []deletedEntry     `xml:"Deleted"`
+    Errors  []deleteErrorEntry `xml:"Error"`
+}
+
+// deleteObjects serves DeleteObjects (POST /bucket?delete) for up to 1000
+// keys at once.
+func (g *Gateway) deleteObjects(w http.ResponseWriter, r *request) {
+    var req deleteRequest
+    if err := xml.NewDecoder(io.LimitReader(r.body, 2<<20)).Decode(&req); err != nil || len(req.Objects) > 1000 {
+        writeError(w, r.Request, errMalformedXML)
+        return
+    }
+
+    result := deleteResult{Xmlns: xmlns}
+    for _, object := range req.Objects {
+        if err := g.removeKey(r, object.Key); err != nil {
+            s3Err := toS3Error(err)
+            result.Errors = append(result.Errors, deleteErrorEntry{Key: object.Key, Code: s3Err.Code, Message: s3Err.Message})
+            continue
+        }
+        if !req.Quiet {
+            result.Deleted = append(result.Deleted, deletedEntry{Key: object.Key})
+        }
+    }
+    writeXML(w, http.StatusOK, result)
+}
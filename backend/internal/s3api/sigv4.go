@@ -0,0 +1,420 @@
+package s3api
+
+import (
+    "bufio"
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "hash"
+    "io"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    signAlgorithm   = "AWS4-HMAC-SHA256"
+    amzDateFormat   = "20060102T150405Z"
+    unsignedPayload = "UNSIGNED-PAYLOAD"
+    emptySHA256     = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+    streamingSigned         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+    streamingSignedTrailer  = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+    streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+    // maxClockSkew is how far a signed request's date may be from ours.
+    maxClockSkew = 15 * time.Minute
+    // maxPresignExpiry is the longest validity AWS allows for presigned URLs.
+    maxPresignExpiry = 7 * 24 * time.Hour
+    // maxStreamChunk bounds one aws-chunked chunk, which is buffered so its
+    // signature can be checked before the data is used.
+    maxStreamChunk = 16 * 1024 * 1024
+)
+
+// signature holds what a request claims about its SigV4 signature.
+type signature struct {
+    accessKeyID   string
+    date          time.Time
+    scope         string
+    region        string
+    signedHeaders []string
+    signature     string
+    payloadHash   string
+    presigned     bool
+}
+
+// parseSignature extracts the signature from the Authorization header or
+// from presigned URL query parameters.
+func parseSignature(r *http.Request, now time.Time) (*signature, error) {
+    query := r.URL.Query()
+    if query.Get("X-Amz-Algorithm") != "" {
+        return parsePresigned(r, query, now)
+    }
+
+    auth := r.Header.Get("Authorization")
+    if auth == "" {
+        return nil, errAccessDenied
+    }
+    if !strings.HasPrefix(auth, signAlgorithm+" ") {
+        return nil, errUnsupportedSignature
+    }
+
+    fields := map[string]string{}
+    for _, part := range strings.Split(strings.TrimPrefix(auth, signAlgorithm+" "), ",") {
+        key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+        if !ok {
+            return nil, errMalformedAuth
+        }
+        fields[key] = value
+    }
+
+    sig := &signature{
+        signedHeaders: strings.Split(fields["SignedHeaders"], ";"),
+        signature:     fields["Signature"],
+        payloadHash:   r.Header.Get("X-Amz-Content-Sha256"),
+    }
+    if err := sig.parseCredential(fields["Credential"]); err != nil {
+        return nil, err
+    }
+    if sig.signature == "" || fields["SignedHeaders"] == "" {
+        return nil, errMalformedAuth
+    }
+    if err := sig.checkSignedHeaders(); err != nil {
+        return nil, err
+    }
+    if sig.payloadHash == "" {
+        return nil, errInvalidArgument.with("x-amz-content-sha256 header is required")
+    }
+
+    rawDate := r.Header.Get("X-Amz-Date")
+    if rawDate == "" {
+        rawDate = r.Header.Get("Date")
+    }
+    date, err := time.Parse(amzDateFormat, rawDate)
+    if err != nil {
+        if date, err = http.ParseTime(rawDate); err != nil {
+            return nil, errAccessDenied.with("AWS authentication requires a valid Date or x-amz-date header")
+        }
+    }
+    sig.date = date.UTC()
+    if sig.date.Sub(now) > maxClockSkew || now.Sub(sig.date) > maxClockSkew {
+        return nil, errRequestTimeTooSkewed
+    }
+    return sig, sig.checkScopeDate()
+}
+
+func parsePresigned(r *http.Request, query url.Values, now time.Time) (*signature, error) {
+    if query.Get("X-Amz-Algorithm") != signAlgorithm {
+        return nil, errUnsupportedSignature
+    }
+
+    sig := &signature{
+        signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+        signature:     query.Get("X-Amz-Signature"),
+        payloadHash:   query.Get("X-Amz-Content-Sha256"),
+        presigned:     true,
+    }
+    if sig.payloadHash == "" {
+        sig.payloadHash = unsignedPayload
+    }
+    if err := sig.parseCredential(query.Get("X-Amz-Credential")); err != nil {
+        return nil, err
+    }
+    if sig.signature == "" {
+        return nil, errMalformedAuth
+    }
+    if err := sig.checkSignedHeaders(); err != nil {
+        return nil, err
+    }
+
+    date, err := time.Parse(amzDateFormat, query.Get("X-Amz-Date"))
+    if err != nil {
+        return nil, errMalformedAuth.with("X-Amz-Date is invalid")
+    }
+    expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+    if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignExpiry {
+        return nil, errMalformedAuth.with("X-Amz-Expires must be between 0 and 604800 seconds")
+    }
+    sig.date = date.UTC()
+    if sig.date.Sub(now) > maxClockSkew {
+        return nil, errRequestTimeTooSkewed
+    }
+    if now.After(sig.date.Add(time.Duration(expires) * time.Second)) {
+        return nil, errExpiredRequest
+    }
+    return sig, sig.checkScopeDate()
+}
+
+// parseCredential splits "AKID/20240101/region/s3/aws4_request".
+func (s *signature) parseCredential(credential string) error {
+    parts := strings.Split(credential, "/")
+    if len(parts) != 5 || parts[0] == "" || parts[3] != "s3" || parts[4] != "aws4_request" {
+        return errMalformedAuth.with("The credential is malformed; expecting \"<AccessKeyID>/<YYYYMMDD>/<region>/s3/aws4_request\"")
+    }
+    s.accessKeyID = parts[0]
+    s.region = parts[2]
+    s.scope = strings.Join(parts[1:], "/")
+    return nil
+}
+
+// checkSignedHeaders requires host to be signed, so a signature made for
+// one host can't be replayed against another.
+func (s *signature) checkSignedHeaders() error {
+    for _, name := range s.signedHeaders {
+        if name == "host" {
+            return nil
+        }
+    }
+    return errMalformedAuth.with("SignedHeaders must include host")
+}
+
+func (s *signature) checkScopeDate() error {
+    if !strings.HasPrefix(s.scope, s.date.Format("20060102")+"/") {
+        return errMalformedAuth.with("The credential date does not match the request date")
+    }
+    return nil
+}
+
+// signingKey derives the SigV4 key for the signature's scope.
+func (s *signature) signingKey(secret string) []byte {
+    parts := strings.Split(s.scope, "/")
+    key := []byte("AWS4" + secret)
+    for _, part := range parts {
+        key = hmacSHA256(key, part)
+    }
+    return key
+}
+
+// verify recomputes the signature of r with secret.
+func (s *signature) verify(r *http.Request, secret string) error {
+    canonical := strings.Join([]string{
+        r.Method,
+        canonicalURI(r.URL.Path),
+        canonicalQuery(r.URL.Query(), s.presigned),
+        canonicalHeaders(r, s.signedHeaders),
+        strings.Join(s.signedHeaders, ";"),
+        s.payloadHash,
+    }, "\n")
+
+    expected := hex.EncodeToString(hmacSHA256(s.signingKey(secret), s.stringToSign(canonical)))
+    if !hmac.Equal([]byte(expected), []byte(s.signature)) {
+        return errSignatureMismatch
+    }
+    return nil
+}
+
+func (s *signature) stringToSign(canonicalRequest string) string {
+    sum := sha256.Sum256([]byte(canonicalRequest))
+    return strings.Join([]string{
+        signAlgorithm,
+        s.date.Format(amzDateFormat),
+        s.scope,
+        hex.EncodeToString(sum[:]),
+    }, "\n")
+}
+
+func canonicalURI(path string) string {
+    if path == "" {
+        return "/"
+    }
+    return awsEscape(path, true)
+}
+
+func canonicalQuery(query url.Values, presigned bool) string {
+    var pairs []string
+    for key, values := range query {
+        if presigned && key == "X-Amz-Signature" {
+            continue
+        }
+        for _, value := range values {
+            pairs = append(pairs, awsEscape(key, false)+"="+awsEscape(value, false))
+        }
+    }
+    sort.Strings(pairs)
+    return strings.Join(pairs, "&")
+}
+
+func canonicalHeaders(r *http.Request, signed []string) string {
+    var b strings.Builder
+    for _, name := range signed {
+        var value string
+        if name == "host" {
+            value = r.Host
+        } else {
+            values := r.Header.Values(name)
+            for i, v := range values {
+                values[i] = strings.Join(strings.Fields(v), " ")
+            }
+            value = strings.Join(values, ",")
+        }
+        b.WriteString(name + ":" + value + "\n")
+    }
+    return b.String()
+}
+
+// awsEscape percent-encodes everything but the unreserved characters of
+// RFC 3986, the way SigV4 canonicalization requires.
+func awsEscape(s string, keepSlash bool) string {
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+            c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+            b.WriteByte(c)
+        default:
+            fmt.Fprintf(&b, "%%%02X", c)
+        }
+    }
+    return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
+
+// payloadReader returns the request body as the object content: checked
+// against x-amz-content-sha256, or decoded from aws-chunked encoding with
+// every chunk signature verified. size is the length of the content.
+func (s *signature) payloadReader(r *http.Request, secret string) (io.Reader, int64, error) {
+    switch s.payloadHash {
+    case unsignedPayload:
+        return r.Body, r.ContentLength, nil
+
+    case streamingSigned, streamingSignedTrailer, streamingUnsignedTrailer:
+        size, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+        if err != nil || size < 0 {
+            return nil, 0, errMissingContentLength.with("x-amz-decoded-content-length is required for aws-chunked uploads")
+        }
+        cr := &chunkedReader{r: bufio.NewReader(r.Body)}
+        if s.payloadHash != streamingUnsignedTrailer {
+            cr.key = s.signingKey(secret)
+            cr.sig = s
+            cr.prev = s.signature
+        }
+        return cr, size, nil
+    }
+
+    want, err := hex.DecodeString(s.payloadHash)
+    if err != nil || len(want) != sha256.Size {
+        return nil, 0, errInvalidArgument.with("x-amz-content-sha256 must be a SHA-256 hex digest, UNSIGNED-PAYLOAD or a supported STREAMING-* value")
+    }
+    return &digestReader{r: r.Body, h: sha256.New(), want: want, mismatch: errContentSHA256Mismatch}, r.ContentLength, nil
+}
+
+// digestReader fails at EOF when the content read does not hash to want.
+type digestReader struct {
+    r        io.Reader
+    h        hash.Hash
+    want     []byte
+    mismatch error
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+    n, err := d.r.Read(p)
+    d.h.Write(p[:n])
+    if err == io.EOF && !bytes.Equal(d.h.Sum(nil), d.want) {
+        return n, d.mismatch
+    }
+    return n, err
+}
+
+// chunkedReader decodes an aws-chunked body:
+//
+//	<hex size>[;chunk-signature=<sig>]\r\n<data>\r\n ... 0[;...]\r\n[trailers]\r\n
+//
+// With key set, each chunk's signature is checked, chained from the
+// request signature, before its data is returned. Trailing checksums are
+// not verified.
+type chunkedReader struct {
+    r    *bufio.Reader
+    key  []byte
+    sig  *signature
+    prev string
+    buf  []byte
+    done bool
+    err  error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+    for len(c.buf) == 0 {
+        if c.err != nil {
+            return 0, c.err
+        }
+        if c.done {
+            return 0, io.EOF
+        }
+        c.err = c.nextChunk()
+    }
+    n := copy(p, c.buf)
+    c.buf = c.buf[n:]
+    return n, nil
+}
+
+func (c *chunkedReader) nextChunk() error {
+    header, err := c.readLine()
+    if err != nil {
+        return errIncompleteBody
+    }
+    sizeField, params, _ := strings.Cut(header, ";")
+    size, err := strconv.ParseInt(strings.TrimSpace(sizeField), 16, 64)
+    if err != nil || size < 0 || size > maxStreamChunk {
+        return errInvalidArgument.with("malformed aws-chunked body")
+    }
+
+    data := make([]byte, size)
+    if _, err := io.ReadFull(c.r, data); err != nil {
+        return errIncompleteBody
+    }
+
+    if c.key != nil {
+        chunkSig := strings.TrimPrefix(strings.TrimSpace(params), "chunk-signature=")
+        sum := sha256.Sum256(data)
+        toSign := strings.Join([]string{
+            signAlgorithm + "-PAYLOAD",
+            c.sig.date.Format(amzDateFormat),
+            c.sig.scope,
+            c.prev,
+            emptySHA256,
+            hex.EncodeToString(sum[:]),
+        }, "\n")
+        expected := hex.EncodeToString(hmacSHA256(c.key, toSign))
+        if !hmac.Equal([]byte(expected), []byte(chunkSig)) {
+            return errSignatureMismatch
+        }
+        c.prev = chunkSig
+    }
+
+    if size == 0 {
+        // Skip trailers up to the closing blank line
+        for {
+            line, err := c.readLine()
+            if err != nil || line == "" {
+                break
+            }
+        }
+        c.done = true
+        return nil
+    }
+
+    if line, err := c.readLine(); err != nil || line != "" {
+        return errInvalidArgument.with("malformed aws-chunked body")
+    }
+    c.buf = data
+    return nil
+}
+
+func (c *chunkedReader) readLine() (string, error) {
+    line, err := c.r.ReadString('\n')
+    if err != nil && !(err == io.EOF && line != "") {
+        return "", err
+    }
+    return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,113 @@
+// internal/service/access_key_service.go
+package service
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/base64"
+    "net/http"
+    "strings"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxAccessKeysPerUser bounds how many S3 access keys one account may hold.
+const maxAccessKeysPerUser = 10
+
+var ErrTooManyAccessKeys = apperr.New(http.StatusConflict, apperr.CodeConflict, "Access key limit reached")
+
+// accessKeyAlphabet is what AWS uses for access key IDs.
+const accessKeyAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+
+// AccessKeyService issues and resolves the access keys used to sign S3
+// requests.
+type AccessKeyService struct {
+    keyRepo  *repository.AccessKeyRepository
+    userRepo *repository.UserRepository
+}
+
+func NewAccessKeyService(keyRepo *repository.AccessKeyRepository, userRepo *repository.UserRepository) *AccessKeyService {
+    return &AccessKeyService{
+        keyRepo:  keyRepo,
+        userRepo: userRepo,
+    }
+}
+
+// Create issues a new key pair for user. The returned key is the only place
+// the secret is ever handed out.
+func (s *AccessKeyService) Create(ctx context.Context, user *models.User, name string) (*models.AccessKey, error) {
+    count, err := s.keyRepo.CountByUser(ctx, user.UserID)
+    if err != nil {
+        return nil, err
+    }
+    if count >= maxAccessKeysPerUser {
+        return nil, ErrTooManyAccessKeys.WithMessage("An account can have at most %d access keys", maxAccessKeysPerUser)
+    }
+
+    idBytes, err := randomBytes(16)
+    if err != nil {
+        return nil, err
+    }
+    secretBytes, err := randomBytes(30)
+    if err != nil {
+        return nil, err
+    }
+    id := make([]byte, 16)
+    for i, b := range idBytes {
+        id[i] = accessKeyAlphabet[int(b)%len(accessKeyAlphabet)]
+    }
+
+    key := &models.AccessKey{
+        ID:          primitive.NewObjectID(),
+        UserID:      user.UserID,
+        AccessKeyID: "STLY" + string(id),
+        SecretKey:   base64.RawURLEncoding.EncodeToString(secretBytes),
+        Name:        strings.TrimSpace(name),
+        CreatedAt:   time.Now(),
+    }
+    if err := s.keyRepo.Create(ctx, key); err != nil {
+        return nil, err
+    }
+    return key, nil
+}
+
+func (s *AccessKeyService) List(ctx context.Context, user *models.User) ([]models.AccessKey, error) {
+    return s.keyRepo.ListByUser(ctx, user.UserID)
+}
+
+func (s *AccessKeyService) Revoke(ctx context.Context, user *models.User, accessKeyID string) error {
+    return s.keyRepo.Delete(ctx, user.UserID, accessKeyID)
+}
+
+// Resolve returns a key and the account it belongs to. Keys of disabled
+// accounts resolve to ErrAccountDisabled.
+func (s *AccessKeyService) Resolve(ctx context.Context, accessKeyID string) (*models.AccessKey, *models.User, error) {
+    key, err := s.keyRepo.FindByAccessKeyID(ctx, accessKeyID)
+    if err != nil {
+        return nil, nil, err
+    }
+    user, err := s.userRepo.FindByUserID(ctx, key.UserID)
+    if err != nil {
+        return nil, nil, err
+    }
+    if user.IsDisabled {
+        return nil, nil, ErrAccountDisabled
+    }
+    return key, user, nil
+}
+
+// TouchLastUsed records a successful use of a key; failures are not fatal.
+func (s *AccessKeyService) TouchLastUsed(ctx context.Context, accessKeyID string) error {
+    return s.keyRepo.TouchLastUsed(ctx, accessKeyID)
+}
+
+func randomBytes(n int) ([]byte, error) {
+    b := make([]byte, n)
+    _, err := rand.Read(b)
+    return b, err
+}
@@ -0,0 +1,308 @@
+// internal/service/account_email_service.go
+package service
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "net/mail"
+    "net/url"
+    "strings"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/mailer"
+    "backend/internal/models"
+    "backend/internal/repository"
+    "backend/utils"
+)
+
+var (
+    ErrEmailAlreadyVerified = apperr.New(http.StatusConflict, apperr.CodeConflict, "Email address is already verified")
+    ErrPasswordTooShort     = apperr.New(http.StatusBadRequest, apperr.CodeValidationFailed, "Password must be at least 8 characters")
+    ErrInvalidEmail         = apperr.New(http.StatusBadRequest, apperr.CodeValidationFailed, "Invalid email address")
+    ErrSameEmail            = apperr.New(http.StatusBadRequest, apperr.CodeValidationFailed, "That is already the account's email address")
+)
+
+const (
+    minPasswordLength = 8
+    // emailCooldown is the least time between two emails of one kind to
+    // an account, however many clients ask for them
+    emailCooldown = time.Minute
+)
+
+// AccountEmailPolicy configures the links AccountEmailService sends.
+type AccountEmailPolicy struct {
+    // AppURL is the web app; links open /verify-email and /reset-password
+    // there with ?token=
+    AppURL           string
+    VerificationTTL  time.Duration
+    PasswordResetTTL time.Duration
+}
+
+// AccountEmailService proves ownership of email addresses and resets
+// forgotten passwords with single-use tokens sent by email. Tokens are
+// stored hashed and expire.
+type AccountEmailService struct {
+    users  *repository.UserRepository
+    tokens *repository.EmailTokenRepository
+    mailer mailer.Mailer
+    guard  *LoginGuard
+    policy AccountEmailPolicy
+}
+
+func NewAccountEmailService(users *repository.UserRepository, tokens *repository.EmailTokenRepository, m mailer.Mailer, guard *LoginGuard, policy AccountEmailPolicy) *AccountEmailService {
+    policy.AppURL = strings.TrimSuffix(policy.AppURL, "/")
+    return &AccountEmailService{users: users, tokens: tokens, mailer: m, guard: guard, policy: policy}
+}
+
+// SendVerification emails the user a link that verifies their address.
+func (s *AccountEmailService) SendVerification(ctx context.Context, user *models.User) error {
+    if user.EmailVerified {
+        return ErrEmailAlreadyVerified
+    }
+    token, err := s.issue(ctx, user, models.TokenVerifyEmail, user.Email, s.policy.VerificationTTL)
+    if err != nil || token == "" {
+        return err
+    }
+    return s.mailer.Send(ctx, mailer.Message{
+        To:      user.Email,
+        Subject: "Confirm your email address",
+        Text: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link:\n\n%s\n\n"+
+            "The link expires in %s. If you didn't create a Storely account, you can ignore this email.\n",
+            user.Name, s.link("/verify-email", token), humanDuration(s.policy.VerificationTTL)),
+    })
+}
+
+// VerifyEmail marks the address a verification token was sent to as
+// verified.
+func (s *AccountEmailService) VerifyEmail(ctx context.Context, token string) error {
+    t, err := s.tokens.Consume(ctx, models.TokenVerifyEmail, hashEmailToken(token), time.Now())
+    if err != nil {
+        return err
+    }
+    ok, err := s.users.MarkEmailVerified(ctx, t.UserID, t.Email)
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return repository.ErrEmailTokenInvalid
+    }
+    return nil
+}
+
+// RequestPasswordReset emails a reset link if email belongs to an active
+// account. It returns at once and never reports whether it does, so the
+// endpoint can't be used to find accounts.
+func (s *AccountEmailService) RequestPasswordReset(ctx context.Context, email string) {
+    go func() {
+        ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+        defer cancel()
+        if err := s.sendPasswordReset(ctx, email); err != nil {
+            log.Printf("Failed to send password reset email: %v", err)
+        }
+    }()
+}
+
+func (s *AccountEmailService) sendPasswordReset(ctx context.Context, email string) error {
+    user, err := s.users.FindByEmail(ctx, email)
+    if errors.Is(err, repository.ErrUserNotFound) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if user.IsDisabled {
+        return nil
+    }
+    token, err := s.issue(ctx, user, models.TokenResetPassword, user.Email, s.policy.PasswordResetTTL)
+    if err != nil || token == "" {
+        return err
+    }
+    return s.mailer.Send(ctx, mailer.Message{
+        To:      user.Email,
+        Subject: "Reset your password",
+        Text: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your Storely account. To choose a new one, open this link:\n\n%s\n\n"+
+            "The link expires in %s. If you didn't ask for this, you can ignore this email; your password stays the same.\n",
+            user.Name, s.link("/reset-password", token), humanDuration(s.policy.PasswordResetTTL)),
+    })
+}
+
+// ResetPassword sets a new password with a reset token, ending every
+// session. Since the token proves the user reads the address, the address
+// counts as verified, and failed logins counted against the account are
+// forgotten.
+func (s *AccountEmailService) ResetPassword(ctx context.Context, token, password string) error {
+    if len(password) < minPasswordLength {
+        return ErrPasswordTooShort
+    }
+    t, err := s.tokens.Consume(ctx, models.TokenResetPassword, hashEmailToken(token), time.Now())
+    if err != nil {
+        return err
+    }
+    user, err := s.users.FindByUserID(ctx, t.UserID)
+    if errors.Is(err, repository.ErrUserNotFound) {
+        return repository.ErrEmailTokenInvalid
+    }
+    if err != nil {
+        return err
+    }
+    if user.Email != t.Email || user.IsDisabled {
+        return repository.ErrEmailTokenInvalid
+    }
+
+    hash, err := utils.HashPassword(password)
+    if err != nil {
+        return apperr.ErrInternal.Wrap(err)
+    }
+    if err := s.users.SetPassword(ctx, user.UserID, hash); err != nil {
+        return err
+    }
+    if err := s.tokens.DeleteForUser(ctx, user.UserID, models.TokenResetPassword); err != nil {
+        log.Printf("Failed to revoke password reset tokens: %v", err)
+    }
+    if _, err := s.users.MarkEmailVerified(ctx, user.UserID, user.Email); err != nil {
+        log.Printf("Failed to mark email verified: %v", err)
+    }
+    if err := s.guard.Reset(ctx, user); err != nil {
+        log.Printf("Failed to reset login failures: %v", err)
+    }
+    return nil
+}
+
+// RequestEmailChange emails a confirmation link to newEmail. The account
+// keeps its current address until the link is used.
+func (s *AccountEmailService) RequestEmailChange(ctx context.Context, user *models.User, newEmail string) error {
+    address, err := mail.ParseAddress(newEmail)
+    if err != nil || address.Address != newEmail {
+        return ErrInvalidEmail
+    }
+    if strings.EqualFold(newEmail, user.Email) {
+        return ErrSameEmail
+    }
+    _, err = s.users.FindByEmail(ctx, newEmail)
+    if err == nil {
+        return repository.ErrEmailTaken
+    }
+    if !errors.Is(err, repository.ErrUserNotFound) {
+        return err
+    }
+
+    token, err := s.issue(ctx, user, models.TokenChangeEmail, newEmail, s.policy.VerificationTTL)
+    if err != nil || token == "" {
+        return err
+    }
+    return s.mailer.Send(ctx, mailer.Message{
+        To:      newEmail,
+        Subject: "Confirm your new email address",
+        Text: fmt.Sprintf("Hi %s,\n\nTo use this address for your Storely account, open this link:\n\n%s\n\n"+
+            "The link expires in %s. If you didn't ask for this, you can ignore this email.\n",
+            user.Name, s.link("/confirm-email", token), humanDuration(s.policy.VerificationTTL)),
+    })
+}
+
+// ConfirmEmailChange moves the account to the address a change token was
+// sent to, which is then verified, and tells the old address.
+func (s *AccountEmailService) ConfirmEmailChange(ctx context.Context, token string) error {
+    t, err := s.tokens.Consume(ctx, models.TokenChangeEmail, hashEmailToken(token), time.Now())
+    if err != nil {
+        return err
+    }
+    user, err := s.users.FindByUserID(ctx, t.UserID)
+    if errors.Is(err, repository.ErrUserNotFound) {
+        return repository.ErrEmailTokenInvalid
+    }
+    if err != nil {
+        return err
+    }
+    if err := s.users.ChangeEmail(ctx, user.UserID, t.Email); err != nil {
+        return err
+    }
+
+    // Links sent to the old address must not work any more
+    for _, purpose := range []string{models.TokenVerifyEmail, models.TokenResetPassword} {
+        if err := s.tokens.DeleteForUser(ctx, user.UserID, purpose); err != nil {
+            log.Printf("Failed to revoke email tokens: %v", err)
+        }
+    }
+    err = s.mailer.Send(ctx, mailer.Message{
+        To:      user.Email,
+        Subject: "Your email address was changed",
+        Text: fmt.Sprintf("Hi %s,\n\nThe email address of your Storely account was changed to %s.\n\n"+
+            "If you didn't do this, reset your password and contact support.\n", user.Name, t.Email),
+    })
+    if err != nil {
+        log.Printf("Failed to notify %s of email change: %v", user.Email, err)
+    }
+    return nil
+}
+
+// forget removes every token issued to a user.
+func (s *AccountEmailService) forget(ctx context.Context, userID string) error {
+    return s.tokens.DeleteByUser(ctx, userID)
+}
+
+// issue replaces the user's tokens for purpose with a new one sent to
+// address. It returns an empty token, and sends nothing, when one was
+// issued within emailCooldown.
+func (s *AccountEmailService) issue(ctx context.Context, user *models.User, purpose, address string, ttl time.Duration) (string, error) {
+    now := time.Now()
+    last, err := s.tokens.LatestCreatedAt(ctx, user.UserID, purpose)
+    if err != nil {
+        return "", err
+    }
+    if now.Sub(last) < emailCooldown {
+        return "", nil
+    }
+    if err := s.tokens.DeleteForUser(ctx, user.UserID, purpose); err != nil {
+        return "", err
+    }
+
+    raw, err := randomBytes(32)
+    if err != nil {
+        return "", apperr.ErrInternal.Wrap(err)
+    }
+    token := base64.RawURLEncoding.EncodeToString(raw)
+    err = s.tokens.Create(ctx, &models.EmailToken{
+        Purpose:   purpose,
+        TokenHash: hashEmailToken(token),
+        UserID:    user.UserID,
+        Email:     address,
+        CreatedAt: now,
+        ExpiresAt: now.Add(ttl),
+    })
+    if err != nil {
+        return "", err
+    }
+    return token, nil
+}
+
+func (s *AccountEmailService) link(path, token string) string {
+    return s.policy.AppURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// hashEmailToken hashes a token for storage. Tokens carry 256 random bits,
+// so a fast hash is safe.
+func hashEmailToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+// humanDuration writes whole hours or minutes, e.g. "48 hours".
+func humanDuration(d time.Duration) string {
+    if d >= time.Hour && d%time.Hour == 0 {
+        if d == time.Hour {
+            return "1 hour"
+        }
+        return fmt.Sprintf("%d hours", d/time.Hour)
+    }
+    if d == time.Minute {
+        return "1 minute"
+    }
+    return fmt.Sprintf("%d minutes", d/time.Minute)
+}
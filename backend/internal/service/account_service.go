@@ -0,0 +1,186 @@
+// internal/service/account_service.go
+package service
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+    "backend/utils"
+)
+
+var (
+    ErrInvalidUsername = apperr.ErrValidation.WithMessage("username must be 1 to 64 characters")
+    ErrReauthRequired  = apperr.New(http.StatusForbidden, apperr.CodeReauthRequired, "Sign in again to confirm it's you")
+)
+
+const (
+    maxUsernameLength = 64
+    // reauthWindow is how recent a sign-in must be to stand in for the
+    // password of an account that has none
+    reauthWindow = 10 * time.Minute
+)
+
+// AccountService lets users manage their own account: rename it, change
+// its password or email address, or delete it with everything it stores.
+type AccountService struct {
+    users      *repository.UserRepository
+    files      *repository.MinIOFileRepository
+    storage    *StorageService
+    shareLinks *repository.ShareLinkRepository
+    accessKeys *repository.AccessKeyRepository
+    folders    *repository.FolderRepository
+    uploads    *repository.MultipartUploadRepository
+    emails     *AccountEmailService
+    mfa        *MFAService
+}
+
+func NewAccountService(users *repository.UserRepository, files *repository.MinIOFileRepository, storage *StorageService, shareLinks *repository.ShareLinkRepository, accessKeys *repository.AccessKeyRepository, folders *repository.FolderRepository, uploads *repository.MultipartUploadRepository, emails *AccountEmailService, mfa *MFAService) *AccountService {
+    return &AccountService{
+        users:      users,
+        files:      files,
+        storage:    storage,
+        shareLinks: shareLinks,
+        accessKeys: accessKeys,
+        folders:    folders,
+        uploads:    uploads,
+        emails:     emails,
+        mfa:        mfa,
+    }
+}
+
+// Rename changes the user's name, which must be free.
+func (s *AccountService) Rename(ctx context.Context, user *models.User, name string) error {
+    name = strings.TrimSpace(name)
+    if name == "" || len(name) > maxUsernameLength {
+        return ErrInvalidUsername
+    }
+    if name == user.Name {
+        return nil
+    }
+    return s.users.SetName(ctx, user.UserID, name)
+}
+
+// ChangePassword replaces the password, given the current one, and ends
+// every session. It returns a token for a new session, so the caller stays
+// signed in. Accounts created by single sign-on set their first password
+// without a current one.
+func (s *AccountService) ChangePassword(ctx context.Context, user *models.User, current, password string, signedInAt time.Time) (string, error) {
+    if err := checkPassword(user, current, signedInAt); err != nil {
+        return "", err
+    }
+    if len(password) < minPasswordLength {
+        return "", ErrPasswordTooShort
+    }
+    hash, err := utils.HashPassword(password)
+    if err != nil {
+        return "", apperr.ErrInternal.Wrap(err)
+    }
+    if err := s.users.SetPassword(ctx, user.UserID, hash); err != nil {
+        return "", err
+    }
+
+    updated, err := s.users.FindByUserID(ctx, user.UserID)
+    if err != nil {
+        return "", err
+    }
+    return utils.GenerateJWT(updated.ID.Hex(), updated.SessionVersion)
+}
+
+// ChangeEmail starts moving the account to newEmail, given the password;
+// see AccountEmailService.RequestEmailChange.
+func (s *AccountService) ChangeEmail(ctx context.Context, user *models.User, password, newEmail string, signedInAt time.Time) error {
+    if err := checkPassword(user, password, signedInAt); err != nil {
+        return err
+    }
+    return s.emails.RequestEmailChange(ctx, user, newEmail)
+}
+
+// DeleteSelf deletes the user's own account. It takes the password and,
+// with two-factor authentication on, a current code.
+func (s *AccountService) DeleteSelf(ctx context.Context, user *models.User, password, code, ipAddress string, signedInAt time.Time) error {
+    if err := checkPassword(user, password, signedInAt); err != nil {
+        return err
+    }
+    if user.TOTPEnabled {
+        if err := s.mfa.prove(ctx, user, code, ipAddress); err != nil {
+            return err
+        }
+    }
+    return s.Delete(ctx, user)
+}
+
+// checkPassword returns ErrInvalidCredentials unless password is the
+// user's. Accounts created by single sign-on have none; for them the
+// session must have signed in within reauthWindow, or ErrReauthRequired is
+// returned.
+func checkPassword(user *models.User, password string, signedInAt time.Time) error {
+    if user.Password == "" {
+        if time.Since(signedInAt) > reauthWindow {
+            return ErrReauthRequired
+        }
+        return nil
+    }
+    if err := utils.VerifyPassword(user.Password, password); err != nil {
+        return ErrInvalidCredentials
+    }
+    return nil
+}
+
+// Delete removes the account with every MinIO object and record it owns.
+// Access keys go first, so the S3 gateway and WebDAV stop accepting them;
+// the account record goes last, so a failed deletion can be retried.
+func (s *AccountService) Delete(ctx context.Context, user *models.User) error {
+    if err := s.accessKeys.DeleteByUser(ctx, user.UserID); err != nil {
+        return err
+    }
+
+    fileIDs, err := s.files.FileIDsByUser(ctx, user.UserID)
+    if err != nil {
+        return err
+    }
+    for _, fileID := range fileIDs {
+        if err := s.storage.RemoveFileObjects(ctx, fileID); err != nil {
+            return fmt.Errorf("failed to remove objects of file %s: %w", fileID, err)
+        }
+    }
+    uploadIDs, err := s.uploads.IDsByUser(ctx, user.UserID)
+    if err != nil {
+        return err
+    }
+    for _, uploadID := range uploadIDs {
+        // Where the S3 gateway keeps the parts of unfinished uploads
+        if err := s.storage.RemovePrefix(ctx, "multipart/"+uploadID+"/"); err != nil {
+            return fmt.Errorf("failed to remove parts of upload %s: %w", uploadID, err)
+        }
+    }
+
+    if err := s.shareLinks.DeleteByUser(ctx, user.UserID); err != nil {
+        return err
+    }
+    if err := s.uploads.DeleteByUser(ctx, user.UserID); err != nil {
+        return err
+    }
+    if err := s.folders.DeleteByUser(ctx, user.UserID); err != nil {
+        return err
+    }
+    if err := s.emails.forget(ctx, user.UserID); err != nil {
+        return err
+    }
+    deleted, err := s.files.DeleteByUser(ctx, user.UserID)
+    if err != nil {
+        return err
+    }
+    if err := s.users.DeleteByUserID(ctx, user.UserID); err != nil {
+        return err
+    }
+
+    log.Printf("Deleted user %s and %d file(s)", user.UserID, deleted)
+    return nil
+}
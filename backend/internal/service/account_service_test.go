@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/utils"
+)
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := utils.HashPassword("hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tests := []struct {
+		name       string
+		hash       string
+		password   string
+		signedInAt time.Time
+		want       error
+	}{
+		{"right password", hash, "hunter22", time.Time{}, nil},
+		{"wrong password", hash, "hunter23", now, ErrInvalidCredentials},
+		{"passwordless, fresh sign-in", "", "", now.Add(-time.Minute), nil},
+		{"passwordless, old sign-in", "", "", now.Add(-reauthWindow - time.Minute), ErrReauthRequired},
+		{"passwordless, token without iat", "", "", time.Time{}, ErrReauthRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPassword(&models.User{Password: tt.hash}, tt.password, tt.signedInAt)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("checkPassword() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
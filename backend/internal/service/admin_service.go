@@ -0,0 +1,134 @@
+// internal/service/admin_service.go
+package service
+
+import (
+    "context"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+)
+
+var ErrInvalidStorageLimit = apperr.ErrValidation.WithMessage("storageLimit must be positive")
+
+// AdminService implements user management and storage oversight for admins.
+type AdminService struct {
+    userRepo  *repository.UserRepository
+    minioRepo *repository.MinIOFileRepository
+    jobQueue  *JobQueue
+    guard     *LoginGuard
+    accounts  *AccountService
+}
+
+func NewAdminService(userRepo *repository.UserRepository, minioRepo *repository.MinIOFileRepository, jobQueue *JobQueue, guard *LoginGuard, accounts *AccountService) *AdminService {
+    return &AdminService{
+        userRepo:  userRepo,
+        minioRepo: minioRepo,
+        jobQueue:  jobQueue,
+        guard:     guard,
+        accounts:  accounts,
+    }
+}
+
+// UserOverview is a user together with their current usage.
+type UserOverview struct {
+    User             *models.User `json:"user"`
+    FileCount        int64        `json:"fileCount"`
+    AvailableBalance float64      `json:"availableBalance"`
+}
+
+// SystemStats are the system-wide totals shown on the admin dashboard.
+type SystemStats struct {
+    Users *repository.UserTotals `json:"users"`
+    Files *repository.FileTotals `json:"files"`
+    Jobs  map[string]int64       `json:"jobs"`
+}
+
+func (s *AdminService) ListUsers(ctx context.Context, query string, page, limit int64) ([]models.User, int64, error) {
+    return s.userRepo.Search(ctx, query, (page-1)*limit, limit)
+}
+
+func (s *AdminService) GetUserOverview(ctx context.Context, userID string) (*UserOverview, error) {
+    user, err := s.userRepo.FindByUserID(ctx, userID)
+    if err != nil {
+        return nil, err
+    }
+    _, fileCount, err := s.minioRepo.ListByUser(ctx, userID, 0, 1)
+    if err != nil {
+        return nil, err
+    }
+    return &UserOverview{
+        User:             user,
+        FileCount:        fileCount,
+        AvailableBalance: user.StorageLimit - user.StorageUsed,
+    }, nil
+}
+
+func (s *AdminService) ListUserFiles(ctx context.Context, userID string, page, limit int64) ([]models.FileMinIO, int64, error) {
+    if _, err := s.userRepo.FindByUserID(ctx, userID); err != nil {
+        return nil, 0, err
+    }
+    return s.minioRepo.ListByUser(ctx, userID, (page-1)*limit, limit)
+}
+
+func (s *AdminService) UpdateStorageLimit(ctx context.Context, userID string, limit float64) error {
+    if limit <= 0 {
+        return ErrInvalidStorageLimit
+    }
+    return s.userRepo.SetStorageLimit(ctx, userID, limit)
+}
+
+// UnlockUser clears the account's lock and the failed logins counted
+// against its email, lifting any login delay or CAPTCHA requirement.
+func (s *AdminService) UnlockUser(ctx context.Context, userID string) error {
+    user, err := s.userRepo.FindByUserID(ctx, userID)
+    if err != nil {
+        return err
+    }
+    if err := s.userRepo.Unlock(ctx, userID); err != nil {
+        return err
+    }
+    return s.guard.Reset(ctx, user)
+}
+
+// ListLoginAttempts lists audited sign-in attempts, newest first,
+// optionally only those for email or from ip.
+func (s *AdminService) ListLoginAttempts(ctx context.Context, email, ip string, page, limit int64) ([]models.LoginAttempt, int64, error) {
+    return s.guard.Attempts(ctx, email, ip, (page-1)*limit, limit)
+}
+
+// ResetMFA turns off two-factor authentication for a user who lost their
+// authenticator and recovery codes.
+func (s *AdminService) ResetMFA(ctx context.Context, userID string) error {
+    return s.userRepo.DisableTOTP(ctx, userID)
+}
+
+func (s *AdminService) SetUserDisabled(ctx context.Context, userID string, disabled bool) error {
+    return s.userRepo.SetDisabled(ctx, userID, disabled)
+}
+
+// DeleteUser removes the account with everything it stores; see
+// AccountService.Delete.
+func (s *AdminService) DeleteUser(ctx context.Context, userID string) error {
+    user, err := s.userRepo.FindByUserID(ctx, userID)
+    if err != nil {
+        return err
+    }
+    return s.accounts.Delete(ctx, user)
+}
+
+func (s *AdminService) SystemStats(ctx context.Context) (*SystemStats, error) {
+    users, err := s.userRepo.Totals(ctx)
+    if err != nil {
+        return nil, err
+    }
+    files, err := s.minioRepo.Totals(ctx)
+    if err != nil {
+        return nil, err
+    }
+    jobs, err := s.jobQueue.Stats(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return &SystemStats{Users: users, Files: files, Jobs: jobs}, nil
+}
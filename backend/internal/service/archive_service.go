@@ -0,0 +1,219 @@
+// internal/service/archive_service.go
+package service
+
+import (
+    "archive/zip"
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "path"
+    "strings"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultArchiveMaxSize is the largest total file size of one archive when
+// nothing is configured.
+const DefaultArchiveMaxSize = 4 * 1024 * 1024 * 1024
+
+// maxArchiveFiles bounds the number of IDs one archive request may list.
+const maxArchiveFiles = 1000
+
+var ErrArchiveTooLarge = apperr.New(http.StatusRequestEntityTooLarge, apperr.CodeFileTooLarge, "Archive is too large")
+
+// ArchiveService builds ZIP archives of a user's files. Archives are
+// streamed: entries are read chunk by chunk from storage while the ZIP is
+// written, so nothing is buffered beyond a chunk read.
+type ArchiveService struct {
+    minioRepo *repository.MinIOFileRepository
+    storage   *StorageService
+    maxSize   int64
+}
+
+func NewArchiveService(minioRepo *repository.MinIOFileRepository, storage *StorageService, maxSize int64) *ArchiveService {
+    if maxSize <= 0 {
+        maxSize = DefaultArchiveMaxSize
+    }
+    return &ArchiveService{minioRepo: minioRepo, storage: storage, maxSize: maxSize}
+}
+
+// ArchiveRequest selects the files of an archive: the listed IDs, or with
+// ByFolder everything in Folder and its subfolders ("" is the whole
+// account).
+type ArchiveRequest struct {
+    FileIDs  []string
+    Folder   string
+    ByFolder bool
+}
+
+// ArchiveEntry is one file of an archive and its path inside it.
+type ArchiveEntry struct {
+    Path string
+    File *models.FileMinIO
+}
+
+// Archive is a checked selection of files, ready to be written.
+type Archive struct {
+    Name    string
+    Size    int64
+    Entries []ArchiveEntry
+}
+
+// Prepare resolves req into an archive of files user owns. Listed files
+// keep their folder structure; a folder archive holds paths relative to the
+// folder, with only the newest file at each path. The total size is checked
+// here so an oversized request fails before anything is sent.
+func (s *ArchiveService) Prepare(ctx context.Context, user *models.User, req ArchiveRequest) (*Archive, error) {
+    var files []models.FileMinIO
+    var folder string
+    name := "files.zip"
+
+    if req.ByFolder {
+        var ok bool
+        if folder, ok = CleanFolder(req.Folder); !ok {
+            return nil, apperr.BadRequest("Invalid folder")
+        }
+        tree, err := s.minioRepo.ListTree(ctx, user.UserID, folder)
+        if err != nil {
+            return nil, err
+        }
+        // ListTree orders versions of a path newest first
+        for i, f := range tree {
+            if i > 0 && f.Folder == tree[i-1].Folder && f.FileName == tree[i-1].FileName {
+                continue
+            }
+            files = append(files, f)
+        }
+        if len(files) == 0 {
+            return nil, repository.ErrFileNotFound.WithMessage("Folder has no files")
+        }
+        if folder != "" {
+            name = path.Base(folder) + ".zip"
+        }
+    } else {
+        ids, err := archiveIDs(req.FileIDs)
+        if err != nil {
+            return nil, err
+        }
+        if files, err = s.minioRepo.FindByIDs(ctx, user.UserID, ids); err != nil {
+            return nil, err
+        }
+        if len(files) < len(ids) {
+            found := map[primitive.ObjectID]bool{}
+            for _, f := range files {
+                found[f.ID] = true
+            }
+            var missing []string
+            for _, id := range ids {
+                if !found[id] {
+                    missing = append(missing, id.Hex())
+                }
+            }
+            return nil, repository.ErrFileNotFound.WithDetails(map[string]interface{}{"fileIds": missing})
+        }
+    }
+
+    archive := &Archive{Name: name}
+    used := map[string]bool{}
+    for i := range files {
+        f := &files[i]
+        dir := strings.TrimPrefix(strings.TrimPrefix(f.Folder, folder), "/")
+        archive.Entries = append(archive.Entries, ArchiveEntry{
+            Path: uniqueEntryPath(path.Join(dir, f.FileName), used),
+            File: f,
+        })
+        archive.Size += int64(f.Size)
+    }
+    if archive.Size > s.maxSize {
+        return nil, ErrArchiveTooLarge.WithMessage("Archive would hold %d bytes; the maximum is %d", archive.Size, s.maxSize).
+            WithDetails(map[string]interface{}{"limit": s.maxSize, "value": archive.Size})
+    }
+    return archive, nil
+}
+
+// Write streams archive to w as a ZIP. Once writing has started, errors can
+// only end the stream early.
+func (s *ArchiveService) Write(ctx context.Context, w io.Writer, archive *Archive) error {
+    zw := zip.NewWriter(w)
+    for _, entry := range archive.Entries {
+        modified := entry.File.UpdatedAt
+        if modified.IsZero() {
+            modified = entry.File.CreatedAt
+        }
+        fw, err := zw.CreateHeader(&zip.FileHeader{
+            Name:     entry.Path,
+            Method:   compressionFor(entry.File.FileType),
+            Modified: modified,
+        })
+        if err != nil {
+            return err
+        }
+
+        content := s.storage.OpenFile(ctx, entry.File)
+        n, err := io.Copy(fw, content)
+        content.Close()
+        if err != nil {
+            return fmt.Errorf("failed to archive %s: %w", entry.File.ID.Hex(), err)
+        }
+        if n != int64(entry.File.Size) {
+            return fmt.Errorf("failed to archive %s: read %d of %d bytes", entry.File.ID.Hex(), n, int64(entry.File.Size))
+        }
+    }
+    return zw.Close()
+}
+
+func archiveIDs(fileIDs []string) ([]primitive.ObjectID, error) {
+    if len(fileIDs) == 0 {
+        return nil, apperr.BadRequest("fileIds or folder is required")
+    }
+    if len(fileIDs) > maxArchiveFiles {
+        return nil, invalidUpload(apperr.ErrValidation, "fileIds", "max", maxArchiveFiles, len(fileIDs), "An archive may list at most %d files", maxArchiveFiles)
+    }
+    seen := map[primitive.ObjectID]bool{}
+    ids := make([]primitive.ObjectID, 0, len(fileIDs))
+    for _, raw := range fileIDs {
+        id, err := primitive.ObjectIDFromHex(raw)
+        if err != nil {
+            return nil, repository.ErrInvalidID.WithDetails(map[string]interface{}{"fileId": raw})
+        }
+        if !seen[id] {
+            seen[id] = true
+            ids = append(ids, id)
+        }
+    }
+    return ids, nil
+}
+
+// uniqueEntryPath cleans p so it can't leave the archive root and appends
+// " (2)", " (3)", ... to the name when the path is already taken.
+func uniqueEntryPath(p string, used map[string]bool) string {
+    p = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(p, "\\", "/")), "/")
+    if p == "" {
+        p = "unnamed"
+    }
+    candidate := p
+    ext := path.Ext(p)
+    for n := 2; used[candidate]; n++ {
+        candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(p, ext), n, ext)
+    }
+    used[candidate] = true
+    return candidate
+}
+
+// compressionFor stores media and archives as they are, since deflating
+// already compressed data costs CPU without saving space.
+func compressionFor(fileType string) uint16 {
+    switch {
+    case strings.HasPrefix(fileType, "image/"), strings.HasPrefix(fileType, "video/"), strings.HasPrefix(fileType, "audio/"):
+        return zip.Store
+    case fileType == "application/zip", fileType == "application/gzip", fileType == "application/x-7z-compressed",
+        fileType == "application/x-rar-compressed", fileType == "application/pdf":
+        return zip.Store
+    }
+    return zip.Deflate
+}
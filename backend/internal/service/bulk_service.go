@@ -0,0 +1,320 @@
+// internal/service/bulk_service.go
+package service
+
+import (
+    "context"
+    "log"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxBulkFiles bounds the number of IDs one bulk request may list.
+const maxBulkFiles = 1000
+
+// bulkConcurrency is how many files' objects are listed at once while a
+// bulk delete removes them from storage.
+const bulkConcurrency = 8
+
+// Tag limits. Tags are free-form labels compared as given, after trimming.
+const (
+    maxTagsPerFile = 50
+    maxTagLength   = 64
+)
+
+// BulkResult is the outcome of a bulk operation for one file. Failed items
+// carry the message and code an API error for that file alone would have.
+type BulkResult struct {
+    FileID    string            `json:"fileId"`
+    OK        bool              `json:"ok"`
+    Error     string            `json:"error,omitempty"`
+    Code      apperr.Code       `json:"code,omitempty"`
+    Tags      []string          `json:"tags,omitempty"`
+    ShareLink *models.ShareLink `json:"shareLink,omitempty"`
+}
+
+func (r *BulkResult) fail(err error) {
+    appErr := apperr.From(err)
+    if appErr.Status >= 500 {
+        log.Printf("Bulk operation failed for %s: %v", r.FileID, err)
+    }
+    r.OK, r.Error, r.Code = false, appErr.Message, appErr.Code
+}
+
+// bulkItem is a listed file that the caller owns, with its result.
+type bulkItem struct {
+    result *BulkResult
+    file   *models.FileMinIO
+}
+
+// BulkService applies one operation to many of a user's files. Every
+// listed file gets a result; a file that can't be processed doesn't stop
+// the others.
+type BulkService struct {
+    minioRepo *repository.MinIOFileRepository
+    userRepo  *repository.UserRepository
+    storage   *StorageService
+    shares    *ShareService
+}
+
+func NewBulkService(minioRepo *repository.MinIOFileRepository, userRepo *repository.UserRepository, storage *StorageService, shares *ShareService) *BulkService {
+    return &BulkService{
+        minioRepo: minioRepo,
+        userRepo:  userRepo,
+        storage:   storage,
+        shares:    shares,
+    }
+}
+
+// Delete removes files and their objects. Objects of all files are removed
+// in batches; only files whose objects are all gone lose their metadata,
+// and the quota is reduced by exactly the size of those.
+func (s *BulkService) Delete(ctx context.Context, user *models.User, fileIDs []string) ([]BulkResult, error) {
+    results, items, err := s.resolve(ctx, user, fileIDs)
+    if err != nil || len(items) == 0 {
+        return results, err
+    }
+
+    ids := make([]string, len(items))
+    for i, item := range items {
+        ids[i] = item.file.ID.Hex()
+    }
+    failed := s.storage.RemoveFilesObjects(ctx, ids, bulkConcurrency)
+
+    // Objects are gone from here on, so the bookkeeping must finish even if
+    // the client goes away.
+    ctx = context.WithoutCancel(ctx)
+    var removed []primitive.ObjectID
+    var removedItems []bulkItem
+    for _, item := range items {
+        if err := failed[item.file.ID.Hex()]; err != nil {
+            item.result.fail(apperr.ErrStorage.Wrap(err))
+            continue
+        }
+        removed = append(removed, item.file.ID)
+        removedItems = append(removedItems, item)
+    }
+    if len(removed) == 0 {
+        return results, nil
+    }
+
+    if _, err := s.minioRepo.DeleteByIDs(ctx, user.UserID, removed); err != nil {
+        for _, item := range removedItems {
+            item.result.fail(err)
+        }
+        return results, nil
+    }
+    var freed float64
+    for _, item := range removedItems {
+        item.result.OK = true
+        freed += item.file.Size
+    }
+    if err := s.userRepo.DecreaseUsedStorage(ctx, user.UserID, freed); err != nil {
+        log.Printf("Failed to decrement storage of %s: %v", user.UserID, err)
+    }
+    if err := s.shares.DeleteForFiles(ctx, removed); err != nil {
+        log.Printf("Failed to delete share links of removed files: %v", err)
+    }
+    return results, nil
+}
+
+// Move puts files into folder. Only metadata changes; objects are keyed by
+// file ID.
+func (s *BulkService) Move(ctx context.Context, user *models.User, fileIDs []string, folder string) ([]BulkResult, error) {
+    target, ok := CleanFolder(folder)
+    if !ok {
+        return nil, invalidUpload(apperr.ErrValidation, "folder", "path", nil, folder, "folder must be a relative path without \"..\" segments")
+    }
+    results, items, err := s.resolve(ctx, user, fileIDs)
+    if err != nil || len(items) == 0 {
+        return results, err
+    }
+
+    ids := make([]primitive.ObjectID, len(items))
+    for i, item := range items {
+        ids[i] = item.file.ID
+    }
+    if err := s.minioRepo.MoveByIDs(ctx, user.UserID, ids, target); err != nil {
+        for _, item := range items {
+            item.result.fail(err)
+        }
+        return results, nil
+    }
+    for _, item := range items {
+        item.result.OK = true
+    }
+    return results, nil
+}
+
+// Tag adds and removes tags on files. A file that would end up with more
+// than maxTagsPerFile tags is left unchanged.
+func (s *BulkService) Tag(ctx context.Context, user *models.User, fileIDs []string, add, remove []string) ([]BulkResult, error) {
+    add, err := cleanTags("add", add)
+    if err != nil {
+        return nil, err
+    }
+    remove, err = cleanTags("remove", remove)
+    if err != nil {
+        return nil, err
+    }
+    if len(add) == 0 && len(remove) == 0 {
+        return nil, apperr.BadRequest("add or remove is required")
+    }
+    results, items, err := s.resolve(ctx, user, fileIDs)
+    if err != nil || len(items) == 0 {
+        return results, err
+    }
+
+    removing := map[string]bool{}
+    for _, tag := range remove {
+        removing[tag] = true
+    }
+    updates := map[primitive.ObjectID][]string{}
+    var tagged []bulkItem
+    for _, item := range items {
+        tags := []string{}
+        seen := map[string]bool{}
+        for _, tag := range append(append([]string{}, item.file.Tags...), add...) {
+            if !removing[tag] && !seen[tag] {
+                seen[tag] = true
+                tags = append(tags, tag)
+            }
+        }
+        if len(tags) > maxTagsPerFile {
+            item.result.fail(invalidUpload(apperr.ErrValidation, "tags", "max", maxTagsPerFile, len(tags),
+                "A file can have at most %d tags", maxTagsPerFile))
+            continue
+        }
+        updates[item.file.ID] = tags
+        item.result.Tags = tags
+        tagged = append(tagged, item)
+    }
+
+    if err := s.minioRepo.SetTags(ctx, user.UserID, updates); err != nil {
+        for _, item := range tagged {
+            item.result.Tags = nil
+            item.result.fail(err)
+        }
+        return results, nil
+    }
+    for _, item := range tagged {
+        item.result.OK = true
+    }
+    return results, nil
+}
+
+// Share issues a public link for each complete file, expiring at
+// expiresAt (nil for never). Files beyond the plan's share link allowance
+// fail with ErrPlanLimitExceeded.
+func (s *BulkService) Share(ctx context.Context, user *models.User, fileIDs []string, expiresAt *time.Time) ([]BulkResult, error) {
+    if !user.EmailVerified {
+        return nil, ErrEmailNotVerified
+    }
+    if expiresAt != nil && !expiresAt.After(time.Now()) {
+        return nil, invalidUpload(apperr.ErrValidation, "expiresAt", "future", nil, expiresAt, "expiresAt must be in the future")
+    }
+    results, items, err := s.resolve(ctx, user, fileIDs)
+    if err != nil || len(items) == 0 {
+        return results, err
+    }
+
+    var shareable []bulkItem
+    var files []*models.FileMinIO
+    for _, item := range items {
+        if !item.file.Complete {
+            item.result.fail(ErrUploadNotComplete)
+            continue
+        }
+        shareable = append(shareable, item)
+        files = append(files, item.file)
+    }
+    if len(files) == 0 {
+        return results, nil
+    }
+
+    // Create returns links for a prefix of files and the reason the rest
+    // got none
+    links, err := s.shares.Create(ctx, user, files, expiresAt)
+    for i, item := range shareable {
+        if i >= len(links) {
+            item.result.fail(err)
+            continue
+        }
+        item.result.OK = true
+        item.result.ShareLink = &links[i]
+    }
+    return results, nil
+}
+
+// resolve validates fileIDs and loads the ones user owns. Results are in
+// request order with duplicates dropped; IDs that are malformed or not the
+// user's already carry their failure.
+func (s *BulkService) resolve(ctx context.Context, user *models.User, fileIDs []string) ([]BulkResult, []bulkItem, error) {
+    if len(fileIDs) == 0 {
+        return nil, nil, apperr.BadRequest("fileIds is required")
+    }
+    if len(fileIDs) > maxBulkFiles {
+        return nil, nil, invalidUpload(apperr.ErrValidation, "fileIds", "max", maxBulkFiles, len(fileIDs), "A bulk request may list at most %d files", maxBulkFiles)
+    }
+
+    seen := map[string]bool{}
+    results := make([]BulkResult, 0, len(fileIDs))
+    index := map[primitive.ObjectID]int{}
+    var ids []primitive.ObjectID
+    for _, raw := range fileIDs {
+        if seen[raw] {
+            continue
+        }
+        seen[raw] = true
+        results = append(results, BulkResult{FileID: raw})
+        id, err := primitive.ObjectIDFromHex(raw)
+        if err != nil {
+            results[len(results)-1].fail(repository.ErrInvalidID)
+            continue
+        }
+        index[id] = len(results) - 1
+        ids = append(ids, id)
+    }
+    if len(ids) == 0 {
+        return results, nil, nil
+    }
+
+    files, err := s.minioRepo.FindOwnedByIDs(ctx, user.UserID, ids)
+    if err != nil {
+        return nil, nil, err
+    }
+    found := map[primitive.ObjectID]*models.FileMinIO{}
+    for i := range files {
+        found[files[i].ID] = &files[i]
+    }
+    var items []bulkItem
+    for _, id := range ids {
+        result := &results[index[id]]
+        file, ok := found[id]
+        if !ok {
+            result.fail(repository.ErrFileNotFound)
+            continue
+        }
+        items = append(items, bulkItem{result: result, file: file})
+    }
+    return results, items, nil
+}
+
+func cleanTags(field string, tags []string) ([]string, error) {
+    cleaned := make([]string, 0, len(tags))
+    for _, tag := range tags {
+        tag = strings.TrimSpace(tag)
+        if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+            return nil, invalidUpload(apperr.ErrValidation, field, "tag", maxTagLength, tag,
+                "Tags must be between 1 and %d characters", maxTagLength)
+        }
+        cleaned = append(cleaned, tag)
+    }
+    return cleaned, nil
+}
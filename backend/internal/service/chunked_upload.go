@@ -0,0 +1,126 @@
+// internal/service/chunked_upload.go
+package service
+
+import (
+    "context"
+    "io"
+    "log"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+)
+
+// ErrChunkSize is returned when a chunk isn't exactly as long as the upload's
+// chunk layout requires.
+var ErrChunkSize = apperr.ErrValidation.WithMessage("Chunk does not have the expected size")
+
+// StartChunked creates a file whose chunks the client sends through the
+// server one request at a time (the /upload-chunk form). Every chunk but the
+// last must be chunkSize bytes. A file of a single chunk gets the server's
+// chunk size, so small files aren't held to the minimum chunk size. An
+// empty file is complete right away.
+func (s *FileStore) StartChunked(ctx context.Context, user *models.User, req PutRequest, chunkSize int64, totalChunks int) (*models.FileMinIO, error) {
+    if req.Size == 0 {
+        totalChunks = 0
+    }
+    if totalChunks <= 1 && (chunkSize <= 0 || chunkSize >= req.Size) {
+        chunkSize = s.chunkSizeFor(req.Size)
+    }
+    if chunkSize > 0 {
+        if expected := ExpectedChunks(req.Size, chunkSize); int64(totalChunks) != expected {
+            return nil, invalidUpload(apperr.ErrValidation, "totalChunks", "consistency", expected, totalChunks,
+                "totalChunks must be %d for a fileSize of %d bytes split into %d byte chunks", expected, req.Size, chunkSize)
+        }
+    }
+
+    file, err := s.reserve(ctx, user, req, chunkSize, nil)
+    if err != nil {
+        return nil, err
+    }
+    if req.Size == 0 {
+        if err := s.finish(ctx, file); err != nil {
+            return nil, err
+        }
+    }
+    return file, nil
+}
+
+// WriteChunk stores chunk index of one of user's chunked uploads from body,
+// which must hold exactly that chunk, and completes the file once every
+// chunk is stored. It returns the file and the number of chunks stored.
+func (s *FileStore) WriteChunk(ctx context.Context, user *models.User, fileID string, index int, body io.Reader) (*models.FileMinIO, int, error) {
+    file, err := s.minioRepo.GetFileByID_MinIO(ctx, fileID)
+    if err != nil {
+        return nil, 0, err
+    }
+    if file.UserID != user.UserID {
+        return nil, 0, repository.ErrFileNotFound
+    }
+    if file.Complete {
+        return nil, 0, ErrUploadFinished
+    }
+    if index < 0 || index >= file.TotalChunks {
+        return nil, 0, invalidUpload(apperr.ErrValidation, "chunkIndex", "range", file.TotalChunks-1, index,
+            "chunkIndex must be between 0 and %d", file.TotalChunks-1)
+    }
+
+    size := file.ChunkSize
+    if index == file.TotalChunks-1 {
+        size = int64(file.Size) - int64(index)*file.ChunkSize
+    }
+    chunkSizeErr := ErrChunkSize.WithDetails(map[string]interface{}{
+        "chunkIndex": index,
+        "expected":   size,
+    })
+
+    exact := &exactReader{r: body, remaining: size}
+    if err := s.storage.PutChunk(ctx, fileID, index, exact, size); err != nil {
+        if exact.short {
+            return nil, 0, chunkSizeErr
+        }
+        return nil, 0, apperr.ErrStorage.Wrap(err)
+    }
+    var extra [1]byte
+    if n, _ := io.ReadFull(body, extra[:]); n > 0 {
+        if err := s.storage.RemoveObject(context.WithoutCancel(ctx), ChunkObjectName(fileID, index)); err != nil {
+            log.Printf("Failed to remove oversized chunk %d of %s: %v", index, fileID, err)
+        }
+        return nil, 0, chunkSizeErr
+    }
+
+    uploaded, err := s.storage.UploadedChunks(ctx, fileID)
+    if err != nil {
+        return nil, 0, apperr.ErrStorage.Wrap(err)
+    }
+    if len(uploaded) >= file.TotalChunks {
+        if err := s.finish(ctx, file); err != nil {
+            return nil, 0, err
+        }
+    }
+    return file, len(uploaded), nil
+}
+
+// exactReader yields at most remaining bytes of r and records whether r
+// ended before that.
+type exactReader struct {
+    r         io.Reader
+    remaining int64
+    short     bool
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+    if e.remaining <= 0 {
+        return 0, io.EOF
+    }
+    if int64(len(p)) > e.remaining {
+        p = p[:e.remaining]
+    }
+    n, err := e.r.Read(p)
+    e.remaining -= int64(n)
+    if err == io.EOF && e.remaining > 0 {
+        e.short = true
+        err = io.ErrUnexpectedEOF
+    }
+    return n, err
+}
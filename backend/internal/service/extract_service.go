@@ -0,0 +1,488 @@
+// internal/service/extract_service.go
+package service
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "compress/flate"
+    "compress/gzip"
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "math"
+    "mime"
+    "path"
+    "strings"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+)
+
+// JobExtractArchive unpacks a ZIP or tar(.gz) file into individual files.
+const JobExtractArchive = "extract_archive"
+
+// extractReadAhead is how much of a ZIP is fetched per range request.
+const extractReadAhead = 4 * 1024 * 1024
+
+// ExtractLimits bound what one archive may unpack to. They protect against
+// archives that expand to far more than they occupy (zip bombs).
+type ExtractLimits struct {
+    MaxEntries   int
+    MaxTotalSize int64
+    // MaxRatio bounds the unpacked size relative to the archive size
+    MaxRatio float64
+}
+
+// DefaultExtractLimits returns the limits used when nothing is configured.
+func DefaultExtractLimits() ExtractLimits {
+    return ExtractLimits{
+        MaxEntries:   10000,
+        MaxTotalSize: 10 * 1024 * 1024 * 1024,
+        MaxRatio:     100,
+    }
+}
+
+var (
+    ErrNotAnArchive      = apperr.ErrValidation.WithMessage("Only ZIP, .tar, .tar.gz and .tgz files can be extracted")
+    ErrUploadNotComplete = apperr.ErrConflict.WithMessage("File upload is not complete")
+)
+
+type archiveFormat int
+
+const (
+    formatZip archiveFormat = iota + 1
+    formatTar
+    formatTarGz
+)
+
+// Extractor unpacks uploaded archives in the background. Every entry
+// becomes a regular file stored through the FileStore, so it is charged to
+// the owner's quota and checked against their plan like any upload. If an
+// extraction fails, the files it created are removed again.
+type Extractor struct {
+    store  *FileStore
+    limits ExtractLimits
+}
+
+func NewExtractor(store *FileStore, limits ExtractLimits) *Extractor {
+    return &Extractor{store: store, limits: limits}
+}
+
+// Register adds the extraction job handler to queue.
+func (e *Extractor) Register(queue *JobQueue) {
+    queue.Register(JobExtractArchive, e.extract)
+}
+
+// Target checks that file can be extracted and returns the folder it will
+// be extracted into: folder when given, otherwise a folder named after the
+// archive next to it.
+func (e *Extractor) Target(file *models.FileMinIO, folder *string) (string, error) {
+    if _, ok := archiveFormatOf(file); !ok {
+        return "", ErrNotAnArchive
+    }
+    if folder == nil {
+        target, _ := CleanFolder(path.Join(file.Folder, trimArchiveExt(file.FileName)))
+        return target, nil
+    }
+    target, ok := CleanFolder(*folder)
+    if !ok {
+        return "", invalidUpload(apperr.ErrValidation, "folder", "path", nil, *folder, "folder must be a relative path without \"..\" segments")
+    }
+    return target, nil
+}
+
+// Enqueue schedules the extraction of a complete archive. With
+// deleteArchive the archive is removed once its content is extracted.
+func (e *Extractor) Enqueue(ctx context.Context, file *models.FileMinIO, folder *string, deleteArchive bool) (*models.Job, string, error) {
+    if !file.Complete {
+        return nil, "", ErrUploadNotComplete
+    }
+    target, err := e.Target(file, folder)
+    if err != nil {
+        return nil, "", err
+    }
+    job, err := e.store.jobQueue.Enqueue(ctx, JobExtractArchive, map[string]string{
+        "fileId":        file.ID.Hex(),
+        "userId":        file.UserID,
+        "folder":        target,
+        "deleteArchive": fmt.Sprint(deleteArchive),
+    })
+    if err != nil {
+        return nil, "", err
+    }
+    return job, target, nil
+}
+
+func (e *Extractor) extract(ctx context.Context, job *models.Job) error {
+    archive, err := e.store.minioRepo.GetFileByID_MinIO(ctx, job.Payload["fileId"])
+    if err != nil {
+        return Permanent(err)
+    }
+    user, err := e.store.userRepo.FindByUserID(ctx, archive.UserID)
+    if err != nil {
+        return Permanent(err)
+    }
+    format, ok := archiveFormatOf(archive)
+    if !ok {
+        return Permanent(ErrNotAnArchive)
+    }
+
+    x := &extraction{
+        e:       e,
+        job:     job,
+        user:    user,
+        archive: archive,
+        folder:  job.Payload["folder"],
+    }
+    if format == formatZip {
+        err = x.zip(ctx)
+    } else {
+        err = x.tar(ctx, format == formatTarGz)
+    }
+    if err != nil {
+        x.rollback(ctx)
+        return err
+    }
+
+    where := "the root folder"
+    if x.folder != "" {
+        where = fmt.Sprintf("%q", x.folder)
+    }
+    x.report(ctx, fmt.Sprintf("Extracted %d files into %s", len(x.created), where))
+
+    if job.Payload["deleteArchive"] == "true" {
+        if err := e.store.Delete(ctx, archive); err != nil {
+            log.Printf("Failed to delete extracted archive %s: %v", archive.ID.Hex(), err)
+        }
+    }
+    return nil
+}
+
+// extraction is the state of one extract job.
+type extraction struct {
+    e       *Extractor
+    job     *models.Job
+    user    *models.User
+    archive *models.FileMinIO
+    folder  string
+
+    entries int
+    total   int
+    bytes   int64
+    created []*models.FileMinIO
+}
+
+func (x *extraction) zip(ctx context.Context) error {
+    size := int64(x.archive.Size)
+    zr, err := zip.NewReader(&objectReaderAt{ctx: ctx, storage: x.e.store.storage, file: x.archive}, size)
+    if err != nil {
+        return x.formatError(err)
+    }
+
+    // The central directory gives every size up front, so oversized archives
+    // are refused before anything is written
+    var declared int64
+    for _, f := range zr.File {
+        if f.UncompressedSize64 > uint64(math.MaxInt64-declared) {
+            return Permanent(fmt.Errorf("entry %q declares an impossible size", f.Name))
+        }
+        declared += int64(f.UncompressedSize64)
+        if err := x.e.limits.checkEntry(f.Name, f.CompressedSize64, f.UncompressedSize64); err != nil {
+            return err
+        }
+        if f.Mode().IsRegular() {
+            x.total++
+        }
+    }
+    if err := x.checkLimits(len(zr.File), declared); err != nil {
+        return err
+    }
+    used, limit, err := x.e.store.userRepo.GetStorageUsedAndLimit(ctx, x.user.UserID)
+    if err != nil {
+        return err
+    }
+    if used+float64(declared) > limit {
+        return Permanent(repository.ErrStorageLimitExceeded.WithMessage("Extracting would need %d bytes; %.0f are available", declared, limit-used))
+    }
+
+    for _, f := range zr.File {
+        x.entries++
+        if !f.Mode().IsRegular() {
+            continue
+        }
+        body, err := f.Open()
+        if err != nil {
+            return x.formatError(err)
+        }
+        err = x.add(ctx, f.Name, int64(f.UncompressedSize64), body)
+        body.Close()
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (x *extraction) tar(ctx context.Context, gzipped bool) error {
+    content := x.e.store.storage.OpenFile(ctx, x.archive)
+    defer content.Close()
+
+    var r io.Reader = content
+    if gzipped {
+        gz, err := gzip.NewReader(content)
+        if err != nil {
+            return x.formatError(err)
+        }
+        defer gz.Close()
+        r = gz
+    }
+
+    // tar has no index, so the limits are checked as entries arrive; skipped
+    // entries count too, since their content is decompressed all the same
+    tr := tar.NewReader(r)
+    for {
+        header, err := tr.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return x.formatError(err)
+        }
+        x.entries++
+        if header.Typeflag != tar.TypeReg {
+            if err := x.checkLimits(x.entries, x.bytes+header.Size); err != nil {
+                return err
+            }
+            x.bytes += header.Size
+            continue
+        }
+        if err := x.add(ctx, header.Name, header.Size, tr); err != nil {
+            return err
+        }
+    }
+}
+
+// add stores one regular entry as a file below the target folder.
+func (x *extraction) add(ctx context.Context, name string, size int64, body io.Reader) error {
+    entryPath, ok := safeEntryPath(name)
+    if !ok {
+        return Permanent(fmt.Errorf("entry %q would be written outside the target folder", name))
+    }
+    if err := x.checkLimits(x.entries, x.bytes+size); err != nil {
+        return err
+    }
+    x.bytes += size
+
+    dir, base := path.Split(entryPath)
+    src := &sourceReader{r: body}
+    file, err := x.e.store.Put(ctx, x.user, PutRequest{
+        Folder:   path.Join(x.folder, dir),
+        FileName: base,
+        FileType: typeByName(base),
+        Size:     size,
+        Body:     src,
+    })
+    if err != nil {
+        if src.err != nil {
+            return x.formatError(src.err)
+        }
+        if errors.Is(err, errBodyTooLong) {
+            return Permanent(fmt.Errorf("entry %q is larger than its header declares", name))
+        }
+        var appErr *apperr.Error
+        if errors.As(err, &appErr) && appErr.Status < 500 {
+            return Permanent(fmt.Errorf("entry %q: %w", name, err))
+        }
+        return fmt.Errorf("entry %q: %w", name, err)
+    }
+    x.created = append(x.created, file)
+    x.report(ctx, "")
+    return nil
+}
+
+// checkLimits fails the job once entries or the unpacked size exceed the
+// limits.
+func (x *extraction) checkLimits(entries int, unpacked int64) error {
+    limits := x.e.limits
+    if limits.MaxEntries > 0 && entries > limits.MaxEntries {
+        return Permanent(fmt.Errorf("archive has more than %d entries", limits.MaxEntries))
+    }
+    if limits.MaxTotalSize > 0 && unpacked > limits.MaxTotalSize {
+        return Permanent(fmt.Errorf("archive unpacks to more than %d bytes", limits.MaxTotalSize))
+    }
+    if limits.MaxRatio > 0 && float64(unpacked) > limits.MaxRatio*x.archive.Size && unpacked > extractReadAhead {
+        return Permanent(fmt.Errorf("archive unpacks to more than %.0f times its size", limits.MaxRatio))
+    }
+    return nil
+}
+
+// checkEntry fails a ZIP entry that expands more than MaxRatio times.
+// Entries up to extractReadAhead are let through whatever their ratio.
+func (l ExtractLimits) checkEntry(name string, compressed, uncompressed uint64) error {
+    if l.MaxRatio > 0 && compressed > 0 && float64(uncompressed) > l.MaxRatio*float64(compressed) && uncompressed > extractReadAhead {
+        return Permanent(fmt.Errorf("entry %q expands %d times, more than the limit of %.0f", name, uncompressed/compressed, l.MaxRatio))
+    }
+    return nil
+}
+
+func (x *extraction) report(ctx context.Context, message string) {
+    progress := models.JobProgress{
+        Done:    int64(len(x.created)),
+        Total:   int64(x.total),
+        Bytes:   x.bytes,
+        Message: message,
+    }
+    if err := x.e.store.jobQueue.ReportProgress(ctx, x.job, progress); err != nil {
+        log.Printf("Failed to record progress of job %s: %v", x.job.ID.Hex(), err)
+    }
+}
+
+// rollback removes the files created by a failed extraction, so a retry
+// starts from scratch.
+func (x *extraction) rollback(ctx context.Context) {
+    ctx = context.WithoutCancel(ctx)
+    for _, file := range x.created {
+        if err := x.e.store.Delete(ctx, file); err != nil {
+            log.Printf("Failed to remove %s after a failed extraction: %v", file.ID.Hex(), err)
+        }
+    }
+    x.created = nil
+}
+
+// formatError makes errors caused by a corrupt archive permanent; anything
+// else may be a storage hiccup and is retried.
+func (x *extraction) formatError(err error) error {
+    var corrupt flate.CorruptInputError
+    if errors.Is(err, zip.ErrFormat) || errors.Is(err, zip.ErrAlgorithm) || errors.Is(err, zip.ErrChecksum) ||
+        errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, tar.ErrHeader) ||
+        errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &corrupt) {
+        return Permanent(fmt.Errorf("%s is not a valid archive: %w", x.archive.FileName, err))
+    }
+    return err
+}
+
+// sourceReader records the first error reading an entry, to tell a corrupt
+// archive apart from a failure storing the entry.
+type sourceReader struct {
+    r   io.Reader
+    err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+    n, err := s.r.Read(p)
+    if err != nil && err != io.EOF && s.err == nil {
+        s.err = err
+    }
+    return n, err
+}
+
+// objectReaderAt gives archive/zip random access to a stored file. Reads
+// are served from a window fetched with one range request, which keeps the
+// mostly sequential reads of an extraction cheap.
+type objectReaderAt struct {
+    ctx     context.Context
+    storage *StorageService
+    file    *models.FileMinIO
+    buf     []byte
+    bufOff  int64
+}
+
+func (o *objectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+    size := int64(o.file.Size)
+    n := 0
+    for n < len(p) {
+        pos := off + int64(n)
+        if pos >= size {
+            return n, io.EOF
+        }
+        if pos < o.bufOff || pos >= o.bufOff+int64(len(o.buf)) {
+            if err := o.fill(pos, size); err != nil {
+                return n, err
+            }
+        }
+        n += copy(p[n:], o.buf[pos-o.bufOff:])
+    }
+    return n, nil
+}
+
+func (o *objectReaderAt) fill(pos, size int64) error {
+    length := int64(extractReadAhead)
+    if pos+length > size {
+        length = size - pos
+    }
+    r, err := o.storage.OpenRange(o.ctx, o.file, pos, length)
+    if err != nil {
+        return err
+    }
+    defer r.Close()
+    if cap(o.buf) < int(length) {
+        o.buf = make([]byte, length)
+    }
+    o.buf = o.buf[:length]
+    if _, err := io.ReadFull(r, o.buf); err != nil {
+        o.buf = o.buf[:0]
+        return err
+    }
+    o.bufOff = pos
+    return nil
+}
+
+func archiveFormatOf(file *models.FileMinIO) (archiveFormat, bool) {
+    name := strings.ToLower(file.FileName)
+    switch {
+    case strings.HasSuffix(name, ".zip"):
+        return formatZip, true
+    case strings.HasSuffix(name, ".tar"):
+        return formatTar, true
+    case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+        return formatTarGz, true
+    }
+    switch file.FileType {
+    case "application/zip", "application/x-zip-compressed":
+        return formatZip, true
+    case "application/x-tar":
+        return formatTar, true
+    }
+    return 0, false
+}
+
+func trimArchiveExt(name string) string {
+    lower := strings.ToLower(name)
+    for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+        if strings.HasSuffix(lower, ext) {
+            return name[:len(name)-len(ext)]
+        }
+    }
+    return name
+}
+
+// safeEntryPath returns the cleaned relative path of an archive entry, or
+// false when the entry is absolute or climbs out with "..".
+func safeEntryPath(name string) (string, bool) {
+    name = strings.ReplaceAll(name, "\\", "/")
+    if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+        return "", false
+    }
+    for _, segment := range strings.Split(name, "/") {
+        if segment == ".." {
+            return "", false
+        }
+    }
+    cleaned := path.Clean(name)
+    if cleaned == "." || strings.HasSuffix(name, "/") {
+        return "", false
+    }
+    return cleaned, true
+}
+
+func typeByName(name string) string {
+    if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+        if mediaType, _, err := mime.ParseMediaType(t); err == nil {
+            return mediaType
+        }
+    }
+    return "application/octet-stream"
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestSafeEntryPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"report.pdf", "report.pdf", true},
+		{"docs/2024/report.pdf", "docs/2024/report.pdf", true},
+		{"./docs//report.pdf", "docs/report.pdf", true},
+		{"docs\\report.pdf", "docs/report.pdf", true},
+		{"...", "...", true},
+		{"../etc/passwd", "", false},
+		{"docs/../../etc/passwd", "", false},
+		{"docs/../report.pdf", "", false},
+		{"..\\..\\windows\\win.ini", "", false},
+		{"..", "", false},
+		{"/etc/passwd", "", false},
+		{"\\etc\\passwd", "", false},
+		{"C:\\Windows\\win.ini", "", false},
+		{"c:report.pdf", "", false},
+		{"docs/", "", false},
+		{".", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := safeEntryPath(tt.name)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("safeEntryPath(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestExtractCheckLimits(t *testing.T) {
+	const mib = 1024 * 1024
+	limits := ExtractLimits{MaxEntries: 100, MaxTotalSize: 1024 * mib, MaxRatio: 100}
+	tests := []struct {
+		name        string
+		limits      ExtractLimits
+		archiveSize float64
+		entries     int
+		unpacked    int64
+		wantErr     bool
+	}{
+		{"within limits", limits, 10 * mib, 100, 500 * mib, false},
+		{"too many entries", limits, 10 * mib, 101, 1, true},
+		{"too large", limits, 100 * mib, 1, 1024*mib + 1, true},
+		{"high ratio", limits, 1 * mib, 1, 101 * mib, true},
+		{"high ratio below the read-ahead", limits, 1024, 1, extractReadAhead, false},
+		{"no limits", ExtractLimits{}, 1, 1 << 20, 1 << 40, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x := &extraction{e: &Extractor{limits: tt.limits}, archive: &models.FileMinIO{Size: tt.archiveSize}}
+			err := x.checkLimits(tt.entries, tt.unpacked)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkLimits() = %v, wantErr %v", err, tt.wantErr)
+			}
+			var permanent *permanentError
+			if err != nil && !errors.As(err, &permanent) {
+				t.Errorf("checkLimits() = %v, want a permanent error", err)
+			}
+		})
+	}
+}
+
+func TestExtractCheckEntry(t *testing.T) {
+	const mib = 1024 * 1024
+	limits := ExtractLimits{MaxRatio: 100}
+	tests := []struct {
+		name         string
+		limits       ExtractLimits
+		compressed   uint64
+		uncompressed uint64
+		wantErr      bool
+	}{
+		{"normal", limits, 10 * mib, 30 * mib, false},
+		{"zip bomb", limits, 1 * mib, 1024 * mib, true},
+		{"small but highly compressed", limits, 10, extractReadAhead, false},
+		{"stored empty file", limits, 0, 0, false},
+		{"ratio check off", ExtractLimits{}, 1 * mib, 1024 * mib, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.checkEntry("bomb.bin", tt.compressed, tt.uncompressed)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkEntry() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestArchiveFormatOf(t *testing.T) {
+	tests := []struct {
+		fileName string
+		fileType string
+		want     archiveFormat
+		wantOK   bool
+	}{
+		{"photos.zip", "", formatZip, true},
+		{"backup.TAR.GZ", "", formatTarGz, true},
+		{"backup.tgz", "", formatTarGz, true},
+		{"backup.tar", "", formatTar, true},
+		{"download", "application/zip", formatZip, true},
+		{"notes.txt", "text/plain", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := archiveFormatOf(&models.FileMinIO{FileName: tt.fileName, FileType: tt.fileType})
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("archiveFormatOf(%q, %q) = %v, %v, want %v, %v", tt.fileName, tt.fileType, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
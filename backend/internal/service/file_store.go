@@ -0,0 +1,340 @@
+// internal/service/file_store.go
+package service
+
+import (
+    "context"
+    "crypto/md5"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "path"
+    "time"
+
+    "backend/internal/models"
+    "backend/internal/repository"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultStoreChunkSize is the chunk size used for content that arrives
+// through the server rather than through presigned chunk URLs.
+const defaultStoreChunkSize = 8 * 1024 * 1024
+
+var errBodyTooLong = errors.New("request body is longer than the declared size")
+
+// FileStore writes, reads and removes files for front ends that receive the
+// content themselves (/upload-chunk, tus, the S3 gateway, WebDAV). Files end
+// up exactly like browser uploads: the same metadata, quota accounting, chunk
+// layout and post-upload jobs.
+type FileStore struct {
+    minioRepo   *repository.MinIOFileRepository
+    userRepo    *repository.UserRepository
+    planService *PlanService
+    storage     *StorageService
+    jobQueue    *JobQueue
+    limits      UploadLimits
+}
+
+func NewFileStore(minioRepo *repository.MinIOFileRepository, userRepo *repository.UserRepository, planService *PlanService, storage *StorageService, jobQueue *JobQueue, limits UploadLimits) *FileStore {
+    return &FileStore{
+        minioRepo:   minioRepo,
+        userRepo:    userRepo,
+        planService: planService,
+        storage:     storage,
+        jobQueue:    jobQueue,
+        limits:      limits,
+    }
+}
+
+// Storage returns the chunk storage the files live in.
+func (s *FileStore) Storage() *StorageService {
+    return s.storage
+}
+
+// PutRequest describes a file to store. ETag is computed as the MD5 of the
+// content when left empty, and a new ID is generated when ID is zero.
+type PutRequest struct {
+    ID       primitive.ObjectID
+    Folder   string
+    FileName string
+    FileType string
+    Size     int64
+    Body     io.Reader
+    ETag     string
+}
+
+// Put stores a new file. The upload limits, the user's plan and quota are
+// checked before anything is written; on failure everything written so far
+// is removed again.
+func (s *FileStore) Put(ctx context.Context, user *models.User, req PutRequest) (*models.FileMinIO, error) {
+    file, err := s.reserve(ctx, user, req, s.chunkSizeFor(req.Size), nil)
+    if err != nil {
+        return nil, err
+    }
+
+    etag, err := s.writeChunks(ctx, file, req.Body)
+    if err == nil && req.ETag != "" {
+        etag = req.ETag
+    }
+    if err == nil {
+        err = s.minioRepo.UpdateETag(ctx, file.ID.Hex(), etag)
+    }
+    if err == nil {
+        file.ETag = etag
+        err = s.finish(ctx, file)
+    }
+    if err != nil {
+        if cleanupErr := s.Delete(context.WithoutCancel(ctx), file); cleanupErr != nil {
+            log.Printf("Failed to clean up partial file %s: %v", file.ID.Hex(), cleanupErr)
+        }
+        return nil, err
+    }
+    return file, nil
+}
+
+// reserve checks the upload limits, the user's plan and quota, charges the
+// size to the quota and creates the incomplete file record, split into
+// chunks of chunkSize. expiresAt is only set for resumable uploads.
+func (s *FileStore) reserve(ctx context.Context, user *models.User, req PutRequest, chunkSize int64, expiresAt *time.Time) (*models.FileMinIO, error) {
+    totalChunks := int(ExpectedChunks(req.Size, chunkSize))
+    if verr := s.limits.Validate(UploadRequest{
+        FileName:    req.FileName,
+        Folder:      req.Folder,
+        FileSize:    float64(req.Size),
+        ChunkSize:   chunkSize,
+        TotalChunks: totalChunks,
+    }); verr != nil {
+        return nil, verr
+    }
+    if err := s.planService.CheckUpload(ctx, user, float64(req.Size), req.FileType); err != nil {
+        return nil, err
+    }
+    if err := s.userRepo.CheckUserStorageLimit(ctx, user.UserID, float64(req.Size)); err != nil {
+        return nil, err
+    }
+
+    folder, _ := CleanFolder(req.Folder)
+    now := time.Now()
+    if req.ID.IsZero() {
+        req.ID = primitive.NewObjectID()
+    }
+    file := &models.FileMinIO{
+        ID:              req.ID,
+        UserID:          user.UserID,
+        FileName:        req.FileName,
+        FileType:        req.FileType,
+        Folder:          folder,
+        Size:            float64(req.Size),
+        TotalChunks:     totalChunks,
+        ChunkSize:       chunkSize,
+        CreatedAt:       now,
+        UpdatedAt:       now,
+        BucketName:      s.storage.Bucket(),
+        UploadExpiresAt: expiresAt,
+    }
+    if err := s.minioRepo.CreateFile_MinIO(ctx, file); err != nil {
+        s.userRepo.DecreaseUsedStorage(context.WithoutCancel(ctx), user.UserID, file.Size)
+        return nil, err
+    }
+    return file, nil
+}
+
+// ReserveStorage charges size bytes to user's quota for content that isn't
+// a file yet, such as S3 multipart parts, or returns
+// repository.ErrStorageLimitExceeded.
+func (s *FileStore) ReserveStorage(ctx context.Context, user *models.User, size int64) error {
+    return s.userRepo.CheckUserStorageLimit(ctx, user.UserID, float64(size))
+}
+
+// ReleaseStorage returns size bytes charged with ReserveStorage. A
+// negative size charges them again regardless of the limit.
+func (s *FileStore) ReleaseStorage(ctx context.Context, userID string, size int64) {
+    if size == 0 {
+        return
+    }
+    if err := s.userRepo.DecreaseUsedStorage(context.WithoutCancel(ctx), userID, float64(size)); err != nil {
+        log.Printf("Failed to release %d bytes of storage of user %s: %v", size, userID, err)
+    }
+}
+
+// finish marks a file whose chunks are all stored as complete and queues
+// the post-upload jobs, as CompleteMinIOUpload does for browser uploads.
+func (s *FileStore) finish(ctx context.Context, file *models.FileMinIO) error {
+    completed, err := s.minioRepo.MarkFileComplete_MinIO(ctx, file.ID.Hex())
+    if err != nil {
+        return err
+    }
+    file.Complete = true
+    if !completed {
+        return nil
+    }
+
+    if err := EnqueueForCompletedUpload(ctx, s.jobQueue, file); err != nil {
+        log.Printf("Failed to enqueue post-upload jobs for %s: %v", file.ID.Hex(), err)
+    }
+    return nil
+}
+
+// chunkSizeFor picks the default chunk size, within the configured bounds,
+// grown when needed to stay under the chunk count limit.
+func (s *FileStore) chunkSizeFor(size int64) int64 {
+    chunkSize := int64(defaultStoreChunkSize)
+    if chunkSize < s.limits.MinChunkSize {
+        chunkSize = s.limits.MinChunkSize
+    }
+    if s.limits.MaxChunkSize > 0 && chunkSize > s.limits.MaxChunkSize {
+        chunkSize = s.limits.MaxChunkSize
+    }
+    if s.limits.MaxChunks > 0 && ExpectedChunks(size, chunkSize) > int64(s.limits.MaxChunks) {
+        chunkSize = (size + int64(s.limits.MaxChunks) - 1) / int64(s.limits.MaxChunks)
+    }
+    return chunkSize
+}
+
+// writeChunks splits body into the file's chunks and returns the MD5 of the
+// content. body must end exactly after file.Size bytes; a reader that fails
+// at EOF (e.g. a checksum mismatch) fails the write.
+func (s *FileStore) writeChunks(ctx context.Context, file *models.FileMinIO, body io.Reader) (string, error) {
+    sum := md5.New()
+    body = io.TeeReader(body, sum)
+
+    remaining := int64(file.Size)
+    for i := 0; i < file.TotalChunks; i++ {
+        n := file.ChunkSize
+        if remaining < n {
+            n = remaining
+        }
+        if err := s.storage.PutChunk(ctx, file.ID.Hex(), i, io.LimitReader(body, n), n); err != nil {
+            return "", err
+        }
+        remaining -= n
+    }
+
+    var extra [1]byte
+    n, err := io.ReadFull(body, extra[:])
+    if n > 0 {
+        return "", errBodyTooLong
+    }
+    if err != io.EOF {
+        return "", err
+    }
+    return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// Open returns a reader over length bytes of file starting at offset.
+func (s *FileStore) Open(ctx context.Context, file *models.FileMinIO, offset, length int64) (io.ReadCloser, error) {
+    return s.storage.OpenRange(ctx, file, offset, length)
+}
+
+// Delete removes a file's objects and metadata and gives its size back to
+// the owner's quota.
+func (s *FileStore) Delete(ctx context.Context, file *models.FileMinIO) error {
+    fileID := file.ID.Hex()
+    if err := s.storage.RemoveFileObjects(ctx, fileID); err != nil {
+        return err
+    }
+    if err := s.minioRepo.DeleteMinIOFile(ctx, fileID); err != nil {
+        return err
+    }
+    if err := s.userRepo.DecreaseUsedStorage(ctx, file.UserID, file.Size); err != nil {
+        log.Printf("Failed to decrement storage of %s: %v", file.UserID, err)
+    }
+    return nil
+}
+
+// Lookup returns the current file at folder/name.
+func (s *FileStore) Lookup(ctx context.Context, user *models.User, folder, name string) (*models.FileMinIO, error) {
+    files, err := s.minioRepo.FindByPath(ctx, user.UserID, folder, name)
+    if err != nil {
+        return nil, err
+    }
+    if len(files) == 0 {
+        return nil, repository.ErrFileNotFound
+    }
+    return &files[0], nil
+}
+
+// Replace stores a new file at folder/name and then removes the files that
+// were there before, so the path refers to the new content only.
+func (s *FileStore) Replace(ctx context.Context, user *models.User, req PutRequest) (*models.FileMinIO, error) {
+    folder, _ := CleanFolder(req.Folder)
+    previous, err := s.minioRepo.FindByPath(ctx, user.UserID, folder, req.FileName)
+    if err != nil {
+        return nil, err
+    }
+
+    file, err := s.Put(ctx, user, req)
+    if err != nil {
+        return nil, err
+    }
+    for i := range previous {
+        if err := s.Delete(ctx, &previous[i]); err != nil {
+            return file, fmt.Errorf("stored %s but failed to remove the previous version: %w", path.Join(folder, req.FileName), err)
+        }
+    }
+    return file, nil
+}
+
+// RemovePath deletes every file at folder/name. It reports
+// repository.ErrFileNotFound when there is none.
+func (s *FileStore) RemovePath(ctx context.Context, user *models.User, folder, name string) error {
+    files, err := s.minioRepo.FindByPath(ctx, user.UserID, folder, name)
+    if err != nil {
+        return err
+    }
+    if len(files) == 0 {
+        return repository.ErrFileNotFound
+    }
+    for i := range files {
+        if err := s.Delete(ctx, &files[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// ListTree returns the complete files below folder, ordered by folder, name
+// and newest first.
+func (s *FileStore) ListTree(ctx context.Context, user *models.User, folder string) ([]models.FileMinIO, error) {
+    return s.minioRepo.ListTree(ctx, user.UserID, folder)
+}
+
+// FolderExists reports whether folder holds any file, directly or below.
+func (s *FileStore) FolderExists(ctx context.Context, user *models.User, folder string) (bool, error) {
+    return s.minioRepo.HasFolder(ctx, user.UserID, folder)
+}
+
+// Move renames the file at folder/name, with all its versions, to
+// newFolder/newName. Content isn't copied; only the metadata changes.
+func (s *FileStore) Move(ctx context.Context, user *models.User, folder, name, newFolder, newName string) error {
+    moved, err := s.minioRepo.MovePath(ctx, user.UserID, folder, name, newFolder, newName)
+    if err != nil {
+        return err
+    }
+    if moved == 0 {
+        return repository.ErrFileNotFound
+    }
+    return nil
+}
+
+// MoveFolder moves every file below folder to the same place below
+// newFolder.
+func (s *FileStore) MoveFolder(ctx context.Context, user *models.User, folder, newFolder string) error {
+    return s.minioRepo.MoveFolder(ctx, user.UserID, folder, newFolder)
+}
+
+// RemoveTree deletes every file in folder and its subfolders.
+func (s *FileStore) RemoveTree(ctx context.Context, user *models.User, folder string) error {
+    files, err := s.minioRepo.ListTree(ctx, user.UserID, folder)
+    if err != nil {
+        return err
+    }
+    for i := range files {
+        if err := s.Delete(ctx, &files[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
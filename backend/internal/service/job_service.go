@@ -0,0 +1,292 @@
+// internal/service/job_service.go
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "sync"
+    "time"
+
+    "backend/internal/models"
+    "backend/internal/repository"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobHandlerFunc processes a single job. Returning an error schedules a
+// retry with exponential backoff; wrap it with Permanent to dead-letter the
+// job immediately.
+type JobHandlerFunc func(ctx context.Context, job *models.Job) error
+
+// JobQueueOptions tunes the worker pool.
+type JobQueueOptions struct {
+    Workers       int
+    MaxAttempts   int
+    PollInterval  time.Duration
+    LeaseDuration time.Duration
+    BaseBackoff   time.Duration
+    MaxBackoff    time.Duration
+}
+
+// DefaultJobQueueOptions returns the options used when nothing is configured.
+func DefaultJobQueueOptions() JobQueueOptions {
+    return JobQueueOptions{
+        Workers:       4,
+        MaxAttempts:   5,
+        PollInterval:  2 * time.Second,
+        LeaseDuration: 5 * time.Minute,
+        BaseBackoff:   10 * time.Second,
+        MaxBackoff:    30 * time.Minute,
+    }
+}
+
+type permanentError struct {
+    err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+    if err == nil {
+        return nil
+    }
+    return &permanentError{err: err}
+}
+
+// JobQueue is a MongoDB-backed job queue with a pool of polling workers.
+type JobQueue struct {
+    repo     *repository.JobRepository
+    opts     JobQueueOptions
+    workerID string
+
+    mu       sync.RWMutex
+    handlers map[string]JobHandlerFunc
+
+    cancel context.CancelFunc
+    wg     sync.WaitGroup
+}
+
+// NewJobQueue creates a job queue. Handlers must be registered before Start.
+func NewJobQueue(repo *repository.JobRepository, opts JobQueueOptions) *JobQueue {
+    defaults := DefaultJobQueueOptions()
+    if opts.Workers <= 0 {
+        opts.Workers = defaults.Workers
+    }
+    if opts.MaxAttempts <= 0 {
+        opts.MaxAttempts = defaults.MaxAttempts
+    }
+    if opts.PollInterval <= 0 {
+        opts.PollInterval = defaults.PollInterval
+    }
+    if opts.LeaseDuration <= 0 {
+        opts.LeaseDuration = defaults.LeaseDuration
+    }
+    if opts.BaseBackoff <= 0 {
+        opts.BaseBackoff = defaults.BaseBackoff
+    }
+    if opts.MaxBackoff <= 0 {
+        opts.MaxBackoff = defaults.MaxBackoff
+    }
+
+    hostname, _ := os.Hostname()
+    return &JobQueue{
+        repo:     repo,
+        opts:     opts,
+        workerID: fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), primitive.NewObjectID().Hex()),
+        handlers: make(map[string]JobHandlerFunc),
+    }
+}
+
+// Register associates a handler with a job type.
+func (q *JobQueue) Register(jobType string, handler JobHandlerFunc) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    q.handlers[jobType] = handler
+}
+
+// Enqueue adds a job that becomes runnable immediately.
+func (q *JobQueue) Enqueue(ctx context.Context, jobType string, payload map[string]string) (*models.Job, error) {
+    return q.EnqueueAt(ctx, jobType, payload, time.Now())
+}
+
+// EnqueueAt adds a job that becomes runnable at runAt.
+func (q *JobQueue) EnqueueAt(ctx context.Context, jobType string, payload map[string]string, runAt time.Time) (*models.Job, error) {
+    now := time.Now()
+    job := &models.Job{
+        ID:          primitive.NewObjectID(),
+        Type:        jobType,
+        Payload:     payload,
+        Status:      models.JobPending,
+        MaxAttempts: q.opts.MaxAttempts,
+        RunAt:       runAt,
+        CreatedAt:   now,
+        UpdatedAt:   now,
+    }
+    if err := q.repo.Enqueue(ctx, job); err != nil {
+        return nil, err
+    }
+    return job, nil
+}
+
+// Start launches the worker pool. Workers run until Stop is called or ctx
+// is cancelled.
+func (q *JobQueue) Start(ctx context.Context) {
+    ctx, q.cancel = context.WithCancel(ctx)
+    for i := 0; i < q.opts.Workers; i++ {
+        q.wg.Add(1)
+        go q.worker(ctx, i)
+    }
+    log.Printf("Job queue started with %d workers (%s)", q.opts.Workers, q.workerID)
+}
+
+// Stop signals the workers to finish and waits for in-flight jobs, or until
+// ctx expires. Jobs still running when ctx expires keep their lease and are
+// picked up again once it runs out.
+func (q *JobQueue) Stop(ctx context.Context) error {
+    if q.cancel == nil {
+        return nil
+    }
+    q.cancel()
+
+    done := make(chan struct{})
+    go func() {
+        q.wg.Wait()
+        close(done)
+    }()
+
+    select {
+    case <-done:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+func (q *JobQueue) worker(ctx context.Context, n int) {
+    defer q.wg.Done()
+    owner := fmt.Sprintf("%s/%d", q.workerID, n)
+
+    for {
+        if ctx.Err() != nil {
+            return
+        }
+
+        job, err := q.repo.ClaimNext(ctx, owner, q.opts.LeaseDuration)
+        if err != nil && ctx.Err() == nil {
+            log.Printf("Job worker %s: %v", owner, err)
+        }
+        if job == nil {
+            select {
+            case <-ctx.Done():
+                return
+            case <-time.After(q.opts.PollInterval):
+            }
+            continue
+        }
+
+        q.process(ctx, owner, job)
+    }
+}
+
+func (q *JobQueue) process(ctx context.Context, owner string, job *models.Job) {
+    q.mu.RLock()
+    handler, ok := q.handlers[job.Type]
+    q.mu.RUnlock()
+
+    var err error
+    if !ok {
+        err = Permanent(fmt.Errorf("no handler registered for job type %q", job.Type))
+    } else {
+        jobCtx, cancel := context.WithTimeout(context.Background(), q.opts.LeaseDuration)
+        err = q.run(jobCtx, handler, job)
+        cancel()
+    }
+
+    // Record the outcome even if the pool is shutting down.
+    recordCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if err == nil {
+        if err := q.repo.MarkSucceeded(recordCtx, job.ID, owner); err != nil {
+            log.Printf("Failed to mark job %s succeeded: %v", job.ID.Hex(), err)
+        }
+        return
+    }
+
+    retryAt := q.retryAt(job, err, time.Now())
+    if retryAt == nil {
+        log.Printf("Job %s (%s) dead-lettered after %d attempt(s): %v", job.ID.Hex(), job.Type, job.Attempts, err)
+    } else {
+        log.Printf("Job %s (%s) failed, retrying at %s: %v", job.ID.Hex(), job.Type, retryAt.Format(time.RFC3339), err)
+    }
+
+    if err := q.repo.MarkFailed(recordCtx, job.ID, owner, err.Error(), retryAt); err != nil {
+        log.Printf("Failed to record failure of job %s: %v", job.ID.Hex(), err)
+    }
+}
+
+// retryAt returns when job, which failed with err, runs again, or nil to
+// dead-letter it: err is Permanent or the job is out of attempts.
+func (q *JobQueue) retryAt(job *models.Job, err error, now time.Time) *time.Time {
+    var permanent *permanentError
+    if errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts {
+        return nil
+    }
+    next := now.Add(q.backoff(job.Attempts))
+    return &next
+}
+
+// run invokes handler, turning a panic into an error so one bad job can't
+// take down the worker.
+func (q *JobQueue) run(ctx context.Context, handler JobHandlerFunc, job *models.Job) (err error) {
+    defer func() {
+        if r := recover(); r != nil {
+            err = fmt.Errorf("job panicked: %v", r)
+        }
+    }()
+    return handler(ctx, job)
+}
+
+// backoff returns BaseBackoff * 2^(attempts-1), capped at MaxBackoff.
+func (q *JobQueue) backoff(attempts int) time.Duration {
+    delay := q.opts.BaseBackoff
+    for i := 1; i < attempts; i++ {
+        delay *= 2
+        if delay >= q.opts.MaxBackoff {
+            return q.opts.MaxBackoff
+        }
+    }
+    return delay
+}
+
+// ListJobs returns recent jobs filtered by status and type.
+func (q *JobQueue) ListJobs(ctx context.Context, status, jobType string, limit int64) ([]models.Job, error) {
+    return q.repo.List(ctx, status, jobType, limit)
+}
+
+// GetJob returns a single job.
+func (q *JobQueue) GetJob(ctx context.Context, jobID string) (*models.Job, error) {
+    return q.repo.GetByID(ctx, jobID)
+}
+
+// ReportProgress records the progress of job, which must be the job a
+// handler is running.
+func (q *JobQueue) ReportProgress(ctx context.Context, job *models.Job, progress models.JobProgress) error {
+    job.Progress = &progress
+    return q.repo.SetProgress(ctx, job.ID, job.LeaseOwner, progress)
+}
+
+// RetryJob requeues a dead-lettered job.
+func (q *JobQueue) RetryJob(ctx context.Context, jobID string) error {
+    return q.repo.Requeue(ctx, jobID)
+}
+
+// Stats returns the number of jobs per status.
+func (q *JobQueue) Stats(ctx context.Context) (map[string]int64, error) {
+    return q.repo.CountByStatus(ctx)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+)
+
+func TestJobQueueBackoff(t *testing.T) {
+	q := NewJobQueue(nil, JobQueueOptions{BaseBackoff: 10 * time.Second, MaxBackoff: time.Minute})
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{30, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := q.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestJobQueueRetryAt(t *testing.T) {
+	q := NewJobQueue(nil, JobQueueOptions{MaxAttempts: 3, BaseBackoff: 10 * time.Second, MaxBackoff: time.Minute})
+	now := time.Now()
+	transient := errors.New("connection reset")
+	tests := []struct {
+		name     string
+		attempts int
+		err      error
+		want     time.Duration
+		dead     bool
+	}{
+		{"first failure", 1, transient, 10 * time.Second, false},
+		{"second failure", 2, transient, 20 * time.Second, false},
+		{"out of attempts", 3, transient, 0, true},
+		{"permanent", 1, Permanent(transient), 0, true},
+		{"wrapped permanent", 1, fmt.Errorf("compose: %w", Permanent(transient)), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &models.Job{Attempts: tt.attempts, MaxAttempts: 3}
+			got := q.retryAt(job, tt.err, now)
+			if tt.dead {
+				if got != nil {
+					t.Errorf("retryAt() = %v, want dead-lettered", got)
+				}
+				return
+			}
+			if got == nil || got.Sub(now) != tt.want {
+				t.Errorf("retryAt() = %v, want now+%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobQueueRunRecoversPanics(t *testing.T) {
+	q := NewJobQueue(nil, JobQueueOptions{})
+	err := q.run(context.Background(), func(context.Context, *models.Job) error {
+		panic("boom")
+	}, &models.Job{})
+	if err == nil {
+		t.Fatal("run() = nil, want the panic as an error")
+	}
+	if got := q.retryAt(&models.Job{Attempts: 1, MaxAttempts: 5}, err, time.Now()); got == nil {
+		t.Error("a panicking job was dead-lettered on its first attempt")
+	}
+}
+
+func TestUploadJobSelection(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      models.FileMinIO
+		thumbnail bool
+		compose   bool
+	}{
+		{"single chunk", models.FileMinIO{FileType: "text/plain", TotalChunks: 1, ChunkSize: composeMinPartSize}, false, false},
+		{"large chunks", models.FileMinIO{FileType: "image/png", TotalChunks: 3, ChunkSize: composeMinPartSize}, true, true},
+		{"small chunks", models.FileMinIO{FileType: "image/png", TotalChunks: 3, ChunkSize: 1024}, true, false},
+		{"unknown chunk size", models.FileMinIO{FileType: "video/mp4", TotalChunks: 3}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isThumbnailable(tt.file.FileType); got != tt.thumbnail {
+				t.Errorf("isThumbnailable() = %v, want %v", got, tt.thumbnail)
+			}
+			if got := isComposable(&tt.file); got != tt.compose {
+				t.Errorf("isComposable() = %v, want %v", got, tt.compose)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+// internal/service/login_guard.go
+package service
+
+import (
+    "context"
+    "errors"
+    "log"
+    "math"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+
+    "golang.org/x/crypto/bcrypt"
+)
+
+var (
+    ErrLoginThrottled  = apperr.New(http.StatusTooManyRequests, apperr.CodeLoginThrottled, "Too many failed login attempts, try again later")
+    ErrCaptchaRequired = apperr.New(http.StatusForbidden, apperr.CodeCaptchaRequired, "Solve the CAPTCHA to sign in")
+)
+
+// LoginPolicy tunes brute-force protection. Failures are counted per
+// client IP and per email, whether or not the email has an account, and
+// forgotten after Window without a new one. Past the free attempts, each
+// failure doubles the wait before the next attempt, from BaseDelay up to
+// MaxDelay.
+type LoginPolicy struct {
+    FreeAttempts   int
+    IPFreeAttempts int
+    BaseDelay      time.Duration
+    MaxDelay       time.Duration
+    Window         time.Duration
+    // CaptchaAfter failures an email needs a solved CAPTCHA instead of
+    // waiting; 0, or no verifier, keeps the delays
+    CaptchaAfter int
+    // AuditRetention is how long attempt records are kept
+    AuditRetention time.Duration
+}
+
+// delay is the wait after failures when free of them cost nothing.
+func (p LoginPolicy) delay(failures, free int) time.Duration {
+    if failures <= free {
+        return 0
+    }
+    delay := float64(p.BaseDelay) * math.Pow(2, float64(failures-free-1))
+    if delay > float64(p.MaxDelay) {
+        return p.MaxDelay
+    }
+    return time.Duration(delay)
+}
+
+// failureCounter is the part of LoginFailureRepository the guard uses.
+type failureCounter interface {
+    Get(ctx context.Context, key string, now time.Time) (int, time.Time, error)
+    Reserve(ctx context.Context, key string, failures int, lastFailedAt, now time.Time, window time.Duration) (bool, error)
+    Release(ctx context.Context, key string, reservedAt, lastFailedAt time.Time, window time.Duration) error
+    Reset(ctx context.Context, key string) error
+}
+
+// maxReserveTries bounds how often a reservation lost to concurrent
+// attempts on the same key is tried again.
+const maxReserveTries = 5
+
+// LoginGuard decides whether a sign-in attempt may be checked, records
+// its outcome and keeps the audit trail. Each attempt it lets through is
+// counted as a failure before the credentials are checked, so concurrent
+// attempts can't all pass the same check; attempts that don't fail are
+// refunded.
+type LoginGuard struct {
+    failures failureCounter
+    attempts *repository.LoginAttemptRepository
+    captcha  CaptchaVerifier
+    policy   LoginPolicy
+}
+
+// NewLoginGuard returns a guard. captcha may be nil.
+func NewLoginGuard(failures *repository.LoginFailureRepository, attempts *repository.LoginAttemptRepository, captcha CaptchaVerifier, policy LoginPolicy) *LoginGuard {
+    dummyHashOnce.Do(initDummyHash)
+    return &LoginGuard{failures: failures, attempts: attempts, captcha: captcha, policy: policy}
+}
+
+func ipKey(ip string) string {
+    return "ip:" + ip
+}
+
+func emailKey(email string) string {
+    return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func mfaKey(accountID string) string {
+    return "mfa:" + accountID
+}
+
+// reservation is the failures counted for an attempt before its
+// credentials were checked.
+type reservation struct {
+    guard *LoginGuard
+    keys  []reservedKey
+}
+
+type reservedKey struct {
+    key          string
+    at           time.Time
+    lastFailedAt time.Time
+}
+
+// refund takes the reserved failures back, for attempts that turned out
+// not to fail. A nil reservation has nothing to refund.
+func (r *reservation) refund(ctx context.Context) {
+    if r == nil {
+        return
+    }
+    for _, k := range r.keys {
+        if err := r.guard.failures.Release(ctx, k.key, k.at, k.lastFailedAt, r.guard.policy.Window); err != nil {
+            log.Printf("Failed to refund login failure: %v", err)
+        }
+    }
+}
+
+// check reserves a failure against the IP and the email. It returns
+// ErrLoginThrottled while either has to wait, and ErrCaptchaRequired when
+// the email needs a CAPTCHA that captchaToken doesn't solve; nothing is
+// reserved then. The outcome to audit is returned with the error.
+func (g *LoginGuard) check(ctx context.Context, email, ip, captchaToken string) (*reservation, string, error) {
+    res := &reservation{guard: g}
+    if err := g.reserve(ctx, res, ipKey(ip), g.policy.IPFreeAttempts, true); err != nil {
+        return nil, throttledOutcome(err), err
+    }
+
+    failures, _, err := g.failures.Get(ctx, emailKey(email), time.Now())
+    if err != nil {
+        res.refund(ctx)
+        return nil, "", err
+    }
+    // The CAPTCHA replaces the account delay, so others can't keep the
+    // owner waiting
+    needsCaptcha := g.captcha != nil && g.policy.CaptchaAfter > 0 && failures >= g.policy.CaptchaAfter
+    if needsCaptcha {
+        if outcome, err := g.solve(ctx, captchaToken, ip); err != nil {
+            res.refund(ctx)
+            return nil, outcome, err
+        }
+    }
+    if err := g.reserve(ctx, res, emailKey(email), g.policy.FreeAttempts, !needsCaptcha); err != nil {
+        res.refund(ctx)
+        return nil, throttledOutcome(err), err
+    }
+    return res, "", nil
+}
+
+// solve checks captchaToken, returning the outcome to audit when it fails.
+func (g *LoginGuard) solve(ctx context.Context, captchaToken, ip string) (string, error) {
+    if captchaToken == "" {
+        return models.LoginCaptchaRequired, ErrCaptchaRequired.WithDetails(map[string]interface{}{"siteKey": g.captcha.SiteKey()})
+    }
+    ok, err := g.captcha.Verify(ctx, captchaToken, ip)
+    if err != nil {
+        return "", apperr.ErrInternal.Wrap(err)
+    }
+    if !ok {
+        return models.LoginCaptchaFailed, ErrCaptchaRequired.WithMessage("CAPTCHA verification failed").
+            WithDetails(map[string]interface{}{"siteKey": g.captcha.SiteKey()})
+    }
+    return "", nil
+}
+
+func throttledOutcome(err error) string {
+    if errors.Is(err, ErrLoginThrottled) {
+        return models.LoginThrottled
+    }
+    return ""
+}
+
+// checkMFA is check for the second factor. Its failures are counted per
+// account rather than per email, since only someone who knew the password
+// got this far.
+func (g *LoginGuard) checkMFA(ctx context.Context, accountID, ip string) (*reservation, error) {
+    res := &reservation{guard: g}
+    if err := g.reserve(ctx, res, ipKey(ip), g.policy.IPFreeAttempts, true); err != nil {
+        return nil, err
+    }
+    if err := g.reserve(ctx, res, mfaKey(accountID), g.policy.FreeAttempts, true); err != nil {
+        res.refund(ctx)
+        return nil, err
+    }
+    return res, nil
+}
+
+// reserve counts a failure against key and adds it to res. With wait it
+// returns ErrLoginThrottled instead while the delay earned by key's
+// failures hasn't passed.
+func (g *LoginGuard) reserve(ctx context.Context, res *reservation, key string, free int, wait bool) error {
+    for try := 0; try < maxReserveTries; try++ {
+        now := time.Now().Truncate(time.Millisecond)
+        failures, last, err := g.failures.Get(ctx, key, now)
+        if err != nil {
+            return err
+        }
+        if delay := last.Add(g.policy.delay(failures, free)).Sub(now); wait && delay > 0 {
+            return throttled(delay)
+        }
+        reserved, err := g.failures.Reserve(ctx, key, failures, last, now, g.policy.Window)
+        if err != nil {
+            return err
+        }
+        if reserved {
+            res.keys = append(res.keys, reservedKey{key: key, at: now, lastFailedAt: last})
+            return nil
+        }
+    }
+    // Every try lost to another attempt on the same key
+    return throttled(time.Second)
+}
+
+func throttled(wait time.Duration) error {
+    return ErrLoginThrottled.WithDetails(map[string]interface{}{
+        "retryAfter": int(math.Ceil(wait.Seconds())),
+    })
+}
+
+// succeed forgets the user's failures. The IP's are kept, so signing in
+// to one's own account doesn't reset guessing at others.
+func (g *LoginGuard) succeed(ctx context.Context, user *models.User) {
+    for _, key := range []string{emailKey(user.Email), mfaKey(user.ID.Hex())} {
+        if err := g.failures.Reset(ctx, key); err != nil {
+            log.Printf("Failed to reset login failures: %v", err)
+        }
+    }
+}
+
+// Reset forgets the failures counted against user, ending any delay or
+// CAPTCHA requirement.
+func (g *LoginGuard) Reset(ctx context.Context, user *models.User) error {
+    for _, key := range []string{emailKey(user.Email), mfaKey(user.ID.Hex())} {
+        if err := g.failures.Reset(ctx, key); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (g *LoginGuard) audit(ctx context.Context, email, ip string, user *models.User, outcome string) {
+    now := time.Now()
+    attempt := &models.LoginAttempt{
+        Email:     strings.ToLower(strings.TrimSpace(email)),
+        IPAddress: ip,
+        Outcome:   outcome,
+        At:        now,
+        ExpiresAt: now.Add(g.policy.AuditRetention),
+    }
+    if user != nil {
+        attempt.UserID = user.UserID
+    }
+    if err := g.attempts.Insert(context.WithoutCancel(ctx), attempt); err != nil {
+        log.Printf("Failed to audit login attempt: %v", err)
+    }
+}
+
+// Attempts lists audit records, newest first.
+func (g *LoginGuard) Attempts(ctx context.Context, email, ip string, skip, limit int64) ([]models.LoginAttempt, int64, error) {
+    return g.attempts.List(ctx, strings.ToLower(strings.TrimSpace(email)), ip, skip, limit)
+}
+
+var (
+    dummyHashOnce sync.Once
+    dummyHash     []byte
+)
+
+// compareDummy spends as long as checking a real password, so unknown
+// emails can't be told apart by response time.
+func compareDummy(password string) {
+    dummyHashOnce.Do(initDummyHash)
+    bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+func initDummyHash() {
+    dummyHash, _ = bcrypt.GenerateFromPassword([]byte("storely-dummy-password"), bcrypt.DefaultCost)
+}
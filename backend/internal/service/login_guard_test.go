@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/internal/apperr"
+	"backend/internal/models"
+	"backend/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memoryFailures is a failureCounter with LoginFailureRepository's
+// semantics, Reserve included.
+type memoryFailures struct {
+	mu       sync.Mutex
+	counters map[string]*memoryCounter
+}
+
+type memoryCounter struct {
+	failures     int
+	lastFailedAt time.Time
+	expiresAt    time.Time
+}
+
+func newMemoryFailures() *memoryFailures {
+	return &memoryFailures{counters: make(map[string]*memoryCounter)}
+}
+
+func (m *memoryFailures) Get(_ context.Context, key string, now time.Time) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.counters[key]
+	if !ok || !now.Before(c.expiresAt) {
+		return 0, time.Time{}, nil
+	}
+	return c.failures, c.lastFailedAt, nil
+}
+
+func (m *memoryFailures) Reserve(_ context.Context, key string, failures int, lastFailedAt, now time.Time, window time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.counters[key]
+	if failures == 0 {
+		if ok && now.Before(c.expiresAt) && c.failures > 0 {
+			return false, nil
+		}
+		m.counters[key] = &memoryCounter{failures: 1, lastFailedAt: now, expiresAt: now.Add(window)}
+		return true, nil
+	}
+	if !ok || c.failures != failures || !c.lastFailedAt.Equal(lastFailedAt) || !now.Before(c.expiresAt) {
+		return false, nil
+	}
+	c.failures++
+	c.lastFailedAt, c.expiresAt = now, now.Add(window)
+	return true, nil
+}
+
+func (m *memoryFailures) Release(_ context.Context, key string, reservedAt, lastFailedAt time.Time, window time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.counters[key]
+	if !ok || c.failures <= 0 {
+		return nil
+	}
+	c.failures--
+	if c.lastFailedAt.Equal(reservedAt) {
+		c.lastFailedAt, c.expiresAt = lastFailedAt, lastFailedAt.Add(window)
+	}
+	return nil
+}
+
+func (m *memoryFailures) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.counters, key)
+	return nil
+}
+
+type stubCaptcha struct{}
+
+func (stubCaptcha) Verify(_ context.Context, token, _ string) (bool, error) {
+	return token == "solved", nil
+}
+
+func (stubCaptcha) SiteKey() string { return "site-key" }
+
+func newTestGuard(captcha CaptchaVerifier, policy LoginPolicy) *LoginGuard {
+	return &LoginGuard{failures: newMemoryFailures(), captcha: captcha, policy: policy}
+}
+
+func TestLoginPolicyDelay(t *testing.T) {
+	policy := LoginPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{40, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.delay(tt.failures, 3); got != tt.want {
+			t.Errorf("delay(%d, 3) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginGuardDelaysAfterFreeAttempts(t *testing.T) {
+	guard := newTestGuard(nil, LoginPolicy{FreeAttempts: 2, IPFreeAttempts: 100, BaseDelay: time.Hour, MaxDelay: time.Hour, Window: time.Hour})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := guard.check(ctx, "ada@example.com", "192.0.2.1", ""); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+	// A refunded attempt doesn't count
+	reserved, _, err := guard.check(ctx, "ada@example.com", "192.0.2.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved.refund(ctx)
+	if _, _, err := guard.check(ctx, "ada@example.com", "192.0.2.1", ""); err != nil {
+		t.Fatalf("attempt after refund: %v", err)
+	}
+
+	_, outcome, err := guard.check(ctx, "ADA@example.com ", "192.0.2.2", "")
+	if !errors.Is(err, ErrLoginThrottled) || outcome != models.LoginThrottled {
+		t.Fatalf("check() = %q, %v, want throttled", outcome, err)
+	}
+	var apiErr *apperr.Error
+	if !errors.As(err, &apiErr) || apiErr.Details["retryAfter"] != 3600 {
+		t.Errorf("details = %v, want retryAfter 3600", apiErr.Details)
+	}
+	if _, _, err := guard.check(ctx, "grace@example.com", "192.0.2.1", ""); err != nil {
+		t.Errorf("other email: %v", err)
+	}
+}
+
+func TestLoginGuardCountsPerIP(t *testing.T) {
+	guard := newTestGuard(nil, LoginPolicy{FreeAttempts: 100, IPFreeAttempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour, Window: time.Hour})
+	ctx := context.Background()
+
+	// Up to IPFreeAttempts failures cost nothing, so the attempt after
+	// them is free as well
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if _, _, err := guard.check(ctx, email, "192.0.2.1", ""); err != nil {
+			t.Fatalf("%s: %v", email, err)
+		}
+	}
+	if _, _, err := guard.check(ctx, "d@example.com", "192.0.2.1", ""); !errors.Is(err, ErrLoginThrottled) {
+		t.Errorf("fourth email from the IP: err = %v, want ErrLoginThrottled", err)
+	}
+	if _, _, err := guard.check(ctx, "d@example.com", "192.0.2.9", ""); err != nil {
+		t.Errorf("other IP: %v", err)
+	}
+	// The IP's failures hold back second factors too
+	if _, err := guard.checkMFA(ctx, "account", "192.0.2.1"); !errors.Is(err, ErrLoginThrottled) {
+		t.Errorf("MFA from the throttled IP: err = %v, want ErrLoginThrottled", err)
+	}
+}
+
+func TestLoginGuardReservesConcurrentAttempts(t *testing.T) {
+	guard := newTestGuard(nil, LoginPolicy{FreeAttempts: 2, IPFreeAttempts: 100, BaseDelay: time.Hour, MaxDelay: time.Hour, Window: time.Hour})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	passed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := guard.check(ctx, "ada@example.com", "192.0.2.1", ""); err == nil {
+				mu.Lock()
+				passed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// The two free failures and the one that earns the first delay
+	if passed != 3 {
+		t.Errorf("%d concurrent attempts passed, want 3", passed)
+	}
+}
+
+func TestLoginGuardCaptcha(t *testing.T) {
+	guard := newTestGuard(stubCaptcha{}, LoginPolicy{FreeAttempts: 2, IPFreeAttempts: 100, BaseDelay: time.Hour, MaxDelay: time.Hour, Window: time.Hour, CaptchaAfter: 2})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := guard.check(ctx, "ada@example.com", "192.0.2.1", ""); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+	tests := []struct {
+		name        string
+		token       string
+		wantOutcome string
+		wantErr     error
+	}{
+		{"no token", "", models.LoginCaptchaRequired, ErrCaptchaRequired},
+		{"wrong token", "guess", models.LoginCaptchaFailed, ErrCaptchaRequired},
+		// Solving it skips the delay the failures earned
+		{"solved", "solved", "", nil},
+		{"solved again", "solved", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, outcome, err := guard.check(ctx, "ada@example.com", "192.0.2.1", tt.token)
+			if outcome != tt.wantOutcome || !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("check() = %q, %v, want %q, %v", outcome, err, tt.wantOutcome, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Unknown emails are answered after a bcrypt comparison as costly as a
+// real one.
+func TestDummyHashCostMatchesPasswords(t *testing.T) {
+	dummyHashOnce.Do(initDummyHash)
+	hash, err := utils.HashPassword("hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := bcrypt.Cost(dummyHash); err != nil || got != want {
+		t.Errorf("dummy hash cost = %d (%v), want %d", got, err, want)
+	}
+}
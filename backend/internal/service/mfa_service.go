@@ -0,0 +1,269 @@
+// internal/service/mfa_service.go
+package service
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+    "backend/utils"
+    "backend/utils/crypto"
+)
+
+var (
+    ErrInvalidMFACode    = apperr.New(http.StatusUnauthorized, apperr.CodeInvalidMFACode, "Invalid two-factor code")
+    ErrInvalidMFAToken   = apperr.New(http.StatusUnauthorized, apperr.CodeInvalidToken, "Two-factor login expired, sign in again")
+    ErrMFAAlreadyEnabled = apperr.New(http.StatusConflict, apperr.CodeConflict, "Two-factor authentication is already enabled")
+    ErrMFANotEnabled     = apperr.New(http.StatusConflict, apperr.CodeConflict, "Two-factor authentication is not enabled")
+)
+
+const (
+    // mfaChallengeTTL is how long a login may take to supply its second
+    // factor
+    mfaChallengeTTL   = 5 * time.Minute
+    recoveryCodeCount = 10
+)
+
+// MFAStatus is what a user sees of their two-factor setup.
+type MFAStatus struct {
+    Enabled           bool `json:"enabled"`
+    RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+// MFAService manages TOTP two-factor authentication (RFC 6238) and the
+// second step of signing in. TOTP secrets are sealed before they are
+// stored; recovery codes are only kept hashed.
+type MFAService struct {
+    users  *repository.UserRepository
+    guard  *LoginGuard
+    sealer *crypto.Sealer
+    issuer string
+}
+
+func NewMFAService(users *repository.UserRepository, guard *LoginGuard, sealer *crypto.Sealer, issuer string) *MFAService {
+    return &MFAService{users: users, guard: guard, sealer: sealer, issuer: issuer}
+}
+
+func (s *MFAService) Status(user *models.User) MFAStatus {
+    return MFAStatus{Enabled: user.TOTPEnabled, RecoveryCodesLeft: len(user.RecoveryCodes)}
+}
+
+// Enroll starts enrollment with a new secret, replacing any unfinished
+// one. It returns the secret in base32 and as an otpauth:// URI; neither
+// is shown again.
+func (s *MFAService) Enroll(ctx context.Context, user *models.User) (string, string, error) {
+    if user.TOTPEnabled {
+        return "", "", ErrMFAAlreadyEnabled
+    }
+    secret, err := newTOTPSecret()
+    if err != nil {
+        return "", "", err
+    }
+    sealed, err := s.sealer.Seal(secret, user.UserID)
+    if err != nil {
+        return "", "", err
+    }
+    if err := s.users.SetPendingTOTP(ctx, user.UserID, sealed); err != nil {
+        return "", "", err
+    }
+    return totpEncoding.EncodeToString(secret), totpURI(s.issuer, user.Email, secret), nil
+}
+
+// Activate enables two-factor authentication once code proves the
+// authenticator app holds the enrolled secret. It returns the recovery
+// codes, which are only shown this once.
+func (s *MFAService) Activate(ctx context.Context, user *models.User, code string) ([]string, error) {
+    if user.TOTPEnabled {
+        return nil, ErrMFAAlreadyEnabled
+    }
+    if user.TOTPPendingSecret == "" {
+        return nil, repository.ErrTOTPNotPending
+    }
+    secret, err := s.sealer.Open(user.TOTPPendingSecret, user.UserID)
+    if err != nil {
+        return nil, apperr.ErrInternal.Wrap(err)
+    }
+    step, ok := verifyTOTP(secret, normalizeCode(code), time.Now())
+    if !ok {
+        return nil, ErrInvalidMFACode
+    }
+
+    codes, hashes, err := newRecoveryCodes()
+    if err != nil {
+        return nil, err
+    }
+    if err := s.users.ActivateTOTP(ctx, user.UserID, user.TOTPPendingSecret, step, hashes); err != nil {
+        return nil, err
+    }
+    return codes, nil
+}
+
+// Disable turns two-factor authentication off. The user proves it's them
+// with their password and a current code or recovery code.
+func (s *MFAService) Disable(ctx context.Context, user *models.User, password, code, ipAddress string, signedInAt time.Time) error {
+    if !user.TOTPEnabled {
+        return ErrMFANotEnabled
+    }
+    if err := checkPassword(user, password, signedInAt); err != nil {
+        return err
+    }
+    if err := s.prove(ctx, user, code, ipAddress); err != nil {
+        return err
+    }
+    return s.users.DisableTOTP(ctx, user.UserID)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, given a
+// current code.
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, user *models.User, code, ipAddress string) ([]string, error) {
+    if !user.TOTPEnabled {
+        return nil, ErrMFANotEnabled
+    }
+    if err := s.prove(ctx, user, code, ipAddress); err != nil {
+        return nil, err
+    }
+    codes, hashes, err := newRecoveryCodes()
+    if err != nil {
+        return nil, err
+    }
+    if err := s.users.SetRecoveryCodes(ctx, user.UserID, hashes); err != nil {
+        return nil, err
+    }
+    return codes, nil
+}
+
+// Challenge issues the token a login passes to CompleteLogin after the
+// password step.
+func (s *MFAService) Challenge(user *models.User) (string, error) {
+    return utils.GenerateMFAToken(user.ID.Hex(), user.SessionVersion, mfaChallengeTTL)
+}
+
+// CompleteLogin finishes a login started by UserService.HandleLoginAttempt
+// with a TOTP or recovery code. Wrong codes count as failed logins. A
+// challenge is spent by the first login it completes, and is void once the
+// account's sessions have been ended.
+func (s *MFAService) CompleteLogin(ctx context.Context, mfaToken, code, ipAddress string) (*models.User, error) {
+    challenge, err := utils.ValidateMFAToken(mfaToken)
+    if err != nil {
+        return nil, ErrInvalidMFAToken
+    }
+    user, err := s.users.FindByObjectID(ctx, challenge.AccountID)
+    if errors.Is(err, repository.ErrUserNotFound) {
+        return nil, ErrInvalidMFAToken
+    }
+    if err != nil {
+        return nil, err
+    }
+    if user.IsDisabled {
+        return nil, ErrAccountDisabled
+    }
+    if !user.TOTPEnabled || user.SessionVersion != challenge.SessionVersion {
+        // Turned off, or sessions ended, since the password step
+        return nil, ErrInvalidMFAToken
+    }
+
+    if err := s.prove(ctx, user, code, ipAddress); err != nil {
+        if errors.Is(err, ErrInvalidMFACode) {
+            s.guard.audit(ctx, user.Email, ipAddress, user, models.LoginMFAFailed)
+        }
+        return nil, err
+    }
+    fresh, err := s.users.UseMFAChallenge(ctx, user.UserID, challenge.ID, challenge.ExpiresAt)
+    if err != nil {
+        return nil, err
+    }
+    if !fresh {
+        return nil, ErrInvalidMFAToken
+    }
+
+    s.guard.succeed(ctx, user)
+    s.guard.audit(ctx, user.Email, ipAddress, user, models.LoginSucceeded)
+    if err := s.users.UpdateLoginStats(ctx, user.ID, ipAddress, true); err != nil {
+        log.Printf("Failed to update login stats: %v", err)
+    }
+    return user, nil
+}
+
+// prove is verify under the LoginGuard: wrong codes earn the account and
+// IP the same delays as wrong passwords.
+func (s *MFAService) prove(ctx context.Context, user *models.User, code, ipAddress string) error {
+    reserved, err := s.guard.checkMFA(ctx, user.ID.Hex(), ipAddress)
+    if err != nil {
+        return err
+    }
+    err = s.verify(ctx, user, code)
+    if !errors.Is(err, ErrInvalidMFACode) {
+        reserved.refund(ctx)
+    }
+    return err
+}
+
+// verify accepts a current TOTP code, each at most once, or an unused
+// recovery code, which is then spent.
+func (s *MFAService) verify(ctx context.Context, user *models.User, code string) error {
+    code = normalizeCode(code)
+    if len(code) == totpDigits {
+        secret, err := s.sealer.Open(user.TOTPSecret, user.UserID)
+        if err != nil {
+            return apperr.ErrInternal.Wrap(err)
+        }
+        step, ok := verifyTOTP(secret, code, time.Now())
+        if !ok {
+            return ErrInvalidMFACode
+        }
+        fresh, err := s.users.UseTOTPStep(ctx, user.UserID, step)
+        if err != nil {
+            return err
+        }
+        if !fresh {
+            return ErrInvalidMFACode
+        }
+        return nil
+    }
+
+    used, err := s.users.UseRecoveryCode(ctx, user.UserID, hashRecoveryCode(code))
+    if err != nil {
+        return err
+    }
+    if !used {
+        return ErrInvalidMFACode
+    }
+    return nil
+}
+
+// normalizeCode drops the spaces and dashes people type into codes.
+func normalizeCode(code string) string {
+    return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+// newRecoveryCodes returns codes like "k3m9q-x2w7p" and their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+    codes := make([]string, recoveryCodeCount)
+    hashes := make([]string, recoveryCodeCount)
+    raw := make([]byte, 10)
+    for i := range codes {
+        if _, err := rand.Read(raw); err != nil {
+            return nil, nil, apperr.ErrInternal.Wrap(err)
+        }
+        code := strings.ToLower(totpEncoding.EncodeToString(raw)[:10])
+        codes[i] = code[:5] + "-" + code[5:]
+        hashes[i] = hashRecoveryCode(code)
+    }
+    return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a normalized code. Codes are random enough that
+// a fast hash is safe.
+func hashRecoveryCode(code string) string {
+    sum := sha256.Sum256([]byte(code))
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,229 @@
+// internal/service/plan_service.go
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+    "backend/utils"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+    ErrPlanNotFound      = apperr.New(http.StatusNotFound, apperr.CodePlanNotFound, "Plan not found")
+    ErrInvalidPlan       = apperr.New(http.StatusBadRequest, apperr.CodeValidationFailed, "Invalid plan")
+    ErrPlanLimitExceeded = apperr.New(http.StatusForbidden, apperr.CodePlanLimitExceeded, "Plan limit exceeded")
+)
+
+// planLimitError reports which limit of the plan an upload would exceed.
+func planLimitError(plan *models.Plan, limit string, format string, args ...interface{}) error {
+    return ErrPlanLimitExceeded.WithMessage(format, args...).WithDetails(map[string]interface{}{
+        "plan":  plan.Name,
+        "limit": limit,
+    })
+}
+
+// defaultPlans are seeded into an empty plans collection. "free" keeps the
+// 10GB limit every account used to get.
+var defaultPlans = []models.Plan{
+    {Name: "free", DisplayName: "Free", StorageLimit: float64(utils.MBToBytes(10240)), MaxShareLinks: 10},
+    {Name: "pro", DisplayName: "Pro", StorageLimit: float64(utils.MBToBytes(102400)), MaxShareLinks: 100},
+    {Name: "business", DisplayName: "Business", StorageLimit: float64(utils.MBToBytes(1048576))},
+}
+
+// PlanService manages storage plans and enforces their limits.
+type PlanService struct {
+    planRepo    *repository.PlanRepository
+    userRepo    *repository.UserRepository
+    minioRepo   *repository.MinIOFileRepository
+    defaultPlan string
+}
+
+func NewPlanService(planRepo *repository.PlanRepository, userRepo *repository.UserRepository, minioRepo *repository.MinIOFileRepository, defaultPlan string) *PlanService {
+    return &PlanService{
+        planRepo:    planRepo,
+        userRepo:    userRepo,
+        minioRepo:   minioRepo,
+        defaultPlan: defaultPlan,
+    }
+}
+
+// EnsureDefaults seeds the built-in plans when no plans exist yet and checks
+// that the configured default plan is present.
+func (s *PlanService) EnsureDefaults(ctx context.Context) error {
+    count, err := s.planRepo.Count(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to count plans: %w", err)
+    }
+    if count == 0 {
+        for _, plan := range defaultPlans {
+            plan := plan
+            plan.ID = primitive.NewObjectID()
+            plan.CreatedAt = time.Now()
+            plan.UpdatedAt = plan.CreatedAt
+            if err := s.planRepo.Create(ctx, &plan); err != nil {
+                return err
+            }
+        }
+        log.Printf("Seeded %d default storage plans", len(defaultPlans))
+    }
+
+    if _, err := s.GetPlan(ctx, s.defaultPlan); err != nil {
+        return fmt.Errorf("default plan %q: %w", s.defaultPlan, err)
+    }
+    return nil
+}
+
+func (s *PlanService) ListPlans(ctx context.Context) ([]models.Plan, error) {
+    return s.planRepo.List(ctx)
+}
+
+func (s *PlanService) GetPlan(ctx context.Context, name string) (*models.Plan, error) {
+    plan, err := s.planRepo.GetByName(ctx, name)
+    if err != nil {
+        if errors.Is(err, mongo.ErrNoDocuments) {
+            return nil, ErrPlanNotFound
+        }
+        return nil, err
+    }
+    return plan, nil
+}
+
+// DefaultPlan returns the plan assigned to new accounts.
+func (s *PlanService) DefaultPlan(ctx context.Context) (*models.Plan, error) {
+    return s.GetPlan(ctx, s.defaultPlan)
+}
+
+// PlanForUser returns the user's plan. Accounts created before plans
+// existed are on the default plan.
+func (s *PlanService) PlanForUser(ctx context.Context, user *models.User) (*models.Plan, error) {
+    if user.Plan == "" {
+        return s.DefaultPlan(ctx)
+    }
+    return s.GetPlan(ctx, user.Plan)
+}
+
+func (s *PlanService) CreatePlan(ctx context.Context, plan *models.Plan) error {
+    if err := validatePlan(plan); err != nil {
+        return err
+    }
+    plan.ID = primitive.NewObjectID()
+    plan.CreatedAt = time.Now()
+    plan.UpdatedAt = plan.CreatedAt
+    if err := s.planRepo.Create(ctx, plan); err != nil {
+        if mongo.IsDuplicateKeyError(err) {
+            return apperr.ErrConflict.WithMessage("Plan %q already exists", plan.Name)
+        }
+        return err
+    }
+    return nil
+}
+
+// UpdatePlan changes a plan's limits and immediately applies the new
+// storage limit to every account on it.
+func (s *PlanService) UpdatePlan(ctx context.Context, name string, plan *models.Plan) error {
+    plan.Name = name
+    if err := validatePlan(plan); err != nil {
+        return err
+    }
+    if err := s.planRepo.Update(ctx, name, plan); err != nil {
+        if errors.Is(err, mongo.ErrNoDocuments) {
+            return ErrPlanNotFound
+        }
+        return err
+    }
+
+    updated, err := s.userRepo.UpdateLimitsForPlan(ctx, name, name == s.defaultPlan, plan.StorageLimit)
+    if err != nil {
+        return err
+    }
+    log.Printf("Updated plan %s; applied new storage limit to %d user(s)", name, updated)
+    return nil
+}
+
+// AssignPlan moves a user to another plan; the plan's storage limit takes
+// effect immediately.
+func (s *PlanService) AssignPlan(ctx context.Context, userID string, planName string) (*models.Plan, error) {
+    plan, err := s.GetPlan(ctx, planName)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.userRepo.SetPlan(ctx, userID, plan.Name, plan.StorageLimit); err != nil {
+        return nil, err
+    }
+    return plan, nil
+}
+
+// CheckUpload verifies that a new file fits the user's plan. It returns
+// ErrPlanLimitExceeded, detailing the limit, when the file doesn't fit.
+func (s *PlanService) CheckUpload(ctx context.Context, user *models.User, fileSize float64, fileType string) error {
+    plan, err := s.PlanForUser(ctx, user)
+    if err != nil {
+        return err
+    }
+
+    if plan.MaxFileSize > 0 && fileSize > plan.MaxFileSize {
+        return planLimitError(plan, "maxFileSize", "File exceeds the %.0f byte limit of the %s plan", plan.MaxFileSize, plan.Name)
+    }
+
+    if !typeAllowed(plan.AllowedTypes, fileType) {
+        return planLimitError(plan, "allowedTypes", "File type %q is not allowed on the %s plan", fileType, plan.Name)
+    }
+
+    if plan.MaxFiles > 0 {
+        count, err := s.minioRepo.CountByUser(ctx, user.UserID)
+        if err != nil {
+            return err
+        }
+        if count >= plan.MaxFiles {
+            return planLimitError(plan, "maxFiles", "The %s plan allows at most %d files", plan.Name, plan.MaxFiles)
+        }
+    }
+
+    return nil
+}
+
+func validatePlan(plan *models.Plan) error {
+    plan.Name = strings.TrimSpace(strings.ToLower(plan.Name))
+    switch {
+    case plan.Name == "":
+        return ErrInvalidPlan.WithMessage("name is required")
+    case plan.StorageLimit <= 0:
+        return ErrInvalidPlan.WithMessage("storageLimit must be positive")
+    case plan.MaxFileSize < 0, plan.MaxFiles < 0, plan.MaxShareLinks < 0:
+        return ErrInvalidPlan.WithMessage("limits cannot be negative")
+    }
+    if plan.DisplayName == "" {
+        plan.DisplayName = plan.Name
+    }
+    return nil
+}
+
+// typeAllowed matches fileType against allowed entries, which are either
+// exact MIME types or "type/*" wildcards.
+func typeAllowed(allowed []string, fileType string) bool {
+    if len(allowed) == 0 {
+        return true
+    }
+    fileType = strings.ToLower(fileType)
+    for _, pattern := range allowed {
+        pattern = strings.ToLower(pattern)
+        if pattern == fileType || pattern == "*/*" {
+            return true
+        }
+        if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(fileType, strings.TrimSuffix(pattern, "*")) {
+            return true
+        }
+    }
+    return false
+}
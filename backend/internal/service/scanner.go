@@ -0,0 +1,22 @@
+// internal/service/scanner.go
+package service
+
+import (
+    "context"
+    "io"
+
+    "backend/internal/models"
+)
+
+// Scanner checks uploaded content for malware.
+type Scanner interface {
+    Scan(ctx context.Context, content io.Reader) (models.ScanResult, error)
+}
+
+// NoScanner reports every file as not scanned without reading it. It's
+// the scanner until a real one, such as a clamd client, is plugged in.
+type NoScanner struct{}
+
+func (NoScanner) Scan(context.Context, io.Reader) (models.ScanResult, error) {
+    return models.ScanResult{Status: models.ScanSkipped}, nil
+}
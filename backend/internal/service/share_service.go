@@ -0,0 +1,177 @@
+// internal/service/share_service.go
+package service
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "io"
+    "log"
+    "net/http"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+    ErrEmailNotVerified = apperr.New(http.StatusForbidden, apperr.CodeEmailNotVerified, "Verify your email address to share files")
+    ErrSharingBusy      = apperr.New(http.StatusConflict, apperr.CodeConflict, "Share links are being created by another request, try again")
+)
+
+const (
+    // shareLeaseDuration bounds how long one request may hold the right to
+    // create a user's share links
+    shareLeaseDuration = 30 * time.Second
+    // shareLeaseAttempts and shareLeaseRetry are how often and how long
+    // apart a request tries to get that right before giving up
+    shareLeaseAttempts = 20
+    shareLeaseRetry    = 50 * time.Millisecond
+)
+
+// ShareService issues and resolves public links to single files. The
+// number of unexpired links an account may hold is its plan's
+// MaxShareLinks.
+type ShareService struct {
+    linkRepo    *repository.ShareLinkRepository
+    minioRepo   *repository.MinIOFileRepository
+    userRepo    *repository.UserRepository
+    planService *PlanService
+    storage     *StorageService
+}
+
+func NewShareService(linkRepo *repository.ShareLinkRepository, minioRepo *repository.MinIOFileRepository, userRepo *repository.UserRepository, planService *PlanService, storage *StorageService) *ShareService {
+    return &ShareService{
+        linkRepo:    linkRepo,
+        minioRepo:   minioRepo,
+        userRepo:    userRepo,
+        planService: planService,
+        storage:     storage,
+    }
+}
+
+// Create issues one link per file, all expiring at expiresAt (nil for
+// never). When the plan doesn't allow a link for every file, links are
+// issued for the leading files only and the plan limit error is returned
+// with them. Accounts must have verified their email address.
+func (s *ShareService) Create(ctx context.Context, user *models.User, files []*models.FileMinIO, expiresAt *time.Time) ([]models.ShareLink, error) {
+    if !user.EmailVerified {
+        return nil, ErrEmailNotVerified
+    }
+    plan, err := s.planService.PlanForUser(ctx, user)
+    if err != nil {
+        return nil, err
+    }
+    var limitErr error
+    if plan.MaxShareLinks > 0 {
+        // Counting and inserting happen under the lease, so concurrent
+        // requests can't both see room for the same links
+        release, err := s.leaseShareLinks(ctx, user.UserID)
+        if err != nil {
+            return nil, err
+        }
+        defer release()
+        count, err := s.linkRepo.CountActive(ctx, user.UserID)
+        if err != nil {
+            return nil, err
+        }
+        if remaining := plan.MaxShareLinks - count; int64(len(files)) > remaining {
+            if remaining < 0 {
+                remaining = 0
+            }
+            files = files[:remaining]
+            limitErr = planLimitError(plan, "maxShareLinks", "The %s plan allows at most %d share links", plan.Name, plan.MaxShareLinks)
+        }
+    }
+
+    now := time.Now()
+    links := make([]models.ShareLink, 0, len(files))
+    for _, file := range files {
+        token, err := randomBytes(24)
+        if err != nil {
+            return nil, err
+        }
+        links = append(links, models.ShareLink{
+            ID:        primitive.NewObjectID(),
+            Token:     base64.RawURLEncoding.EncodeToString(token),
+            FileID:    file.ID,
+            UserID:    user.UserID,
+            CreatedAt: now,
+            ExpiresAt: expiresAt,
+        })
+    }
+    if err := s.linkRepo.CreateMany(ctx, links); err != nil {
+        return nil, err
+    }
+    return links, limitErr
+}
+
+// leaseShareLinks waits for the right to create the user's share links and
+// returns the function that gives it up.
+func (s *ShareService) leaseShareLinks(ctx context.Context, userID string) (func(), error) {
+    raw, err := randomBytes(16)
+    if err != nil {
+        return nil, err
+    }
+    lease := hex.EncodeToString(raw)
+    for attempt := 1; ; attempt++ {
+        now := time.Now()
+        acquired, err := s.userRepo.LeaseShareLinks(ctx, userID, lease, now.Add(shareLeaseDuration), now)
+        if err != nil {
+            return nil, err
+        }
+        if acquired {
+            break
+        }
+        if attempt == shareLeaseAttempts {
+            return nil, ErrSharingBusy
+        }
+        select {
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        case <-time.After(shareLeaseRetry):
+        }
+    }
+    return func() {
+        if err := s.userRepo.ReleaseShareLinks(context.WithoutCancel(ctx), userID, lease); err != nil {
+            log.Printf("Failed to release share links of %s: %v", userID, err)
+        }
+    }, nil
+}
+
+// Open resolves token to its file and a reader over the content. Expired
+// links, links to files that are gone and links of disabled accounts all
+// report repository.ErrShareLinkNotFound.
+func (s *ShareService) Open(ctx context.Context, token string) (*models.FileMinIO, io.ReadCloser, error) {
+    link, err := s.linkRepo.FindByToken(ctx, token)
+    if err != nil {
+        return nil, nil, err
+    }
+    file, err := s.minioRepo.GetFileByID_MinIO(ctx, link.FileID.Hex())
+    if err != nil {
+        if errors.Is(err, repository.ErrFileNotFound) {
+            return nil, nil, repository.ErrShareLinkNotFound
+        }
+        return nil, nil, err
+    }
+    if !file.Complete || file.UserID != link.UserID {
+        return nil, nil, repository.ErrShareLinkNotFound
+    }
+    owner, err := s.userRepo.FindByUserID(ctx, link.UserID)
+    if errors.Is(err, repository.ErrUserNotFound) || (err == nil && owner.IsDisabled) {
+        return nil, nil, repository.ErrShareLinkNotFound
+    }
+    if err != nil {
+        return nil, nil, err
+    }
+    return file, s.storage.OpenFile(ctx, file), nil
+}
+
+// DeleteForFiles removes the links to files that are being deleted.
+func (s *ShareService) DeleteForFiles(ctx context.Context, fileIDs []primitive.ObjectID) error {
+    return s.linkRepo.DeleteByFiles(ctx, fileIDs)
+}
@@ -0,0 +1,358 @@
+// internal/service/sso_service.go
+package service
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "log"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/oidc"
+    "backend/internal/repository"
+    "backend/utils"
+    "backend/utils/crypto"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+    ErrSSONotConfigured = apperr.New(http.StatusNotFound, apperr.CodeNotFound, "Single sign-on is not configured")
+    ErrSSOFailed        = apperr.New(http.StatusUnauthorized, apperr.CodeSSOFailed, "Single sign-on failed")
+    ErrSSONoAccount     = apperr.New(http.StatusForbidden, apperr.CodeForbidden, "No account is linked to this identity")
+    ErrSSOEmailInUse    = apperr.New(http.StatusConflict, apperr.CodeEmailTaken, "An account already uses this email address; sign in with its password")
+    ErrSSOUnverified    = apperr.New(http.StatusForbidden, apperr.CodeForbidden, "The identity provider hasn't verified your email address")
+)
+
+const (
+    // ssoFlowTTL is how long a user may take at the provider
+    ssoFlowTTL = 10 * time.Minute
+    // loginCodeTTL is how long the web app has to redeem a login code
+    loginCodeTTL = time.Minute
+    // ssoFlowContext binds sealed flow cookies to their use
+    ssoFlowContext = "oidc-flow"
+)
+
+// SSOPolicy configures single sign-on.
+type SSOPolicy struct {
+    // AppURL is the web app; finished logins land on /sso/callback there,
+    // with ?code= or ?error=
+    AppURL string
+    // AutoProvision creates accounts for identities that match none and
+    // whose email the provider verified
+    AutoProvision bool
+    // SecureCookie marks the flow cookie Secure; set it when the callback
+    // is served over HTTPS
+    SecureCookie bool
+}
+
+// SSOService signs users in with an OpenID Connect provider. An identity
+// maps to the account it was linked to; failing that it is linked to the
+// account with its email address, when both sides have verified it, or
+// a new account is created when the provider verified the address. A
+// finished login is handed to the web app as a single-use code, traded
+// for the usual session token at /api/auth/oidc/token.
+type SSOService struct {
+    provider *oidc.Provider
+    users    ssoAccounts
+    codes    *repository.LoginCodeRepository
+    plans    *PlanService
+    guard    *LoginGuard
+    sealer   *crypto.Sealer
+    policy   SSOPolicy
+}
+
+func NewSSOService(provider *oidc.Provider, users *repository.UserRepository, codes *repository.LoginCodeRepository, plans *PlanService, guard *LoginGuard, sealer *crypto.Sealer, policy SSOPolicy) *SSOService {
+    policy.AppURL = strings.TrimSuffix(policy.AppURL, "/")
+    return &SSOService{provider: provider, users: users, codes: codes, plans: plans, guard: guard, sealer: sealer, policy: policy}
+}
+
+// ssoAccounts is the part of UserRepository the service uses.
+type ssoAccounts interface {
+    FindByIdentity(ctx context.Context, issuer, subject string) (*models.User, error)
+    FindByEmail(ctx context.Context, email string) (*models.User, error)
+    FindByName(ctx context.Context, name string) (*models.User, error)
+    FindByUserID(ctx context.Context, userID string) (*models.User, error)
+    FindByObjectID(ctx context.Context, id string) (*models.User, error)
+    Create(ctx context.Context, user *models.User) error
+    AddIdentity(ctx context.Context, userID string, identity models.ExternalIdentity) error
+    UpdateLoginStats(ctx context.Context, userID primitive.ObjectID, ipAddress string, isSuccessful bool) error
+}
+
+// ssoFlow is what the browser carries, sealed, between Start and Finish.
+type ssoFlow struct {
+    State     string    `json:"state"`
+    Nonce     string    `json:"nonce"`
+    Verifier  string    `json:"verifier"`
+    ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Start begins a login. It returns the provider URL to send the browser
+// to and the sealed flow state the browser must bring back to Finish.
+func (s *SSOService) Start(ctx context.Context) (string, string, error) {
+    var flow ssoFlow
+    for _, value := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+        random, err := oidc.RandomValue()
+        if err != nil {
+            return "", "", apperr.ErrInternal.Wrap(err)
+        }
+        *value = random
+    }
+    flow.ExpiresAt = time.Now().Add(ssoFlowTTL)
+
+    redirect, err := s.provider.AuthCodeURL(ctx, flow.State, flow.Nonce, flow.Verifier)
+    if err != nil {
+        return "", "", ErrSSOFailed.Wrap(err)
+    }
+    data, err := json.Marshal(flow)
+    if err != nil {
+        return "", "", apperr.ErrInternal.Wrap(err)
+    }
+    sealed, err := s.sealer.Seal(data, ssoFlowContext)
+    if err != nil {
+        return "", "", apperr.ErrInternal.Wrap(err)
+    }
+    return redirect, sealed, nil
+}
+
+// FlowCookie returns the cookie that carries value, the sealed state from
+// Start, to the callback. An empty value deletes it.
+func (s *SSOService) FlowCookie(value string) *http.Cookie {
+    cookie := &http.Cookie{
+        Name:     "storely_oidc",
+        Value:    value,
+        Path:     "/api/auth/oidc",
+        MaxAge:   int(ssoFlowTTL.Seconds()),
+        Secure:   s.policy.SecureCookie,
+        HttpOnly: true,
+        // Lax, so the cookie comes along on the provider's redirect back
+        SameSite: http.SameSiteLaxMode,
+    }
+    if value == "" {
+        cookie.MaxAge = -1
+    }
+    return cookie
+}
+
+// Finish completes a login the provider redirected back with state and
+// code. It returns a login code for Redeem.
+func (s *SSOService) Finish(ctx context.Context, sealedFlow, state, code, ipAddress string) (string, error) {
+    data, err := s.sealer.Open(sealedFlow, ssoFlowContext)
+    if err != nil {
+        return "", ErrSSOFailed.WithMessage("Sign-in session is missing or invalid, try again")
+    }
+    var flow ssoFlow
+    if err := json.Unmarshal(data, &flow); err != nil || time.Now().After(flow.ExpiresAt) {
+        return "", ErrSSOFailed.WithMessage("Sign-in session expired, try again")
+    }
+    if state == "" || state != flow.State {
+        return "", ErrSSOFailed.WithMessage("Sign-in session doesn't match, try again")
+    }
+
+    rawIDToken, err := s.provider.Exchange(ctx, code, flow.Verifier)
+    if err != nil {
+        return "", ErrSSOFailed.Wrap(err)
+    }
+    claims, err := s.provider.Verify(ctx, rawIDToken, flow.Nonce)
+    if err != nil {
+        s.guard.audit(ctx, "", ipAddress, nil, models.LoginSSOFailed)
+        return "", ErrSSOFailed.Wrap(err)
+    }
+
+    user, err := s.resolve(ctx, claims, ipAddress)
+    if err != nil {
+        if errors.Is(err, ErrSSONoAccount) || errors.Is(err, ErrSSOEmailInUse) || errors.Is(err, ErrSSOUnverified) {
+            s.guard.audit(ctx, claims.Email, ipAddress, nil, models.LoginSSOFailed)
+        }
+        return "", err
+    }
+    if user.IsDisabled {
+        s.guard.audit(ctx, user.Email, ipAddress, user, models.LoginDisabled)
+        return "", ErrAccountDisabled
+    }
+
+    if user.TOTPEnabled {
+        // The login completes in MFAService.CompleteLogin
+        s.guard.audit(ctx, user.Email, ipAddress, user, models.LoginMFARequired)
+    } else {
+        s.guard.succeed(ctx, user)
+        s.guard.audit(ctx, user.Email, ipAddress, user, models.LoginSucceeded)
+        if err := s.users.UpdateLoginStats(ctx, user.ID, ipAddress, true); err != nil {
+            log.Printf("Failed to update login stats: %v", err)
+        }
+    }
+    return s.issueCode(ctx, user)
+}
+
+// Redeem trades a login code from Finish for its account.
+func (s *SSOService) Redeem(ctx context.Context, code string) (*models.User, error) {
+    loginCode, err := s.codes.Consume(ctx, hashEmailToken(code), time.Now())
+    if err != nil {
+        return nil, err
+    }
+    user, err := s.users.FindByObjectID(ctx, loginCode.AccountID)
+    if errors.Is(err, repository.ErrUserNotFound) {
+        return nil, repository.ErrLoginCodeInvalid
+    }
+    if err != nil {
+        return nil, err
+    }
+    if user.IsDisabled {
+        return nil, ErrAccountDisabled
+    }
+    return user, nil
+}
+
+// AppRedirect is where the browser goes after Finish: the web app's
+// callback with the login code, or with the error code of err.
+func (s *SSOService) AppRedirect(loginCode string, err error) string {
+    if err == nil {
+        return s.policy.AppURL + "/sso/callback?code=" + url.QueryEscape(loginCode)
+    }
+    code := apperr.CodeSSOFailed
+    var appErr *apperr.Error
+    if errors.As(err, &appErr) && appErr.Status < http.StatusInternalServerError {
+        code = appErr.Code
+    }
+    return s.policy.AppURL + "/sso/callback?error=" + url.QueryEscape(string(code))
+}
+
+// resolve finds or creates the account of a verified identity.
+func (s *SSOService) resolve(ctx context.Context, claims *oidc.Claims, ipAddress string) (*models.User, error) {
+    user, err := s.users.FindByIdentity(ctx, claims.Issuer, claims.Subject)
+    if err == nil {
+        return user, nil
+    }
+    if !errors.Is(err, repository.ErrUserNotFound) {
+        return nil, err
+    }
+
+    identity := models.ExternalIdentity{Issuer: claims.Issuer, Subject: claims.Subject, LinkedAt: time.Now()}
+    if claims.Email == "" {
+        return nil, ErrSSOFailed.WithMessage("The identity provider didn't share an email address")
+    }
+    user, err = s.users.FindByEmail(ctx, claims.Email)
+    if err == nil {
+        // Only link when both sides proved the address, or whoever
+        // controls an unverified one at either end could take the account
+        if !claims.EmailVerified || !user.EmailVerified {
+            return nil, ErrSSOEmailInUse
+        }
+        if err := s.users.AddIdentity(ctx, user.UserID, identity); err != nil {
+            return nil, err
+        }
+        log.Printf("Linked %s identity %s to user %s", claims.Issuer, claims.Subject, user.UserID)
+        return user, nil
+    }
+    if !errors.Is(err, repository.ErrUserNotFound) {
+        return nil, err
+    }
+
+    if !s.policy.AutoProvision {
+        return nil, ErrSSONoAccount
+    }
+    // An unverified address may belong to someone else, who could then
+    // no longer register it
+    if !claims.EmailVerified {
+        return nil, ErrSSOUnverified
+    }
+    return s.provision(ctx, claims, identity, ipAddress)
+}
+
+// provision creates an account without a password for the identity, on
+// the default plan, with the provider-verified email.
+func (s *SSOService) provision(ctx context.Context, claims *oidc.Claims, identity models.ExternalIdentity, ipAddress string) (*models.User, error) {
+    plan, err := s.plans.DefaultPlan(ctx)
+    if err != nil {
+        return nil, err
+    }
+    userID, err := utils.GenerateUserID()
+    if err != nil {
+        return nil, apperr.ErrInternal.Wrap(err)
+    }
+    name, err := s.freeUsername(ctx, claims)
+    if err != nil {
+        return nil, err
+    }
+
+    now := time.Now()
+    user := &models.User{
+        UserID:          userID,
+        Name:            name,
+        Email:           claims.Email,
+        Role:            models.RoleUser,
+        Plan:            plan.Name,
+        IPAddress:       ipAddress,
+        StorageLimit:    plan.StorageLimit,
+        CreatedAt:       now,
+        EmailVerified:   true,
+        EmailVerifiedAt: &now,
+        Identities:      []models.ExternalIdentity{identity},
+    }
+    if err := s.users.Create(ctx, user); err != nil {
+        return nil, err
+    }
+    // Create doesn't fill in the ObjectID
+    created, err := s.users.FindByUserID(ctx, userID)
+    if err != nil {
+        return nil, err
+    }
+    log.Printf("Created user %s for %s identity %s", userID, claims.Issuer, claims.Subject)
+    return created, nil
+}
+
+// freeUsername picks an unused username from the identity's preferred
+// username, name or email, adding a random suffix when it's taken.
+func (s *SSOService) freeUsername(ctx context.Context, claims *oidc.Claims) (string, error) {
+    base := strings.TrimSpace(claims.PreferredUsername)
+    if base == "" {
+        base = strings.TrimSpace(claims.Name)
+    }
+    if base == "" {
+        base, _, _ = strings.Cut(claims.Email, "@")
+    }
+    if len(base) > maxUsernameLength-5 {
+        base = strings.ToValidUTF8(base[:maxUsernameLength-5], "")
+    }
+
+    name := base
+    for attempt := 0; attempt < 5; attempt++ {
+        _, err := s.users.FindByName(ctx, name)
+        if errors.Is(err, repository.ErrUserNotFound) {
+            return name, nil
+        }
+        if err != nil {
+            return "", err
+        }
+        suffix, err := randomBytes(2)
+        if err != nil {
+            return "", apperr.ErrInternal.Wrap(err)
+        }
+        name = base + "-" + hex.EncodeToString(suffix)
+    }
+    return "", repository.ErrUsernameTaken
+}
+
+func (s *SSOService) issueCode(ctx context.Context, user *models.User) (string, error) {
+    raw, err := randomBytes(32)
+    if err != nil {
+        return "", apperr.ErrInternal.Wrap(err)
+    }
+    code := base64.RawURLEncoding.EncodeToString(raw)
+    err = s.codes.Create(ctx, &models.LoginCode{
+        CodeHash:  hashEmailToken(code),
+        AccountID: user.ID.Hex(),
+        ExpiresAt: time.Now().Add(loginCodeTTL),
+    })
+    if err != nil {
+        return "", err
+    }
+    return code, nil
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/oidc"
+	"backend/internal/repository"
+	"backend/utils/crypto"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryAccounts is an ssoAccounts over a slice of users.
+type memoryAccounts struct {
+	users []*models.User
+}
+
+func (m *memoryAccounts) find(match func(*models.User) bool) (*models.User, error) {
+	for _, user := range m.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (m *memoryAccounts) FindByIdentity(_ context.Context, issuer, subject string) (*models.User, error) {
+	return m.find(func(u *models.User) bool {
+		for _, identity := range u.Identities {
+			if identity.Issuer == issuer && identity.Subject == subject {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (m *memoryAccounts) FindByEmail(_ context.Context, email string) (*models.User, error) {
+	return m.find(func(u *models.User) bool { return strings.EqualFold(u.Email, email) })
+}
+
+func (m *memoryAccounts) FindByName(_ context.Context, name string) (*models.User, error) {
+	return m.find(func(u *models.User) bool { return u.Name == name })
+}
+
+func (m *memoryAccounts) FindByUserID(_ context.Context, userID string) (*models.User, error) {
+	return m.find(func(u *models.User) bool { return u.UserID == userID })
+}
+
+func (m *memoryAccounts) FindByObjectID(_ context.Context, id string) (*models.User, error) {
+	return m.find(func(u *models.User) bool { return u.ID.Hex() == id })
+}
+
+func (m *memoryAccounts) Create(_ context.Context, user *models.User) error {
+	m.users = append(m.users, user)
+	return nil
+}
+
+func (m *memoryAccounts) AddIdentity(_ context.Context, userID string, identity models.ExternalIdentity) error {
+	user, err := m.FindByUserID(context.Background(), userID)
+	if err != nil {
+		return err
+	}
+	user.Identities = append(user.Identities, identity)
+	return nil
+}
+
+func (m *memoryAccounts) UpdateLoginStats(context.Context, primitive.ObjectID, string, bool) error {
+	return nil
+}
+
+func TestSSOResolve(t *testing.T) {
+	const issuer = "https://idp.example"
+	newAccounts := func() *memoryAccounts {
+		return &memoryAccounts{users: []*models.User{
+			{UserID: "linked", Email: "linked@example.com", EmailVerified: true,
+				Identities: []models.ExternalIdentity{{Issuer: issuer, Subject: "sub-linked"}}},
+			{UserID: "verified", Email: "ada@example.com", EmailVerified: true},
+			{UserID: "unverified", Email: "grace@example.com"},
+		}}
+	}
+	tests := []struct {
+		name          string
+		autoProvision bool
+		claims        oidc.Claims
+		wantUser      string
+		wantErr       error
+	}{
+		{"linked identity", false, oidc.Claims{Subject: "sub-linked", Email: "other@example.com"}, "linked", nil},
+		{"verified on both sides", false, oidc.Claims{Subject: "sub-new", Email: "ADA@example.com", EmailVerified: true}, "verified", nil},
+		{"unverified at the provider", false, oidc.Claims{Subject: "sub-new", Email: "ada@example.com"}, "", ErrSSOEmailInUse},
+		{"unverified account", false, oidc.Claims{Subject: "sub-new", Email: "grace@example.com", EmailVerified: true}, "", ErrSSOEmailInUse},
+		{"no email", true, oidc.Claims{Subject: "sub-new"}, "", ErrSSOFailed},
+		{"unknown without auto-provisioning", false, oidc.Claims{Subject: "sub-new", Email: "new@example.com", EmailVerified: true}, "", ErrSSONoAccount},
+		{"unknown with an unverified email", true, oidc.Claims{Subject: "sub-new", Email: "new@example.com"}, "", ErrSSOUnverified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts := newAccounts()
+			s := &SSOService{users: accounts, policy: SSOPolicy{AutoProvision: tt.autoProvision}}
+			claims := tt.claims
+			claims.Issuer = issuer
+
+			user, err := s.resolve(context.Background(), &claims, "192.0.2.1")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("resolve() error = %v, want %v", err, tt.wantErr)
+				}
+				if len(accounts.users) != 3 {
+					t.Errorf("resolve() created an account")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.UserID != tt.wantUser {
+				t.Errorf("resolve() = user %s, want %s", user.UserID, tt.wantUser)
+			}
+			if _, err := accounts.FindByIdentity(context.Background(), issuer, claims.Subject); err != nil {
+				t.Errorf("identity %s is not linked: %v", claims.Subject, err)
+			}
+		})
+	}
+}
+
+func TestSSOFreeUsername(t *testing.T) {
+	accounts := &memoryAccounts{users: []*models.User{{Name: "ada"}}}
+	s := &SSOService{users: accounts}
+	tests := []struct {
+		name   string
+		claims oidc.Claims
+		want   string
+	}{
+		{"preferred username", oidc.Claims{PreferredUsername: " grace ", Name: "Grace Hopper", Email: "gh@example.com"}, "grace"},
+		{"name", oidc.Claims{Name: "Grace Hopper", Email: "gh@example.com"}, "Grace Hopper"},
+		{"email", oidc.Claims{Email: "gh@example.com"}, "gh"},
+		{"long username", oidc.Claims{PreferredUsername: strings.Repeat("x", 100)}, strings.Repeat("x", maxUsernameLength-5)},
+	}
+	for _, tt := range tests {
+		got, err := s.freeUsername(context.Background(), &tt.claims)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: freeUsername() = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	got, err := s.freeUsername(context.Background(), &oidc.Claims{PreferredUsername: "ada"})
+	if err != nil || !strings.HasPrefix(got, "ada-") || len(got) != len("ada-0000") {
+		t.Errorf("taken username: freeUsername() = %q, %v, want ada- and a random suffix", got, err)
+	}
+}
+
+func TestSSOFinishChecksFlow(t *testing.T) {
+	sealer, err := crypto.NewSealer("flow-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &SSOService{sealer: sealer}
+	seal := func(flow ssoFlow, context string) string {
+		data, err := json.Marshal(flow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed, err := sealer.Seal(data, context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sealed
+	}
+	valid := ssoFlow{State: "state-1", Nonce: "nonce", Verifier: "verifier", ExpiresAt: time.Now().Add(time.Minute)}
+	expired := valid
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+
+	tests := []struct {
+		name  string
+		flow  string
+		state string
+	}{
+		{"no cookie", "", "state-1"},
+		{"tampered cookie", seal(valid, ssoFlowContext) + "x", "state-1"},
+		{"sealed for another use", seal(valid, "mfa-secret"), "state-1"},
+		{"expired", seal(expired, ssoFlowContext), "state-1"},
+		{"state mismatch", seal(valid, ssoFlowContext), "state-2"},
+		{"no state", seal(valid, ssoFlowContext), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The provider is never reached, so it may be nil
+			if _, err := s.Finish(context.Background(), tt.flow, tt.state, "code", "192.0.2.1"); !errors.Is(err, ErrSSOFailed) {
+				t.Errorf("Finish() error = %v, want ErrSSOFailed", err)
+			}
+		})
+	}
+}
+
+func TestSSOAppRedirect(t *testing.T) {
+	s := NewSSOService(nil, nil, nil, nil, nil, nil, SSOPolicy{AppURL: "https://app.example/"})
+	tests := []struct {
+		name string
+		code string
+		err  error
+		want string
+	}{
+		{"login code", "a+b/c", nil, "https://app.example/sso/callback?code=a%2Bb%2Fc"},
+		{"client error", "", ErrSSOUnverified, "https://app.example/sso/callback?error=FORBIDDEN"},
+		{"email in use", "", ErrSSOEmailInUse, "https://app.example/sso/callback?error=EMAIL_ALREADY_REGISTERED"},
+		{"internal error", "", errors.New("database down"), "https://app.example/sso/callback?error=SSO_FAILED"},
+	}
+	for _, tt := range tests {
+		if got := s.AppRedirect(tt.code, tt.err); got != tt.want {
+			t.Errorf("%s: AppRedirect() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// internal/service/storage_service.go
+package service
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "sync"
+
+    "backend/internal/models"
+
+    "github.com/minio/minio-go/v7"
+)
+
+// ChunkObjectName returns the object key of a file chunk in the bucket.
+func ChunkObjectName(fileID string, index int) string {
+    return fmt.Sprintf("%s/chunk_%d", fileID, index)
+}
+
+// StorageService wraps the chunk layout used for files in MinIO: every file
+// lives under "<fileID>/" and its content is the concatenation of
+// chunk_0 .. chunk_{TotalChunks-1}.
+type StorageService struct {
+    client *minio.Client
+    bucket string
+}
+
+func NewStorageService(client *minio.Client, bucket string) *StorageService {
+    return &StorageService{
+        client: client,
+        bucket: bucket,
+    }
+}
+
+// Client returns the underlying MinIO client.
+func (s *StorageService) Client() *minio.Client {
+    return s.client
+}
+
+// Bucket returns the bucket files are stored in.
+func (s *StorageService) Bucket() string {
+    return s.bucket
+}
+
+// OpenFile returns a reader over the full content of file. Chunks are
+// fetched one at a time as the reader advances.
+func (s *StorageService) OpenFile(ctx context.Context, file *models.FileMinIO) io.ReadCloser {
+    return &chunkReader{
+        ctx:    ctx,
+        client: s.client,
+        bucket: s.bucket,
+        fileID: file.ID.Hex(),
+        total:  file.TotalChunks,
+    }
+}
+
+// OpenRange returns a reader over length bytes of file starting at offset.
+// Only the chunks covering the range are fetched.
+func (s *StorageService) OpenRange(ctx context.Context, file *models.FileMinIO, offset, length int64) (io.ReadCloser, error) {
+    r := &chunkReader{
+        ctx:    ctx,
+        client: s.client,
+        bucket: s.bucket,
+        fileID: file.ID.Hex(),
+        total:  file.TotalChunks,
+    }
+    if file.ChunkSize > 0 {
+        r.next = int(offset / file.ChunkSize)
+        r.skip = offset % file.ChunkSize
+    } else if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+        // Without a recorded chunk size the offset can only be reached by reading
+        r.Close()
+        return nil, err
+    }
+    return &limitedReadCloser{Reader: io.LimitReader(r, length), Closer: r}, nil
+}
+
+// PutChunk stores chunk index of fileID from r, which must yield size bytes.
+func (s *StorageService) PutChunk(ctx context.Context, fileID string, index int, r io.Reader, size int64) error {
+    if err := s.PutObject(ctx, ChunkObjectName(fileID, index), r, size); err != nil {
+        return fmt.Errorf("failed to store chunk %d: %w", index, err)
+    }
+    return nil
+}
+
+// PutObject stores an arbitrary object, such as a pending S3 multipart part.
+func (s *StorageService) PutObject(ctx context.Context, key string, r io.Reader, size int64) error {
+    _, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+        ContentType: "application/octet-stream",
+    })
+    return err
+}
+
+// OpenObject returns a reader over an object stored with PutObject. The
+// object is only requested once the reader is first read.
+func (s *StorageService) OpenObject(ctx context.Context, key string) (io.ReadCloser, error) {
+    return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+// RemoveObject deletes a single object.
+func (s *StorageService) RemoveObject(ctx context.Context, key string) error {
+    return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// RemoveFileObjects deletes every object stored under the file's prefix.
+func (s *StorageService) RemoveFileObjects(ctx context.Context, fileID string) error {
+    return s.RemovePrefix(ctx, fileID+"/")
+}
+
+// RemovePrefix deletes every object whose key starts with prefix.
+func (s *StorageService) RemovePrefix(ctx context.Context, prefix string) error {
+    objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+        Prefix:    prefix,
+        Recursive: true,
+    })
+
+    toRemove := make(chan minio.ObjectInfo)
+    go func() {
+        defer close(toRemove)
+        for object := range objects {
+            if object.Err != nil {
+                continue
+            }
+            toRemove <- object
+        }
+    }()
+
+    for removeErr := range s.client.RemoveObjects(ctx, s.bucket, toRemove, minio.RemoveObjectsOptions{}) {
+        if removeErr.Err != nil {
+            return fmt.Errorf("failed to remove %s: %w", removeErr.ObjectName, removeErr.Err)
+        }
+    }
+    return nil
+}
+
+// RemoveFilesObjects deletes the objects of several files through one
+// batched RemoveObjects call, listing up to concurrency prefixes at a time.
+// It returns an error for every file whose objects were not all removed.
+func (s *StorageService) RemoveFilesObjects(ctx context.Context, fileIDs []string, concurrency int) map[string]error {
+    var mu sync.Mutex
+    failed := map[string]error{}
+    fail := func(fileID string, err error) {
+        mu.Lock()
+        defer mu.Unlock()
+        if failed[fileID] == nil {
+            failed[fileID] = err
+        }
+    }
+
+    ids := make(chan string)
+    toRemove := make(chan minio.ObjectInfo)
+    var listing sync.WaitGroup
+    for i := 0; i < concurrency; i++ {
+        listing.Add(1)
+        go func() {
+            defer listing.Done()
+            for fileID := range ids {
+                objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+                    Prefix:    fileID + "/",
+                    Recursive: true,
+                })
+                for object := range objects {
+                    if object.Err != nil {
+                        fail(fileID, fmt.Errorf("failed to list objects: %w", object.Err))
+                        continue
+                    }
+                    select {
+                    case toRemove <- object:
+                    case <-ctx.Done():
+                    }
+                }
+            }
+        }()
+    }
+    go func() {
+        defer close(toRemove)
+        defer listing.Wait()
+        defer close(ids)
+        for _, fileID := range fileIDs {
+            select {
+            case ids <- fileID:
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+
+    for removeErr := range s.client.RemoveObjects(ctx, s.bucket, toRemove, minio.RemoveObjectsOptions{}) {
+        if removeErr.Err != nil {
+            fileID, _, _ := strings.Cut(removeErr.ObjectName, "/")
+            fail(fileID, fmt.Errorf("failed to remove %s: %w", removeErr.ObjectName, removeErr.Err))
+        }
+    }
+    if err := ctx.Err(); err != nil {
+        for _, fileID := range fileIDs {
+            fail(fileID, err)
+        }
+    }
+    return failed
+}
+
+// UploadedChunks returns the indexes of the chunks of fileID that are
+// present in the bucket.
+func (s *StorageService) UploadedChunks(ctx context.Context, fileID string) (map[int]bool, error) {
+    prefix := fileID + "/chunk_"
+    uploaded := map[int]bool{}
+    for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+        if object.Err != nil {
+            return nil, fmt.Errorf("failed to list chunks of %s: %w", fileID, object.Err)
+        }
+        index, err := strconv.Atoi(strings.TrimPrefix(object.Key, prefix))
+        if err != nil {
+            continue
+        }
+        uploaded[index] = true
+    }
+    return uploaded, nil
+}
+
+type chunkReader struct {
+    ctx     context.Context
+    client  *minio.Client
+    bucket  string
+    fileID  string
+    total   int
+    next    int
+    skip    int64
+    current *minio.Object
+}
+
+type limitedReadCloser struct {
+    io.Reader
+    io.Closer
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+    for {
+        if r.current == nil {
+            if r.next >= r.total {
+                return 0, io.EOF
+            }
+            opts := minio.GetObjectOptions{}
+            if r.skip > 0 {
+                opts.SetRange(r.skip, 0)
+                r.skip = 0
+            }
+            obj, err := r.client.GetObject(r.ctx, r.bucket, ChunkObjectName(r.fileID, r.next), opts)
+            if err != nil {
+                return 0, fmt.Errorf("failed to open chunk %d: %w", r.next, err)
+            }
+            r.current = obj
+            r.next++
+        }
+
+        n, err := r.current.Read(p)
+        if err == io.EOF {
+            r.current.Close()
+            r.current = nil
+            if n > 0 {
+                return n, nil
+            }
+            continue
+        }
+        return n, err
+    }
+}
+
+func (r *chunkReader) Close() error {
+    if r.current != nil {
+        err := r.current.Close()
+        r.current = nil
+        return err
+    }
+    return nil
+}
@@ -0,0 +1,295 @@
+// internal/service/tus_service.go
+package service
+
+import (
+    "bytes"
+    "context"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "hash"
+    "io"
+    "log"
+    "net/http"
+    "time"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+    "backend/internal/repository"
+)
+
+// JobExpireUpload discards a resumable upload that wasn't finished in time.
+const JobExpireUpload = "expire_upload"
+
+// DefaultTusUploadExpiry is how long a resumable upload may take when
+// nothing is configured.
+const DefaultTusUploadExpiry = 24 * time.Hour
+
+// tusLeaseDuration is how long a PATCH holds its upload without renewing
+// the lease; it is renewed before every chunk is written.
+const tusLeaseDuration = time.Minute
+
+var (
+    ErrUploadOffsetMismatch = apperr.New(http.StatusConflict, apperr.CodeConflict, "Upload-Offset does not match the offset of the upload")
+    ErrUploadExpired        = apperr.New(http.StatusGone, apperr.CodeUploadExpired, "Upload has expired")
+    ErrUploadFinished       = apperr.New(http.StatusConflict, apperr.CodeConflict, "Upload is already complete")
+    ErrUploadLocked         = apperr.New(http.StatusLocked, apperr.CodeUploadLocked, "Another request is writing to this upload")
+    // 460 is the status the tus checksum extension defines
+    ErrChecksumMismatch = apperr.New(460, apperr.CodeChecksumMismatch, "Checksum mismatch")
+)
+
+// TusService implements resumable uploads (the tus protocol) on top of the
+// regular file model. An upload is a FileMinIO record that stays incomplete
+// until UploadOffset reaches its size, and its content is stored in the
+// usual chunk layout.
+//
+// PATCH requests may end anywhere, but chunk objects can't be appended to.
+// Bytes past the last full chunk are therefore kept in a tail object named
+// after the offset they end at; the next PATCH starts by reading it back.
+// Because a new tail gets a new name, a failed PATCH never damages the
+// state the committed offset refers to. Chunk objects keep their names,
+// so a PATCH first leases the upload; concurrent PATCHes at the same
+// offset get ErrUploadLocked instead of overwriting each other's chunks.
+type TusService struct {
+    store  *FileStore
+    expiry time.Duration
+}
+
+func NewTusService(store *FileStore, expiry time.Duration) *TusService {
+    if expiry <= 0 {
+        expiry = DefaultTusUploadExpiry
+    }
+    return &TusService{store: store, expiry: expiry}
+}
+
+// Register adds the expiry job handler to queue.
+func (s *TusService) Register(queue *JobQueue) {
+    queue.Register(JobExpireUpload, s.expireUpload)
+}
+
+// MaxSize is the largest upload accepted, 0 for no limit.
+func (s *TusService) MaxSize() int64 {
+    return s.store.limits.MaxFileSize
+}
+
+func tailObjectName(fileID string, offset int64) string {
+    return fmt.Sprintf("%s/tail_%d", fileID, offset)
+}
+
+// Create starts an upload of req.Size bytes; req.Body is unused. The size
+// is charged to the quota right away, as for browser uploads.
+func (s *TusService) Create(ctx context.Context, user *models.User, req PutRequest) (*models.FileMinIO, error) {
+    expiresAt := time.Now().Add(s.expiry)
+    file, err := s.store.reserve(ctx, user, req, s.store.chunkSizeFor(req.Size), &expiresAt)
+    if err != nil {
+        return nil, err
+    }
+
+    // An empty file is complete as soon as it exists
+    if req.Size == 0 {
+        if err := s.store.finish(ctx, file); err != nil {
+            return nil, err
+        }
+        return file, nil
+    }
+
+    if _, err := s.store.jobQueue.EnqueueAt(ctx, JobExpireUpload, map[string]string{"fileId": file.ID.Hex()}, expiresAt); err != nil {
+        log.Printf("Failed to schedule expiry of upload %s: %v", file.ID.Hex(), err)
+    }
+    return file, nil
+}
+
+// Get returns one of user's uploads. Unfinished uploads past their expiry
+// are reported as ErrUploadExpired.
+func (s *TusService) Get(ctx context.Context, user *models.User, fileID string) (*models.FileMinIO, error) {
+    file, err := s.store.minioRepo.GetFileByID_MinIO(ctx, fileID)
+    if err != nil {
+        return nil, err
+    }
+    if file.UserID != user.UserID {
+        return nil, repository.ErrFileNotFound
+    }
+    if !file.Complete && file.UploadExpiresAt != nil && time.Now().After(*file.UploadExpiresAt) {
+        return nil, ErrUploadExpired
+    }
+    return file, nil
+}
+
+// Checksum is the expected digest of a PATCH body.
+type Checksum struct {
+    Hash     hash.Hash
+    Expected []byte
+}
+
+// Patch appends body to the upload at offset and returns the upload with
+// its new offset. Without a checksum, whatever arrived before the body
+// broke off is kept, so the client can resume from there. With one, the
+// offset only moves if the whole body matches it.
+func (s *TusService) Patch(ctx context.Context, user *models.User, fileID string, offset int64, body io.Reader, checksum *Checksum) (*models.FileMinIO, error) {
+    file, err := s.Get(ctx, user, fileID)
+    if err != nil {
+        return nil, err
+    }
+    if file.Complete {
+        return nil, ErrUploadFinished
+    }
+    if offset != file.UploadOffset {
+        return nil, ErrUploadOffsetMismatch
+    }
+
+    // What was received is kept even if the client goes away mid-request
+    writeCtx := context.WithoutCancel(ctx)
+
+    leaseBytes, err := randomBytes(16)
+    if err != nil {
+        return nil, apperr.ErrInternal.Wrap(err)
+    }
+    lease := hex.EncodeToString(leaseBytes)
+    hold := func() error {
+        now := time.Now()
+        held, err := s.store.minioRepo.LeaseUpload(writeCtx, fileID, offset, lease, now.Add(tusLeaseDuration), now)
+        if err != nil {
+            return err
+        }
+        if !held {
+            return ErrUploadLocked
+        }
+        return nil
+    }
+    if err := hold(); err != nil {
+        if errors.Is(err, ErrUploadLocked) {
+            // Either someone else holds it, or it moved on meanwhile
+            if current, getErr := s.Get(ctx, user, fileID); getErr == nil && current.UploadOffset != offset {
+                return nil, ErrUploadOffsetMismatch
+            }
+        }
+        return nil, err
+    }
+    defer func() {
+        if err := s.store.minioRepo.ReleaseUpload(writeCtx, fileID, lease); err != nil {
+            log.Printf("Failed to release upload %s: %v", fileID, err)
+        }
+    }()
+
+    size := int64(file.Size)
+    body = io.LimitReader(body, size-offset)
+    if checksum != nil {
+        body = io.TeeReader(body, checksum.Hash)
+    }
+
+    // buf holds the chunk being filled, starting with the saved tail
+    index := int(offset / file.ChunkSize)
+    chunkStart := int64(index) * file.ChunkSize
+    buf := make([]byte, file.ChunkSize)
+    filled := int(offset - chunkStart)
+    if filled > 0 {
+        tail, err := s.store.storage.OpenObject(ctx, tailObjectName(fileID, offset))
+        if err != nil {
+            return nil, apperr.ErrStorage.Wrap(err)
+        }
+        _, err = io.ReadFull(tail, buf[:filled])
+        tail.Close()
+        if err != nil {
+            return nil, apperr.ErrStorage.Wrap(err)
+        }
+    }
+
+    var readErr error
+    for chunkStart < size {
+        chunkLen := file.ChunkSize
+        if size-chunkStart < chunkLen {
+            chunkLen = size - chunkStart
+        }
+        n, err := io.ReadFull(body, buf[filled:chunkLen])
+        filled += n
+        if int64(filled) == chunkLen {
+            if err := hold(); err != nil {
+                return nil, err
+            }
+            if err := s.store.storage.PutChunk(writeCtx, fileID, index, bytes.NewReader(buf[:filled]), chunkLen); err != nil {
+                return nil, apperr.ErrStorage.Wrap(err)
+            }
+            index++
+            chunkStart += chunkLen
+            filled = 0
+        }
+        if err != nil {
+            if err != io.EOF && err != io.ErrUnexpectedEOF {
+                readErr = err
+            }
+            break
+        }
+    }
+
+    if checksum != nil && (readErr != nil || !bytes.Equal(checksum.Hash.Sum(nil), checksum.Expected)) {
+        return nil, ErrChecksumMismatch
+    }
+    newOffset := chunkStart + int64(filled)
+    if newOffset == offset {
+        if readErr != nil {
+            return nil, readErr
+        }
+        return file, nil
+    }
+
+    if filled > 0 {
+        if err := hold(); err != nil {
+            return nil, err
+        }
+        if err := s.store.storage.PutObject(writeCtx, tailObjectName(fileID, newOffset), bytes.NewReader(buf[:filled]), int64(filled)); err != nil {
+            return nil, apperr.ErrStorage.Wrap(err)
+        }
+    }
+    advanced, err := s.store.minioRepo.AdvanceUploadOffset(writeCtx, fileID, offset, newOffset, lease)
+    if err != nil {
+        return nil, err
+    }
+    if !advanced {
+        return nil, ErrUploadOffsetMismatch
+    }
+    file.UploadOffset = newOffset
+
+    if offset%file.ChunkSize != 0 {
+        if err := s.store.storage.RemoveObject(writeCtx, tailObjectName(fileID, offset)); err != nil {
+            log.Printf("Failed to remove tail of upload %s: %v", fileID, err)
+        }
+    }
+
+    if newOffset == size {
+        if err := s.store.finish(writeCtx, file); err != nil {
+            return nil, err
+        }
+    }
+    return file, nil
+}
+
+// Terminate discards an unfinished upload and gives its size back to the
+// quota.
+func (s *TusService) Terminate(ctx context.Context, user *models.User, fileID string) error {
+    file, err := s.store.minioRepo.GetFileByID_MinIO(ctx, fileID)
+    if err != nil {
+        return err
+    }
+    if file.UserID != user.UserID {
+        return repository.ErrFileNotFound
+    }
+    if file.Complete {
+        return ErrUploadFinished
+    }
+    return s.store.Delete(ctx, file)
+}
+
+// expireUpload removes an upload that is still unfinished at its expiry.
+func (s *TusService) expireUpload(ctx context.Context, job *models.Job) error {
+    file, err := s.store.minioRepo.GetFileByID_MinIO(ctx, job.Payload["fileId"])
+    if errors.Is(err, repository.ErrFileNotFound) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if file.Complete || file.UploadExpiresAt == nil || time.Now().Before(*file.UploadExpiresAt) {
+        return nil
+    }
+    return s.store.Delete(ctx, file)
+}
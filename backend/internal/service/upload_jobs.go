@@ -0,0 +1,357 @@
+// internal/service/upload_jobs.go
+package service
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "image"
+    _ "image/gif"
+    "image/jpeg"
+    _ "image/png"
+    "io"
+    "log"
+    "strings"
+    "time"
+
+    "backend/internal/models"
+    "backend/internal/repository"
+
+    "github.com/minio/minio-go/v7"
+)
+
+// Job types for post-upload processing.
+const (
+    JobVerifyChecksum    = "verify_checksum"
+    JobComposeChunks     = "compose_chunks"
+    JobGenerateThumbnail = "generate_thumbnail"
+    JobScanFile          = "scan_file"
+    JobReconcileQuota    = "reconcile_quota"
+)
+
+const (
+    thumbnailMaxSide   = 256
+    thumbnailMaxPixels = 40_000_000
+    // thumbnailMaxBytes is the largest image a thumbnail is made of
+    thumbnailMaxBytes = 64 * 1024 * 1024
+    // MinIO requires every part of a compose except the last to be >= 5MiB.
+    composeMinPartSize = 5 * 1024 * 1024
+)
+
+// UploadJobs holds the handlers for work triggered by upload completion.
+type UploadJobs struct {
+    minioRepo *repository.MinIOFileRepository
+    userRepo  *repository.UserRepository
+    uploads   *repository.MultipartUploadRepository
+    storage   *StorageService
+    scanner   Scanner
+}
+
+// NewUploadJobs returns the handlers. A nil scanner means NoScanner.
+func NewUploadJobs(minioRepo *repository.MinIOFileRepository, userRepo *repository.UserRepository, uploads *repository.MultipartUploadRepository, storage *StorageService, scanner Scanner) *UploadJobs {
+    if scanner == nil {
+        scanner = NoScanner{}
+    }
+    return &UploadJobs{
+        minioRepo: minioRepo,
+        userRepo:  userRepo,
+        uploads:   uploads,
+        storage:   storage,
+        scanner:   scanner,
+    }
+}
+
+// Register adds all upload job handlers to queue.
+func (j *UploadJobs) Register(queue *JobQueue) {
+    queue.Register(JobVerifyChecksum, j.verifyChecksum)
+    queue.Register(JobComposeChunks, j.composeChunks)
+    queue.Register(JobGenerateThumbnail, j.generateThumbnail)
+    queue.Register(JobScanFile, j.scanFile)
+    queue.Register(JobReconcileQuota, j.reconcileQuota)
+}
+
+// EnqueueForCompletedUpload schedules the standard processing for a file
+// whose chunks have all been uploaded.
+func EnqueueForCompletedUpload(ctx context.Context, queue *JobQueue, file *models.FileMinIO) error {
+    fileID := file.ID.Hex()
+    jobs := map[string]map[string]string{
+        JobVerifyChecksum: {"fileId": fileID},
+        JobScanFile:       {"fileId": fileID},
+        JobReconcileQuota: {"userId": file.UserID},
+    }
+    if isThumbnailable(file.FileType) {
+        jobs[JobGenerateThumbnail] = map[string]string{"fileId": fileID}
+    }
+    if isComposable(file) {
+        jobs[JobComposeChunks] = map[string]string{"fileId": fileID}
+    }
+
+    for jobType, payload := range jobs {
+        if _, err := queue.Enqueue(ctx, jobType, payload); err != nil {
+            return fmt.Errorf("failed to enqueue %s: %w", jobType, err)
+        }
+    }
+    return nil
+}
+
+func (j *UploadJobs) loadFile(ctx context.Context, job *models.Job) (*models.FileMinIO, error) {
+    fileID := job.Payload["fileId"]
+    if fileID == "" {
+        return nil, Permanent(fmt.Errorf("payload is missing fileId"))
+    }
+    file, err := j.minioRepo.GetFileByID_MinIO(ctx, fileID)
+    if err != nil {
+        return nil, Permanent(err)
+    }
+    return file, nil
+}
+
+// verifyChecksum streams every chunk, checks the total size against the
+// declared file size and stores the SHA-256 of the content.
+func (j *UploadJobs) verifyChecksum(ctx context.Context, job *models.Job) error {
+    file, err := j.loadFile(ctx, job)
+    if err != nil {
+        return err
+    }
+
+    reader := j.storage.OpenFile(ctx, file)
+    defer reader.Close()
+
+    hash := sha256.New()
+    written, err := io.Copy(hash, reader)
+    if err != nil {
+        return fmt.Errorf("failed to read file content: %w", err)
+    }
+    if float64(written) != file.Size {
+        // Presigned chunk uploads can't enforce the declared size, so the
+        // stored size is what counts against the quota
+        corrected, err := j.minioRepo.CorrectSize(ctx, file.ID.Hex(), file.Size, float64(written))
+        if err != nil {
+            return err
+        }
+        if corrected {
+            if err := j.userRepo.DecreaseUsedStorage(ctx, file.UserID, file.Size-float64(written)); err != nil {
+                return err
+            }
+        }
+        return Permanent(fmt.Errorf("size mismatch: declared %.0f bytes, stored %d bytes", file.Size, written))
+    }
+
+    checksum := hex.EncodeToString(hash.Sum(nil))
+    if err := j.minioRepo.UpdateChecksum(ctx, file.ID.Hex(), checksum); err != nil {
+        return err
+    }
+    log.Printf("Verified checksum of file %s: %s", file.ID.Hex(), checksum)
+    return nil
+}
+
+// composeChunks merges the chunk objects into a single "<fileID>/object"
+// and records it as the file's MinIO path. The chunks stay, since reads
+// and chunk downloads use them.
+func (j *UploadJobs) composeChunks(ctx context.Context, job *models.Job) error {
+    file, err := j.loadFile(ctx, job)
+    if err != nil {
+        return err
+    }
+    if file.TotalChunks == 0 {
+        return Permanent(fmt.Errorf("file has no chunks"))
+    }
+
+    client, bucket := j.storage.Client(), j.storage.Bucket()
+    sources := make([]minio.CopySrcOptions, 0, file.TotalChunks)
+    for i := 0; i < file.TotalChunks; i++ {
+        objectName := ChunkObjectName(file.ID.Hex(), i)
+        info, err := client.StatObject(ctx, bucket, objectName, minio.StatObjectOptions{})
+        if err != nil {
+            return fmt.Errorf("failed to stat chunk %d: %w", i, err)
+        }
+        if i < file.TotalChunks-1 && info.Size < composeMinPartSize {
+            return Permanent(fmt.Errorf("chunk %d is %d bytes, below the 5MiB compose minimum", i, info.Size))
+        }
+        sources = append(sources, minio.CopySrcOptions{Bucket: bucket, Object: objectName})
+    }
+
+    target := file.ID.Hex() + "/object"
+    dst := minio.CopyDestOptions{Bucket: bucket, Object: target}
+    if _, err := client.ComposeObject(ctx, dst, sources...); err != nil {
+        return fmt.Errorf("failed to compose chunks: %w", err)
+    }
+
+    return j.minioRepo.UpdateMinIOPath(ctx, file.ID.Hex(), target)
+}
+
+// generateThumbnail stores a JPEG no larger than thumbnailMaxSide on either
+// side next to the file's chunks. Images over thumbnailMaxBytes are
+// skipped, and no more than that is read whatever the stored size.
+func (j *UploadJobs) generateThumbnail(ctx context.Context, job *models.Job) error {
+    file, err := j.loadFile(ctx, job)
+    if err != nil {
+        return err
+    }
+    if !isThumbnailable(file.FileType) {
+        return Permanent(fmt.Errorf("file type %q does not support thumbnails", file.FileType))
+    }
+
+    if file.Size > thumbnailMaxBytes {
+        return Permanent(fmt.Errorf("image is too large for a thumbnail (%.0f bytes)", file.Size))
+    }
+
+    reader := j.storage.OpenFile(ctx, file)
+    defer reader.Close()
+    limited := &readErrors{r: io.LimitReader(reader, thumbnailMaxBytes)}
+
+    // The header is read first, so huge dimensions are refused before
+    // anything is decoded; what it consumed is replayed for the decoder
+    var header bytes.Buffer
+    cfg, _, err := image.DecodeConfig(io.TeeReader(limited, &header))
+    if limited.err != nil {
+        return fmt.Errorf("failed to read file content: %w", limited.err)
+    }
+    if err != nil {
+        return Permanent(fmt.Errorf("failed to decode image header: %w", err))
+    }
+    if cfg.Width*cfg.Height > thumbnailMaxPixels {
+        return Permanent(fmt.Errorf("image is too large for a thumbnail (%dx%d)", cfg.Width, cfg.Height))
+    }
+
+    src, _, err := image.Decode(io.MultiReader(&header, limited))
+    if limited.err != nil {
+        return fmt.Errorf("failed to read file content: %w", limited.err)
+    }
+    if err != nil {
+        return Permanent(fmt.Errorf("failed to decode image: %w", err))
+    }
+
+    var buf bytes.Buffer
+    if err := jpeg.Encode(&buf, scaleDown(src, thumbnailMaxSide), &jpeg.Options{Quality: 80}); err != nil {
+        return fmt.Errorf("failed to encode thumbnail: %w", err)
+    }
+
+    target := file.ID.Hex() + "/thumbnail.jpg"
+    _, err = j.storage.Client().PutObject(ctx, j.storage.Bucket(), target, &buf, int64(buf.Len()), minio.PutObjectOptions{
+        ContentType: "image/jpeg",
+    })
+    if err != nil {
+        return fmt.Errorf("failed to store thumbnail: %w", err)
+    }
+
+    return j.minioRepo.UpdateThumbnailPath(ctx, file.ID.Hex(), target)
+}
+
+// readErrors remembers the first error its reader returned other than
+// io.EOF, telling storage failures, which are retried, from undecodable
+// content.
+type readErrors struct {
+    r   io.Reader
+    err error
+}
+
+func (e *readErrors) Read(p []byte) (int, error) {
+    n, err := e.r.Read(p)
+    if err != nil && err != io.EOF && e.err == nil {
+        e.err = err
+    }
+    return n, err
+}
+
+// scanFile runs the file's content through the scanner and stores the
+// result. Infected files are flagged and logged, not removed.
+func (j *UploadJobs) scanFile(ctx context.Context, job *models.Job) error {
+    file, err := j.loadFile(ctx, job)
+    if err != nil {
+        return err
+    }
+
+    reader := j.storage.OpenFile(ctx, file)
+    defer reader.Close()
+
+    result, err := j.scanner.Scan(ctx, reader)
+    if err != nil {
+        return fmt.Errorf("failed to scan file: %w", err)
+    }
+    result.ScannedAt = time.Now()
+    if result.Status == models.ScanInfected {
+        log.Printf("File %s of user %s is infected: %s", file.ID.Hex(), file.UserID, strings.Join(result.Threats, ", "))
+    }
+    return j.minioRepo.UpdateScanResult(ctx, file.ID.Hex(), result)
+}
+
+// reconcileQuota recomputes a user's storage usage from their files and the
+// parts of their unfinished S3 multipart uploads.
+func (j *UploadJobs) reconcileQuota(ctx context.Context, job *models.Job) error {
+    userID := job.Payload["userId"]
+    if userID == "" {
+        return Permanent(fmt.Errorf("payload is missing userId"))
+    }
+
+    observed, _, err := j.userRepo.GetStorageUsedAndLimit(ctx, userID)
+    if err != nil {
+        return err
+    }
+    used, err := j.minioRepo.SumSizeByUser(ctx, userID)
+    if err != nil {
+        return err
+    }
+    pending, err := j.uploads.PendingSizeByUser(ctx, userID)
+    if err != nil {
+        return err
+    }
+    used += pending
+    // Only written if nothing was charged or released meanwhile;
+    // otherwise the job is retried
+    written, err := j.userRepo.SetStorageUsed(ctx, userID, observed, used)
+    if err != nil {
+        return err
+    }
+    if !written {
+        return fmt.Errorf("storage usage of user %s changed while reconciling", userID)
+    }
+    return nil
+}
+
+// isComposable reports whether file has several chunks, all but the last
+// of the size MinIO needs to compose them.
+func isComposable(file *models.FileMinIO) bool {
+    return file.TotalChunks > 1 && file.ChunkSize >= composeMinPartSize
+}
+
+func isThumbnailable(fileType string) bool {
+    switch strings.ToLower(fileType) {
+    case "image/jpeg", "image/jpg", "image/png", "image/gif":
+        return true
+    }
+    return false
+}
+
+// scaleDown resizes src with nearest-neighbour sampling so that neither side
+// exceeds maxSide. Images that already fit are returned unchanged.
+func scaleDown(src image.Image, maxSide int) image.Image {
+    bounds := src.Bounds()
+    width, height := bounds.Dx(), bounds.Dy()
+    if width <= maxSide && height <= maxSide {
+        return src
+    }
+
+    dstW, dstH := maxSide, height*maxSide/width
+    if height > width {
+        dstW, dstH = width*maxSide/height, maxSide
+    }
+    if dstW < 1 {
+        dstW = 1
+    }
+    if dstH < 1 {
+        dstH = 1
+    }
+
+    dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+    for y := 0; y < dstH; y++ {
+        sy := bounds.Min.Y + y*height/dstH
+        for x := 0; x < dstW; x++ {
+            sx := bounds.Min.X + x*width/dstW
+            dst.Set(x, y, src.At(sx, sy))
+        }
+    }
+    return dst
+}
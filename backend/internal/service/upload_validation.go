@@ -0,0 +1,122 @@
+// internal/service/upload_validation.go
+package service
+
+import (
+    "math"
+    "net/http"
+    "path"
+    "strings"
+
+    "backend/internal/apperr"
+)
+
+// UploadLimits bounds what a client may ask for when initializing an upload.
+type UploadLimits struct {
+    MaxFileSize  int64
+    MaxChunks    int
+    MinChunkSize int64
+    MaxChunkSize int64
+}
+
+// DefaultUploadLimits returns the limits used when nothing is configured.
+func DefaultUploadLimits() UploadLimits {
+    return UploadLimits{
+        MaxFileSize:  10 * 1024 * 1024 * 1024,
+        MaxChunks:    10000,
+        MinChunkSize: 256 * 1024,
+        MaxChunkSize: 64 * 1024 * 1024,
+    }
+}
+
+// UploadRequest is what a client declares when initializing an upload.
+type UploadRequest struct {
+    FileName    string
+    Folder      string
+    FileSize    float64
+    ChunkSize   int64
+    TotalChunks int
+}
+
+var ErrFileTooLarge = apperr.New(http.StatusRequestEntityTooLarge, apperr.CodeFileTooLarge, "File is too large")
+
+// invalidUpload reports the single constraint an upload request violated.
+// limit and value are included for numeric constraints.
+func invalidUpload(base *apperr.Error, field, constraint string, limit, value interface{}, format string, args ...interface{}) *apperr.Error {
+    details := map[string]interface{}{
+        "field":      field,
+        "constraint": constraint,
+    }
+    if limit != nil {
+        details["limit"] = limit
+    }
+    if value != nil {
+        details["value"] = value
+    }
+    return base.WithMessage(format, args...).WithDetails(details)
+}
+
+// Validate checks req against the limits and returns the first violated
+// constraint, or nil.
+func (l UploadLimits) Validate(req UploadRequest) *apperr.Error {
+    if strings.TrimSpace(req.FileName) == "" {
+        return invalidUpload(apperr.ErrValidation, "fileName", "required", nil, nil, "fileName is required")
+    }
+    if _, ok := CleanFolder(req.Folder); !ok {
+        return invalidUpload(apperr.ErrValidation, "folder", "path", nil, req.Folder, "folder must be a relative path without \"..\" segments")
+    }
+
+    if req.FileSize < 0 || req.FileSize != math.Trunc(req.FileSize) || math.IsInf(req.FileSize, 0) {
+        return invalidUpload(apperr.ErrValidation, "fileSize", "nonNegativeInteger", nil, req.FileSize, "fileSize must be a non-negative whole number of bytes")
+    }
+    if l.MaxFileSize > 0 && req.FileSize > float64(l.MaxFileSize) {
+        return invalidUpload(ErrFileTooLarge, "fileSize", "max", l.MaxFileSize, int64(req.FileSize), "fileSize exceeds the maximum of %d bytes", l.MaxFileSize)
+    }
+
+    if req.ChunkSize <= 0 {
+        return invalidUpload(apperr.ErrValidation, "chunkSize", "required", nil, nil, "chunkSize is required and must be positive")
+    }
+    if req.ChunkSize < l.MinChunkSize {
+        return invalidUpload(apperr.ErrValidation, "chunkSize", "min", l.MinChunkSize, req.ChunkSize, "chunkSize must be at least %d bytes", l.MinChunkSize)
+    }
+    if l.MaxChunkSize > 0 && req.ChunkSize > l.MaxChunkSize {
+        return invalidUpload(apperr.ErrValidation, "chunkSize", "max", l.MaxChunkSize, req.ChunkSize, "chunkSize must be at most %d bytes", l.MaxChunkSize)
+    }
+
+    if req.TotalChunks < 0 {
+        return invalidUpload(apperr.ErrValidation, "totalChunks", "min", 0, req.TotalChunks, "totalChunks cannot be negative")
+    }
+    if l.MaxChunks > 0 && req.TotalChunks > l.MaxChunks {
+        return invalidUpload(apperr.ErrValidation, "totalChunks", "max", l.MaxChunks, req.TotalChunks, "totalChunks exceeds the maximum of %d", l.MaxChunks)
+    }
+
+    expected := ExpectedChunks(int64(req.FileSize), req.ChunkSize)
+    if int64(req.TotalChunks) != expected {
+        return invalidUpload(apperr.ErrValidation, "totalChunks", "consistency", expected, req.TotalChunks,
+            "totalChunks must be %d for a fileSize of %d bytes split into %d byte chunks", expected, int64(req.FileSize), req.ChunkSize)
+    }
+
+    return nil
+}
+
+// CleanFolder normalizes a slash-separated folder path to "a/b" form, with
+// "" meaning the root. It reports false for paths that escape the root.
+func CleanFolder(folder string) (string, bool) {
+    folder = strings.ReplaceAll(strings.TrimSpace(folder), "\\", "/")
+    if len(folder) > 1024 {
+        return "", false
+    }
+    for _, segment := range strings.Split(folder, "/") {
+        if segment == ".." {
+            return "", false
+        }
+    }
+    return strings.Trim(path.Clean("/"+folder), "/"), true
+}
+
+// ExpectedChunks returns ceil(fileSize / chunkSize).
+func ExpectedChunks(fileSize int64, chunkSize int64) int64 {
+    if fileSize <= 0 {
+        return 0
+    }
+    return (fileSize + chunkSize - 1) / chunkSize
+}
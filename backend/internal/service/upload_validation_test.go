@@ -0,0 +1,107 @@
+package service
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"backend/internal/apperr"
+)
+
+func TestUploadLimitsValidate(t *testing.T) {
+	limits := UploadLimits{
+		MaxFileSize:  100 << 20,
+		MaxChunks:    100,
+		MinChunkSize: 1 << 20,
+		MaxChunkSize: 8 << 20,
+	}
+	valid := UploadRequest{FileName: "a.bin", FileSize: 10 << 20, ChunkSize: 4 << 20, TotalChunks: 3}
+	with := func(change func(*UploadRequest)) UploadRequest {
+		req := valid
+		change(&req)
+		return req
+	}
+
+	tests := []struct {
+		name      string
+		req       UploadRequest
+		wantField string
+		wantCode  apperr.Code
+	}{
+		{"valid", valid, "", ""},
+		{"empty file", with(func(r *UploadRequest) { r.FileSize, r.TotalChunks = 0, 0 }), "", ""},
+		{"exact multiple of chunkSize", with(func(r *UploadRequest) { r.FileSize, r.TotalChunks = 8<<20, 2 }), "", ""},
+		{"at max file size", with(func(r *UploadRequest) { r.FileSize, r.ChunkSize, r.TotalChunks = 100<<20, 8<<20, 13 }), "", ""},
+		{"missing file name", with(func(r *UploadRequest) { r.FileName = "  " }), "fileName", apperr.CodeValidationFailed},
+		{"negative fileSize", with(func(r *UploadRequest) { r.FileSize = -1 }), "fileSize", apperr.CodeValidationFailed},
+		{"non-integral fileSize", with(func(r *UploadRequest) { r.FileSize = 1.5 }), "fileSize", apperr.CodeValidationFailed},
+		{"NaN fileSize", with(func(r *UploadRequest) { r.FileSize = math.NaN() }), "fileSize", apperr.CodeValidationFailed},
+		{"infinite fileSize", with(func(r *UploadRequest) { r.FileSize = math.Inf(1) }), "fileSize", apperr.CodeValidationFailed},
+		{"oversized fileSize", with(func(r *UploadRequest) { r.FileSize = 100<<20 + 1 }), "fileSize", apperr.CodeFileTooLarge},
+		{"zero chunkSize", with(func(r *UploadRequest) { r.ChunkSize = 0 }), "chunkSize", apperr.CodeValidationFailed},
+		{"negative chunkSize", with(func(r *UploadRequest) { r.ChunkSize = -1 }), "chunkSize", apperr.CodeValidationFailed},
+		{"chunkSize below min", with(func(r *UploadRequest) { r.ChunkSize = 1<<20 - 1 }), "chunkSize", apperr.CodeValidationFailed},
+		{"chunkSize above max", with(func(r *UploadRequest) { r.ChunkSize = 8<<20 + 1 }), "chunkSize", apperr.CodeValidationFailed},
+		{"negative totalChunks", with(func(r *UploadRequest) { r.TotalChunks = -1 }), "totalChunks", apperr.CodeValidationFailed},
+		{"too many chunks", with(func(r *UploadRequest) { r.TotalChunks = 101 }), "totalChunks", apperr.CodeValidationFailed},
+		{"too few chunks for size", with(func(r *UploadRequest) { r.TotalChunks = 2 }), "totalChunks", apperr.CodeValidationFailed},
+		{"too many chunks for size", with(func(r *UploadRequest) { r.TotalChunks = 4 }), "totalChunks", apperr.CodeValidationFailed},
+		{"chunks for an empty file", with(func(r *UploadRequest) { r.FileSize = 0 }), "totalChunks", apperr.CodeValidationFailed},
+		{"folder traversal", with(func(r *UploadRequest) { r.Folder = "a/../../etc" }), "folder", apperr.CodeValidationFailed},
+		{"folder traversal with backslashes", with(func(r *UploadRequest) { r.Folder = `a\..\..\etc` }), "folder", apperr.CodeValidationFailed},
+		{"absolute folder", with(func(r *UploadRequest) { r.Folder = "/docs/2024" }), "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := limits.Validate(tt.req)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want an error on %s", tt.wantField)
+			}
+			if err.Code != tt.wantCode {
+				t.Errorf("code = %s, want %s", err.Code, tt.wantCode)
+			}
+			if field := err.Details["field"]; field != tt.wantField {
+				t.Errorf("field = %v, want %s", field, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestCleanFolder(t *testing.T) {
+	tests := []struct {
+		folder string
+		want   string
+		wantOK bool
+	}{
+		{"", "", true},
+		{"/", "", true},
+		{"docs", "docs", true},
+		{"docs/2024/", "docs/2024", true},
+		{"/docs/2024", "docs/2024", true},
+		{"//docs//./2024", "docs/2024", true},
+		{`docs\2024`, "docs/2024", true},
+		{`\docs\2024\`, "docs/2024", true},
+		{"  docs  ", "docs", true},
+		{"..", "", false},
+		{"../docs", "", false},
+		{"docs/..", "", false},
+		{"docs/../../etc", "", false},
+		{"/../etc", "", false},
+		{`..\etc`, "", false},
+		{`docs\..\..\etc`, "", false},
+		{"docs/..hidden", "docs/..hidden", true},
+		{strings.Repeat("a", 1025), "", false},
+	}
+	for _, tt := range tests {
+		got, ok := CleanFolder(tt.folder)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("CleanFolder(%q) = %q, %v, want %q, %v", tt.folder, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
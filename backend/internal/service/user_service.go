@@ -3,32 +3,29 @@ package service
 
 import (
     "context"
-    "time"
     "errors"
     "log"
-    "fmt"
+    "net/http"
+    "backend/internal/apperr"
     "backend/internal/models"
     "backend/internal/repository"
     "backend/utils"
 )
 
 type UserService struct {
-    repo *repository.UserRepository
+    repo  *repository.UserRepository
+    guard *LoginGuard
 }
 
-func NewUserService(repo *repository.UserRepository) *UserService {
-    return &UserService{repo: repo}
+func NewUserService(repo *repository.UserRepository, guard *LoginGuard) *UserService {
+    return &UserService{repo: repo, guard: guard}
 }
 
 func (s *UserService) RegisterUser(user models.User) error {
     // Check for duplicates first
-    exists, message, err := s.repo.CheckDuplicate(context.Background(), user.Email, user.Name)
-    if err != nil {
+    if err := s.repo.CheckDuplicate(context.Background(), user.Email, user.Name); err != nil {
         return err
     }
-    if exists {
-        return fmt.Errorf(message)
-    }
 
     hashedPassword, err := utils.HashPassword(user.Password)
     if err != nil {
@@ -39,52 +36,77 @@ func (s *UserService) RegisterUser(user models.User) error {
     return s.repo.Create(context.Background(), &user)
 }
 
-func (s *UserService) AuthenticateUser(email, password string) (*models.User, error) {
-    user, err := s.repo.FindByEmail(context.Background(), email)
-    if err != nil {
-        return nil, err
-    }
-
-    if err := utils.VerifyPassword(user.Password, password); err != nil {
-        return nil, err
-    }
-
-    return user, nil
+func (s *UserService) GenerateToken(user *models.User) (string, error) {
+    return utils.GenerateJWT(user.ID.Hex(), user.SessionVersion)
 }
 
-func (s *UserService) GenerateToken(user *models.User) (string, error) {
-    return utils.GenerateJWT(user.ID.Hex())
+// SessionValid is the middleware.SessionCheck of session tokens: a token
+// is valid while its account exists and is at the same session version.
+func (s *UserService) SessionValid(ctx context.Context, accountID string, version int) (bool, error) {
+    current, err := s.repo.SessionVersion(ctx, accountID)
+    if errors.Is(err, repository.ErrUserNotFound) || errors.Is(err, repository.ErrInvalidID) {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    return current == version, nil
 }
 
-var ErrAccountLocked = errors.New("account is locked")
-var ErrInvalidCredentials = errors.New("Invalid Credentials. Account is locked")
+var ErrInvalidCredentials = apperr.New(http.StatusUnauthorized, apperr.CodeInvalidCredentials, "Invalid credentials")
+var ErrAccountDisabled = apperr.New(http.StatusForbidden, apperr.CodeAccountDisabled, "Account is disabled")
 
-func (s *UserService) HandleLoginAttempt(ctx context.Context, email, password, ipAddress string) (*models.User, error) {
-    user, err := s.repo.FindByEmail(ctx, email)
+// HandleLoginAttempt signs a user in through the LoginGuard. Unknown
+// emails and wrong passwords get the same error after the same amount of
+// work; whether an account is disabled is only revealed to someone who
+// knows its password. For users with two-factor authentication the login
+// only completes in MFAService.CompleteLogin.
+func (s *UserService) HandleLoginAttempt(ctx context.Context, email, password, captchaToken, ipAddress string) (*models.User, error) {
+    // The attempt counts as failed unless it's refunded below
+    reserved, outcome, err := s.guard.check(ctx, email, ipAddress, captchaToken)
     if err != nil {
+        if outcome != "" {
+            s.guard.audit(ctx, email, ipAddress, nil, outcome)
+        }
         return nil, err
     }
 
-    // Check lock status
-    if user.IsLocked {
-        if user.LockExpiresAt != nil && time.Now().Before(*user.LockExpiresAt) {
-            return nil, ErrAccountLocked
+    user, err := s.repo.FindByEmail(ctx, email)
+    if err != nil {
+        if !errors.Is(err, repository.ErrUserNotFound) {
+            reserved.refund(ctx)
+            return nil, err
         }
-        // Reset lock if expired
-        s.repo.UpdateLockStatus(ctx, user.ID, nil)
+        compareDummy(password)
+        s.guard.audit(ctx, email, ipAddress, nil, models.LoginUnknownEmail)
+        return nil, ErrInvalidCredentials
     }
 
     // Verify password
     if err := utils.VerifyPassword(user.Password, password); err != nil {
-        // Handle failed attempt
-        if user.FailedAttempts >= 4 {
-            lockExpiry := time.Now().Add(15 * time.Minute)
-            s.repo.UpdateLockStatus(ctx, user.ID, &lockExpiry)
+        s.guard.audit(ctx, email, ipAddress, user, models.LoginBadPassword)
+        if err := s.repo.UpdateLoginStats(ctx, user.ID, ipAddress, false); err != nil {
+            log.Printf("Failed to update login stats: %v", err)
         }
-        s.repo.UpdateLoginStats(ctx, user.ID, ipAddress, false)
         return nil, ErrInvalidCredentials
     }
 
+    // The password was right
+    reserved.refund(ctx)
+
+    if user.IsDisabled {
+        s.guard.audit(ctx, email, ipAddress, user, models.LoginDisabled)
+        return nil, ErrAccountDisabled
+    }
+
+    if user.TOTPEnabled {
+        s.guard.audit(ctx, email, ipAddress, user, models.LoginMFARequired)
+        return user, nil
+    }
+
+    s.guard.succeed(ctx, user)
+    s.guard.audit(ctx, email, ipAddress, user, models.LoginSucceeded)
+
     // Update successful login stats
     err = s.repo.UpdateLoginStats(ctx, user.ID, ipAddress, true)
     if err != nil {
@@ -92,4 +114,4 @@ func (s *UserService) HandleLoginAttempt(ctx context.Context, email, password, i
     }
 
     return user, nil
-}
\ No newline at end of file
+}
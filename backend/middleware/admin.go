@@ -0,0 +1,42 @@
+// middleware/admin.go
+package middleware
+
+import (
+    "context"
+    "net/http"
+
+    "backend/internal/apperr"
+    "backend/internal/models"
+)
+
+const authUserKey contextKey = "authUser"
+
+// UserLookup loads an account by the ID carried in the token.
+type UserLookup func(ctx context.Context, accountID string) (*models.User, error)
+
+// RequireAdmin must run after RequireAuth. It loads the authenticated
+// account and rejects the request unless it is an enabled admin.
+func RequireAdmin(lookup UserLookup) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            user, err := lookup(r.Context(), AuthUserID(r.Context()))
+            if err != nil {
+                apperr.Write(w, r, apperr.ErrInvalidToken)
+                return
+            }
+            if !user.IsAdmin() || user.IsDisabled {
+                apperr.Write(w, r, apperr.ErrForbidden.WithMessage("Admin access required"))
+                return
+            }
+
+            ctx := context.WithValue(r.Context(), authUserKey, user)
+            next.ServeHTTP(w, r.WithContext(ctx))
+        })
+    }
+}
+
+// AuthUser returns the account loaded by RequireAdmin, or nil.
+func AuthUser(ctx context.Context) *models.User {
+    user, _ := ctx.Value(authUserKey).(*models.User)
+    return user
+}
@@ -1,24 +1,29 @@
 package middleware
 
 import (
+    "backend/internal/apperr"
     "backend/utils"
+    "context"
     "net/http"
+    "strings"
+    "time"
 
 		"github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v4"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
     return func(c *gin.Context) {
         tokenString := c.GetHeader("Authorization")
         if tokenString == "" {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+            apperr.Write(c.Writer, c.Request, apperr.ErrUnauthorized)
             c.Abort()
             return
         }
 
         token, err := utils.ValidateJWT(tokenString)
         if err != nil || !token.Valid {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+            apperr.Write(c.Writer, c.Request, apperr.ErrInvalidToken)
             c.Abort()
             return
         }
@@ -26,3 +31,84 @@ func AuthMiddleware() gin.HandlerFunc {
         c.Next()
     }
 }
+
+type contextKey string
+
+const (
+    authUserIDKey   contextKey = "authUserID"
+    authSignedInKey contextKey = "authSignedIn"
+)
+
+// SessionCheck reports whether the account still accepts tokens issued at
+// the given session version. Accounts that no longer exist don't.
+type SessionCheck func(ctx context.Context, accountID string, version int) (bool, error)
+
+var sessionCheck SessionCheck
+
+// SetSessionCheck makes RequireAuth reject tokens of ended sessions. Without
+// it, every validly signed token is accepted until it expires.
+func SetSessionCheck(check SessionCheck) {
+    sessionCheck = check
+}
+
+// RequireAuth validates the bearer token and stores the authenticated
+// account ID (the user's ObjectID hex) in the request context.
+func RequireAuth(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+        if tokenString == "" {
+            apperr.Write(w, r, apperr.ErrUnauthorized)
+            return
+        }
+
+        token, err := utils.ValidateJWT(tokenString)
+        if err != nil || !token.Valid {
+            apperr.Write(w, r, apperr.ErrInvalidToken)
+            return
+        }
+
+        claims, ok := token.Claims.(jwt.MapClaims)
+        if !ok {
+            apperr.Write(w, r, apperr.ErrInvalidToken)
+            return
+        }
+        accountID, _ := claims["userID"].(string)
+        if accountID == "" {
+            apperr.Write(w, r, apperr.ErrInvalidToken)
+            return
+        }
+        if sessionCheck != nil {
+            // Tokens from before session versions existed count as version 0
+            version, _ := claims["sv"].(float64)
+            valid, err := sessionCheck(r.Context(), accountID, int(version))
+            if err != nil {
+                apperr.Write(w, r, apperr.ErrInternal.Wrap(err))
+                return
+            }
+            if !valid {
+                apperr.Write(w, r, apperr.ErrInvalidToken.WithMessage("Session has ended, sign in again"))
+                return
+            }
+        }
+
+        ctx := context.WithValue(r.Context(), authUserIDKey, accountID)
+        // Tokens from before iat was added count as signed in long ago
+        if issuedAt, ok := claims["iat"].(float64); ok {
+            ctx = context.WithValue(ctx, authSignedInKey, time.Unix(int64(issuedAt), 0))
+        }
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
+
+// AuthUserID returns the account ID stored by RequireAuth.
+func AuthUserID(ctx context.Context) string {
+    accountID, _ := ctx.Value(authUserIDKey).(string)
+    return accountID
+}
+
+// AuthSignedInAt returns when the session validated by RequireAuth was
+// signed in, or the zero time when the token doesn't say.
+func AuthSignedInAt(ctx context.Context) time.Time {
+    signedIn, _ := ctx.Value(authSignedInKey).(time.Time)
+    return signedIn
+}
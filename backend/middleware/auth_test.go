@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/utils"
+)
+
+func TestRequireAuthRejectsEndedSessions(t *testing.T) {
+	if err := utils.InitJWT("test-secret-test-secret-test-secret", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	SetSessionCheck(func(_ context.Context, accountID string, version int) (bool, error) {
+		return accountID == "account" && version == 2, nil
+	})
+	defer SetSessionCheck(nil)
+
+	handler := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name      string
+		accountID string
+		version   int
+		want      int
+	}{
+		{"current session", "account", 2, http.StatusNoContent},
+		{"ended session", "account", 1, http.StatusUnauthorized},
+		{"deleted account", "other", 2, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := utils.GenerateJWT(tt.accountID, tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// middleware/client_cert.go
+package middleware
+
+import (
+    "net/http"
+
+    "backend/internal/apperr"
+)
+
+// RequireClientCert rejects requests whose TLS connection didn't present a
+// client certificate verified against the server's client CA bundle.
+func RequireClientCert(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+            apperr.Write(w, r, apperr.ErrForbidden.WithMessage("Client certificate required"))
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
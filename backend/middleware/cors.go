@@ -4,35 +4,95 @@ package middleware
 import (
     "log"
     "net/http"
+    "strings"
 )
 
-func CORS(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        // Log incoming request
-        log.Printf("Incoming %s request to %s", r.Method, r.URL.Path)
-
-        // Set CORS headers
-        w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
-        w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-        w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization, X-Requested-With,X-Content-Encrypted")
-        w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-        // Handle preflight
-        if r.Method == "OPTIONS" {
-            log.Printf("Handling OPTIONS preflight request")
-            w.WriteHeader(http.StatusOK)
-            return
-        }
-        log.Printf("Incoming %s request to %s", r.Method, r.URL.Path)
-        // Log request body size for POST requests
-        if r.Method == "POST" {
-            log.Printf("Content-Length: %d bytes", r.ContentLength)
-        }
+// CORSOptions configures cross-origin access to the API.
+type CORSOptions struct {
+    // AllowedOrigins are origins such as https://app.example.com. A leading
+    // "*." label matches any subdomain; "*" alone allows every origin, but
+    // without credentials.
+    AllowedOrigins []string
+    AllowedMethods []string
+    AllowedHeaders []string
+}
+
+// exposedHeaders are the response headers clients need to read.
+const exposedHeaders = "X-Request-ID, Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Tus-Checksum-Algorithm, " +
+    "Upload-Offset, Upload-Length, Upload-Metadata, Upload-Expires"
+
+// CORS answers preflight requests and adds CORS headers for allowed
+// origins. Origins listed explicitly or by subdomain may send credentials,
+// so the matching origin is echoed back; any other origin allowed by "*"
+// gets "*" and no credentials.
+func CORS(opts CORSOptions) func(http.Handler) http.Handler {
+    methods := strings.Join(opts.AllowedMethods, ", ")
+    headers := strings.Join(opts.AllowedHeaders, ", ")
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            // Log incoming request
+            log.Printf("Incoming %s request to %s", r.Method, r.URL.Path)
+
+            // Set CORS headers
+            w.Header().Add("Vary", "Origin")
+            if origin := r.Header.Get("Origin"); origin != "" {
+                if allowed, credentials := originAllowed(opts.AllowedOrigins, origin); allowed {
+                    if credentials {
+                        w.Header().Set("Access-Control-Allow-Origin", origin)
+                        w.Header().Set("Access-Control-Allow-Credentials", "true")
+                    } else {
+                        w.Header().Set("Access-Control-Allow-Origin", "*")
+                    }
+                    w.Header().Set("Access-Control-Allow-Methods", methods)
+                    w.Header().Set("Access-Control-Allow-Headers", headers)
+                    w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+                }
+            }
+
+            // Handle preflight. Other OPTIONS requests to the tus endpoint are
+            // protocol discovery and go to its handler.
+            if r.Method == "OPTIONS" && (r.Header.Get("Access-Control-Request-Method") != "" || !strings.HasPrefix(r.URL.Path, "/api/tus")) {
+                log.Printf("Handling OPTIONS preflight request")
+                w.WriteHeader(http.StatusOK)
+                return
+            }
+            log.Printf("Incoming %s request to %s", r.Method, r.URL.Path)
+            // Log request body size for POST requests
+            if r.Method == "POST" {
+                log.Printf("Content-Length: %d bytes", r.ContentLength)
+            }
 
-        // Call the next handler
-        next.ServeHTTP(w, r)
+            // Call the next handler
+            next.ServeHTTP(w, r)
         
-        // Log response
-        log.Printf("Completed request to %s", r.URL.Path)
-    })
-}
\ No newline at end of file
+            // Log response
+            log.Printf("Completed request to %s", r.URL.Path)
+        })
+    }
+}
+
+// originAllowed reports whether origin matches one of the patterns, and
+// whether it may send credentials, which a match of "*" may not.
+func originAllowed(patterns []string, origin string) (allowed, credentials bool) {
+    origin = strings.ToLower(origin)
+    for _, pattern := range patterns {
+        pattern = strings.ToLower(pattern)
+        if pattern == "*" {
+            allowed = true
+            continue
+        }
+        if pattern == origin {
+            return true, true
+        }
+        // https://*.example.com matches https://a.example.com and
+        // https://a.b.example.com, not https://example.com
+        prefix, suffix, ok := strings.Cut(pattern, "*")
+        if !ok || len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+            continue
+        }
+        if label := origin[len(prefix) : len(origin)-len(suffix)]; !strings.ContainsAny(label, "/:@") {
+            return true, true
+        }
+    }
+    return allowed, false
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name            string
+		patterns        []string
+		origin          string
+		wantAllowed     bool
+		wantCredentials bool
+	}{
+		{"exact", []string{"https://app.example.com"}, "https://app.example.com", true, true},
+		{"exact, other scheme", []string{"https://app.example.com"}, "http://app.example.com", false, false},
+		{"subdomain", []string{"https://*.example.com"}, "https://a.example.com", true, true},
+		{"nested subdomain", []string{"https://*.example.com"}, "https://a.b.example.com", true, true},
+		{"apex is not a subdomain", []string{"https://*.example.com"}, "https://example.com", false, false},
+		{"lookalike domain", []string{"https://*.example.com"}, "https://evil-example.com", false, false},
+		{"lookalike subdomain", []string{"https://*.example.com"}, "https://a.evil-example.com", false, false},
+		{"suffix of another domain", []string{"https://*.example.com"}, "https://a.example.com.evil.com", false, false},
+		{"mixed-case origin", []string{"https://*.example.com"}, "https://A.Example.COM", true, true},
+		{"mixed-case pattern", []string{"https://*.Example.com"}, "https://a.example.com", true, true},
+		{"port on origin only", []string{"https://*.example.com"}, "https://a.example.com:8443", false, false},
+		{"port on both", []string{"https://*.example.com:8443"}, "https://a.example.com:8443", true, true},
+		{"other port", []string{"https://*.example.com:8443"}, "https://a.example.com:9443", false, false},
+		{"userinfo in label", []string{"https://*.example.com"}, "https://user@a.example.com", false, false},
+		{"any origin", []string{"*"}, "https://evil.com", true, false},
+		{"any origin, listed one keeps credentials", []string{"*", "https://app.example.com"}, "https://app.example.com", true, true},
+		{"no patterns", nil, "https://app.example.com", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, credentials := originAllowed(tt.patterns, tt.origin)
+			if allowed != tt.wantAllowed || credentials != tt.wantCredentials {
+				t.Errorf("originAllowed(%q, %q) = %v, %v, want %v, %v", tt.patterns, tt.origin, allowed, credentials, tt.wantAllowed, tt.wantCredentials)
+			}
+		})
+	}
+}
+
+func TestCORSWildcardOmitsCredentials(t *testing.T) {
+	handler := CORS(CORSOptions{
+		AllowedOrigins: []string{"*", "https://app.example.com"},
+		AllowedMethods: []string{"GET"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		origin          string
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{"https://evil.com", "*", ""},
+		{"https://app.example.com", "https://app.example.com", "true"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/files", nil)
+		req.Header.Set("Origin", tt.origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", tt.origin, got, tt.wantOrigin)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %q, want %q", tt.origin, got, tt.wantCredentials)
+		}
+	}
+}
@@ -2,27 +2,123 @@
 package middleware
 
 import (
+    "context"
     "net"
     "net/http"
     "strings"
 )
 
+const clientIPKey contextKey = "clientIP"
+
+// RealIP records the client address ResolveClientIP finds, which GetIP
+// returns.
+func RealIP(proxies TrustedProxies) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            ctx := context.WithValue(r.Context(), clientIPKey, ResolveClientIP(r, proxies))
+            next.ServeHTTP(w, r.WithContext(ctx))
+        })
+    }
+}
+
+// GetIP returns the client address recorded by RealIP. Without it, only
+// the peer address is used, since forwarding headers can't be trusted.
 func GetIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-			return strings.Split(forwarded, ",")[0]
-	}
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-			return NormalizeIP(r.RemoteAddr)
-	}
-	return NormalizeIP(ip)
+    if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+        return ip
+    }
+    return ResolveClientIP(r, nil)
+}
+
+// ResolveClientIP finds the address of the client behind any trusted
+// proxies. Forwarding headers are only read when the peer is a trusted
+// proxy. The hops in Forwarded (RFC 7239), or else X-Forwarded-For, are
+// walked from the right, the proxy nearest to the server, and the first
+// address that isn't a trusted proxy is the client. X-Real-IP is used when
+// neither header is present. A hop that isn't an address ends the walk at
+// the last one verified.
+func ResolveClientIP(r *http.Request, proxies TrustedProxies) string {
+    client := parseIP(r.RemoteAddr)
+    if client == nil {
+        return NormalizeIP(r.RemoteAddr)
+    }
+    if !proxies.contains(client) {
+        return NormalizeIP(client.String())
+    }
+
+    var hops []string
+    if forwarded := r.Header.Values("Forwarded"); len(forwarded) > 0 {
+        hops = forwardedFor(forwarded)
+    } else if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+        for _, value := range xff {
+            hops = append(hops, strings.Split(value, ",")...)
+        }
+    } else if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+        hops = []string{realIP}
+    }
+
+    for i := len(hops) - 1; i >= 0; i-- {
+        ip := parseIP(hops[i])
+        if ip == nil {
+            break
+        }
+        client = ip
+        if !proxies.contains(client) {
+            break
+        }
+    }
+    return NormalizeIP(client.String())
 }
 
+// forwardedFor returns the for= parameter of every element of Forwarded
+// header values, in order. Elements without one yield "" so they still
+// count as a hop.
+func forwardedFor(values []string) []string {
+    var hops []string
+    for _, value := range values {
+        for _, element := range strings.Split(value, ",") {
+            hop := ""
+            for _, pair := range strings.Split(element, ";") {
+                key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+                if ok && strings.EqualFold(key, "for") {
+                    hop = strings.Trim(val, `"`)
+                }
+            }
+            hops = append(hops, hop)
+        }
+    }
+    return hops
+}
+
+// parseIP parses an address as it appears in forwarding headers: bare,
+// with a port, in brackets and with an IPv6 zone. Obfuscated identifiers
+// and "unknown" yield nil.
+func parseIP(raw string) net.IP {
+    raw = strings.TrimSpace(raw)
+    if host, _, err := net.SplitHostPort(raw); err == nil {
+        raw = host
+    }
+    raw = strings.TrimSuffix(strings.TrimPrefix(raw, "["), "]")
+    if i := strings.IndexByte(raw, '%'); i >= 0 {
+        raw = raw[:i]
+    }
+    return net.ParseIP(raw)
+}
 
+// NormalizeIP returns ip in canonical form. IPv4-mapped IPv6 addresses
+// become plain IPv4 and the IPv6 loopback becomes 127.0.0.1, so the same
+// client is always recorded the same way. Anything that isn't an address
+// is returned as is.
 func NormalizeIP(ip string) string {
-	if ip == "::1" {
-			return "127.0.0.1" // Normalize IPv6 loopback to IPv4 loopback
-	}
-	return ip
+    parsed := parseIP(ip)
+    if parsed == nil {
+        return ip
+    }
+    if parsed.Equal(net.IPv6loopback) {
+        return "127.0.0.1"
+    }
+    if ip4 := parsed.To4(); ip4 != nil {
+        return ip4.String()
+    }
+    return parsed.String()
 }
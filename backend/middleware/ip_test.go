@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:   "untrusted peer ignores headers",
+			remote: "203.0.113.7:5000",
+			headers: map[string]string{
+				"X-Forwarded-For": "198.51.100.1",
+				"X-Real-IP":       "198.51.100.2",
+			},
+			want: "203.0.113.7",
+		},
+		{
+			name:   "trusted peer without headers",
+			remote: "10.1.1.1:5000",
+			want:   "10.1.1.1",
+		},
+		{
+			name:    "single hop",
+			remote:  "10.1.1.1:5000",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "spoofed leftmost entry is skipped",
+			remote:  "10.1.1.1:5000",
+			headers: map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 10.2.2.2"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "all hops trusted",
+			remote:  "10.1.1.1:5000",
+			headers: map[string]string{"X-Forwarded-For": "10.3.3.3, 192.0.2.1"},
+			want:    "10.3.3.3",
+		},
+		{
+			name:    "garbage hop stops the walk",
+			remote:  "10.1.1.1:5000",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.1, not-an-ip, 10.2.2.2"},
+			want:    "10.2.2.2",
+		},
+		{
+			name:    "X-Real-IP",
+			remote:  "10.1.1.1:5000",
+			headers: map[string]string{"X-Real-IP": "198.51.100.9"},
+			want:    "198.51.100.9",
+		},
+		{
+			name:   "Forwarded takes precedence",
+			remote: "10.1.1.1:5000",
+			headers: map[string]string{
+				"Forwarded":       `for=198.51.100.3;proto=https, for="10.2.2.2:8080"`,
+				"X-Forwarded-For": "198.51.100.4",
+			},
+			want: "198.51.100.3",
+		},
+		{
+			name:    "Forwarded IPv6 with port",
+			remote:  "[::1]:5000",
+			headers: map[string]string{"Forwarded": `For="[2001:db9::17]:4711"`},
+			want:    "2001:db9::17",
+		},
+		{
+			name:    "Forwarded obfuscated identifier",
+			remote:  "10.1.1.1:5000",
+			headers: map[string]string{"Forwarded": "for=_hidden, for=10.2.2.2"},
+			want:    "10.2.2.2",
+		},
+		{
+			name:    "Forwarded element without for",
+			remote:  "10.1.1.1:5000",
+			headers: map[string]string{"Forwarded": "for=198.51.100.3, proto=https"},
+			want:    "10.1.1.1",
+		},
+		{
+			name:    "IPv4-mapped peer matches IPv4 proxy",
+			remote:  "[::ffff:10.1.1.1]:5000",
+			headers: map[string]string{"X-Forwarded-For": "::ffff:198.51.100.1"},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "IPv6 proxy network",
+			remote:  "[2001:db8::1]:5000",
+			headers: map[string]string{"X-Forwarded-For": "2001:DB9:0:0::5"},
+			want:    "2001:db9::5",
+		},
+		{
+			name:   "IPv6 loopback peer",
+			remote: "[::1]:5000",
+			want:   "127.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if got := ResolveClientIP(r, proxies); got != tt.want {
+				t.Errorf("ResolveClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetIPWithoutRealIPIgnoresHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.7:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	if got := GetIP(r); got != "203.0.113.7" {
+		t.Errorf("GetIP() = %q, want %q", got, "203.0.113.7")
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	handler := RealIP(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetIP(r)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.1.1.1:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got != "198.51.100.1" {
+		t.Errorf("GetIP() = %q, want %q", got, "198.51.100.1")
+	}
+}
+
+func TestNormalizeIP(t *testing.T) {
+	tests := map[string]string{
+		"::1":                  "127.0.0.1",
+		"::ffff:192.0.2.1":     "192.0.2.1",
+		"192.0.2.1":            "192.0.2.1",
+		"2001:DB8:0:0:0:0:0:1": "2001:db8::1",
+		"fe80::1%eth0":         "fe80::1",
+		"[2001:db8::2]":        "2001:db8::2",
+		"not-an-ip":            "not-an-ip",
+	}
+	for in, want := range tests {
+		if got := NormalizeIP(in); got != want {
+			t.Errorf("NormalizeIP(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[string]bool{
+		"192.0.2.1:80":      true,
+		"192.0.2.2:80":      false,
+		"[2001:db8::9]:443": true,
+		"[2001:db9::9]:443": false,
+		"::ffff:192.0.2.1":  true,
+		"garbage":           false,
+	} {
+		if got := proxies.Trusts(addr); got != want {
+			t.Errorf("Trusts(%q) = %v, want %v", addr, got, want)
+		}
+	}
+
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("ParseTrustedProxies accepted an invalid CIDR")
+	}
+}
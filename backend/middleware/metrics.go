@@ -27,6 +27,14 @@ var (
         },
         []string{"method", "path", "status"},
     )
+
+    rateLimitRejectionsTotal = promauto.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "rate_limit_rejections_total",
+            Help: "Total number of requests rejected by a rate limit policy",
+        },
+        []string{"policy", "key"},
+    )
 )
 
 // Middleware
@@ -0,0 +1,114 @@
+// middleware/proxy.go
+package middleware
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+const baseURLKey contextKey = "baseURL"
+
+// TrustedProxies are the peers whose forwarding headers are believed.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses addresses and CIDRs. A bare address trusts
+// only itself.
+func ParseTrustedProxies(entries []string) (TrustedProxies, error) {
+    proxies := make(TrustedProxies, 0, len(entries))
+    for _, entry := range entries {
+        if _, network, err := net.ParseCIDR(entry); err == nil {
+            proxies = append(proxies, network)
+            continue
+        }
+        ip := net.ParseIP(entry)
+        if ip == nil {
+            return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+        }
+        bits := 8 * net.IPv6len
+        if ip4 := ip.To4(); ip4 != nil {
+            ip, bits = ip4, 8*net.IPv4len
+        }
+        proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+    }
+    return proxies, nil
+}
+
+// Trusts reports whether the peer at addr, an address or host:port as in
+// RemoteAddr, is a trusted proxy.
+func (t TrustedProxies) Trusts(addr string) bool {
+    return t.contains(parseIP(addr))
+}
+
+func (t TrustedProxies) contains(ip net.IP) bool {
+    if ip == nil {
+        return false
+    }
+    for _, network := range t {
+        if network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+// ExternalURL records the base URL the client reached the server at, which
+// BaseURL returns. publicURL wins when set. Otherwise it is the request's
+// scheme and host, taken from X-Forwarded-Proto and X-Forwarded-Host when
+// the peer is a trusted proxy.
+func ExternalURL(publicURL string, proxies TrustedProxies) func(http.Handler) http.Handler {
+    publicURL = strings.TrimSuffix(publicURL, "/")
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            base := publicURL
+            if base == "" {
+                scheme, host := requestScheme(r), r.Host
+                if proxies.Trusts(r.RemoteAddr) {
+                    if proto := firstValue(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+                        scheme = proto
+                    }
+                    if fwdHost := firstValue(r.Header.Get("X-Forwarded-Host")); validHost(fwdHost) {
+                        host = fwdHost
+                    }
+                }
+                base = scheme + "://" + host
+            }
+            ctx := context.WithValue(r.Context(), baseURLKey, base)
+            next.ServeHTTP(w, r.WithContext(ctx))
+        })
+    }
+}
+
+// BaseURL returns the base URL recorded by ExternalURL, or the request's
+// own scheme and host when it didn't run.
+func BaseURL(r *http.Request) string {
+    if base, ok := r.Context().Value(baseURLKey).(string); ok {
+        return base
+    }
+    return requestScheme(r) + "://" + r.Host
+}
+
+func requestScheme(r *http.Request) string {
+    if r.TLS != nil {
+        return "https"
+    }
+    return "http"
+}
+
+// firstValue is the first entry of a comma-separated header, the one the
+// proxy closest to the client added.
+func firstValue(header string) string {
+    first, _, _ := strings.Cut(header, ",")
+    return strings.ToLower(strings.TrimSpace(first))
+}
+
+func validHost(host string) bool {
+    if host == "" {
+        return false
+    }
+    u, err := url.Parse("http://" + host)
+    return err == nil && u.Host == host && u.User == nil
+}
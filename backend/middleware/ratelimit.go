@@ -0,0 +1,166 @@
+// middleware/ratelimit.go
+package middleware
+
+import (
+    "context"
+    "log"
+    "math"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "backend/internal/apperr"
+)
+
+// RateLimitPolicy is a token bucket: a client may make Limit requests at
+// once, and regains the allowance evenly over Period.
+type RateLimitPolicy struct {
+    // Name identifies the policy in bucket keys and metrics
+    Name   string
+    Limit  int
+    Period time.Duration
+    // ByUser keys authenticated requests by account instead of client IP.
+    // The route must run RequireAuth first.
+    ByUser bool
+}
+
+// interval is how long the bucket takes to regain one token.
+func (p RateLimitPolicy) interval() time.Duration {
+    return p.Period / time.Duration(p.Limit)
+}
+
+// RateLimitStore holds token buckets. Take removes one token from the
+// bucket at key, which holds up to capacity tokens and regains one every
+// interval; a new bucket starts full. It reports whether a token was
+// available and how many are left afterwards.
+type RateLimitStore interface {
+    Take(ctx context.Context, key string, capacity int, interval time.Duration, now time.Time) (bool, float64, error)
+}
+
+// RateLimiter applies named policies to routes.
+type RateLimiter struct {
+    store    RateLimitStore
+    policies map[string]RateLimitPolicy
+}
+
+// NewRateLimiter returns a limiter for policies. Policies with a Limit of
+// zero are disabled.
+func NewRateLimiter(store RateLimitStore, policies ...RateLimitPolicy) *RateLimiter {
+    l := &RateLimiter{store: store, policies: map[string]RateLimitPolicy{}}
+    for _, policy := range policies {
+        if policy.Limit > 0 && policy.Period > 0 {
+            l.policies[policy.Name] = policy
+        }
+    }
+    return l
+}
+
+// Limit wraps next with the named policy. Requests over the limit get 429
+// with Retry-After; every limited response carries RateLimit-* headers. A
+// nil limiter or a disabled policy returns next unchanged. When the store
+// fails, requests are let through.
+func (l *RateLimiter) Limit(name string, next http.Handler) http.Handler {
+    if l == nil {
+        return next
+    }
+    policy, ok := l.policies[name]
+    if !ok {
+        return next
+    }
+    interval := policy.interval()
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == http.MethodOptions {
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        keyType, subject := "ip", GetIP(r)
+        if accountID := AuthUserID(r.Context()); policy.ByUser && accountID != "" {
+            keyType, subject = "user", accountID
+        }
+        allowed, tokens, err := l.store.Take(r.Context(), policy.Name+":"+keyType+":"+subject, policy.Limit, interval, time.Now())
+        if err != nil {
+            log.Printf("[%s] Rate limit store failed, allowing request: %v", apperr.RequestID(r.Context()), err)
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        h := w.Header()
+        h.Set("RateLimit-Policy", strconv.Itoa(policy.Limit)+";w="+strconv.Itoa(int(math.Ceil(policy.Period.Seconds()))))
+        h.Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+        h.Set("RateLimit-Remaining", strconv.Itoa(int(tokens)))
+        h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(time.Duration((float64(policy.Limit)-tokens)*float64(interval)))))
+        if !allowed {
+            retryAfter := ceilSeconds(time.Duration((1 - tokens) * float64(interval)))
+            h.Set("Retry-After", strconv.Itoa(retryAfter))
+            rateLimitRejectionsTotal.WithLabelValues(policy.Name, keyType).Inc()
+            apperr.Write(w, r, apperr.ErrRateLimited.WithDetails(map[string]interface{}{
+                "policy":     policy.Name,
+                "retryAfter": retryAfter,
+            }))
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+func ceilSeconds(d time.Duration) int {
+    if d <= 0 {
+        return 0
+    }
+    return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore keeps buckets in process memory. Each server
+// instance then enforces its own limits.
+type MemoryRateLimitStore struct {
+    mu        sync.Mutex
+    buckets   map[string]*tokenBucket
+    lastSweep time.Time
+}
+
+type tokenBucket struct {
+    tokens  float64
+    updated time.Time
+    // full is when the bucket will have refilled, after which it can be
+    // forgotten
+    full time.Time
+}
+
+// sweepInterval is how often full buckets are dropped from memory.
+const sweepInterval = time.Minute
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+    return &MemoryRateLimitStore{buckets: map[string]*tokenBucket{}}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, capacity int, interval time.Duration, now time.Time) (bool, float64, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if now.Sub(s.lastSweep) >= sweepInterval {
+        for k, b := range s.buckets {
+            if !now.Before(b.full) {
+                delete(s.buckets, k)
+            }
+        }
+        s.lastSweep = now
+    }
+
+    b, ok := s.buckets[key]
+    if !ok {
+        b = &tokenBucket{tokens: float64(capacity), updated: now}
+        s.buckets[key] = b
+    }
+    if elapsed := now.Sub(b.updated); elapsed > 0 {
+        b.tokens = math.Min(float64(capacity), b.tokens+float64(elapsed)/float64(interval))
+        b.updated = now
+    }
+    allowed := b.tokens >= 1
+    if allowed {
+        b.tokens--
+    }
+    b.full = now.Add(time.Duration((float64(capacity) - b.tokens) * float64(interval)))
+    return allowed, b.tokens, nil
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStoreRefills(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := store.Take(context.Background(), "k", 3, time.Second, now); !ok {
+			t.Fatalf("request %d rejected within the burst", i+1)
+		}
+	}
+	ok, tokens, _ := store.Take(context.Background(), "k", 3, time.Second, now)
+	if ok {
+		t.Fatal("request beyond the burst allowed")
+	}
+	if tokens != 0 {
+		t.Errorf("tokens = %v, want 0", tokens)
+	}
+
+	if ok, _, _ := store.Take(context.Background(), "k", 3, time.Second, now.Add(time.Second)); !ok {
+		t.Error("request rejected after a token was regained")
+	}
+	if ok, _, _ := store.Take(context.Background(), "other", 3, time.Second, now); !ok {
+		t.Error("buckets are not separated by key")
+	}
+}
+
+func TestRateLimiterRejectsWithHeaders(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryRateLimitStore(),
+		RateLimitPolicy{Name: "login", Limit: 2, Period: time.Minute},
+		RateLimitPolicy{Name: "off", Limit: 0, Period: time.Minute},
+	)
+	handler := limiter.Limit("login", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := request("192.0.2.1:1000"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, w.Code)
+		}
+	}
+	w := request("192.0.2.1:1000")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+	if got := w.Header().Get("RateLimit-Policy"); got != "2;w=60" {
+		t.Errorf("RateLimit-Policy = %q, want 2;w=60", got)
+	}
+
+	if w := request("192.0.2.2:1000"); w.Code != http.StatusOK {
+		t.Errorf("other client: status %d, want 200", w.Code)
+	}
+
+	off := limiter.Limit("off", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		off.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("disabled policy limited request %d", i+1)
+		}
+	}
+}
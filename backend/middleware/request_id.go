@@ -0,0 +1,46 @@
+// middleware/request_id.go
+package middleware
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "net/http"
+
+    "backend/internal/apperr"
+)
+
+// RequestID tags every request with an ID, reusing a well-formed incoming
+// X-Request-ID header. The ID is echoed in the response header and in error
+// bodies so client reports can be matched with server logs.
+func RequestID(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        requestID := r.Header.Get("X-Request-ID")
+        if !validRequestID(requestID) {
+            requestID = newRequestID()
+        }
+
+        w.Header().Set("X-Request-ID", requestID)
+        next.ServeHTTP(w, r.WithContext(apperr.WithRequestID(r.Context(), requestID)))
+    })
+}
+
+func validRequestID(id string) bool {
+    if id == "" || len(id) > 64 {
+        return false
+    }
+    for _, c := range id {
+        isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+        if !isAlnum && c != '-' && c != '_' && c != '.' {
+            return false
+        }
+    }
+    return true
+}
+
+func newRequestID() string {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "unknown"
+    }
+    return hex.EncodeToString(b)
+}
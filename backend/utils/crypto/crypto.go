@@ -19,6 +19,12 @@ func InitCrypto(key string) error {
 }
 
 func Decrypt(data string) ([]byte, error) {
+    return DecryptWithKey(data, secretKey)
+}
+
+// DecryptWithKey verifies and decodes an envelope produced with key. Clients
+// that talk to a server use it with the server's shared key.
+func DecryptWithKey(data string, key string) ([]byte, error) {
     // Split data and hash
     parts := strings.Split(data, ".")
     if len(parts) != 2 {
@@ -29,7 +35,7 @@ func Decrypt(data string) ([]byte, error) {
     
     // Verify hash
     h := sha256.New()
-    h.Write([]byte(base64Data + secretKey))
+    h.Write([]byte(base64Data + key))
     calculatedHash := hex.EncodeToString(h.Sum(nil))
     
     if hash != calculatedHash {
@@ -46,12 +52,18 @@ func Decrypt(data string) ([]byte, error) {
 }
 
 func Encrypt(data []byte) (string, error) {
+    return EncryptWithKey(data, secretKey)
+}
+
+// EncryptWithKey wraps data in an envelope that DecryptWithKey accepts with
+// the same key.
+func EncryptWithKey(data []byte, key string) (string, error) {
     // Encode data to base64
     base64Data := base64.StdEncoding.EncodeToString(data)
     
     // Create hash
     h := sha256.New()
-    h.Write([]byte(base64Data + secretKey))
+    h.Write([]byte(base64Data + key))
     hash := hex.EncodeToString(h.Sum(nil))
     
     // Combine data and hash
@@ -0,0 +1,70 @@
+package crypto
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "fmt"
+    "strings"
+)
+
+// sealVersion prefixes sealed values so the scheme can change later.
+const sealVersion = "v1:"
+
+// Sealer encrypts small secrets, such as TOTP keys, for storage with
+// AES-256-GCM. Unlike the request envelopes, its key never leaves the
+// server.
+type Sealer struct {
+    aead cipher.AEAD
+}
+
+// NewSealer derives the AES key from key with SHA-256.
+func NewSealer(key string) (*Sealer, error) {
+    if key == "" {
+        return nil, fmt.Errorf("sealing key cannot be empty")
+    }
+    sum := sha256.Sum256([]byte(key))
+    block, err := aes.NewCipher(sum[:])
+    if err != nil {
+        return nil, err
+    }
+    aead, err := cipher.NewGCM(block)
+    if err != nil {
+        return nil, err
+    }
+    return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts plaintext. context is authenticated but not stored, so a
+// value sealed for one record can't be opened for another.
+func (s *Sealer) Seal(plaintext []byte, context string) (string, error) {
+    nonce := make([]byte, s.aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return "", fmt.Errorf("failed to generate nonce: %w", err)
+    }
+    sealed := s.aead.Seal(nonce, nonce, plaintext, []byte(context))
+    return sealVersion + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value from Seal with the same context.
+func (s *Sealer) Open(sealed string, context string) ([]byte, error) {
+    encoded, ok := strings.CutPrefix(sealed, sealVersion)
+    if !ok {
+        return nil, fmt.Errorf("unknown sealed value format")
+    }
+    data, err := base64.RawStdEncoding.DecodeString(encoded)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decode sealed value: %w", err)
+    }
+    if len(data) < s.aead.NonceSize() {
+        return nil, fmt.Errorf("sealed value too short")
+    }
+    nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+    plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(context))
+    if err != nil {
+        return nil, fmt.Errorf("failed to open sealed value: %w", err)
+    }
+    return plaintext, nil
+}
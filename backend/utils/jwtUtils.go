@@ -1,24 +1,132 @@
 package utils
 
 import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
     "time"
 
     "github.com/golang-jwt/jwt/v4"
 )
 
-var jwtSecret = []byte("your_secret_key")
+var (
+    jwtSecret []byte
+    // mfaSecret signs MFA challenge tokens. It is derived from jwtSecret, so
+    // a challenge can never pass for a session token or the other way round.
+    mfaSecret []byte
+    jwtExpiry = 24 * time.Hour
+)
+
+// InitJWT sets the key session tokens are signed with and how long they
+// stay valid.
+func InitJWT(secret string, expiry time.Duration) error {
+    if secret == "" {
+        return fmt.Errorf("JWT secret cannot be empty")
+    }
+    jwtSecret = []byte(secret)
+    mac := hmac.New(sha256.New, jwtSecret)
+    mac.Write([]byte("storely mfa challenge"))
+    mfaSecret = mac.Sum(nil)
+    if expiry > 0 {
+        jwtExpiry = expiry
+    }
+    return nil
+}
 
-func GenerateJWT(userID string) (string, error) {
+// GenerateJWT issues a session token. sessionVersion is the account's
+// session version; the token stops working once that changes. iat records
+// when the user signed in.
+func GenerateJWT(userID string, sessionVersion int) (string, error) {
+    now := time.Now()
     claims := jwt.MapClaims{
         "userID": userID,
-        "exp":    time.Now().Add(time.Hour * 24).Unix(),
+        "sv":     sessionVersion,
+        "iat":    now.Unix(),
+        "exp":    now.Add(jwtExpiry).Unix(),
     }
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
     return token.SignedString(jwtSecret)
 }
 
+// ValidateJWT parses a session token. Tokens must be HMAC-signed with the
+// session key and carry a userID claim.
 func ValidateJWT(tokenString string) (*jwt.Token, error) {
-    return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+    token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+            return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+        }
         return jwtSecret, nil
     })
+    if err != nil {
+        return token, err
+    }
+    claims, ok := token.Claims.(jwt.MapClaims)
+    if !ok {
+        return token, fmt.Errorf("invalid token claims")
+    }
+    if userID, _ := claims["userID"].(string); userID == "" {
+        return token, fmt.Errorf("token is not a session token")
+    }
+    return token, nil
+}
+
+// MFAChallenge is what a token from GenerateMFAToken carries.
+type MFAChallenge struct {
+    // ID tells challenges apart, so each can be used only once
+    ID             string
+    AccountID      string
+    SessionVersion int
+    ExpiresAt      time.Time
+}
+
+// GenerateMFAToken issues the token that carries a login from the password
+// step to the second factor. It is signed with its own key and has no
+// userID claim, so ValidateJWT never accepts it as a session. Like session
+// tokens it carries the session version, so ending every session also
+// ends logins waiting for their second factor.
+func GenerateMFAToken(userID string, sessionVersion int, ttl time.Duration) (string, error) {
+    raw := make([]byte, 16)
+    if _, err := rand.Read(raw); err != nil {
+        return "", fmt.Errorf("failed to generate MFA token ID: %w", err)
+    }
+    claims := jwt.MapClaims{
+        "mfa": userID,
+        "sv":  sessionVersion,
+        "jti": hex.EncodeToString(raw),
+        "exp": time.Now().Add(ttl).Unix(),
+    }
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+    return token.SignedString(mfaSecret)
+}
+
+// ValidateMFAToken returns the challenge of a token from GenerateMFAToken.
+func ValidateMFAToken(tokenString string) (*MFAChallenge, error) {
+    token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+            return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+        }
+        return mfaSecret, nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("invalid MFA token: %w", err)
+    }
+    claims, ok := token.Claims.(jwt.MapClaims)
+    if !ok || !token.Valid {
+        return nil, fmt.Errorf("invalid MFA token claims")
+    }
+    userID, _ := claims["mfa"].(string)
+    id, _ := claims["jti"].(string)
+    version, hasVersion := claims["sv"].(float64)
+    exp, _ := claims["exp"].(float64)
+    if userID == "" || id == "" || !hasVersion || exp == 0 {
+        return nil, fmt.Errorf("invalid MFA token claims")
+    }
+    return &MFAChallenge{
+        ID:             id,
+        AccountID:      userID,
+        SessionVersion: int(version),
+        ExpiresAt:      time.Unix(int64(exp), 0),
+    }, nil
 }
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestSessionAndMFATokensDontMix(t *testing.T) {
+	if err := InitJWT("test-secret-test-secret-test-secret", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	session, err := GenerateJWT("account", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := GenerateMFAToken("account", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A token with a userID claim but signed with the MFA key
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": "account",
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	}).SignedString(mfaSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"userID": "account",
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		wantSession bool
+		wantMFA     bool
+	}{
+		{"session token", session, true, false},
+		{"MFA challenge", challenge, false, true},
+		{"userID signed with the MFA key", forged, false, false},
+		{"unsigned", unsigned, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ValidateJWT(tt.token); (err == nil) != tt.wantSession {
+				t.Errorf("ValidateJWT() error = %v, want valid %v", err, tt.wantSession)
+			}
+			if _, err := ValidateMFAToken(tt.token); (err == nil) != tt.wantMFA {
+				t.Errorf("ValidateMFAToken() error = %v, want valid %v", err, tt.wantMFA)
+			}
+		})
+	}
+}
+
+func TestMFATokenClaims(t *testing.T) {
+	if err := InitJWT("test-secret-test-secret-test-secret", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	first, err := GenerateMFAToken("account", 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateMFAToken("account", 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := ValidateMFAToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ValidateMFAToken(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.AccountID != "account" || a.SessionVersion != 3 {
+		t.Errorf("challenge = %+v, want account with session version 3", a)
+	}
+	if a.ID == "" || a.ID == b.ID {
+		t.Errorf("challenge IDs %q and %q must be set and differ", a.ID, b.ID)
+	}
+	if until := time.Until(a.ExpiresAt); until <= 0 || until > time.Minute {
+		t.Errorf("challenge expires in %v, want within a minute", until)
+	}
+
+	// Challenges from before the session version and ID were added
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"mfa": "account",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString(mfaSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateMFAToken(legacy); err == nil {
+		t.Error("ValidateMFAToken() accepted a challenge without sv and jti")
+	}
+}
@@ -1,13 +1,17 @@
 package utils
 
 import (
-    "crypto/sha256"
+    "crypto/rand"
     "encoding/hex"
+    "fmt"
 )
 
-// GenerateUserID creates a unique ID based on user data
-func GenerateUserID(name, email, password string) string {
-    data := name + email + password
-    hash := sha256.Sum256([]byte(data))
-    return hex.EncodeToString(hash[:])
-}
\ No newline at end of file
+// GenerateUserID creates a random, permanent user ID. It has nothing to do
+// with the user's name, email or password, so those can change.
+func GenerateUserID() (string, error) {
+    raw := make([]byte, 32)
+    if _, err := rand.Read(raw); err != nil {
+        return "", fmt.Errorf("failed to generate user ID: %w", err)
+    }
+    return hex.EncodeToString(raw), nil
+}
@@ -1,7 +1,7 @@
 "use client"
 import { useState } from 'react';
 import { motion, AnimatePresence } from 'framer-motion';
-import { FileIcon, Copy, Check, Trash2, X, Image, FileText, File } from 'lucide-react';
+import { FileIcon, Copy, Check, Trash2, X, Image, FileText, File, Download, CheckSquare, Square } from 'lucide-react';
 import { authUtils } from '@/utils/authUtils'; // adjust the import path
 import { useUploads } from '@/contexts/UploadsContext';
 
@@ -19,6 +19,82 @@ export default function DeletableUploads() {
   const [confirmFileName, setConfirmFileName] = useState('');
   const [fileToDelete, setFileToDelete] = useState<UploadItem | null>(null);
   const [isModalOpen, setIsModalOpen] = useState(false);
+  const [selectedIds, setSelectedIds] = useState<string[]>([]);
+  const [isDownloading, setIsDownloading] = useState(false);
+  const [isDeletingSelected, setIsDeletingSelected] = useState(false);
+
+  const toggleSelected = (fileId: string) => {
+    setSelectedIds((ids) =>
+      ids.includes(fileId) ? ids.filter((id) => id !== fileId) : [...ids, fileId]
+    );
+  };
+
+  const downloadSelected = async () => {
+    const { token } = authUtils.getAuthTokenAndUserId();
+    setIsDownloading(true);
+    try {
+      const response = await fetch('http://localhost:8080/api/minio/archive', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          Authorization: `Bearer ${token}`,
+        },
+        body: JSON.stringify({ fileIds: selectedIds }),
+      });
+
+      if (!response.ok) {
+        const errorData = await response.json().catch(() => ({}));
+        throw new Error(errorData.error || 'Download failed');
+      }
+
+      const url = URL.createObjectURL(await response.blob());
+      const link = document.createElement('a');
+      link.href = url;
+      link.download = 'files.zip';
+      link.click();
+      URL.revokeObjectURL(url);
+      setSelectedIds([]);
+    } catch (err) {
+      console.error('Archive download error:', err);
+      alert(err instanceof Error ? err.message : 'Failed to download files.');
+    } finally {
+      setIsDownloading(false);
+    }
+  };
+
+  const deleteSelected = async () => {
+    if (!window.confirm(`Delete ${selectedIds.length} file(s)? This cannot be undone.`)) return;
+    const { token } = authUtils.getAuthTokenAndUserId();
+    setIsDeletingSelected(true);
+    try {
+      const response = await fetch('http://localhost:8080/api/minio/files/bulk/delete', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          Authorization: `Bearer ${token}`,
+        },
+        body: JSON.stringify({ fileIds: selectedIds }),
+      });
+
+      const data = await response.json().catch(() => ({}));
+      if (!response.ok) {
+        throw new Error(data.error || 'Delete failed');
+      }
+
+      const results: { fileId: string; ok: boolean; error?: string }[] = data.results ?? [];
+      const deleted = results.filter((result) => result.ok).map((result) => result.fileId);
+      deleted.forEach((fileId) => removeUpload(fileId));
+      setSelectedIds((ids) => ids.filter((id) => !deleted.includes(id)));
+      if (data.failed > 0) {
+        alert(`${data.failed} file(s) could not be deleted.`);
+      }
+    } catch (err) {
+      console.error('Bulk delete error:', err);
+      alert(err instanceof Error ? err.message : 'Failed to delete files.');
+    } finally {
+      setIsDeletingSelected(false);
+    }
+  };
 
   const copyToClipboard = async (fileId: string) => {
     try {
@@ -81,11 +157,12 @@ export default function DeletableUploads() {
       });
 
       if (!response.ok) {
-        const msg = await response.text();
-        throw new Error(msg);
+        const errorData = await response.json().catch(() => ({}));
+        throw new Error(errorData.error || 'Delete failed');
       }
 
       removeUpload(fileId);
+      setSelectedIds((ids) => ids.filter((id) => id !== fileId));
       alert('File deleted successfully.');
     } catch (err) {
       console.error('Delete error:', err);
@@ -113,7 +190,33 @@ export default function DeletableUploads() {
       animate={{ opacity: 1, y: 0 }}
       className="max-w-4xl mx-auto mt-6 p-6 bg-white rounded-lg shadow-lg relative"
     >
-      <h2 className="text-2xl text-black font-bold mb-6">Recent Uploads</h2>
+      <div className="flex items-center justify-between mb-6">
+        <h2 className="text-2xl text-black font-bold">Recent Uploads</h2>
+        {selectedIds.length > 0 && (
+          <div className="flex items-center space-x-2">
+            <motion.button
+              whileHover={{ scale: 1.05 }}
+              whileTap={{ scale: 0.95 }}
+              onClick={downloadSelected}
+              disabled={isDownloading}
+              className="flex items-center space-x-2 px-4 py-2 bg-blue-600 text-white rounded disabled:opacity-50"
+            >
+              <Download className="h-4 w-4" />
+              <span>{isDownloading ? 'Preparing ZIP...' : `Download ${selectedIds.length} as ZIP`}</span>
+            </motion.button>
+            <motion.button
+              whileHover={{ scale: 1.05 }}
+              whileTap={{ scale: 0.95 }}
+              onClick={deleteSelected}
+              disabled={isDeletingSelected}
+              className="flex items-center space-x-2 px-4 py-2 bg-red-600 text-white rounded disabled:opacity-50"
+            >
+              <Trash2 className="h-4 w-4" />
+              <span>{isDeletingSelected ? 'Deleting...' : `Delete ${selectedIds.length}`}</span>
+            </motion.button>
+          </div>
+        )}
+      </div>
       
       <AnimatePresence>
         {recentUploads.length === 0 ? (
@@ -140,6 +243,19 @@ export default function DeletableUploads() {
                   <div className="flex items-center justify-between mb-2">
                     {getFileTypeIcon(upload.fileType)}
                     <div className="flex items-center space-x-2">
+                      <motion.button
+                        whileHover={{ scale: 1.1 }}
+                        whileTap={{ scale: 0.9 }}
+                        onClick={() => toggleSelected(upload.fileId)}
+                        className="p-1 hover:bg-gray-200 rounded transition-colors"
+                        title="Select for download"
+                      >
+                        {selectedIds.includes(upload.fileId) ? (
+                          <CheckSquare className="h-4 w-4 text-blue-600" />
+                        ) : (
+                          <Square className="h-4 w-4 text-gray-500" />
+                        )}
+                      </motion.button>
                       <motion.button
                         whileHover={{ scale: 1.1 }}
                         whileTap={{ scale: 0.9 }}
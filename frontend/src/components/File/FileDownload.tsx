@@ -5,6 +5,7 @@ import { motion } from 'framer-motion'
 import { Download, AlertCircle } from 'lucide-react'
 import { XMLParser } from 'fast-xml-parser'
 import { MinIOError } from '@/types/minio'
+import { authUtils } from '@/utils/authUtils'
 
 
 const FileDownload = () => {
@@ -30,7 +31,10 @@ const FileDownload = () => {
   setProgress(0)
 
   try {
-    const response = await fetch(`http://localhost:8080/files/minio/${fileId}`)
+    const { token } = authUtils.getAuthTokenAndUserId()
+    const response = await fetch(`http://localhost:8080/files/minio/${fileId}`, {
+      headers: { Authorization: `Bearer ${token}` },
+    })
     
     if (!response.ok) {
       const errorMessage = await parseMinIOError(response)
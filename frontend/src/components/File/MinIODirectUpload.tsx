@@ -2,6 +2,7 @@
 import axios from "axios"
 import { useState } from "react"
 import { MinIODirectUploadProps } from "@/types/minio"
+import { authUtils } from "@/utils/authUtils"
 
 
 const CHUNK_SIZE = 5 * 1024 * 1024
@@ -22,13 +23,14 @@ export default function MinIODirectUpload({
     console.log("User ID MinIODirectUpload : ", userData.userID)
     try {
       // Initialize upload
+      const { token } = authUtils.getAuthTokenAndUserId()
       const initRes = await axios.post("http://localhost:8080/api/minio/files/init", {
-        userID : userData.userID,
         fileName: file.name,
         fileType: file.type,
         fileSize: file.size,
+        chunkSize: CHUNK_SIZE,
         totalChunks: Math.ceil(file.size / CHUNK_SIZE),
-      })
+      }, { headers: { Authorization: `Bearer ${token}` } })
 
       const { fileId, uploadUrls, callbackUrl } = initRes.data
       let completedChunks = 0
@@ -48,7 +50,7 @@ export default function MinIODirectUpload({
       }
 
       // Complete upload
-      await axios.post(callbackUrl)
+      await axios.post(callbackUrl, null, { headers: { Authorization: `Bearer ${token}` } })
 
       onComplete({
         fileId,
@@ -65,6 +67,8 @@ export default function MinIODirectUpload({
           errMessage = err.response.data
         } else if (err.response.data.message) {
           errMessage = err.response.data.message
+        } else if (err.response.data.error) {
+          errMessage = err.response.data.error
         }
       }
       onError(errMessage)
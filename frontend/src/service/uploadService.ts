@@ -1,7 +1,9 @@
 import axios from "axios";
 import { UploadResponse, UploadProgressInfo, UploadOptions } from "../types/upload";
+import { authUtils } from "@/utils/authUtils";
 
 const DEFAULT_CHUNK_SIZE = 1024 * 1024; // 1MB
+const MIN_CHUNK_SIZE = 256 * 1024; // server's MIN_UPLOAD_CHUNK_SIZE default
 const MAX_CHUNK_SIZE = 5 * 1024 * 1024; // 5MB
 
 export type ProgressCallback = (info: UploadProgressInfo) => void;
@@ -12,29 +14,36 @@ class UploadService {
       if (fileSize < 5 * 1024 * 1024) {
         return Math.min(DEFAULT_CHUNK_SIZE, fileSize);
       }
-      return Math.min(Math.ceil(fileSize / 100), MAX_CHUNK_SIZE);
+      return Math.min(Math.max(Math.ceil(fileSize / 100), MIN_CHUNK_SIZE), MAX_CHUNK_SIZE);
     }
-    return Math.min(requestedSize, MAX_CHUNK_SIZE);
+    return Math.min(Math.max(requestedSize, MIN_CHUNK_SIZE), MAX_CHUNK_SIZE);
   }
 
   private async uploadChunk(
     chunk: Blob,
-    fileName: string,
+    file: File,
+    chunkSize: number,
     chunkIndex: number,
     totalChunks: number,
     fileId?: string
   ): Promise<UploadResponse> {
+    // The server streams the file part, so the fields have to come first
     const formData = new FormData();
-    formData.append("file", chunk, fileName);
     formData.append("chunkIndex", chunkIndex.toString());
     formData.append("totalChunks", totalChunks.toString());
     if (fileId) {
       formData.append("fileId", fileId);
+    } else {
+      formData.append("fileSize", file.size.toString());
+      formData.append("chunkSize", chunkSize.toString());
     }
+    formData.append("file", chunk, file.name);
 
+    const { token } = authUtils.getAuthTokenAndUserId();
     const response = await axios.post<UploadResponse>(
       "http://localhost:8080/upload-chunk",
-      formData
+      formData,
+      { headers: { Authorization: `Bearer ${token}` } }
     );
     return response.data;
   }
@@ -51,7 +60,7 @@ class UploadService {
         Math.min((i + 1) * chunkSize, file.size)
       );
 
-      lastResponse = await this.uploadChunk(chunk, file.name, i, chunks, fileId);
+      lastResponse = await this.uploadChunk(chunk, file, chunkSize, i, chunks, fileId);
       fileId = lastResponse.fileId;
 
       onProgress({
@@ -10,6 +10,7 @@ export interface UploadResponse {
   fileType: string;
   totalChunks: number;
   chunksReceived: number;
+  complete: boolean;
 }
 
 export interface RecentUpload {